@@ -0,0 +1,813 @@
+package fontcompress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CFF DICT operators. Two-byte operators (12 x) are stored as 1200+x.
+const (
+	cffOpCharset        = 15
+	cffOpEncoding       = 16
+	cffOpCharStrings    = 17
+	cffOpPrivate        = 18
+	cffOpSubrs          = 19
+	cffOpSyntheticBase  = 1220
+	cffOpROS            = 1230
+	cffOpFDArray        = 1236
+	cffOpFDSelect       = 1237
+	cffOpCharstringType = 1206
+)
+
+/*
+*
+Card8	major	Format major version (starting at 1)
+Card8	minor	Format minor version (starting at 0)
+Card8	hdrSize	Header size (bytes)
+OffSize	offSize	Absolute offset (0) size
+*/
+type CFFHeader struct {
+	Major   uint8
+	Minor   uint8
+	HdrSize uint8
+	OffSize uint8
+}
+
+// CFFDict holds the operands of a Top, Font or Private DICT keyed by
+// operator. Integer and real operands are both stored as float64.
+type CFFDict map[int][]float64
+
+// Int returns the first operand of op truncated to an integer, or def when
+// the dict does not contain op.
+func (d CFFDict) Int(op int, def int) int {
+	if v, ok := d[op]; ok && len(v) > 0 {
+		return int(v[0])
+	}
+	return def
+}
+
+// CFFFontDict is one entry of the FDArray of a CID-keyed font: a Font DICT
+// with its Private DICT and local subroutines.
+type CFFFontDict struct {
+	Dict    CFFDict
+	Private CFFDict
+	Subrs   [][]byte
+}
+
+// CFF — Compact Font Format outlines
+//
+// Offsets stored in the DICTs (charset, CharStrings, Private, Subrs,
+// FDArray, FDSelect) are resolved while reading and recomputed by encode,
+// so the decoded operands of those operators are not meaningful. A custom
+// Encoding is not kept: OpenType fonts map characters through cmap.
+type CFFTable struct {
+	Header CFFHeader
+
+	Name        string        // PostScript name, the only entry of the Name INDEX
+	TopDict     CFFDict       // Top DICT
+	Strings     []string      // String INDEX; string id 391 is Strings[0]
+	GlobalSubrs [][]byte      // Global Subr INDEX
+	CharStrings [][]byte      // Type 2 charstrings, indexed by glyph id
+	Charset     []uint16      // SID (name-keyed) or CID (CID-keyed) of each glyph
+	Private     CFFDict       // Private DICT of a name-keyed font
+	Subrs       [][]byte      // local subroutines of a name-keyed font
+	FDArray     []CFFFontDict // Font DICTs of a CID-keyed font
+	FDSelect    []uint8       // FDArray index of each glyph of a CID-keyed font
+}
+
+func (CFFTable) Tag() Tag { return tagCFF }
+
+// IsCIDKeyed reports whether the font is CID-keyed.
+func (cff CFFTable) IsCIDKeyed() bool {
+	_, ok := cff.TopDict[cffOpROS]
+	return ok
+}
+
+// NumGlyphs returns the number of charstrings.
+func (cff CFFTable) NumGlyphs() int {
+	return len(cff.CharStrings)
+}
+
+// String returns the string with the given string id.
+func (cff CFFTable) String(sid uint16) string {
+	if int(sid) < len(cffStandardStrings) {
+		return cffStandardStrings[sid]
+	}
+	if i := int(sid) - len(cffStandardStrings); i < len(cff.Strings) {
+		return cff.Strings[i]
+	}
+	return ""
+}
+
+// GlyphName returns the charset name of glyph gid. CID-keyed fonts have no
+// glyph names and return "cid" followed by the CID.
+func (cff CFFTable) GlyphName(gid uint16) string {
+	if int(gid) >= len(cff.Charset) {
+		return ""
+	}
+	if cff.IsCIDKeyed() {
+		return fmt.Sprintf("cid%05d", cff.Charset[gid])
+	}
+	return cff.String(cff.Charset[gid])
+}
+
+// CFF returns the CFF table of an OpenType font with CFF outlines,
+// decoding it on first use.
+func (ttf *TTF) CFF() (CFFTable, error) {
+	table, err := ttf.decodeTable(tagCFF, func(data []byte) (TTFTable, error) {
+		cff, err := readCFFTable(data)
+		if err != nil {
+			return nil, parseError("CFF ", err)
+		}
+		return cff, nil
+	})
+	if err != nil {
+		return CFFTable{}, err
+	}
+	cff, ok := table.(CFFTable)
+	if !ok {
+		return CFFTable{}, fmt.Errorf("CFF table holds a %T", table)
+	}
+	return cff, nil
+}
+
+// read CFF table
+func readCFFTable(data []byte) (CFFTable, error) {
+	cff := CFFTable{}
+	if len(data) < 4 {
+		return cff, errors.New("truncated cff header")
+	}
+	cff.Header = CFFHeader{Major: data[0], Minor: data[1], HdrSize: data[2], OffSize: data[3]}
+	if cff.Header.Major != 1 {
+		return cff, fmt.Errorf("cff major version %d is not supported", cff.Header.Major)
+	}
+	pos := int(cff.Header.HdrSize)
+
+	names, pos, err := readCFFIndex(data, pos)
+	if err != nil {
+		return cff, err
+	}
+	topDicts, pos, err := readCFFIndex(data, pos)
+	if err != nil {
+		return cff, err
+	}
+	if len(names) != 1 || len(topDicts) != 1 {
+		return cff, errors.New("cff table must contain exactly one font")
+	}
+	cff.Name = string(names[0])
+	strs, pos, err := readCFFIndex(data, pos)
+	if err != nil {
+		return cff, err
+	}
+	cff.Strings = make([]string, len(strs))
+	for i, s := range strs {
+		cff.Strings[i] = string(s)
+	}
+	if cff.GlobalSubrs, _, err = readCFFIndex(data, pos); err != nil {
+		return cff, err
+	}
+	if cff.TopDict, err = readCFFDict(topDicts[0]); err != nil {
+		return cff, err
+	}
+	if cff.TopDict.Int(cffOpCharstringType, 2) != 2 {
+		return cff, errors.New("cff charstring type is not 2")
+	}
+
+	// CharStrings
+	offset, ok := cffOffset(cff.TopDict, cffOpCharStrings, len(data))
+	if !ok {
+		return cff, errors.New("cff font has no CharStrings INDEX")
+	}
+	if cff.CharStrings, _, err = readCFFIndex(data, offset); err != nil {
+		return cff, err
+	}
+	numGlyphs := len(cff.CharStrings)
+	if numGlyphs == 0 {
+		return cff, errors.New("cff font has no glyphs")
+	}
+
+	// charset
+	switch charset := cff.TopDict.Int(cffOpCharset, 0); charset {
+	case 0:
+		// ISOAdobe: glyph id equals SID
+		if !cff.IsCIDKeyed() && numGlyphs > 229 {
+			return cff, errors.New("cff font has too many glyphs for the ISOAdobe charset")
+		}
+		cff.Charset = make([]uint16, numGlyphs)
+		for i := range cff.Charset {
+			cff.Charset[i] = uint16(i)
+		}
+	case 1, 2:
+		return cff, errors.New("cff expert charsets are not supported")
+	default:
+		if charset < 0 || charset >= len(data) {
+			return cff, errors.New("cff charset offset out of range")
+		}
+		if cff.Charset, err = readCFFCharset(data[charset:], numGlyphs); err != nil {
+			return cff, err
+		}
+	}
+
+	if !cff.IsCIDKeyed() {
+		cff.Private, cff.Subrs, err = readCFFPrivate(data, cff.TopDict)
+		return cff, err
+	}
+
+	// CID-keyed fonts have one Font DICT per FDSelect value
+	offset, ok = cffOffset(cff.TopDict, cffOpFDArray, len(data))
+	if !ok {
+		return cff, errors.New("cid-keyed cff font has no FDArray")
+	}
+	fontDicts, _, err := readCFFIndex(data, offset)
+	if err != nil {
+		return cff, err
+	}
+	cff.FDArray = make([]CFFFontDict, len(fontDicts))
+	for i, fd := range fontDicts {
+		dict, err := readCFFDict(fd)
+		if err != nil {
+			return cff, err
+		}
+		cff.FDArray[i].Dict = dict
+		if cff.FDArray[i].Private, cff.FDArray[i].Subrs, err = readCFFPrivate(data, dict); err != nil {
+			return cff, err
+		}
+	}
+	offset, ok = cffOffset(cff.TopDict, cffOpFDSelect, len(data))
+	if !ok {
+		return cff, errors.New("cid-keyed cff font has no FDSelect")
+	}
+	if cff.FDSelect, err = readCFFFDSelect(data[offset:], numGlyphs); err != nil {
+		return cff, err
+	}
+	for _, fd := range cff.FDSelect {
+		if int(fd) >= len(cff.FDArray) {
+			return cff, errors.New("cff FDSelect refers to a missing Font DICT")
+		}
+	}
+	return cff, nil
+}
+
+// cffOffset returns the offset operand of op, checked against the table
+// length.
+func cffOffset(dict CFFDict, op int, length int) (int, bool) {
+	offset := dict.Int(op, -1)
+	return offset, offset > 0 && offset < length
+}
+
+// readCFFIndex reads the INDEX at pos and returns its objects and the
+// position following it.
+func readCFFIndex(data []byte, pos int) ([][]byte, int, error) {
+	if pos < 0 || pos+2 > len(data) {
+		return nil, 0, errors.New("truncated cff INDEX")
+	}
+	count := int(binary.BigEndian.Uint16(data[pos:]))
+	if count == 0 {
+		return [][]byte{}, pos + 2, nil
+	}
+	if pos+3 > len(data) {
+		return nil, 0, errors.New("truncated cff INDEX")
+	}
+	offSize := int(data[pos+2])
+	if offSize < 1 || offSize > 4 {
+		return nil, 0, errors.New("invalid cff INDEX offset size")
+	}
+	offsets := pos + 3
+	if offsets+(count+1)*offSize > len(data) {
+		return nil, 0, errors.New("truncated cff INDEX")
+	}
+	offset := func(i int) int {
+		v := 0
+		for _, b := range data[offsets+i*offSize : offsets+(i+1)*offSize] {
+			v = v<<8 | int(b)
+		}
+		return v
+	}
+	// offsets are relative to the byte preceding the object data
+	base := offsets + (count+1)*offSize - 1
+	objects := make([][]byte, count)
+	for i := range objects {
+		start, end := offset(i), offset(i+1)
+		if start < 1 || end < start || base+end > len(data) {
+			return nil, 0, errors.New("invalid cff INDEX offset")
+		}
+		objects[i] = data[base+start : base+end]
+	}
+	return objects, base + offset(count), nil
+}
+
+// readCFFDict decodes DICT data.
+func readCFFDict(data []byte) (CFFDict, error) {
+	dict := CFFDict{}
+	var operands []float64
+	for i := 0; i < len(data); {
+		b0 := data[i]
+		switch {
+		case b0 <= 21:
+			op := int(b0)
+			i++
+			if b0 == 12 {
+				if i >= len(data) {
+					return nil, errors.New("truncated cff DICT operator")
+				}
+				op = 1200 + int(data[i])
+				i++
+			}
+			dict[op] = operands
+			operands = nil
+		case b0 == 28:
+			if i+3 > len(data) {
+				return nil, errors.New("truncated cff DICT operand")
+			}
+			operands = append(operands, float64(int16(binary.BigEndian.Uint16(data[i+1:]))))
+			i += 3
+		case b0 == 29:
+			if i+5 > len(data) {
+				return nil, errors.New("truncated cff DICT operand")
+			}
+			operands = append(operands, float64(int32(binary.BigEndian.Uint32(data[i+1:]))))
+			i += 5
+		case b0 == 30:
+			v, n, err := readCFFReal(data[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			operands = append(operands, v)
+			i += 1 + n
+		case b0 >= 32 && b0 <= 246:
+			operands = append(operands, float64(int(b0)-139))
+			i++
+		case b0 >= 247 && b0 <= 254:
+			if i+2 > len(data) {
+				return nil, errors.New("truncated cff DICT operand")
+			}
+			v := (int(b0)-247)*256 + int(data[i+1]) + 108
+			if b0 >= 251 {
+				v = -(int(b0)-251)*256 - int(data[i+1]) - 108
+			}
+			operands = append(operands, float64(v))
+			i += 2
+		default:
+			return nil, fmt.Errorf("invalid cff DICT byte %d", b0)
+		}
+	}
+	if len(operands) > 0 {
+		return nil, errors.New("cff DICT ends with operands")
+	}
+	return dict, nil
+}
+
+// cffRealNibbles are the characters of the real number nibbles 0x0–0xe.
+var cffRealNibbles = [...]string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", ".", "E", "E-", "", "-"}
+
+// readCFFReal decodes a packed BCD real number and returns it with the
+// number of bytes used.
+func readCFFReal(data []byte) (float64, int, error) {
+	var s strings.Builder
+	for i, b := range data {
+		for _, nibble := range [2]byte{b >> 4, b & 0xF} {
+			switch {
+			case nibble == 0xF:
+				v, err := strconv.ParseFloat(s.String(), 64)
+				if err != nil {
+					return 0, 0, errors.New("invalid cff real number")
+				}
+				return v, i + 1, nil
+			case nibble == 0xD:
+				return 0, 0, errors.New("invalid cff real number")
+			}
+			s.WriteString(cffRealNibbles[nibble])
+		}
+	}
+	return 0, 0, errors.New("truncated cff real number")
+}
+
+// readCFFPrivate reads the Private DICT referenced by dict and its local
+// subroutines.
+func readCFFPrivate(data []byte, dict CFFDict) (CFFDict, [][]byte, error) {
+	operands, ok := dict[cffOpPrivate]
+	if !ok {
+		return CFFDict{}, nil, nil
+	}
+	if len(operands) != 2 {
+		return nil, nil, errors.New("invalid cff Private operator")
+	}
+	size, offset := int(operands[0]), int(operands[1])
+	if size < 0 || offset < 0 || size > len(data) || offset > len(data)-size {
+		return nil, nil, errors.New("cff Private DICT out of range")
+	}
+	private, err := readCFFDict(data[offset : offset+size])
+	if err != nil {
+		return nil, nil, err
+	}
+	subrs, ok := private[cffOpSubrs]
+	if !ok || len(subrs) != 1 {
+		return private, nil, nil
+	}
+	// Subrs is relative to the start of the Private DICT
+	local, _, err := readCFFIndex(data, offset+int(subrs[0]))
+	return private, local, err
+}
+
+// readCFFCharset reads a format 0, 1 or 2 charset for numGlyphs glyphs.
+func readCFFCharset(data []byte, numGlyphs int) ([]uint16, error) {
+	charset := make([]uint16, 1, numGlyphs)
+	format := data[0]
+	pos := 1
+	for len(charset) < numGlyphs {
+		switch format {
+		case 0:
+			if pos+2 > len(data) {
+				return nil, errors.New("truncated cff charset")
+			}
+			charset = append(charset, binary.BigEndian.Uint16(data[pos:]))
+			pos += 2
+		case 1, 2:
+			size := 3 + int(format-1)
+			if pos+size > len(data) {
+				return nil, errors.New("truncated cff charset")
+			}
+			first := int(binary.BigEndian.Uint16(data[pos:]))
+			left := int(data[pos+2])
+			if format == 2 {
+				left = int(binary.BigEndian.Uint16(data[pos+2:]))
+			}
+			for sid := first; sid <= first+left && len(charset) < numGlyphs; sid++ {
+				charset = append(charset, uint16(sid))
+			}
+			pos += size
+		default:
+			return nil, fmt.Errorf("cff charset format %d is not supported", format)
+		}
+	}
+	return charset, nil
+}
+
+// readCFFFDSelect reads a format 0 or 3 FDSelect for numGlyphs glyphs.
+func readCFFFDSelect(data []byte, numGlyphs int) ([]uint8, error) {
+	if len(data) < 1 {
+		return nil, errors.New("truncated cff FDSelect")
+	}
+	switch data[0] {
+	case 0:
+		if 1+numGlyphs > len(data) {
+			return nil, errors.New("truncated cff FDSelect")
+		}
+		return append([]uint8(nil), data[1:1+numGlyphs]...), nil
+	case 3:
+		if len(data) < 3 {
+			return nil, errors.New("truncated cff FDSelect")
+		}
+		nRanges := int(binary.BigEndian.Uint16(data[1:]))
+		if 3+3*nRanges+2 > len(data) {
+			return nil, errors.New("truncated cff FDSelect")
+		}
+		fdSelect := make([]uint8, numGlyphs)
+		for i := 0; i < nRanges; i++ {
+			rng := data[3+3*i:]
+			first := int(binary.BigEndian.Uint16(rng))
+			next := int(binary.BigEndian.Uint16(rng[3:])) // first glyph of the next range or the sentinel
+			if first > next || next > numGlyphs || (i == 0 && first != 0) {
+				return nil, errors.New("invalid cff FDSelect range")
+			}
+			for gid := first; gid < next; gid++ {
+				fdSelect[gid] = rng[2]
+			}
+		}
+		if int(binary.BigEndian.Uint16(data[3+3*nRanges:])) != numGlyphs {
+			return nil, errors.New("invalid cff FDSelect sentinel")
+		}
+		return fdSelect, nil
+	default:
+		return nil, fmt.Errorf("cff FDSelect format %d is not supported", data[0])
+	}
+}
+
+// encode serializes the CFF table. The layout is header, Name, Top DICT,
+// String and Global Subr INDEXes, charset, FDSelect, CharStrings, FDArray
+// and finally the Private DICTs, each followed by its local subroutines.
+func (cff CFFTable) encode() ([]byte, error) {
+	numGlyphs := len(cff.CharStrings)
+	if numGlyphs == 0 || len(cff.Charset) != numGlyphs {
+		return nil, errors.New("cff charset does not match the number of charstrings")
+	}
+	cid := cff.IsCIDKeyed()
+	if cid && len(cff.FDSelect) != numGlyphs {
+		return nil, errors.New("cff FDSelect does not match the number of charstrings")
+	}
+
+	strs := make([][]byte, len(cff.Strings))
+	for i, s := range cff.Strings {
+		strs[i] = []byte(s)
+	}
+	charset := encodeCFFCharset(cff.Charset)
+	var fdSelect []byte
+	if cid {
+		fdSelect = encodeCFFFDSelect(cff.FDSelect)
+	}
+	charStrings, err := encodeCFFIndex(cff.CharStrings)
+	if err != nil {
+		return nil, err
+	}
+
+	// Private DICTs and their subroutines, in FDArray order for CID fonts
+	privates := []CFFFontDict{{Private: cff.Private, Subrs: cff.Subrs}}
+	if cid {
+		privates = cff.FDArray
+	}
+	privateData := make([][]byte, len(privates))
+	privateSize := make([]int, len(privates))
+	for i, fd := range privates {
+		private := copyCFFDict(fd.Private)
+		delete(private, cffOpSubrs)
+		var subrs []byte
+		if len(fd.Subrs) > 0 {
+			if subrs, err = encodeCFFIndex(fd.Subrs); err != nil {
+				return nil, err
+			}
+			// the subroutines directly follow the Private DICT
+			private[cffOpSubrs] = []float64{0}
+			private[cffOpSubrs][0] = float64(len(encodeCFFDict(private)))
+		}
+		data := encodeCFFDict(private)
+		privateSize[i] = len(data)
+		privateData[i] = append(data, subrs...)
+	}
+
+	// the Top DICT and Font DICTs write offsets as 5-byte integers, so their
+	// size does not depend on the offsets and the layout is computed once
+	top := copyCFFDict(cff.TopDict)
+	delete(top, cffOpEncoding)
+	for _, op := range []int{cffOpCharset, cffOpCharStrings, cffOpFDArray, cffOpFDSelect, cffOpPrivate} {
+		delete(top, op)
+	}
+	top[cffOpCharset] = []float64{0}
+	top[cffOpCharStrings] = []float64{0}
+	fontDicts := make([]CFFDict, len(cff.FDArray))
+	if cid {
+		top[cffOpFDArray] = []float64{0}
+		top[cffOpFDSelect] = []float64{0}
+		for i, fd := range cff.FDArray {
+			fontDicts[i] = copyCFFDict(fd.Dict)
+			fontDicts[i][cffOpPrivate] = []float64{0, 0}
+		}
+	} else {
+		top[cffOpPrivate] = []float64{0, 0}
+	}
+
+	header := []byte{1, 0, 4, 4}
+	name, err := encodeCFFIndex([][]byte{[]byte(cff.Name)})
+	if err != nil {
+		return nil, err
+	}
+	topIndex, err := encodeCFFIndex([][]byte{encodeCFFDict(top)})
+	if err != nil {
+		return nil, err
+	}
+	stringIndex, err := encodeCFFIndex(strs)
+	if err != nil {
+		return nil, err
+	}
+	gsubrs, err := encodeCFFIndex(cff.GlobalSubrs)
+	if err != nil {
+		return nil, err
+	}
+	encodeFontDicts := func() ([]byte, error) {
+		objects := make([][]byte, len(fontDicts))
+		for i, fd := range fontDicts {
+			objects[i] = encodeCFFDict(fd)
+		}
+		return encodeCFFIndex(objects)
+	}
+	fdArray, err := encodeFontDicts()
+	if err != nil {
+		return nil, err
+	}
+	if !cid {
+		fdArray = nil
+	}
+
+	pos := len(header) + len(name) + len(topIndex) + len(stringIndex) + len(gsubrs)
+	top[cffOpCharset][0] = float64(pos)
+	pos += len(charset)
+	if cid {
+		top[cffOpFDSelect][0] = float64(pos)
+		pos += len(fdSelect)
+	}
+	top[cffOpCharStrings][0] = float64(pos)
+	pos += len(charStrings)
+	if cid {
+		top[cffOpFDArray][0] = float64(pos)
+		pos += len(fdArray)
+	}
+	for i, data := range privateData {
+		if cid {
+			fontDicts[i][cffOpPrivate] = []float64{float64(privateSize[i]), float64(pos)}
+		} else {
+			top[cffOpPrivate] = []float64{float64(privateSize[i]), float64(pos)}
+		}
+		pos += len(data)
+	}
+	if topIndex, err = encodeCFFIndex([][]byte{encodeCFFDict(top)}); err != nil {
+		return nil, err
+	}
+	if cid {
+		if fdArray, err = encodeFontDicts(); err != nil {
+			return nil, err
+		}
+	}
+
+	buf := make([]byte, 0, pos)
+	for _, part := range [][]byte{header, name, topIndex, stringIndex, gsubrs, charset, fdSelect, charStrings, fdArray} {
+		buf = append(buf, part...)
+	}
+	for _, data := range privateData {
+		buf = append(buf, data...)
+	}
+	return buf, nil
+}
+
+func copyCFFDict(dict CFFDict) CFFDict {
+	c := make(CFFDict, len(dict))
+	for op, operands := range dict {
+		c[op] = append([]float64(nil), operands...)
+	}
+	return c
+}
+
+// encodeCFFIndex encodes objects as an INDEX with the smallest offset size.
+func encodeCFFIndex(objects [][]byte) ([]byte, error) {
+	if len(objects) > 0xFFFF {
+		return nil, errors.New("too many objects for a cff INDEX")
+	}
+	buf := binary.BigEndian.AppendUint16(nil, uint16(len(objects)))
+	if len(objects) == 0 {
+		return buf, nil
+	}
+	size := 1
+	for _, object := range objects {
+		size += len(object)
+	}
+	offSize := 1
+	for offSize < 4 && size >= 1<<(8*offSize) {
+		offSize++
+	}
+	buf = append(buf, byte(offSize))
+	offset := 1
+	appendOffset := func() {
+		for i := offSize - 1; i >= 0; i-- {
+			buf = append(buf, byte(offset>>(8*i)))
+		}
+	}
+	appendOffset()
+	for _, object := range objects {
+		offset += len(object)
+		appendOffset()
+	}
+	for _, object := range objects {
+		buf = append(buf, object...)
+	}
+	return buf, nil
+}
+
+// encodeCFFDict encodes a DICT. ROS and SyntheticBase must come first; the
+// other operators follow in ascending order. Offset operands are written as
+// 5-byte integers so that their size is independent of their value.
+func encodeCFFDict(dict CFFDict) []byte {
+	ops := make([]int, 0, len(dict))
+	for op := range dict {
+		ops = append(ops, op)
+	}
+	first := func(op int) bool { return op == cffOpROS || op == cffOpSyntheticBase }
+	sort.Slice(ops, func(i, j int) bool {
+		if first(ops[i]) != first(ops[j]) {
+			return first(ops[i])
+		}
+		return ops[i] < ops[j]
+	})
+	var buf []byte
+	for _, op := range ops {
+		fixed := false
+		switch op {
+		case cffOpCharset, cffOpCharStrings, cffOpPrivate, cffOpSubrs, cffOpFDArray, cffOpFDSelect:
+			fixed = true
+		}
+		for _, v := range dict[op] {
+			buf = appendCFFOperand(buf, v, fixed)
+		}
+		if op >= 1200 {
+			buf = append(buf, 12, byte(op-1200))
+		} else {
+			buf = append(buf, byte(op))
+		}
+	}
+	return buf
+}
+
+// appendCFFOperand appends v as the shortest DICT integer or, if it has a
+// fractional part, as a real number. fixed forces the 5-byte integer form.
+func appendCFFOperand(buf []byte, v float64, fixed bool) []byte {
+	if v != math.Trunc(v) || v < math.MinInt32 || v > math.MaxInt32 {
+		s := strings.ToUpper(strconv.FormatFloat(v, 'g', -1, 64))
+		s = strings.Replace(s, "E+", "E", 1)
+		var nibbles []byte
+		for i := 0; i < len(s); i++ {
+			switch c := s[i]; {
+			case c >= '0' && c <= '9':
+				nibbles = append(nibbles, c-'0')
+			case c == '.':
+				nibbles = append(nibbles, 0xA)
+			case c == 'E' && i+1 < len(s) && s[i+1] == '-':
+				nibbles = append(nibbles, 0xC)
+				i++
+			case c == 'E':
+				nibbles = append(nibbles, 0xB)
+			case c == '-':
+				nibbles = append(nibbles, 0xE)
+			}
+		}
+		nibbles = append(nibbles, 0xF)
+		if len(nibbles)%2 != 0 {
+			nibbles = append(nibbles, 0xF)
+		}
+		buf = append(buf, 30)
+		for i := 0; i < len(nibbles); i += 2 {
+			buf = append(buf, nibbles[i]<<4|nibbles[i+1])
+		}
+		return buf
+	}
+	n := int32(v)
+	switch {
+	case fixed:
+		return binary.BigEndian.AppendUint32(append(buf, 29), uint32(n))
+	case n >= -107 && n <= 107:
+		return append(buf, byte(n+139))
+	case n >= 108 && n <= 1131:
+		n -= 108
+		return append(buf, byte(n>>8+247), byte(n))
+	case n >= -1131 && n <= -108:
+		n = -n - 108
+		return append(buf, byte(n>>8+251), byte(n))
+	case n >= -32768 && n <= 32767:
+		return binary.BigEndian.AppendUint16(append(buf, 28), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(buf, 29), uint32(n))
+}
+
+// encodeCFFCharset encodes charset in the smallest of formats 0, 1 and 2.
+// The .notdef entry is implied and not written.
+func encodeCFFCharset(charset []uint16) []byte {
+	format0 := []byte{0}
+	for _, sid := range charset[1:] {
+		format0 = binary.BigEndian.AppendUint16(format0, sid)
+	}
+	best := format0
+	for _, format := range []byte{1, 2} {
+		maxLeft := 0xFF
+		if format == 2 {
+			maxLeft = 0xFFFF
+		}
+		buf := []byte{format}
+		for i := 1; i < len(charset); {
+			left := 0
+			for i+left+1 < len(charset) && left < maxLeft && charset[i+left+1] == charset[i]+uint16(left)+1 {
+				left++
+			}
+			buf = binary.BigEndian.AppendUint16(buf, charset[i])
+			if format == 1 {
+				buf = append(buf, byte(left))
+			} else {
+				buf = binary.BigEndian.AppendUint16(buf, uint16(left))
+			}
+			i += left + 1
+		}
+		if len(buf) < len(best) {
+			best = buf
+		}
+	}
+	return best
+}
+
+// encodeCFFFDSelect encodes fdSelect in format 0 or, if smaller, format 3.
+func encodeCFFFDSelect(fdSelect []uint8) []byte {
+	format3 := []byte{3, 0, 0}
+	nRanges := 0
+	for gid, fd := range fdSelect {
+		if gid == 0 || fd != fdSelect[gid-1] {
+			format3 = binary.BigEndian.AppendUint16(format3, uint16(gid))
+			format3 = append(format3, fd)
+			nRanges++
+		}
+	}
+	binary.BigEndian.PutUint16(format3[1:], uint16(nRanges))
+	format3 = binary.BigEndian.AppendUint16(format3, uint16(len(fdSelect)))
+	if len(format3) < 1+len(fdSelect) {
+		return format3
+	}
+	return append([]byte{0}, fdSelect...)
+}
@@ -0,0 +1,138 @@
+package fontcompress_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+func cffTable(t *testing.T, ttf *font_compress.TTF) font_compress.CFFTable {
+	t.Helper()
+	cff, err := ttf.CFF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cff
+}
+
+func TestFlavor(t *testing.T) {
+	for _, tt := range []struct {
+		scalerType uint32
+		want       font_compress.Flavor
+	}{
+		{font_compress.TTF_MAGIC, font_compress.FlavorTrueType},
+		{font_compress.OTF_MAGIC, font_compress.FlavorCFF},
+		{font_compress.TRUE_MAGIC, font_compress.FlavorAppleTrueType},
+	} {
+		ttf, err := font_compress.NewTTF(writeFont(t, assembleFont(tt.scalerType, fixtureTables())))
+		if err != nil {
+			t.Fatalf("%#x: %v", tt.scalerType, err)
+		}
+		if got := ttf.Flavor(); got != tt.want {
+			t.Errorf("%#x: flavor %v, want %v", tt.scalerType, got, tt.want)
+		}
+	}
+	if _, err := font_compress.NewTTF(writeFont(t, assembleFont(0x12345678, fixtureTables()))); err == nil {
+		t.Error("unknown sfnt version accepted")
+	}
+}
+
+func TestReadCFFTable(t *testing.T) {
+	ttf, err := font_compress.NewTTF(writeFont(t, fixtureCFFFont(false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ttf.Flavor() != font_compress.FlavorCFF {
+		t.Errorf("flavor %v, want CFF", ttf.Flavor())
+	}
+	cff := cffTable(t, ttf)
+	if cff.Name != "Fixture" || cff.IsCIDKeyed() || cff.NumGlyphs() != len(fixtureGlyphs) {
+		t.Fatalf("name %q, cid %v, %d glyphs", cff.Name, cff.IsCIDKeyed(), cff.NumGlyphs())
+	}
+	var names []string
+	for gid := 0; gid < cff.NumGlyphs(); gid++ {
+		names = append(names, cff.GlyphName(uint16(gid)))
+	}
+	want := []string{".notdef", "A", "B", "dieresis", "Adieresis", "C", "u20000"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("glyph names %v, want %v", names, want)
+	}
+	if m := cff.TopDict[1207]; len(m) != 6 || m[0] != 0.001 || m[3] != 0.001 {
+		t.Errorf("FontMatrix %v", m)
+	}
+	if cff.Private.Int(20, 0) != 500 || len(cff.Subrs) != 1 || len(cff.GlobalSubrs) != 1 {
+		t.Errorf("defaultWidthX %d, %d local and %d global subrs", cff.Private.Int(20, 0), len(cff.Subrs), len(cff.GlobalSubrs))
+	}
+
+	ttf, err = font_compress.NewTTF(writeFont(t, fixtureCFFFont(true)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cff = cffTable(t, ttf)
+	if !cff.IsCIDKeyed() || len(cff.FDArray) != 2 || cff.FDArray[1].Private.Int(20, 0) != 500 || len(cff.FDArray[1].Subrs) != 1 {
+		t.Fatalf("cid %v with %d Font DICTs", cff.IsCIDKeyed(), len(cff.FDArray))
+	}
+	if want := []uint8{0, 0, 0, 0, 1, 1, 1}; !bytes.Equal(cff.FDSelect, want) {
+		t.Errorf("FDSelect %v, want %v", cff.FDSelect, want)
+	}
+	if got := cff.GlyphName(2); got != "cid00002" {
+		t.Errorf("glyph 2 named %q", got)
+	}
+}
+
+func TestCFFWriteTo(t *testing.T) {
+	for _, cid := range []bool{false, true} {
+		ttf, err := font_compress.NewTTF(writeFont(t, fixtureCFFFont(cid)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := cffTable(t, ttf)
+		var buf bytes.Buffer
+		if _, err := ttf.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if binary.BigEndian.Uint32(buf.Bytes()) != font_compress.OTF_MAGIC {
+			t.Errorf("cid %v: written font is not OTTO", cid)
+		}
+		got := cffTable(t, readFont(t, buf.Bytes()))
+		if got.Name != want.Name || !reflect.DeepEqual(got.CharStrings, want.CharStrings) ||
+			!reflect.DeepEqual(got.Charset, want.Charset) || !bytes.Equal(got.FDSelect, want.FDSelect) ||
+			!reflect.DeepEqual(got.Strings, want.Strings) || !reflect.DeepEqual(got.TopDict[1207], want.TopDict[1207]) {
+			t.Errorf("cid %v: round trip changed the CFF table", cid)
+		}
+	}
+}
+
+func TestSubsetCFF(t *testing.T) {
+	for _, cid := range []bool{false, true} {
+		ttf, err := font_compress.NewTTF(writeFont(t, fixtureCFFFont(cid)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		font, err := font_compress.Subset(ttf, []rune("ÄCz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if binary.BigEndian.Uint32(font) != font_compress.OTF_MAGIC || fontTable(font, "glyf") != nil {
+			t.Fatalf("cid %v: subset is not a CFF font", cid)
+		}
+		if n := binary.BigEndian.Uint16(fontTable(font, "maxp")[4:]); n != 3 {
+			t.Errorf("cid %v: maxp has %d glyphs, want 3", cid, n)
+		}
+		cff := cffTable(t, readFont(t, font))
+		want := [][]byte{{139, 14}, {143, 14}, {144, 14}}
+		if !reflect.DeepEqual(cff.CharStrings, want) {
+			t.Errorf("cid %v: charstrings %v, want %v", cid, cff.CharStrings, want)
+		}
+		if cid {
+			if !reflect.DeepEqual(cff.Charset, []uint16{0, 4, 5}) || !bytes.Equal(cff.FDSelect, []uint8{0, 1, 1}) {
+				t.Errorf("charset %v, FDSelect %v", cff.Charset, cff.FDSelect)
+			}
+		} else if cff.GlyphName(1) != "Adieresis" || cff.GlyphName(2) != "C" {
+			t.Errorf("glyph names %q %q", cff.GlyphName(1), cff.GlyphName(2))
+		}
+	}
+}
@@ -0,0 +1,627 @@
+package fontcompress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// cmapPreference lists the Unicode encodings in the order a subtable is
+// chosen for lookups: full repertoire Windows, BMP Windows, the Unicode
+// platform, then Windows symbol fonts.
+var cmapPreference = [][2]uint16{{3, 10}, {3, 1}, {0, 6}, {0, 4}, {0, 3}, {0, 2}, {0, 1}, {0, 0}, {3, 0}}
+
+// UnicodeSubtable returns the preferred subtable mapping Unicode characters
+// to glyphs, or nil if the table has none in a supported format.
+func (cmap *CmapTable) UnicodeSubtable() *CmapSubTable {
+	for _, want := range cmapPreference {
+		for i := range cmap.EncodingSubtables {
+			sub := &cmap.EncodingSubtables[i]
+			if sub.PlatformID == want[0] && sub.EncodingID == want[1] && sub.supported() {
+				return sub
+			}
+		}
+	}
+	return nil
+}
+
+// Lookup returns the glyph that r maps to in the preferred Unicode subtable.
+// ok is false if r is not mapped or maps to the missing glyph.
+func (cmap *CmapTable) Lookup(r rune) (gid uint16, ok bool) {
+	sub := cmap.UnicodeSubtable()
+	if sub == nil {
+		return 0, false
+	}
+	return sub.Lookup(r)
+}
+
+// Range calls fn for every rune mapped by the preferred Unicode subtable,
+// in ascending order, until fn returns false.
+func (cmap *CmapTable) Range(fn func(r rune, gid uint16) bool) {
+	if sub := cmap.UnicodeSubtable(); sub != nil {
+		sub.Range(fn)
+	}
+}
+
+func (sub *CmapSubTable) supported() bool {
+	switch sub.Format {
+	case 0, 2, 4, 6, 10, 12, 13:
+		return true
+	}
+	return false
+}
+
+// glyphIndex reads the big-endian glyph id at byte offset off of the
+// subtable, 0 if off is outside of it.
+func (sub *CmapSubTable) glyphIndex(off int) uint16 {
+	// GlyphIndexArray holds the subtable after its 6-byte header
+	off -= 6
+	if off < 0 || off+2 > len(sub.GlyphIndexArray) {
+		return 0
+	}
+	return binary.BigEndian.Uint16(sub.GlyphIndexArray[off:])
+}
+
+// Lookup returns the glyph that r maps to in the subtable. ok is false if r
+// is not mapped or maps to the missing glyph.
+func (sub *CmapSubTable) Lookup(r rune) (gid uint16, ok bool) {
+	if r < 0 {
+		return 0, false
+	}
+	switch sub.Format {
+	case 0:
+		if int(r) < len(sub.GlyphIndexArray) && r < 256 {
+			gid = uint16(sub.GlyphIndexArray[r])
+		}
+	case 2:
+		gid = sub.lookupFormat2(r)
+	case 4:
+		if r <= 0xFFFF {
+			c := uint16(r)
+			// segments are sorted by endCode
+			i := sort.Search(len(sub.EndCode), func(i int) bool { return sub.EndCode[i] >= c })
+			if i < len(sub.EndCode) && i < len(sub.StartCode) && c >= sub.StartCode[i] {
+				gid = sub.format4Glyph(i, c)
+			}
+		}
+	case 6:
+		if r >= rune(sub.FirstCode) && r < rune(sub.FirstCode)+rune(sub.EntryCount) {
+			gid = sub.glyphIndex(10 + 2*int(r-rune(sub.FirstCode)))
+		}
+	case 10:
+		if uint32(r) >= sub.StartCharCode && uint32(r)-sub.StartCharCode < sub.NumChars {
+			if i := int(uint32(r) - sub.StartCharCode); i < len(sub.GlyphIndexArray16) {
+				gid = sub.GlyphIndexArray16[i]
+			}
+		}
+	case 12, 13:
+		c := uint32(r)
+		i := sort.Search(len(sub.Groups), func(i int) bool { return sub.Groups[i].EndCharCode >= c })
+		if i < len(sub.Groups) && c >= sub.Groups[i].StartCharCode {
+			gid = uint16(sub.Groups[i].StartGlyphCode)
+			if sub.Format == 12 {
+				gid += uint16(c - sub.Groups[i].StartCharCode)
+			}
+		}
+	}
+	return gid, gid != 0
+}
+
+// format4Glyph maps c through segment i of a format 4 subtable.
+func (sub *CmapSubTable) format4Glyph(i int, c uint16) uint16 {
+	var delta, rangeOffset uint16
+	if i < len(sub.IdDelta) {
+		delta = sub.IdDelta[i]
+	}
+	if i < len(sub.IdRangeOffset) {
+		rangeOffset = sub.IdRangeOffset[i]
+	}
+	if rangeOffset == 0 {
+		return c + delta
+	}
+	// idRangeOffset is relative to its own position in the subtable
+	segCount := int(sub.SegCountX2) / 2
+	pos := 16 + 6*segCount + 2*i
+	gid := sub.glyphIndex(pos + int(rangeOffset) + 2*int(c-sub.StartCode[i]))
+	if gid == 0 {
+		return 0
+	}
+	return gid + delta
+}
+
+// format4Span returns the characters that Lookup maps through segment i of
+// a format 4 subtable: those from next, the first character past the
+// earlier segments, up to 0xFFFE. start > end if there are none. after is
+// the first character past segment i and the earlier ones.
+func (sub *CmapSubTable) format4Span(i int, next uint32) (start, end, after uint32) {
+	start = max(uint32(sub.StartCode[i]), next)
+	end = min(uint32(sub.EndCode[i]), 0xFFFE)
+	return start, end, max(next, uint32(sub.EndCode[i])+1)
+}
+
+// lookupFormat2 maps r through a format 2 subtable. Bytes whose
+// subHeaderKey is 0 are single-byte characters mapped through subHeader 0;
+// the others start two-byte characters.
+func (sub *CmapSubTable) lookupFormat2(r rune) uint16 {
+	if r > 0xFFFF || len(sub.SubHeaderKeys) < 256 {
+		return 0
+	}
+	if r < 0x100 {
+		if sub.SubHeaderKeys[r] != 0 || len(sub.SubHeaders) == 0 {
+			return 0
+		}
+		return sub.format2Glyph(0, uint16(r))
+	}
+	k := int(sub.SubHeaderKeys[r>>8] / 8)
+	if k == 0 || k >= len(sub.SubHeaders) {
+		return 0
+	}
+	return sub.format2Glyph(k, uint16(r&0xFF))
+}
+
+// format2Glyph maps the low byte lo through subHeader k.
+func (sub *CmapSubTable) format2Glyph(k int, lo uint16) uint16 {
+	h := sub.SubHeaders[k]
+	if lo < h.FirstCode || lo-h.FirstCode >= h.EntryCount {
+		return 0
+	}
+	// idRangeOffset is relative to its own position in the subtable
+	pos := 6 + 2*256 + 8*k + 6
+	gid := sub.glyphIndex(pos + int(h.IdRangeOffset) + 2*int(lo-h.FirstCode))
+	if gid == 0 {
+		return 0
+	}
+	return gid + h.IdDelta
+}
+
+// Range calls fn for every rune mapped by the subtable, in ascending order,
+// until fn returns false. Characters mapped to the missing glyph are
+// skipped.
+func (sub *CmapSubTable) Range(fn func(r rune, gid uint16) bool) {
+	emit := func(r rune, gid uint16) bool {
+		return gid == 0 || fn(r, gid)
+	}
+	switch sub.Format {
+	case 0:
+		for c := 0; c < len(sub.GlyphIndexArray) && c < 256; c++ {
+			if !emit(rune(c), uint16(sub.GlyphIndexArray[c])) {
+				return
+			}
+		}
+	case 2:
+		if len(sub.SubHeaderKeys) < 256 {
+			return
+		}
+		// single-byte characters sort before all two-byte ones
+		for c := 0; c < 256 && len(sub.SubHeaders) > 0; c++ {
+			if sub.SubHeaderKeys[c] == 0 && !emit(rune(c), sub.format2Glyph(0, uint16(c))) {
+				return
+			}
+		}
+		for hi := 1; hi < 256; hi++ {
+			k := int(sub.SubHeaderKeys[hi] / 8)
+			if k == 0 || k >= len(sub.SubHeaders) {
+				continue
+			}
+			h := sub.SubHeaders[k]
+			for lo := uint32(h.FirstCode); lo < uint32(h.FirstCode)+uint32(h.EntryCount) && lo <= 0xFF; lo++ {
+				if !emit(rune(hi<<8|int(lo)), sub.format2Glyph(k, uint16(lo))) {
+					return
+				}
+			}
+		}
+	case 4:
+		var next uint32
+		for i := 0; i < len(sub.EndCode) && i < len(sub.StartCode); i++ {
+			var start, end uint32
+			start, end, next = sub.format4Span(i, next)
+			for c := start; c <= end; c++ {
+				if !emit(rune(c), sub.format4Glyph(i, uint16(c))) {
+					return
+				}
+			}
+		}
+	case 6:
+		for i := 0; i < int(sub.EntryCount); i++ {
+			if !emit(rune(sub.FirstCode)+rune(i), sub.glyphIndex(10+2*i)) {
+				return
+			}
+		}
+	case 10:
+		for i, gid := range sub.GlyphIndexArray16 {
+			if uint32(i) >= sub.NumChars || !emit(rune(sub.StartCharCode)+rune(i), gid) {
+				return
+			}
+		}
+	case 12, 13:
+		for _, group := range sub.Groups {
+			for c := uint64(group.StartCharCode); c <= uint64(group.EndCharCode) && c <= 0x10FFFF; c++ {
+				gid := uint16(group.StartGlyphCode)
+				if sub.Format == 12 {
+					gid += uint16(c - uint64(group.StartCharCode))
+				}
+				if !emit(rune(c), gid) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// checkGlyphs reports the first character of the subtable mapped to a
+// glyph id of numGlyphs or more.
+func (sub *CmapSubTable) checkGlyphs(numGlyphs int) error {
+	fail := func(r rune, gid uint64) error {
+		return fmt.Errorf("format %d subtable maps %U to glyph %d, the font has %d glyphs", sub.Format, r, gid, numGlyphs)
+	}
+	switch sub.Format {
+	case 8, 12:
+		// the last character of a group has the highest glyph id
+		for _, group := range sub.Groups {
+			if group.EndCharCode < group.StartCharCode {
+				continue
+			}
+			if last := uint64(group.StartGlyphCode) + uint64(group.EndCharCode-group.StartCharCode); last >= uint64(numGlyphs) {
+				// the first character past the last glyph
+				skip := uint32(max(0, numGlyphs-int(group.StartGlyphCode)))
+				return fail(rune(group.StartCharCode+skip), uint64(group.StartGlyphCode)+uint64(skip))
+			}
+		}
+	case 13:
+		for _, group := range sub.Groups {
+			if group.StartGlyphCode >= uint32(numGlyphs) && group.EndCharCode >= group.StartCharCode {
+				return fail(rune(group.StartCharCode), uint64(group.StartGlyphCode))
+			}
+		}
+	case 14:
+		for _, record := range sub.VarSelectors {
+			for _, m := range record.NonDefaultUVS {
+				if int(m.GlyphID) >= numGlyphs {
+					return fail(rune(m.UnicodeValue), uint64(m.GlyphID))
+				}
+			}
+		}
+	case 2:
+		if len(sub.SubHeaderKeys) < 256 {
+			return nil
+		}
+		for c := 0; c < 256 && len(sub.SubHeaders) > 0; c++ {
+			if gid := sub.format2Glyph(0, uint16(c)); sub.SubHeaderKeys[c] == 0 && gid != 0 && int(gid) >= numGlyphs {
+				return fail(rune(c), uint64(gid))
+			}
+		}
+		// subHeaders shared by several high bytes map the same glyphs
+		checked := make([]bool, len(sub.SubHeaders))
+		for hi := 1; hi < 256; hi++ {
+			k := int(sub.SubHeaderKeys[hi] / 8)
+			if k == 0 || k >= len(sub.SubHeaders) || checked[k] {
+				continue
+			}
+			checked[k] = true
+			h := sub.SubHeaders[k]
+			for lo := uint32(h.FirstCode); lo < uint32(h.FirstCode)+uint32(h.EntryCount) && lo <= 0xFF; lo++ {
+				if gid := sub.format2Glyph(k, uint16(lo)); gid != 0 && int(gid) >= numGlyphs {
+					return fail(rune(hi<<8|int(lo)), uint64(gid))
+				}
+			}
+		}
+	case 4:
+		var next uint32
+		for i := 0; i < len(sub.EndCode) && i < len(sub.StartCode); i++ {
+			var start, end uint32
+			start, end, next = sub.format4Span(i, next)
+			if start > end {
+				continue
+			}
+			var delta, rangeOffset uint16
+			if i < len(sub.IdDelta) {
+				delta = sub.IdDelta[i]
+			}
+			if i < len(sub.IdRangeOffset) {
+				rangeOffset = sub.IdRangeOffset[i]
+			}
+			if rangeOffset != 0 {
+				for c := start; c <= end; c++ {
+					if gid := sub.format4Glyph(i, uint16(c)); gid != 0 && int(gid) >= numGlyphs {
+						return fail(rune(c), uint64(gid))
+					}
+				}
+				continue
+			}
+			// the segment maps to consecutive glyph ids from that of start,
+			// wrapping past 0xFFFF to the missing glyph; the first id at
+			// or past numGlyphs is the first one out of range
+			limit := uint32(max(numGlyphs, 1))
+			if limit > 0xFFFF {
+				continue
+			}
+			c := start
+			if first := uint32(uint16(start) + delta); first < limit {
+				c += limit - first
+			}
+			if c <= end {
+				return fail(rune(c), uint64(uint16(c)+delta))
+			}
+		}
+	default:
+		var err error
+		sub.Range(func(r rune, gid uint16) bool {
+			if int(gid) >= numGlyphs {
+				err = fail(r, uint64(gid))
+			}
+			return err == nil
+		})
+		return err
+	}
+	return nil
+}
+
+// VariationSubtable returns the format 14 Unicode Variation Sequences
+// subtable, or nil if the table has none.
+func (cmap *CmapTable) VariationSubtable() *CmapSubTable {
+	for i := range cmap.EncodingSubtables {
+		if sub := &cmap.EncodingSubtables[i]; sub.Format == 14 {
+			return sub
+		}
+	}
+	return nil
+}
+
+// LookupVariant returns the glyph of the variation sequence base followed
+// by selector. Sequences listed as default use the glyph of base. ok is
+// false if the font does not support the sequence; callers usually fall
+// back to Lookup(base).
+func (cmap *CmapTable) LookupVariant(base, selector rune) (gid uint16, ok bool) {
+	sub := cmap.VariationSubtable()
+	if sub == nil {
+		return 0, false
+	}
+	gid, isDefault, ok := sub.lookupVariant(base, selector)
+	if ok && isDefault {
+		return cmap.Lookup(base)
+	}
+	return gid, ok
+}
+
+// lookupVariant finds the sequence base, selector in a format 14 subtable.
+func (sub *CmapSubTable) lookupVariant(base, selector rune) (gid uint16, isDefault, ok bool) {
+	if base < 0 || selector < 0 {
+		return 0, false, false
+	}
+	c, vs := uint32(base), uint32(selector)
+	i := sort.Search(len(sub.VarSelectors), func(i int) bool { return sub.VarSelectors[i].VarSelector >= vs })
+	if i == len(sub.VarSelectors) || sub.VarSelectors[i].VarSelector != vs {
+		return 0, false, false
+	}
+	record := sub.VarSelectors[i]
+	ranges := record.DefaultUVS
+	j := sort.Search(len(ranges), func(j int) bool {
+		return ranges[j].StartUnicodeValue+uint32(ranges[j].AdditionalCount) >= c
+	})
+	if j < len(ranges) && c >= ranges[j].StartUnicodeValue {
+		return 0, true, true
+	}
+	mappings := record.NonDefaultUVS
+	j = sort.Search(len(mappings), func(j int) bool { return mappings[j].UnicodeValue >= c })
+	if j < len(mappings) && mappings[j].UnicodeValue == c && mappings[j].GlyphID != 0 {
+		return mappings[j].GlyphID, false, true
+	}
+	return 0, false, false
+}
+
+// subsetVariations returns the format 14 subtable restricted to the base
+// characters of mapping, with glyph ids remapped through newID. Selectors
+// left without sequences are dropped.
+func (sub *CmapSubTable) subsetVariations(mapping map[rune]uint16, newID map[uint16]uint16) CmapSubTable {
+	out := CmapSubTable{PlatformID: sub.PlatformID, EncodingID: sub.EncodingID, Format: 14}
+	for _, record := range sub.VarSelectors {
+		selector := CmapVariationSelector{VarSelector: record.VarSelector}
+		for _, rng := range record.DefaultUVS {
+			for c := rng.StartUnicodeValue; c <= rng.StartUnicodeValue+uint32(rng.AdditionalCount); c++ {
+				if _, ok := mapping[rune(c)]; !ok {
+					continue
+				}
+				// extend the previous range when c follows it
+				if n := len(selector.DefaultUVS); n > 0 {
+					last := &selector.DefaultUVS[n-1]
+					if last.StartUnicodeValue+uint32(last.AdditionalCount)+1 == c && last.AdditionalCount < 0xFF {
+						last.AdditionalCount++
+						continue
+					}
+				}
+				selector.DefaultUVS = append(selector.DefaultUVS, CmapUnicodeRange{StartUnicodeValue: c})
+			}
+		}
+		for _, m := range record.NonDefaultUVS {
+			gid, ok := newID[m.GlyphID]
+			if _, retained := mapping[rune(m.UnicodeValue)]; retained && ok {
+				selector.NonDefaultUVS = append(selector.NonDefaultUVS, CmapUVSMapping{UnicodeValue: m.UnicodeValue, GlyphID: gid})
+			}
+		}
+		if len(selector.DefaultUVS) > 0 || len(selector.NonDefaultUVS) > 0 {
+			out.VarSelectors = append(out.VarSelectors, selector)
+		}
+	}
+	out.NumVarSelectorRecords = uint32(len(out.VarSelectors))
+	return out
+}
+
+// NewCmapTable builds a cmap table for mapping. The BMP is encoded as a
+// format 4 subtable, recorded for platforms 0 and 3; a format 12 subtable
+// covering every character is added only when mapping contains
+// supplementary characters. Characters mapped to glyph 0 are omitted.
+func NewCmapTable(mapping map[rune]uint16) (CmapTable, error) {
+	runes := make([]rune, 0, len(mapping))
+	for r, gid := range mapping {
+		if r < 0 || r > 0x10FFFF {
+			return CmapTable{}, fmt.Errorf("cmap: invalid character %#x", r)
+		}
+		if gid != 0 {
+			runes = append(runes, r)
+		}
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+
+	f4, err := newCmapFormat4(runes, mapping)
+	if err != nil {
+		return CmapTable{}, err
+	}
+	subtables := []CmapSubTable{f4, f4}
+	subtables[0].PlatformID, subtables[0].EncodingID = 0, 3
+	subtables[1].PlatformID, subtables[1].EncodingID = 3, 1
+	if len(runes) > 0 && runes[len(runes)-1] > 0xFFFF {
+		f12 := newCmapFormat12(runes, mapping)
+		subtables = []CmapSubTable{subtables[0], f12, subtables[1], f12}
+		subtables[1].PlatformID, subtables[1].EncodingID = 0, 4
+		subtables[3].PlatformID, subtables[3].EncodingID = 3, 10
+	}
+	// records sharing a subtable point to the same data
+	base := uint32(4 + 8*len(subtables))
+	for i := range subtables {
+		subtables[i].SubOffset = base
+		if subtables[i].Format == 12 {
+			subtables[i].SubOffset += f4.Length
+		}
+	}
+	return CmapTable{NumberSubtables: uint16(len(subtables)), EncodingSubtables: subtables}, nil
+}
+
+// newCmapFormat4 encodes the BMP characters of runes, which are sorted. Runs
+// of consecutive characters with consecutive glyphs become idDelta segments
+// of 8 bytes; a segment going through glyphIdArray costs 2 more bytes per
+// character it spans, including unmapped ones. Runs are grouped into the
+// cheapest sequence of segments.
+func newCmapFormat4(runes []rune, mapping map[rune]uint16) (CmapSubTable, error) {
+	type run struct {
+		start, end uint16
+		gid        uint16 // glyph of start
+	}
+	var runs []run
+	for _, r := range runes {
+		if r >= 0xFFFF {
+			break
+		}
+		c, gid := uint16(r), mapping[r]
+		if n := len(runs); n > 0 && runs[n-1].end+1 == c && runs[n-1].gid+(c-runs[n-1].start) == gid {
+			runs[n-1].end = c
+			continue
+		}
+		runs = append(runs, run{c, c, gid})
+	}
+
+	// cost[j] is the smallest size of segments covering runs[:j]; from[j]
+	// is the first run of the last segment, negative for an idDelta segment
+	cost := make([]int, len(runs)+1)
+	from := make([]int, len(runs)+1)
+	best, bestFrom := 0, 0 // min of cost[i] - 2*runs[i].start
+	for j, rn := range runs {
+		if c := cost[j] - 2*int(rn.start); j == 0 || c < best {
+			best, bestFrom = c, j
+		}
+		cost[j+1], from[j+1] = cost[j]+8, -1
+		if c := best + 8 + 2*(int(rn.end)+1); c < cost[j+1] {
+			cost[j+1], from[j+1] = c, bestFrom
+		}
+	}
+	type segment struct {
+		first, last int // runs covered
+		delta       bool
+	}
+	var segments []segment
+	for j := len(runs); j > 0; {
+		if from[j] < 0 {
+			segments = append(segments, segment{j - 1, j - 1, true})
+			j--
+		} else {
+			segments = append(segments, segment{from[j], j - 1, false})
+			j = from[j]
+		}
+	}
+
+	segCount := len(segments) + 1
+	sub := CmapSubTable{
+		Format:        4,
+		SegCountX2:    uint16(2 * segCount),
+		EndCode:       make([]uint16, 0, segCount),
+		StartCode:     make([]uint16, 0, segCount),
+		IdDelta:       make([]uint16, 0, segCount),
+		IdRangeOffset: make([]uint16, 0, segCount),
+	}
+	var glyphIDs []uint16
+	for k := len(segments) - 1; k >= 0; k-- {
+		seg := segments[k]
+		start, end := runs[seg.first].start, runs[seg.last].end
+		sub.StartCode = append(sub.StartCode, start)
+		sub.EndCode = append(sub.EndCode, end)
+		if seg.delta {
+			sub.IdDelta = append(sub.IdDelta, runs[seg.first].gid-start)
+			sub.IdRangeOffset = append(sub.IdRangeOffset, 0)
+			continue
+		}
+		// idRangeOffset is relative to its own position in the subtable
+		i := len(sub.IdRangeOffset)
+		sub.IdDelta = append(sub.IdDelta, 0)
+		sub.IdRangeOffset = append(sub.IdRangeOffset, uint16(2*(segCount-i)+2*len(glyphIDs)))
+		first := len(glyphIDs)
+		glyphIDs = append(glyphIDs, make([]uint16, int(end-start)+1)...)
+		for _, rn := range runs[seg.first : seg.last+1] {
+			for c := rn.start; ; c++ {
+				glyphIDs[first+int(c-start)] = rn.gid + (c - rn.start)
+				if c == rn.end {
+					break
+				}
+			}
+		}
+	}
+	sub.StartCode = append(sub.StartCode, 0xFFFF)
+	sub.EndCode = append(sub.EndCode, 0xFFFF)
+	sub.IdDelta = append(sub.IdDelta, 1)
+	sub.IdRangeOffset = append(sub.IdRangeOffset, 0)
+
+	length := 16 + 8*segCount + 2*len(glyphIDs)
+	if length > 0xFFFF {
+		return CmapSubTable{}, errors.New("cmap: too many characters for a format 4 subtable")
+	}
+	sub.Length = uint32(length)
+	searchRange, entrySelector := 2, 0
+	for 2*searchRange <= 2*segCount {
+		searchRange *= 2
+		entrySelector++
+	}
+	sub.SearchRange, sub.EntrySelector = uint16(searchRange), uint16(entrySelector)
+	sub.RangeShift = uint16(2*segCount - searchRange)
+
+	// GlyphIndexArray holds the subtable after its header, as read
+	sub.GlyphIndexArray = make([]uint8, 0, length-6)
+	header := []uint16{sub.SegCountX2, sub.SearchRange, sub.EntrySelector, sub.RangeShift}
+	for _, list := range [][]uint16{header, sub.EndCode, {sub.ReservedPad}, sub.StartCode, sub.IdDelta, sub.IdRangeOffset, glyphIDs} {
+		for _, v := range list {
+			sub.GlyphIndexArray = binary.BigEndian.AppendUint16(sub.GlyphIndexArray, v)
+		}
+	}
+	return sub, nil
+}
+
+// newCmapFormat12 encodes runes, which are sorted, as groups of consecutive
+// characters with consecutive glyphs.
+func newCmapFormat12(runes []rune, mapping map[rune]uint16) CmapSubTable {
+	var groups []CmapSubTableFormatMixGroup
+	for _, r := range runes {
+		c, gid := uint32(r), uint32(mapping[r])
+		if n := len(groups); n > 0 {
+			last := &groups[n-1]
+			if last.EndCharCode+1 == c && last.StartGlyphCode+c-last.StartCharCode == gid {
+				last.EndCharCode = c
+				continue
+			}
+		}
+		groups = append(groups, CmapSubTableFormatMixGroup{StartCharCode: c, EndCharCode: c, StartGlyphCode: gid})
+	}
+	return CmapSubTable{
+		Format:  12,
+		Length:  uint32(16 + 12*len(groups)),
+		NGroups: uint32(len(groups)),
+		Groups:  groups,
+	}
+}
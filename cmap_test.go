@@ -0,0 +1,477 @@
+package fontcompress_test
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+// cmapTable returns the decoded cmap table of ttf.
+func cmapTable(t *testing.T, ttf *font_compress.TTF) *font_compress.CmapTable {
+	t.Helper()
+	cmap, err := ttf.Cmap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &cmap
+}
+
+// fontWithSubtable returns the fixture font with a cmap holding only sub,
+// recorded as platform 3 encoding 1.
+func fontWithSubtable(sub []byte) []byte {
+	cmap := binary.BigEndian.AppendUint16(nil, 0)
+	cmap = binary.BigEndian.AppendUint16(cmap, 1)
+	cmap = binary.BigEndian.AppendUint16(cmap, 3)
+	cmap = binary.BigEndian.AppendUint16(cmap, 1)
+	cmap = binary.BigEndian.AppendUint32(cmap, 12)
+	tables := fixtureTables()
+	tables["cmap"] = append(cmap, sub...)
+	return assembleFont(font_compress.TTF_MAGIC, tables)
+}
+
+func appendUint16s(b []byte, v ...uint16) []byte {
+	for _, x := range v {
+		b = binary.BigEndian.AppendUint16(b, x)
+	}
+	return b
+}
+
+func TestCmapLookupFormats(t *testing.T) {
+	format0 := appendUint16s(nil, 0, 262, 0)
+	format0 = append(format0, make([]byte, 256)...)
+	format0[6+'A'], format0[6+'B'] = 1, 2
+
+	// subHeader 1 maps 0x8140 and 0x8141; 0x81 is a lead byte
+	format2 := appendUint16s(nil, 2, 518+16+2*258, 0)
+	keys := make([]uint16, 256)
+	keys[0x81] = 8
+	format2 = appendUint16s(format2, keys...)
+	format2 = appendUint16s(format2, 0, 256, 0, 10)   // subHeader 0 at 518, glyphs at 534
+	format2 = appendUint16s(format2, 0x40, 2, 0, 514) // subHeader 1 at 526, glyphs at 1046
+	glyphs := make([]uint16, 258)
+	glyphs['A'], glyphs[256], glyphs[257] = 1, 5, 6
+	format2 = appendUint16s(format2, glyphs...)
+
+	// A-B go through glyphIdArray with idDelta 1, C uses idDelta alone
+	format4 := appendUint16s(nil, 4, 16+8*3+4, 0, 6, 4, 1, 2)
+	format4 = appendUint16s(format4, 'B', 'C', 0xFFFF, 0)
+	format4 = appendUint16s(format4, 'A', 'C', 0xFFFF)
+	format4 = appendUint16s(format4, 1, 0x10000+5-'C', 1)
+	format4 = appendUint16s(format4, 6, 0, 0) // idRangeOffset[0] at 34, glyphIdArray at 40
+	format4 = appendUint16s(format4, 1, 0)
+
+	format6 := appendUint16s(nil, 6, 16, 0, 'A', 3, 1, 2, 5)
+
+	for _, tt := range []struct {
+		name string
+		sub  []byte
+		want map[rune]uint16
+	}{
+		{"format 0", format0, map[rune]uint16{'A': 1, 'B': 2}},
+		{"format 2", format2, map[rune]uint16{'A': 1, 0x8140: 5, 0x8141: 6}},
+		{"format 4", format4, map[rune]uint16{'A': 2, 'C': 5}},
+		{"format 6", format6, map[rune]uint16{'A': 1, 'B': 2, 'C': 5}},
+	} {
+		cmap := cmapTable(t, readFont(t, fontWithSubtable(tt.sub)))
+		testCmapMapping(t, tt.name, cmap, tt.want)
+	}
+}
+
+// TestCmapGlyphLimit checks format 4 segments against the 7 fixture glyphs
+// through idDelta alone, including ids that wrap past 0xFFFF.
+func TestCmapGlyphLimit(t *testing.T) {
+	format4 := func(end, start, delta uint16) []byte {
+		sub := appendUint16s(nil, 4, 16+8*3, 0, 6, 4, 1, 2)
+		sub = appendUint16s(sub, 'C', end, 0xFFFF, 0)
+		sub = appendUint16s(sub, 'A', start, 0xFFFF)
+		sub = appendUint16s(sub, 0x10000+1-'A', delta, 1)
+		return appendUint16s(sub, 0, 0, 0)
+	}
+	// the characters of the second segment before D belong to the first
+	// one, where Lookup finds them unmapped; D wraps to the missing glyph
+	cmap := cmapTable(t, readFont(t, fontWithSubtable(format4('J', ' ', 0x10000-'D'))))
+	testCmapMapping(t, "overlapping segments", cmap, map[rune]uint16{
+		'A': 1, 'B': 2, 'C': 3, 'E': 1, 'F': 2, 'G': 3, 'H': 4, 'I': 5, 'J': 6,
+	})
+	cmap = cmapTable(t, readFont(t, fontWithSubtable(format4('Z', 'X', 0x10000-'X'))))
+	testCmapMapping(t, "wrapping segment", cmap, map[rune]uint16{'A': 1, 'B': 2, 'C': 3, 'Y': 1, 'Z': 2})
+
+	for _, tt := range []struct {
+		name string
+		sub  []byte
+		want string
+	}{
+		{"segment past the last glyph", format4('K', ' ', 0x10000-'D'), "maps U+004B to glyph 7,"},
+		{"segment wrapping past 0xFFFF", format4('Z', 'X', 0x10000-'Y'), "maps U+0058 to glyph 65535,"},
+	} {
+		_, err := readFont(t, fontWithSubtable(tt.sub)).Cmap()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Cmap() error %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestCmapLookupWideFormats(t *testing.T) {
+	groups := []font_compress.CmapSubTableFormatMixGroup{
+		{StartCharCode: 'A', EndCharCode: 'B', StartGlyphCode: 1},
+		{StartCharCode: 0x20000, EndCharCode: 0x20000, StartGlyphCode: 6},
+	}
+	for _, tt := range []struct {
+		name string
+		sub  font_compress.CmapSubTable
+		want map[rune]uint16
+	}{
+		{"format 10", font_compress.CmapSubTable{Format: 10, StartCharCode: 0x20000, NumChars: 2, GlyphIndexArray16: []uint16{6, 3}},
+			map[rune]uint16{0x20000: 6, 0x20001: 3}},
+		{"format 12", font_compress.CmapSubTable{Format: 12, Groups: groups},
+			map[rune]uint16{'A': 1, 'B': 2, 0x20000: 6}},
+		{"format 13", font_compress.CmapSubTable{Format: 13, Groups: groups},
+			map[rune]uint16{'A': 1, 'B': 1, 0x20000: 6}},
+	} {
+		tt.sub.PlatformID, tt.sub.EncodingID = 3, 10
+		cmap := &font_compress.CmapTable{EncodingSubtables: []font_compress.CmapSubTable{tt.sub}}
+		testCmapMapping(t, tt.name, cmap, tt.want)
+	}
+}
+
+func testCmapMapping(t *testing.T, name string, cmap *font_compress.CmapTable, want map[rune]uint16) {
+	t.Helper()
+	for r := rune(0); r < 0x20010; r++ {
+		gid, ok := cmap.Lookup(r)
+		if gid != want[r] || ok != (want[r] != 0) {
+			t.Errorf("%s: Lookup(%#x) = %d, %v, want %d", name, r, gid, ok, want[r])
+		}
+	}
+	got := make(map[rune]uint16)
+	last := rune(-1)
+	cmap.Range(func(r rune, gid uint16) bool {
+		if r <= last {
+			t.Errorf("%s: Range visits %#x after %#x", name, r, last)
+		}
+		last, got[r] = r, gid
+		return true
+	})
+	if len(got) != len(want) {
+		t.Errorf("%s: Range visited %v, want %v", name, got, want)
+	}
+	for r, gid := range want {
+		if got[r] != gid {
+			t.Errorf("%s: Range maps %#x to %d, want %d", name, r, got[r], gid)
+		}
+	}
+}
+
+func TestCmapSubtablePreference(t *testing.T) {
+	sub := func(platformID, encodingID uint16, gid uint32) font_compress.CmapSubTable {
+		return font_compress.CmapSubTable{
+			PlatformID: platformID,
+			EncodingID: encodingID,
+			Format:     12,
+			Groups:     []font_compress.CmapSubTableFormatMixGroup{{StartCharCode: 'A', EndCharCode: 'A', StartGlyphCode: gid}},
+		}
+	}
+	cmap := &font_compress.CmapTable{EncodingSubtables: []font_compress.CmapSubTable{
+		sub(0, 3, 1), sub(3, 1, 2), sub(3, 10, 3),
+	}}
+	for _, want := range []uint16{3, 2, 1} {
+		if gid, _ := cmap.Lookup('A'); gid != want {
+			t.Errorf("Lookup picked the subtable mapping to %d, want %d", gid, want)
+		}
+		cmap.EncodingSubtables = cmap.EncodingSubtables[:len(cmap.EncodingSubtables)-1]
+	}
+	if _, ok := cmap.Lookup('A'); ok {
+		t.Error("Lookup succeeded without subtables")
+	}
+
+	// Range stops when fn returns false
+	cmap = cmapTable(t, readFont(t, fixtureFont()))
+	n := 0
+	cmap.Range(func(rune, uint16) bool { n++; return false })
+	if n != 1 {
+		t.Errorf("Range called fn %d times after it returned false", n)
+	}
+}
+
+func TestReadCmapWideFormats(t *testing.T) {
+	cmap := cmapTable(t, readFont(t, fixtureFont()))
+	if len(cmap.EncodingSubtables) != 2 {
+		t.Fatalf("%d subtables, want 2", len(cmap.EncodingSubtables))
+	}
+	f12 := cmap.EncodingSubtables[1]
+	runes := fixtureRunes()
+	if f12.Format != 12 || f12.Length != uint32(16+12*len(runes)) || f12.Language != 0 || f12.NGroups != uint32(len(runes)) {
+		t.Fatalf("format %d, length %d, language %d, %d groups", f12.Format, f12.Length, f12.Language, f12.NGroups)
+	}
+	for i, r := range runes {
+		want := font_compress.CmapSubTableFormatMixGroup{StartCharCode: uint32(r), EndCharCode: uint32(r), StartGlyphCode: uint32(fixtureCmap[r])}
+		if f12.Groups[i] != want {
+			t.Errorf("group %d = %+v, want %+v", i, f12.Groups[i], want)
+		}
+	}
+	if gid, _ := cmap.Lookup(0x20000); gid != 6 {
+		t.Errorf("U+20000 maps to %d, want 6", gid)
+	}
+
+	// format 13 with a 32-bit language, then format 10
+	f13 := appendUint16s(nil, 13, 0)
+	f13 = binary.BigEndian.AppendUint32(f13, 16+12)
+	f13 = binary.BigEndian.AppendUint32(f13, 0x10001)
+	f13 = binary.BigEndian.AppendUint32(f13, 1)
+	f13 = binary.BigEndian.AppendUint32(f13, 'A')
+	f13 = binary.BigEndian.AppendUint32(f13, 'C')
+	f13 = binary.BigEndian.AppendUint32(f13, 5)
+	f10 := appendUint16s(nil, 10, 0)
+	f10 = binary.BigEndian.AppendUint32(f10, 20+4)
+	f10 = binary.BigEndian.AppendUint32(f10, 0)
+	f10 = binary.BigEndian.AppendUint32(f10, 0x20000)
+	f10 = binary.BigEndian.AppendUint32(f10, 2)
+	f10 = appendUint16s(f10, 6, 3)
+	for _, tt := range []struct {
+		sub  []byte
+		want map[rune]uint16
+	}{
+		{f13, map[rune]uint16{'A': 5, 'B': 5, 'C': 5}},
+		{f10, map[rune]uint16{0x20000: 6, 0x20001: 3}},
+	} {
+		ttf := readFont(t, fontWithSubtable(tt.sub))
+		cmap := cmapTable(t, ttf)
+		sub := cmap.EncodingSubtables[0]
+		if sub.Length != uint32(len(tt.sub)) {
+			t.Errorf("format %d: length %d, want %d", sub.Format, sub.Length, len(tt.sub))
+		}
+		testCmapMapping(t, "parsed", cmap, tt.want)
+
+		// the subtable is written back unchanged
+		font, err := ttf.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fontTable(font, "cmap")[12:]; string(got) != string(tt.sub) {
+			t.Errorf("format %d written as %x, want %x", sub.Format, got, tt.sub)
+		}
+	}
+	if sub := cmapTable(t, readFont(t, fontWithSubtable(f13))).EncodingSubtables[0]; sub.Language != 0x10001 {
+		t.Errorf("format 13 language %#x, want 0x10001", sub.Language)
+	}
+}
+
+// fixtureVariations is a format 14 subtable for the fixture font: U+FE00
+// lists A-B as default sequences and maps C to dieresis, U+E0100 maps
+// U+20000 to B.
+func fixtureVariations() []byte {
+	uint24 := func(b []byte, v uint32) []byte { return append(b, byte(v>>16), byte(v>>8), byte(v)) }
+	f14 := appendUint16s(nil, 14)
+	f14 = binary.BigEndian.AppendUint32(f14, 10+2*11+8+9+9)
+	f14 = binary.BigEndian.AppendUint32(f14, 2)
+	f14 = uint24(f14, 0xFE00)
+	f14 = binary.BigEndian.AppendUint32(f14, 32)
+	f14 = binary.BigEndian.AppendUint32(f14, 40)
+	f14 = uint24(f14, 0xE0100)
+	f14 = binary.BigEndian.AppendUint32(f14, 0)
+	f14 = binary.BigEndian.AppendUint32(f14, 49)
+	f14 = binary.BigEndian.AppendUint32(f14, 1) // default UVS at 32
+	f14 = append(uint24(f14, 'A'), 1)
+	f14 = binary.BigEndian.AppendUint32(f14, 1) // non-default UVS at 40
+	f14 = appendUint16s(uint24(f14, 'C'), 3)
+	f14 = binary.BigEndian.AppendUint32(f14, 1) // non-default UVS at 49
+	return appendUint16s(uint24(f14, 0x20000), 2)
+}
+
+// fontWithVariations returns the fixture font with fixtureVariations added
+// to its cmap as platform 0 encoding 5.
+func fontWithVariations() []byte {
+	subtables := fixtureCmapTable()[20:]
+	f4Length := int(binary.BigEndian.Uint16(subtables[2:]))
+	cmap := appendUint16s(nil, 0, 3)
+	cmap = appendUint16s(cmap, 0, 5)
+	cmap = binary.BigEndian.AppendUint32(cmap, uint32(28+len(subtables)))
+	cmap = appendUint16s(cmap, 3, 1)
+	cmap = binary.BigEndian.AppendUint32(cmap, 28)
+	cmap = appendUint16s(cmap, 3, 10)
+	cmap = binary.BigEndian.AppendUint32(cmap, uint32(28+f4Length))
+	cmap = append(cmap, subtables...)
+	tables := fixtureTables()
+	tables["cmap"] = append(cmap, fixtureVariations()...)
+	return assembleFont(font_compress.TTF_MAGIC, tables)
+}
+
+func TestCmapVariations(t *testing.T) {
+	ttf := readFont(t, fontWithVariations())
+	cmap := cmapTable(t, ttf)
+	sub := cmap.VariationSubtable()
+	if sub == nil {
+		t.Fatal("no format 14 subtable")
+	}
+	if sub.PlatformID != 0 || sub.EncodingID != 5 || sub.Length != uint32(len(fixtureVariations())) || len(sub.VarSelectors) != 2 {
+		t.Fatalf("format 14 subtable = %+v", sub)
+	}
+	want := font_compress.CmapVariationSelector{
+		VarSelector:   0xFE00,
+		DefaultUVS:    []font_compress.CmapUnicodeRange{{StartUnicodeValue: 'A', AdditionalCount: 1}},
+		NonDefaultUVS: []font_compress.CmapUVSMapping{{UnicodeValue: 'C', GlyphID: 3}},
+	}
+	if got := sub.VarSelectors[0]; got.VarSelector != want.VarSelector ||
+		len(got.DefaultUVS) != 1 || got.DefaultUVS[0] != want.DefaultUVS[0] ||
+		len(got.NonDefaultUVS) != 1 || got.NonDefaultUVS[0] != want.NonDefaultUVS[0] {
+		t.Errorf("record 0 = %+v, want %+v", got, want)
+	}
+
+	for _, tt := range []struct {
+		base, selector rune
+		gid            uint16
+		ok             bool
+	}{
+		{'A', 0xFE00, 1, true},
+		{'B', 0xFE00, 2, true},
+		{'C', 0xFE00, 3, true},
+		{'Ä', 0xFE00, 0, false},
+		{0x20000, 0xE0100, 2, true},
+		{'A', 0xE0100, 0, false},
+		{'A', 0xFE01, 0, false},
+	} {
+		if gid, ok := cmap.LookupVariant(tt.base, tt.selector); gid != tt.gid || ok != tt.ok {
+			t.Errorf("LookupVariant(%U, %U) = %d, %v, want %d, %v", tt.base, tt.selector, gid, ok, tt.gid, tt.ok)
+		}
+	}
+
+	// the subtable is written back unchanged
+	font, err := ttf.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmapData := fontTable(font, "cmap")
+	if got := cmapData[binary.BigEndian.Uint32(cmapData[8:]):]; string(got[:len(fixtureVariations())]) != string(fixtureVariations()) {
+		t.Errorf("format 14 written as %x, want %x", got, fixtureVariations())
+	}
+}
+
+func TestSubsetVariations(t *testing.T) {
+	out, err := font_compress.Subset(readFont(t, fontWithVariations()), []rune("AC"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// .notdef, A, dieresis for C+U+FE00, C
+	if n := binary.BigEndian.Uint16(fontTable(out, "maxp")[4:]); n != 4 {
+		t.Errorf("numGlyphs = %d, want 4", n)
+	}
+	cmap := cmapTable(t, readFont(t, out))
+	sub := cmap.VariationSubtable()
+	if sub == nil {
+		t.Fatal("subset has no format 14 subtable")
+	}
+	if len(sub.VarSelectors) != 1 || sub.VarSelectors[0].VarSelector != 0xFE00 {
+		t.Errorf("subset keeps selectors %+v, want only U+FE00", sub.VarSelectors)
+	}
+	for _, tt := range []struct {
+		base, selector rune
+		gid            uint16
+		ok             bool
+	}{
+		{'A', 0xFE00, 1, true},
+		{'B', 0xFE00, 0, false},
+		{'C', 0xFE00, 2, true},
+		{0x20000, 0xE0100, 0, false},
+	} {
+		if gid, ok := cmap.LookupVariant(tt.base, tt.selector); gid != tt.gid || ok != tt.ok {
+			t.Errorf("subset LookupVariant(%U, %U) = %d, %v, want %d, %v", tt.base, tt.selector, gid, ok, tt.gid, tt.ok)
+		}
+	}
+	if gid, _ := cmap.Lookup('C'); gid != 3 {
+		t.Errorf("C maps to %d, want 3", gid)
+	}
+}
+
+func TestNewCmapTable(t *testing.T) {
+	// A-C is one idDelta segment; a-d has scattered glyphs and is cheaper
+	// through glyphIdArray than as three idDelta segments
+	mapping := map[rune]uint16{'A': 1, 'B': 2, 'C': 3, 'a': 9, 'b': 5, 'c': 7, 'd': 8, 'x': 4, 'y': 0}
+	built, err := font_compress.NewCmapTable(mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(built.EncodingSubtables) != 2 {
+		t.Fatalf("%d subtables, want 2 without supplementary characters", len(built.EncodingSubtables))
+	}
+	f4 := built.EncodingSubtables[0]
+	if f4.Format != 4 || f4.SegCountX2 != 8 || f4.SearchRange != 8 || f4.EntrySelector != 2 || f4.RangeShift != 0 {
+		t.Errorf("format %d, segCountX2 %d, searchRange %d, entrySelector %d, rangeShift %d, want 4, 8, 8, 2, 0",
+			f4.Format, f4.SegCountX2, f4.SearchRange, f4.EntrySelector, f4.RangeShift)
+	}
+	if f4.Length != 16+8*4+2*4 {
+		t.Errorf("length %d, want %d", f4.Length, 16+8*4+2*4)
+	}
+	if f4.IdRangeOffset[0] != 0 || f4.IdRangeOffset[1] == 0 || f4.IdRangeOffset[2] != 0 {
+		t.Errorf("idRangeOffset = %v, want only the a-d segment through glyphIdArray", f4.IdRangeOffset)
+	}
+	delete(mapping, 'y')
+	testCmapMapping(t, "built", &built, mapping)
+
+	mapping[0x20000], mapping[0x20001] = 6, 7
+	built, err = font_compress.NewCmapTable(mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(built.EncodingSubtables) != 4 {
+		t.Fatalf("%d subtables, want 4 with supplementary characters", len(built.EncodingSubtables))
+	}
+	if f12 := built.EncodingSubtables[1]; f12.Format != 12 || f12.EncodingID != 4 || f12.NGroups != 6 {
+		t.Errorf("subtable 1 is format %d, encoding %d with %d groups, want format 12, encoding 4 with 6 groups", f12.Format, f12.EncodingID, f12.NGroups)
+	}
+
+	// the built table reads back unchanged; maxp is raised to cover the
+	// glyph ids of mapping
+	tables := fixtureTables()
+	binary.BigEndian.PutUint16(tables["maxp"][4:], 10)
+	ttf := readFont(t, assembleFont(font_compress.TTF_MAGIC, tables))
+	for i := range ttf.Tables {
+		if font_compress.PrintTagName(ttf.Tables[i].Tag) == "cmap" {
+			ttf.Tables[i].Table = built
+		}
+	}
+	font, err := ttf.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := cmapTable(t, readFont(t, font))
+	if !reflect.DeepEqual(read.EncodingSubtables, built.EncodingSubtables) {
+		t.Errorf("read back as %+v, want %+v", read.EncodingSubtables, built.EncodingSubtables)
+	}
+	testCmapMapping(t, "read back", read, mapping)
+}
+
+func TestWriteCmapSegmentCount(t *testing.T) {
+	ttf := readFont(t, fixtureFont())
+	cmap := *cmapTable(t, ttf)
+	cmap.EncodingSubtables = append([]font_compress.CmapSubTable(nil), cmap.EncodingSubtables...)
+	for i, sub := range cmap.EncodingSubtables {
+		if sub.Format != 4 {
+			continue
+		}
+		// a segment dropped without updating SegCountX2
+		sub.EndCode, sub.StartCode = sub.EndCode[1:], sub.StartCode[1:]
+		sub.IdDelta, sub.IdRangeOffset = sub.IdDelta[1:], sub.IdRangeOffset[1:]
+		cmap.EncodingSubtables[i] = sub
+	}
+	replaceTable(ttf, cmap)
+	if _, err := ttf.Bytes(); err == nil {
+		t.Error("format 4 subtable with a stale segCountX2 written")
+	}
+}
+
+func TestWriteCmapKeepsTable(t *testing.T) {
+	ttf := readFont(t, fixtureFont())
+	cmap := *cmapTable(t, ttf)
+	// the subtables move when the first encoding record is dropped
+	cmap.EncodingSubtables = cmap.EncodingSubtables[1:]
+	want := append([]font_compress.CmapSubTable(nil), cmap.EncodingSubtables...)
+	replaceTable(ttf, cmap)
+	if _, err := ttf.Bytes(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cmap.EncodingSubtables, want) {
+		t.Errorf("Bytes changed the subtables to %+v, want %+v", cmap.EncodingSubtables, want)
+	}
+}
@@ -0,0 +1,201 @@
+package fontcompress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const (
+	// TTC, font collection
+	TTC_MAGIC uint32 = 0x74746366 // 'ttcf'
+)
+
+/*
+*
+TAG	ttcTag	Font Collection ID string: 'ttcf'
+uint16	majorVersion	Major version of the TTC Header, = 1 or 2.
+uint16	minorVersion	Minor version of the TTC Header, = 0.
+uint32	numFonts	Number of fonts in TTC
+Offset32	tableDirectoryOffsets[numFonts]	Array of offsets to the TableDirectory for each font from the beginning of the file
+uint32	dsigTag	Tag indicating that a DSIG table exists, 0x44534947 ('DSIG') (null if no signature), version 2.0 only
+uint32	dsigLength	The length (in bytes) of the DSIG table (null if no signature), version 2.0 only
+uint32	dsigOffset	The offset (in bytes) of the DSIG table from the beginning of the TTC file (null if no signature), version 2.0 only
+*/
+type Collection struct {
+	File string
+
+	MajorVersion uint16 // 1 or 2
+	MinorVersion uint16 // 0
+
+	Fonts []*TTF // member fonts; they share the collection data
+
+	buf []byte // raw collection data
+}
+
+// NewCollection reads a TrueType or OpenType collection (.ttc, .otc).
+func NewCollection(fileName string) (*Collection, error) {
+	buf, err := (&TTF{File: fileName}).readTTF()
+	if err != nil {
+		return nil, err
+	}
+	c := &Collection{File: fileName}
+	if err := c.readCollection(buf); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Collection) readCollection(buf []byte) error {
+	if len(buf) < 12 || binary.BigEndian.Uint32(buf) != TTC_MAGIC {
+		return &ParseError{Reason: "not a font collection"}
+	}
+	c.MajorVersion = binary.BigEndian.Uint16(buf[4:])
+	c.MinorVersion = binary.BigEndian.Uint16(buf[6:])
+	numFonts := binary.BigEndian.Uint32(buf[8:])
+	if numFonts == 0 || 12+4*uint64(numFonts) > uint64(len(buf)) {
+		return &ParseError{Offset: 8, Reason: fmt.Sprintf("collection of %d fonts is truncated", numFonts)}
+	}
+	c.buf = buf
+	c.Fonts = make([]*TTF, numFonts)
+	for i := range c.Fonts {
+		offset := binary.BigEndian.Uint32(buf[12+4*i:])
+		if uint64(offset)+12 > uint64(len(buf)) {
+			return &ParseError{Offset: int64(12 + 4*i), Reason: fmt.Sprintf("collection font %d is out of range", i)}
+		}
+		ttf := &TTF{
+			File:   c.File,
+			Tables: make([]TTFTableInfo, 0),
+			buf:    buf,
+			offset: int(offset),
+		}
+		if err := ttf.readTTFInfo(buf[offset:]); err != nil {
+			return err
+		}
+		if err := ttf.readTTFTables(buf); err != nil {
+			return err
+		}
+		c.Fonts[i] = ttf
+	}
+	return nil
+}
+
+// Extract returns member i as a standalone font. Tables changed through
+// the accessors of the member are encoded as in (*TTF).Bytes.
+func (c *Collection) Extract(i int) ([]byte, error) {
+	if i < 0 || i >= len(c.Fonts) {
+		return nil, fmt.Errorf("collection has no font %d", i)
+	}
+	tables, err := c.Fonts[i].encodeTables()
+	if err != nil {
+		return nil, err
+	}
+	return buildSFNT(c.Fonts[i].ScalerType, tables, c.Fonts[i].dataOrder()), nil
+}
+
+// Bytes rebuilds the collection from the tables of its members, encoded as
+// in (*TTF).Bytes. Tables with identical data are stored once and shared.
+func (c *Collection) Bytes() ([]byte, error) {
+	fonts := make([]collectionFont, len(c.Fonts))
+	for i, ttf := range c.Fonts {
+		tables, err := ttf.encodeTables()
+		if err != nil {
+			return nil, fmt.Errorf("collection font %d: %w", i, err)
+		}
+		fonts[i] = collectionFont{ttf.ScalerType, tables}
+	}
+	return buildCollection(fonts)
+}
+
+// WriteTo writes the rebuilt collection to w. It implements io.WriterTo.
+func (c *Collection) WriteTo(w io.Writer) (int64, error) {
+	buf, err := c.Bytes()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// EncodeCollection builds a collection from standalone TrueType or
+// OpenType fonts. Tables with identical data are stored once and shared.
+func EncodeCollection(fonts ...[]byte) ([]byte, error) {
+	members := make([]collectionFont, len(fonts))
+	for i, font := range fonts {
+		scalerType, tables, err := sfntTables(font)
+		if err != nil {
+			return nil, err
+		}
+		members[i] = collectionFont{scalerType, tables}
+	}
+	return buildCollection(members)
+}
+
+// collectionFont is one member of a collection being built.
+type collectionFont struct {
+	scalerType uint32
+	tables     map[string][]byte
+}
+
+// buildCollection lays out a version 1.0 collection header, the offset
+// table and directory of every member, then the table data. Table data is
+// kept as is, including head.checkSumAdjustment.
+func buildCollection(fonts []collectionFont) ([]byte, error) {
+	if len(fonts) == 0 {
+		return nil, errors.New("collection has no fonts")
+	}
+	size := 12 + 4*len(fonts)
+	for _, font := range fonts {
+		size += 12 + 16*len(font.tables)
+	}
+	out := make([]byte, size)
+	binary.BigEndian.PutUint32(out, TTC_MAGIC)
+	binary.BigEndian.PutUint16(out[4:], 1)
+	binary.BigEndian.PutUint32(out[8:], uint32(len(fonts)))
+
+	// offsets of the table data already written, keyed by content
+	written := make(map[string]uint32)
+	dir := 12 + 4*len(fonts)
+	for i, font := range fonts {
+		binary.BigEndian.PutUint32(out[12+4*i:], uint32(dir))
+		tags := make([]string, 0, len(font.tables))
+		for tag := range font.tables {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		entrySelector := 0
+		for 1<<(entrySelector+1) <= len(tags) {
+			entrySelector++
+		}
+		searchRange := 16 << entrySelector
+		binary.BigEndian.PutUint32(out[dir:], font.scalerType)
+		binary.BigEndian.PutUint16(out[dir+4:], uint16(len(tags)))
+		binary.BigEndian.PutUint16(out[dir+6:], uint16(searchRange))
+		binary.BigEndian.PutUint16(out[dir+8:], uint16(entrySelector))
+		binary.BigEndian.PutUint16(out[dir+10:], uint16(16*len(tags)-searchRange))
+		for j, tag := range tags {
+			data := font.tables[tag]
+			offset, ok := written[string(data)]
+			if !ok {
+				offset = uint32(len(out))
+				written[string(data)] = offset
+				out = append(out, data...)
+				out = append(out, make([]byte, (4-len(data)%4)%4)...)
+			}
+			checksum := tableChecksum(data)
+			if tag == "head" && len(data) >= 12 {
+				// the checksum of head is computed with checkSumAdjustment zeroed
+				checksum -= binary.BigEndian.Uint32(data[8:])
+			}
+			rec := out[dir+12+16*j:]
+			copy(rec, tag)
+			binary.BigEndian.PutUint32(rec[4:], checksum)
+			binary.BigEndian.PutUint32(rec[8:], offset)
+			binary.BigEndian.PutUint32(rec[12:], uint32(len(data)))
+		}
+		dir += 12 + 16*len(tags)
+	}
+	return out, nil
+}
@@ -0,0 +1,115 @@
+package fontcompress_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+func TestCollection(t *testing.T) {
+	regular := fixtureFont()
+	tables := fixtureTables()
+	tables["head"] = append([]byte(nil), tables["head"]...)
+	binary.BigEndian.PutUint32(tables["head"][4:], 0x00020000) // fontRevision
+	bold := assembleFont(font_compress.TTF_MAGIC, tables)
+
+	ttc, err := font_compress.EncodeCollection(regular, bold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := font_compress.NewTTF(writeFont(t, ttc)); err == nil {
+		t.Error("NewTTF accepted a collection")
+	}
+	c, err := font_compress.NewCollection(writeFont(t, ttc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Fonts) != 2 || c.MajorVersion != 1 {
+		t.Fatalf("%d fonts, version %d", len(c.Fonts), c.MajorVersion)
+	}
+
+	// only head differs, every other table is stored once
+	offsets := make([]map[string]uint32, 2)
+	for i, ttf := range c.Fonts {
+		offsets[i] = make(map[string]uint32)
+		for _, ti := range ttf.Tables {
+			offsets[i][font_compress.PrintTagName(ti.Tag)] = ti.Offset
+		}
+		if len(glyfTable(t, ttf).Glyphs) != len(fixtureGlyphs) {
+			t.Errorf("font %d: glyf not decoded", i)
+		}
+	}
+	for _, tag := range []string{"cmap", "glyf", "loca"} {
+		if offsets[0][tag] != offsets[1][tag] {
+			t.Errorf("%s is not shared", tag)
+		}
+	}
+	if offsets[0]["head"] == offsets[1]["head"] {
+		t.Error("different head tables are shared")
+	}
+
+	for i, want := range [][]byte{regular, bold} {
+		font, err := c.Extract(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for tag := range tables {
+			got, want := fontTable(font, tag), fontTable(want, tag)
+			if tag == "head" {
+				// checkSumAdjustment is recomputed for the standalone font
+				got, want = append(got[:8:8], got[12:]...), append(want[:8:8], want[12:]...)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("font %d: extracted %s differs", i, tag)
+			}
+		}
+	}
+	if _, err := c.Extract(2); err == nil {
+		t.Error("extracted a missing font")
+	}
+
+	rebuilt, err := c.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rebuilt, ttc) {
+		t.Error("rebuilt collection differs")
+	}
+
+	// changes made through the accessors of a member are written
+	head, err := c.Fonts[0].Head()
+	if err != nil {
+		t.Fatal(err)
+	}
+	head.FontRevision = 0x00030000
+	replaceTable(c.Fonts[0], head)
+	extracted, err := c.Extract(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev := binary.BigEndian.Uint32(fontTable(extracted, "head")[4:]); rev != head.FontRevision {
+		t.Errorf("extracted fontRevision = %#x, want %#x", rev, head.FontRevision)
+	}
+	if rebuilt, err = c.Bytes(); err != nil {
+		t.Fatal(err)
+	}
+	edited, err := font_compress.NewCollection(writeFont(t, rebuilt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []uint32{head.FontRevision, 0x00020000} {
+		if head, err := edited.Fonts[i].Head(); err != nil || head.FontRevision != want {
+			t.Errorf("rebuilt font %d: fontRevision = %#x (%v), want %#x", i, head.FontRevision, err, want)
+		}
+	}
+
+	font, err := font_compress.Subset(c.Fonts[1], []rune("B"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := binary.BigEndian.Uint16(fontTable(font, "maxp")[4:]); n != 2 {
+		t.Errorf("subset of a member has %d glyphs, want 2", n)
+	}
+}
@@ -0,0 +1,51 @@
+package fontcompress
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoTable is returned, wrapped, by the table accessors of TTF when the
+// font does not contain the table.
+var ErrNoTable = errors.New("font has no such table")
+
+// ErrSubsettingForbidden is returned by Subset for fonts whose OS/2 fsType
+// does not permit subsetting, unless SubsetOptions.IgnoreEmbeddingPermissions
+// is set.
+var ErrSubsettingForbidden = errors.New("font embedding permissions forbid subsetting")
+
+// ParseError reports font data that is truncated or malformed. NewTTF,
+// NewCollection and the table accessors of TTF return it for every problem
+// found in the data itself, as opposed to errors reading the file.
+type ParseError struct {
+	Table  string // tag of the table being parsed, empty for the file headers and the table directory
+	Offset int64  // byte offset of the problem, relative to Table or to the start of the font data
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	if e.Table == "" {
+		return fmt.Sprintf("parse error at offset %d: %s", e.Offset, e.Reason)
+	}
+	return fmt.Sprintf("parse error in %s table at offset %d: %s", strings.TrimRight(e.Table, " "), e.Offset, e.Reason)
+}
+
+// parseError wraps err, returned while parsing table, in a *ParseError
+// unless it already is one.
+func parseError(table string, err error) error {
+	var pe *ParseError
+	if err == nil || errors.As(err, &pe) {
+		return err
+	}
+	return &ParseError{Table: table, Reason: err.Error()}
+}
+
+// checkRange reports a *ParseError for table unless data holds n bytes at
+// off.
+func checkRange(table string, data []byte, off, n uint64) error {
+	if off > uint64(len(data)) || n > uint64(len(data))-off {
+		return &ParseError{Table: table, Offset: int64(off), Reason: fmt.Sprintf("%d bytes needed, %d available", n, uint64(len(data))-min(off, uint64(len(data))))}
+	}
+	return nil
+}
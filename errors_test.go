@@ -0,0 +1,192 @@
+package fontcompress_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+// tableOffset returns the offset of the table tagged tag in font.
+func tableOffset(font []byte, tag string) int {
+	numTables := int(binary.BigEndian.Uint16(font[4:]))
+	for i := 0; i < numTables; i++ {
+		if rec := font[12+16*i:]; string(rec[:4]) == tag {
+			return int(binary.BigEndian.Uint32(rec[8:]))
+		}
+	}
+	return -1
+}
+
+func TestParseErrors(t *testing.T) {
+	font := fixtureFont()
+	cmap := tableOffset(font, "cmap")
+	head := tableOffset(font, "head")
+	cmapTable := func(ttf *font_compress.TTF) error { _, err := ttf.Cmap(); return err }
+	headTable := func(ttf *font_compress.TTF) error { _, err := ttf.Head(); return err }
+	glyfTable := func(ttf *font_compress.TTF) error { _, err := ttf.Glyf(); return err }
+	maxpTable := func(ttf *font_compress.TTF) error { _, err := ttf.Maxp(); return err }
+	hmtxTable := func(ttf *font_compress.TTF) error { _, err := ttf.Hmtx(); return err }
+	nameTable := func(ttf *font_compress.TTF) error { _, err := ttf.Name(); return err }
+	os2Table := func(ttf *font_compress.TTF) error { _, err := ttf.OS2(); return err }
+	postTable := func(ttf *font_compress.TTF) error { _, err := ttf.Post(); return err }
+	vmtxTable := func(ttf *font_compress.TTF) error { _, err := ttf.Vmtx(); return err }
+	vorgTable := func(ttf *font_compress.TTF) error { _, err := ttf.Vorg(); return err }
+	gsubTable := func(ttf *font_compress.TTF) error { _, err := ttf.GSUB(); return err }
+	gposTable := func(ttf *font_compress.TTF) error { _, err := ttf.GPOS(); return err }
+	gdefTable := func(ttf *font_compress.TTF) error { _, err := ttf.GDEF(); return err }
+	vertical := assembleFont(font_compress.TTF_MAGIC, fixtureVerticalTables(fixtureTables()))
+	cffVertical := assembleFont(font_compress.OTF_MAGIC, fixtureVerticalTables(fixtureCFFTables(false)))
+	named := fixtureFontWith(map[string][]byte{"name": fixtureNameTable()})
+	os2 := fixtureFontWith(map[string][]byte{"OS/2": fixtureOS2Table(fixtureOS2)})
+	postNamed := fixtureFontWith(map[string][]byte{"post": fixturePostTable()})
+	gsub := fixtureFontWith(map[string][]byte{"GSUB": fixtureGSUB()})
+	gpos := fixtureFontWith(map[string][]byte{"GPOS": fixtureGPOS()})
+	gdef := fixtureFontWith(map[string][]byte{"GDEF": fixtureGDEF()})
+	for _, tt := range []struct {
+		name   string
+		font   []byte
+		decode func(*font_compress.TTF) error // nil if NewTTF fails
+		table  string
+		offset int64
+	}{
+		{"empty", nil, nil, "", 0},
+		{"truncated directory", font[:20], nil, "", 12},
+		{"table beyond the end", font[:head+10], nil, "head", 0},
+		{"cmap subtable offset", patchUint32(font, cmap+8, 0xFFFF), cmapTable, "cmap", 0xFFFF},
+		{"cmap subtable length", patchUint16(font, cmap+20+2, 0xFFF0), cmapTable, "cmap", 20},
+		{"cmap segCountX2", patchUint16(font, cmap+20+6, 0x1000), cmapTable, "cmap", 20},
+		{"head directory length", patchUint32(font, 12+16*tagIndex(font, "head")+12, 20), headTable, "head", 0},
+		{"head offset", patchUint32(font, 12+16*tagIndex(font, "head")+8, uint32(len(font)-8)), nil, "head", 0},
+		{"glyph", patchUint16(font, tableOffset(font, "glyf"), 0xFF), glyfTable, "glyf", 0},
+		{"loca shorter than maxp", patchUint16(font, tableOffset(font, "maxp")+4, 10), glyfTable, "loca", 16},
+		{"cmap glyph beyond maxp", patchUint16(font, tableOffset(font, "maxp")+4, 3), cmapTable, "cmap", 20},
+		{"hhea metrics beyond maxp", patchUint16(font, tableOffset(font, "hhea")+34, 8), hmtxTable, "hmtx", 0},
+		{"hmtx truncated", patchUint16(font, tableOffset(font, "hhea")+34, 7), hmtxTable, "hmtx", 0},
+		{"vhea metrics beyond maxp", patchUint16(vertical, tableOffset(vertical, "vhea")+34, 8), vmtxTable, "vmtx", 0},
+		{"VORG glyph beyond maxp", patchUint16(cffVertical, tableOffset(cffVertical, "VORG")+12, 7), vorgTable, "VORG", 12},
+		{"name string beyond the end", patchUint16(named, tableOffset(named, "name")+6+8, 0xFFFF), nameTable, "name", 6},
+		{"name format", patchUint16(named, tableOffset(named, "name"), 2), nameTable, "name", 0},
+		{"OS/2 version", patchUint16(os2, tableOffset(os2, "OS/2"), 6), os2Table, "OS/2", 0},
+		{"OS/2 truncated", patchUint16(os2, tableOffset(os2, "OS/2"), 5), os2Table, "OS/2", 0},
+		{"post version", patchUint16(postNamed, tableOffset(postNamed, "post"), 4), postTable, "post", 0},
+		{"post name index", patchUint16(postNamed, tableOffset(postNamed, "post")+34+2*6, 259), postTable, "post", 46},
+		{"GSUB version", patchUint16(gsub, tableOffset(gsub, "GSUB"), 2), gsubTable, "GSUB", 0},
+		{"GSUB lookup type", patchUint16(gsub, tableOffset(gsub, "GSUB")+132, 9), gsubTable, "GSUB", 140},
+		{"GPOS lookup type", patchUint16(gpos, tableOffset(gpos, "GPOS")+72, 10), gposTable, "GPOS", 80},
+		{"GPOS value format", patchUint16(gpos, tableOffset(gpos, "GPOS")+80+4, 0x100), gposTable, "GPOS", 84},
+		{"GDEF version", patchUint16(gdef, tableOffset(gdef, "GDEF")+2, 1), gdefTable, "GDEF", 0},
+		{"GDEF caret format", patchUint16(gdef, tableOffset(gdef, "GDEF")+68, 4), gdefTable, "GDEF", 68},
+		{"maxp version", patchUint32(font, tableOffset(font, "maxp"), 0x00020000), maxpTable, "maxp", 0},
+	} {
+		ttf, err := font_compress.NewTTF(writeFont(t, tt.font))
+		if tt.decode != nil {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+				continue
+			}
+			err = tt.decode(ttf)
+		}
+		var pe *font_compress.ParseError
+		if !errors.As(err, &pe) {
+			t.Errorf("%s: error %v is not a *ParseError", tt.name, err)
+			continue
+		}
+		if pe.Table != tt.table || pe.Offset != tt.offset {
+			t.Errorf("%s: error in table %q at %d, want %q at %d (%v)", tt.name, pe.Table, pe.Offset, tt.table, tt.offset, err)
+		}
+	}
+	if _, err := readFont(t, fontWithSubtable(nil)).Glyf(); err != nil {
+		t.Errorf("Glyf of a font with a broken cmap: %v", err)
+	}
+	ttf := readFont(t, assembleFont(font_compress.TTF_MAGIC, map[string][]byte{"head": fontTable(font, "head")}))
+	if _, err := ttf.Cmap(); !errors.Is(err, font_compress.ErrNoTable) {
+		t.Errorf("Cmap of a font without cmap: %v, want ErrNoTable", err)
+	}
+}
+
+// tagIndex returns the directory index of the table tagged tag in font.
+func tagIndex(font []byte, tag string) int {
+	numTables := int(binary.BigEndian.Uint16(font[4:]))
+	for i := 0; i < numTables; i++ {
+		if string(font[12+16*i:16+16*i]) == tag {
+			return i
+		}
+	}
+	return -1
+}
+
+func patchUint16(font []byte, off int, v uint16) []byte {
+	font = append([]byte(nil), font...)
+	binary.BigEndian.PutUint16(font[off:], v)
+	return font
+}
+
+func patchUint32(font []byte, off int, v uint32) []byte {
+	font = append([]byte(nil), font...)
+	binary.BigEndian.PutUint32(font[off:], v)
+	return font
+}
+
+func FuzzNewTTF(f *testing.F) {
+	font := fixtureFont()
+	f.Add(font)
+	f.Add(fixtureCFFFont(false))
+	f.Add(fixtureCFFFont(true))
+	f.Add(fontWithVariations())
+	f.Add(assembleFont(font_compress.OTF_MAGIC, fixtureVerticalTables(fixtureCFFTables(false))))
+	f.Add(fixtureFontWith(map[string][]byte{"name": fixtureNameTable()}))
+	f.Add(fixtureFontWith(map[string][]byte{"OS/2": fixtureOS2Table(fixtureOS2)}))
+	f.Add(fixtureFontWith(map[string][]byte{"post": fixturePostTable()}))
+	f.Add(fixtureFontWith(map[string][]byte{"GSUB": fixtureGSUB(), "OS/2": fixtureOS2Table(fixtureOS2)}))
+	f.Add(fixtureFontWith(map[string][]byte{"GPOS": fixtureGPOS(), "OS/2": fixtureOS2Table(fixtureOS2)}))
+	f.Add(fixtureFontWith(map[string][]byte{"GDEF": fixtureGDEF()}))
+	if woff, err := font_compress.EncodeWOFF(font); err == nil {
+		f.Add(woff)
+	}
+	if woff2, err := font_compress.EncodeWOFF2(font); err == nil {
+		f.Add(woff2)
+	}
+	path := filepath.Join(f.TempDir(), "font.ttf")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		ttf, err := font_compress.NewTTF(path)
+		if err != nil {
+			var pe *font_compress.ParseError
+			if !errors.As(err, &pe) && (len(data) < 4 || string(data[:4]) != "ttcf") {
+				t.Fatalf("error %v is not a *ParseError", err)
+			}
+			return
+		}
+		// tables are decoded on demand, with the same guarantees
+		for _, decode := range []func() error{
+			func() error { _, err := ttf.Cmap(); return err },
+			func() error { _, err := ttf.Head(); return err },
+			func() error { _, err := ttf.Glyf(); return err },
+			func() error { _, err := ttf.CFF(); return err },
+			func() error { _, err := ttf.Maxp(); return err },
+			func() error { _, err := ttf.Hmtx(); return err },
+			func() error { _, err := ttf.Vmtx(); return err },
+			func() error { _, err := ttf.Name(); return err },
+			func() error { _, err := ttf.OS2(); return err },
+			func() error { _, err := ttf.Post(); return err },
+			func() error { _, err := ttf.Vorg(); return err },
+			func() error { _, err := ttf.GSUB(); return err },
+			func() error { _, err := ttf.GPOS(); return err },
+			func() error { _, err := ttf.GDEF(); return err },
+		} {
+			var pe *font_compress.ParseError
+			if err := decode(); err != nil && !errors.As(err, &pe) && !errors.Is(err, font_compress.ErrNoTable) {
+				t.Fatalf("error %v is neither a *ParseError nor ErrNoTable", err)
+			}
+		}
+		// whatever parses must also survive writing and subsetting
+		ttf.Bytes()
+		font_compress.Subset(ttf, fixtureRunes())
+	})
+}
@@ -0,0 +1,435 @@
+package fontcompress_test
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+// fixtureGlyph describes one glyph of the fixture font: either a single
+// closed contour of on-curve points or a list of components.
+type fixtureGlyph struct {
+	points     [][2]int16
+	components []uint16
+}
+
+// fixtureGlyphs are the glyphs of the fixture font, indexed by glyph id.
+var fixtureGlyphs = []fixtureGlyph{
+	{points: [][2]int16{{0, 0}, {500, 0}, {500, 700}, {0, 700}}},     // .notdef
+	{points: [][2]int16{{0, 0}, {600, 0}, {300, 700}}},               // A
+	{points: [][2]int16{{100, 0}, {500, 0}, {500, 700}, {100, 700}}}, // B
+	{points: [][2]int16{{200, 800}, {400, 800}, {300, 900}}},         // dieresis
+	{components: []uint16{1, 3}},                                     // Adieresis
+	{points: [][2]int16{{50, 0}, {550, 0}, {300, 700}}},              // C
+	{points: [][2]int16{{0, 0}, {800, 0}, {800, 800}, {0, 800}}},     // U+20000
+}
+
+// fixtureCmap maps the characters of the fixture font to glyph ids.
+var fixtureCmap = map[rune]uint16{'A': 1, 'B': 2, 'C': 5, 'Ä': 4, 0x20000: 6}
+
+// fixtureRunes returns the characters of fixtureCmap in ascending order.
+func fixtureRunes() []rune {
+	runes := make([]rune, 0, len(fixtureCmap))
+	for r := range fixtureCmap {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool { return runes[i] < runes[j] })
+	return runes
+}
+
+// fixtureAdvances are the advance widths of the fixture glyphs; the last
+// two share the final long metric.
+var fixtureAdvances = []uint16{500, 600, 600, 600, 600}
+
+func glyphBounds(g fixtureGlyph) (xMin, yMin, xMax, yMax int16) {
+	points := g.points
+	for _, c := range g.components {
+		points = append(points, fixtureGlyphs[c].points...)
+	}
+	xMin, yMin, xMax, yMax = points[0][0], points[0][1], points[0][0], points[0][1]
+	for _, p := range points {
+		xMin, yMin = min(xMin, p[0]), min(yMin, p[1])
+		xMax, yMax = max(xMax, p[0]), max(yMax, p[1])
+	}
+	return
+}
+
+func appendInt16(b []byte, v ...int16) []byte {
+	for _, x := range v {
+		b = binary.BigEndian.AppendUint16(b, uint16(x))
+	}
+	return b
+}
+
+func encodeFixtureGlyph(g fixtureGlyph) []byte {
+	xMin, yMin, xMax, yMax := glyphBounds(g)
+	var b []byte
+	if len(g.components) > 0 {
+		b = appendInt16(b, -1, xMin, yMin, xMax, yMax)
+		for i, c := range g.components {
+			flags := uint16(0x0001 | 0x0002) // ARG_1_AND_2_ARE_WORDS | ARGS_ARE_XY_VALUES
+			if i < len(g.components)-1 {
+				flags |= 0x0020 // MORE_COMPONENTS
+			}
+			b = binary.BigEndian.AppendUint16(b, flags)
+			b = binary.BigEndian.AppendUint16(b, c)
+			b = appendInt16(b, 0, 0)
+		}
+		return b
+	}
+	b = appendInt16(b, 1, xMin, yMin, xMax, yMax)
+	b = appendInt16(b, int16(len(g.points)-1), 0)
+	for range g.points {
+		b = append(b, 0x01) // on curve, 16-bit deltas
+	}
+	var x, y int16
+	for _, p := range g.points {
+		b = appendInt16(b, p[0]-x)
+		x = p[0]
+	}
+	for _, p := range g.points {
+		b = appendInt16(b, p[1]-y)
+		y = p[1]
+	}
+	return b
+}
+
+// fixtureTables returns the tables of a small TrueType font covering
+// fixtureCmap, keyed by tag.
+func fixtureTables() map[string][]byte {
+	var glyf, loca []byte
+	for _, g := range fixtureGlyphs {
+		loca = binary.BigEndian.AppendUint16(loca, uint16(len(glyf)/2))
+		glyf = append(glyf, encodeFixtureGlyph(g)...)
+		if len(glyf)%2 != 0 {
+			glyf = append(glyf, 0)
+		}
+	}
+	loca = binary.BigEndian.AppendUint16(loca, uint16(len(glyf)/2))
+
+	head := binary.BigEndian.AppendUint32(nil, 0x00010000)
+	head = binary.BigEndian.AppendUint32(head, 0x00010000)
+	head = binary.BigEndian.AppendUint32(head, 0)
+	head = binary.BigEndian.AppendUint32(head, 0x5F0F3CF5)
+	head = binary.BigEndian.AppendUint16(head, 0x000B)
+	head = binary.BigEndian.AppendUint16(head, 1000)
+	head = append(head, make([]byte, 16)...)
+	head = appendInt16(head, 0, 0, 800, 900)
+	head = appendInt16(head, 0, 8, 2, 0, 0)
+
+	hhea := binary.BigEndian.AppendUint32(nil, 0x00010000)
+	hhea = appendInt16(hhea, 900, -200, 0, 600, 0, 0, 800, 1, 0, 0, 0, 0, 0, 0, 0)
+	hhea = binary.BigEndian.AppendUint16(hhea, uint16(len(fixtureAdvances)))
+
+	maxp := binary.BigEndian.AppendUint32(nil, 0x00010000)
+	maxp = binary.BigEndian.AppendUint16(maxp, uint16(len(fixtureGlyphs)))
+	maxp = appendInt16(maxp, 4, 1, 6, 2, 2, 0, 0, 0, 0, 0, 0, 2, 1)
+
+	var hmtx []byte
+	for gid, g := range fixtureGlyphs {
+		xMin, _, _, _ := glyphBounds(g)
+		if gid < len(fixtureAdvances) {
+			hmtx = binary.BigEndian.AppendUint16(hmtx, fixtureAdvances[gid])
+		}
+		hmtx = appendInt16(hmtx, xMin)
+	}
+
+	post := binary.BigEndian.AppendUint32(nil, 0x00030000)
+	post = append(post, make([]byte, 28)...)
+
+	return map[string][]byte{
+		"cmap": fixtureCmapTable(),
+		"glyf": glyf,
+		"head": head,
+		"hhea": hhea,
+		"hmtx": hmtx,
+		"loca": loca,
+		"maxp": maxp,
+		"post": post,
+	}
+}
+
+// fixtureCmapTable encodes the BMP part of fixtureCmap as a format 4
+// subtable with one segment per character, and all of it as a format 12
+// subtable.
+func fixtureCmapTable() []byte {
+	runes := fixtureRunes()
+
+	var ends, starts, deltas []uint16
+	for _, r := range runes {
+		if r <= 0xFFFF {
+			ends, starts = append(ends, uint16(r)), append(starts, uint16(r))
+			deltas = append(deltas, fixtureCmap[r]-uint16(r))
+		}
+	}
+	ends, starts, deltas = append(ends, 0xFFFF), append(starts, 0xFFFF), append(deltas, 1)
+	segCount := len(ends)
+	f4 := binary.BigEndian.AppendUint16(nil, 4)
+	f4 = binary.BigEndian.AppendUint16(f4, uint16(16+8*segCount))
+	f4 = binary.BigEndian.AppendUint16(f4, 0)
+	f4 = binary.BigEndian.AppendUint16(f4, uint16(2*segCount))
+	f4 = binary.BigEndian.AppendUint16(f4, 4)
+	f4 = binary.BigEndian.AppendUint16(f4, 1)
+	f4 = binary.BigEndian.AppendUint16(f4, uint16(2*segCount-4))
+	for _, list := range [][]uint16{ends, {0}, starts, deltas, make([]uint16, segCount)} {
+		for _, v := range list {
+			f4 = binary.BigEndian.AppendUint16(f4, v)
+		}
+	}
+
+	f12 := binary.BigEndian.AppendUint16(nil, 12)
+	f12 = binary.BigEndian.AppendUint16(f12, 0)
+	f12 = binary.BigEndian.AppendUint32(f12, uint32(16+12*len(runes)))
+	f12 = binary.BigEndian.AppendUint32(f12, 0)
+	f12 = binary.BigEndian.AppendUint32(f12, uint32(len(runes)))
+	for _, r := range runes {
+		f12 = binary.BigEndian.AppendUint32(f12, uint32(r))
+		f12 = binary.BigEndian.AppendUint32(f12, uint32(r))
+		f12 = binary.BigEndian.AppendUint32(f12, uint32(fixtureCmap[r]))
+	}
+
+	cmap := binary.BigEndian.AppendUint16(nil, 0)
+	cmap = binary.BigEndian.AppendUint16(cmap, 2)
+	cmap = binary.BigEndian.AppendUint16(cmap, 3)
+	cmap = binary.BigEndian.AppendUint16(cmap, 1)
+	cmap = binary.BigEndian.AppendUint32(cmap, 20)
+	cmap = binary.BigEndian.AppendUint16(cmap, 3)
+	cmap = binary.BigEndian.AppendUint16(cmap, 10)
+	cmap = binary.BigEndian.AppendUint32(cmap, uint32(20+len(f4)))
+	cmap = append(cmap, f4...)
+	return append(cmap, f12...)
+}
+
+// assembleFont lays tables out behind an sfnt header. Checksums are left
+// zero; the reader does not verify them.
+func assembleFont(scalerType uint32, tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return assembleFontInOrder(scalerType, tables, tags)
+}
+
+// assembleFontInOrder is assembleFont with the table data laid out in
+// order, which must hold every tag of tables.
+func assembleFontInOrder(scalerType uint32, tables map[string][]byte, order []string) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	font := binary.BigEndian.AppendUint32(nil, scalerType)
+	font = binary.BigEndian.AppendUint16(font, uint16(len(tags)))
+	font = append(font, make([]byte, 6+16*len(tags))...)
+	for _, tag := range order {
+		rec := font[12+16*sort.SearchStrings(tags, tag):]
+		copy(rec, tag)
+		binary.BigEndian.PutUint32(rec[8:], uint32(len(font)))
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(tables[tag])))
+		font = append(font, tables[tag]...)
+		font = append(font, make([]byte, (4-len(font)%4)%4)...)
+	}
+	return font
+}
+
+// fixtureTablesWithGlyph returns fixtureTables with the data of glyph gid
+// replaced by glyph.
+func fixtureTablesWithGlyph(gid int, glyph []byte) map[string][]byte {
+	tables := fixtureTables()
+	var glyf, loca []byte
+	for i, g := range fixtureGlyphs {
+		loca = binary.BigEndian.AppendUint16(loca, uint16(len(glyf)/2))
+		if i == gid {
+			glyf = append(glyf, glyph...)
+		} else {
+			glyf = append(glyf, encodeFixtureGlyph(g)...)
+		}
+		if len(glyf)%2 != 0 {
+			glyf = append(glyf, 0)
+		}
+	}
+	tables["glyf"], tables["loca"] = glyf, binary.BigEndian.AppendUint16(loca, uint16(len(glyf)/2))
+	return tables
+}
+
+// fixtureFont returns the fixture font as TrueType bytes.
+func fixtureFont() []byte {
+	return assembleFont(0x00010000, fixtureTables())
+}
+
+// fixtureFontWith returns the fixture font with tables added to, or
+// replacing, those of fixtureTables.
+func fixtureFontWith(tables map[string][]byte) []byte {
+	all := fixtureTables()
+	for tag, data := range tables {
+		all[tag] = data
+	}
+	return assembleFont(font_compress.TTF_MAGIC, all)
+}
+
+// writeFont stores font in a temporary file and returns its path.
+func writeFont(t *testing.T, font []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "font.ttf")
+	if err := os.WriteFile(path, font, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readFont parses font with ParseTTF.
+func readFont(t *testing.T, font []byte) *font_compress.TTF {
+	t.Helper()
+	ttf, err := font_compress.ParseTTF(font)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ttf
+}
+
+// fontTable returns the bytes of the table tagged tag in font, or nil.
+func fontTable(font []byte, tag string) []byte {
+	numTables := int(binary.BigEndian.Uint16(font[4:]))
+	for i := 0; i < numTables; i++ {
+		rec := font[12+16*i:]
+		if string(rec[:4]) == tag {
+			offset := binary.BigEndian.Uint32(rec[8:])
+			return font[offset : offset+binary.BigEndian.Uint32(rec[12:])]
+		}
+	}
+	return nil
+}
+
+// cffIndex encodes objects as a CFF INDEX with 2-byte offsets.
+func cffIndex(objects ...[]byte) []byte {
+	b := binary.BigEndian.AppendUint16(nil, uint16(len(objects)))
+	b = append(b, 2)
+	offset := 1
+	b = binary.BigEndian.AppendUint16(b, uint16(offset))
+	for _, o := range objects {
+		offset += len(o)
+		b = binary.BigEndian.AppendUint16(b, uint16(offset))
+	}
+	for _, o := range objects {
+		b = append(b, o...)
+	}
+	return b
+}
+
+// cffInt appends v as 5-byte CFF DICT integers.
+func cffInt(b []byte, v ...int) []byte {
+	for _, x := range v {
+		b = binary.BigEndian.AppendUint32(append(b, 29), uint32(x))
+	}
+	return b
+}
+
+// fixtureCFFTable returns a CFF table with the glyphs of the fixture font,
+// name-keyed or CID-keyed with two Font DICTs. The charstrings are distinct
+// placeholders, not real outlines.
+func fixtureCFFTable(cid bool) []byte {
+	charStrings := make([][]byte, len(fixtureGlyphs))
+	for gid := range charStrings {
+		charStrings[gid] = []byte{byte(139 + gid), 14} // width endchar
+	}
+	var strs [][]byte
+	var charset, fdSelect []byte
+	if cid {
+		strs = [][]byte{[]byte("Adobe"), []byte("Identity")}
+		charset = []byte{2, 0, 1, 0, byte(len(fixtureGlyphs) - 2)} // CIDs 1 to 6
+		fdSelect = []byte{3, 0, 2, 0, 0, 0, 0, 4, 1, 0, byte(len(fixtureGlyphs))}
+	} else {
+		strs = [][]byte{[]byte("u20000")}
+		charset = []byte{0}
+		for _, sid := range []uint16{34, 35, 131, 173, 36, 391} {
+			charset = binary.BigEndian.AppendUint16(charset, sid)
+		}
+	}
+
+	// defaultWidthX 500, Subrs right after the Private DICT
+	private := append(cffInt(nil, 500), 20)
+	private = append(cffInt(private, len(private)+6), 19)
+	subrs := cffIndex([]byte{11})
+	numPrivates := 1
+	if cid {
+		numPrivates = 2
+	}
+
+	fontMatrix := []byte{30, 0x0a, 0x00, 0x1f, 139, 139, 30, 0x0a, 0x00, 0x1f, 139, 139, 12, 7} // 0.001 0 0 0.001 0 0
+	topDict := func(charsetOff, fdSelectOff, charStringsOff, fdArrayOff, privateOff int) []byte {
+		var d []byte
+		if cid {
+			d = append(cffInt(nil, 391, 392), 139, 12, 30) // ROS Adobe Identity 0
+		}
+		d = append(d, fontMatrix...)
+		d = append(cffInt(d, charsetOff), 15)
+		d = append(cffInt(d, charStringsOff), 17)
+		if cid {
+			d = append(cffInt(d, fdArrayOff), 12, 36)
+			d = append(cffInt(d, fdSelectOff), 12, 37)
+		} else {
+			d = append(cffInt(d, len(private), privateOff), 18)
+		}
+		return d
+	}
+	fdArray := func(privateOff int) []byte {
+		var dicts [][]byte
+		for i := 0; i < numPrivates; i++ {
+			dicts = append(dicts, append(cffInt(nil, len(private), privateOff+i*(len(private)+len(subrs))), 18))
+		}
+		return cffIndex(dicts...)
+	}
+
+	header := []byte{1, 0, 4, 4}
+	name := cffIndex([]byte("Fixture"))
+	stringIndex := cffIndex(strs...)
+	gsubrs := cffIndex([]byte{11})
+	charStringIndex := cffIndex(charStrings...)
+	charsetOff := len(header) + len(name) + len(cffIndex(topDict(0, 0, 0, 0, 0))) + len(stringIndex) + len(gsubrs)
+	fdSelectOff := charsetOff + len(charset)
+	charStringsOff := fdSelectOff + len(fdSelect)
+	fdArrayOff := charStringsOff + len(charStringIndex)
+	privateOff := fdArrayOff
+	if cid {
+		privateOff += len(fdArray(0))
+	}
+
+	cff := append(header, name...)
+	cff = append(cff, cffIndex(topDict(charsetOff, fdSelectOff, charStringsOff, fdArrayOff, privateOff))...)
+	cff = append(cff, stringIndex...)
+	cff = append(cff, gsubrs...)
+	cff = append(cff, charset...)
+	cff = append(cff, fdSelect...)
+	cff = append(cff, charStringIndex...)
+	if cid {
+		cff = append(cff, fdArray(privateOff)...)
+	}
+	for i := 0; i < numPrivates; i++ {
+		cff = append(cff, private...)
+		cff = append(cff, subrs...)
+	}
+	return cff
+}
+
+// fixtureCFFTables returns the tables of the fixture font with CFF
+// outlines, keyed by tag.
+func fixtureCFFTables(cid bool) map[string][]byte {
+	tables := fixtureTables()
+	delete(tables, "glyf")
+	delete(tables, "loca")
+	tables["maxp"] = tables["maxp"][:6]
+	binary.BigEndian.PutUint32(tables["maxp"], 0x00005000)
+	tables["CFF "] = fixtureCFFTable(cid)
+	return tables
+}
+
+// fixtureCFFFont returns the fixture font with CFF outlines as OpenType
+// bytes.
+func fixtureCFFFont(cid bool) []byte {
+	return assembleFont(0x4F54544F, fixtureCFFTables(cid))
+}
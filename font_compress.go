@@ -1 +1,454 @@
 package fontcompress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// subsetPassThrough lists the tables that do not refer to glyph ids and are
+// copied unchanged into a subset font. Every other table is dropped.
+var subsetPassThrough = map[string]bool{
+	"name": true,
+	"cvt ": true,
+	"fpgm": true,
+	"prep": true,
+	"gasp": true,
+}
+
+// Subset builds a font that only contains the glyphs needed to render
+// runes. Glyph 0 (.notdef), the glyphs GSUB substitutes for retained ones,
+// such as ligatures and vertical forms, and the components of retained
+// composite glyphs are always kept; runes the font does not map are
+// ignored. Tables changed through their accessors, the outlines of Glyf
+// included, are subset as changed.
+//
+// The cmap, hmtx, maxp and hhea tables are rebuilt for the new glyph order
+// together with either loca and glyf or, for CFF fonts, the CFF table, and
+// so are vhea, vmtx and VORG when the font has them; the maxp maxima of
+// TrueType outlines are recomputed for the retained glyphs. post is cut down
+// to a version 3.0 table without glyph names unless
+// SubsetOptions.KeepGlyphNames is set. GSUB and GPOS keep their scripts,
+// features and lookups, with subtables pruned to the retained glyphs, and
+// GDEF keeps its class definitions, attachment points, ligature carets and
+// mark glyph sets for the retained glyphs; tables that reference glyph ids
+// without being rewritten (kern, ...) are dropped. CFF subroutines are kept
+// whole since charstrings are not interpreted.
+//
+// The Unicode ranges and first and last character indices of OS/2 are
+// recomputed for the retained characters. Fonts whose OS/2 fsType forbids
+// subsetting are refused with ErrSubsettingForbidden; SubsetWithOptions can
+// override that.
+func Subset(ttf *TTF, runes []rune) ([]byte, error) {
+	return SubsetWithOptions(ttf, runes, SubsetOptions{})
+}
+
+// SubsetOptions changes how SubsetWithOptions builds a subset font.
+type SubsetOptions struct {
+	// IgnoreEmbeddingPermissions subsets fonts whose OS/2 fsType has
+	// FS_TYPE_NO_SUBSETTING set or the usage permission
+	// FS_TYPE_RESTRICTED_LICENSE. The license of the font must permit it.
+	IgnoreEmbeddingPermissions bool
+	// KeepGlyphNames writes the names of the retained glyphs to a version
+	// 2.0 post table instead of the nameless version 3.0 one.
+	KeepGlyphNames bool
+}
+
+// SubsetWithOptions is Subset with options.
+func SubsetWithOptions(ttf *TTF, runes []rune, opts SubsetOptions) ([]byte, error) {
+	if ttf == nil || ttf.buf == nil {
+		return nil, errors.New("subset: font data is not loaded")
+	}
+	head := ttf.rawTable("head")
+	if len(head) < 54 {
+		return nil, errors.New("subset: missing or truncated head table")
+	}
+	maxp, err := ttf.Maxp()
+	if err != nil {
+		return nil, fmt.Errorf("subset: %w", err)
+	}
+	hhea, err := ttf.Hhea()
+	if err != nil {
+		return nil, fmt.Errorf("subset: %w", err)
+	}
+	hmtx, err := ttf.Hmtx()
+	if err != nil {
+		return nil, fmt.Errorf("subset: %w", err)
+	}
+	// vertical metrics are optional
+	vmtx, err := ttf.Vmtx()
+	hasVmtx := err == nil
+	if err != nil && !errors.Is(err, ErrNoTable) {
+		return nil, fmt.Errorf("subset: %w", err)
+	}
+	post, err := ttf.Post()
+	hasPost := err == nil
+	if err != nil && !errors.Is(err, ErrNoTable) {
+		return nil, fmt.Errorf("subset: %w", err)
+	}
+	os2, err := ttf.OS2()
+	hasOS2 := err == nil
+	if err != nil && !errors.Is(err, ErrNoTable) {
+		return nil, fmt.Errorf("subset: %w", err)
+	}
+	if hasOS2 && !os2.SubsettingAllowed() && !opts.IgnoreEmbeddingPermissions {
+		return nil, fmt.Errorf("subset: %w (fsType %#04x)", ErrSubsettingForbidden, os2.FsType)
+	}
+	vorg, err := ttf.Vorg()
+	hasVorg := err == nil
+	if err != nil && !errors.Is(err, ErrNoTable) {
+		return nil, fmt.Errorf("subset: %w", err)
+	}
+	gsub, err := ttf.GSUB()
+	hasGSUB := err == nil
+	if err != nil && !errors.Is(err, ErrNoTable) {
+		return nil, fmt.Errorf("subset: %w", err)
+	}
+	gpos, err := ttf.GPOS()
+	hasGPOS := err == nil
+	if err != nil && !errors.Is(err, ErrNoTable) {
+		return nil, fmt.Errorf("subset: %w", err)
+	}
+	gdef, err := ttf.GDEF()
+	hasGDEF := err == nil
+	if err != nil && !errors.Is(err, ErrNoTable) {
+		return nil, fmt.Errorf("subset: %w", err)
+	}
+	cmap, err := ttf.Cmap()
+	if err != nil {
+		return nil, fmt.Errorf("subset: %w", err)
+	}
+	numGlyphs := int(maxp.NumGlyphs)
+
+	// glyph data of TrueType outlines; nil for CFF fonts
+	var glyphData func(gid uint16) []byte
+	var cff CFFTable
+	glyf, loca := ttf.rawTable("glyf"), ttf.rawTable("loca")
+	var offsets []uint32
+	// outlines changed through Glyf are subset as changed
+	if ti := ttf.tableInfo(tagGlyf); ti != nil && ttf.asRead().changed(*ti) {
+		if decoded, ok := ti.Table.(GlyfTable); ok {
+			glyf, offsets = decoded.encode()
+		}
+	} else if glyf != nil && loca != nil {
+		locaTable, err := readLocaTable(loca, int16(binary.BigEndian.Uint16(head[50:])))
+		if err != nil {
+			return nil, err
+		}
+		offsets = locaTable.Offsets
+	}
+	switch {
+	case offsets != nil:
+		if len(offsets) <= numGlyphs || offsets[numGlyphs] > uint32(len(glyf)) {
+			return nil, errors.New("subset: loca table does not match the glyph count")
+		}
+		glyphData = func(gid uint16) []byte {
+			return glyf[offsets[gid]:offsets[gid+1]]
+		}
+	case ttf.rawTable("CFF ") != nil:
+		var err error
+		if cff, err = ttf.CFF(); err != nil {
+			return nil, err
+		}
+		if cff.NumGlyphs() != numGlyphs {
+			return nil, errors.New("subset: cff table does not match the glyph count")
+		}
+	default:
+		return nil, errors.New("subset: font has no TrueType or CFF outlines")
+	}
+	if cmap.UnicodeSubtable() == nil {
+		return nil, errors.New("subset: no supported Unicode cmap subtable")
+	}
+
+	// glyphs reachable from the requested runes and their variation
+	// sequences, then those GSUB substitutes for them, then their
+	// components
+	mapping := make(map[rune]uint16)
+	keep := map[uint16]bool{0: true}
+	for _, r := range runes {
+		if gid, ok := cmap.Lookup(r); ok && int(gid) < numGlyphs {
+			mapping[r] = gid
+			keep[gid] = true
+		}
+	}
+	uvs := cmap.VariationSubtable()
+	if uvs != nil {
+		for _, record := range uvs.VarSelectors {
+			for _, m := range record.NonDefaultUVS {
+				if _, ok := mapping[rune(m.UnicodeValue)]; ok && int(m.GlyphID) < numGlyphs {
+					keep[m.GlyphID] = true
+				}
+			}
+		}
+	}
+	if hasGSUB {
+		gsub.closure(keep, numGlyphs)
+	}
+	stack := make([]uint16, 0, len(keep))
+	for gid := range keep {
+		stack = append(stack, gid)
+	}
+	for glyphData != nil && len(stack) > 0 {
+		gid := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		refs, _, err := compositeComponents(glyphData(gid))
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range refs {
+			component := binary.BigEndian.Uint16(glyphData(gid)[ref:])
+			if int(component) >= numGlyphs {
+				return nil, errors.New("subset: composite glyph references a missing glyph")
+			}
+			if !keep[component] {
+				keep[component] = true
+				stack = append(stack, component)
+			}
+		}
+	}
+
+	// retained glyphs keep their relative order
+	order := make([]uint16, 0, len(keep))
+	for gid := range keep {
+		order = append(order, gid)
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i] < order[j] })
+	newID := make(map[uint16]uint16, len(order))
+	for i, gid := range order {
+		newID[gid] = uint16(i)
+	}
+
+	tables := make(map[string][]byte)
+	scalerType := TTF_MAGIC
+	if glyphData != nil {
+		// glyf and loca
+		newGlyf := make([]byte, 0, len(glyf))
+		newOffsets := make([]uint32, 0, len(order)+1)
+		for _, gid := range order {
+			newOffsets = append(newOffsets, uint32(len(newGlyf)))
+			data := glyphData(gid)
+			start := len(newGlyf)
+			newGlyf = append(newGlyf, data...)
+			refs, _, _ := compositeComponents(data)
+			for _, ref := range refs {
+				component := binary.BigEndian.Uint16(data[ref:])
+				binary.BigEndian.PutUint16(newGlyf[start+ref:], newID[component])
+			}
+			if len(newGlyf)%2 != 0 {
+				newGlyf = append(newGlyf, 0)
+			}
+		}
+		newOffsets = append(newOffsets, uint32(len(newGlyf)))
+		var newLoca []byte
+		locaFormat := uint16(0)
+		if len(newGlyf)/2 <= 0xFFFF {
+			newLoca = make([]byte, 2*len(newOffsets))
+			for i, off := range newOffsets {
+				binary.BigEndian.PutUint16(newLoca[2*i:], uint16(off/2))
+			}
+		} else {
+			locaFormat = 1
+			newLoca = make([]byte, 4*len(newOffsets))
+			for i, off := range newOffsets {
+				binary.BigEndian.PutUint32(newLoca[4*i:], off)
+			}
+		}
+		newHead := append([]byte(nil), head...)
+		binary.BigEndian.PutUint16(newHead[50:], locaFormat)
+		tables["head"], tables["loca"], tables["glyf"] = newHead, newLoca, newGlyf
+	} else {
+		// CFF charstrings, charset and FDSelect follow the new glyph order
+		newCFF := cff
+		newCFF.CharStrings = make([][]byte, len(order))
+		newCFF.Charset = make([]uint16, len(order))
+		if cff.IsCIDKeyed() {
+			newCFF.FDSelect = make([]uint8, len(order))
+		}
+		for i, gid := range order {
+			newCFF.CharStrings[i] = cff.CharStrings[gid]
+			newCFF.Charset[i] = cff.Charset[gid]
+			if cff.IsCIDKeyed() {
+				newCFF.FDSelect[i] = cff.FDSelect[gid]
+			}
+		}
+		data, err := newCFF.encode()
+		if err != nil {
+			return nil, err
+		}
+		tables["head"], tables["CFF "] = head, data
+		scalerType = OTF_MAGIC
+	}
+
+	// hmtx and hhea
+	newHmtx := hmtx.subset(order)
+	hhea.NumberOfHMetrics = uint16(len(newHmtx.HMetrics))
+	hhea.AdvanceWidthMax = 0
+	for _, gid := range order {
+		hhea.AdvanceWidthMax = max(hhea.AdvanceWidthMax, hmtx.Metric(gid).AdvanceWidth)
+	}
+	// the extents need glyph bounds; CFF fonts keep those of the full font
+	if glyphData != nil {
+		minLSB, minRSB, xMaxExtent := int16(0x7FFF), int16(0x7FFF), int16(-0x8000)
+		hasContours := false
+		for _, gid := range order {
+			data := glyphData(gid)
+			if len(data) < 10 {
+				continue
+			}
+			hasContours = true
+			xMin := int16(binary.BigEndian.Uint16(data[2:]))
+			xMax := int16(binary.BigEndian.Uint16(data[6:]))
+			m := hmtx.Metric(gid)
+			minLSB = min(minLSB, m.Lsb)
+			minRSB = min(minRSB, int16(m.AdvanceWidth)-m.Lsb-(xMax-xMin))
+			xMaxExtent = max(xMaxExtent, m.Lsb+(xMax-xMin))
+		}
+		if !hasContours {
+			minLSB, minRSB, xMaxExtent = 0, 0, 0
+		}
+		hhea.MinLeftSideBearing, hhea.MinRightSideBearing, hhea.XMaxExtent = minLSB, minRSB, xMaxExtent
+	}
+
+	// vmtx and vhea, likewise
+	if hasVmtx {
+		vhea, err := ttf.Vhea()
+		if err != nil {
+			return nil, fmt.Errorf("subset: %w", err)
+		}
+		newVmtx := vmtx.subset(order)
+		vhea.NumOfLongVerMetrics = uint16(len(newVmtx.VMetrics))
+		vhea.AdvanceHeightMax = 0
+		for _, gid := range order {
+			vhea.AdvanceHeightMax = max(vhea.AdvanceHeightMax, vmtx.Metric(gid).AdvanceHeight)
+		}
+		if glyphData != nil {
+			minTSB, minBSB, yMaxExtent := int16(0x7FFF), int16(0x7FFF), int16(-0x8000)
+			hasContours := false
+			for _, gid := range order {
+				data := glyphData(gid)
+				if len(data) < 10 {
+					continue
+				}
+				hasContours = true
+				yMin := int16(binary.BigEndian.Uint16(data[4:]))
+				yMax := int16(binary.BigEndian.Uint16(data[8:]))
+				m := vmtx.Metric(gid)
+				minTSB = min(minTSB, m.TopSideBearing)
+				minBSB = min(minBSB, int16(m.AdvanceHeight)-m.TopSideBearing-(yMax-yMin))
+				yMaxExtent = max(yMaxExtent, m.TopSideBearing+(yMax-yMin))
+			}
+			if !hasContours {
+				minTSB, minBSB, yMaxExtent = 0, 0, 0
+			}
+			vhea.MinTopSideBearing, vhea.MinBottomSideBearing, vhea.YMaxExtent = minTSB, minBSB, yMaxExtent
+		}
+		if tables["vhea"], err = vhea.encode(); err != nil {
+			return nil, err
+		}
+		if tables["vmtx"], err = newVmtx.encode(); err != nil {
+			return nil, err
+		}
+	}
+	if hasVorg {
+		if tables["VORG"], err = vorg.subset(newID).encode(); err != nil {
+			return nil, err
+		}
+	}
+
+	// maxp, cmap
+	maxp.NumGlyphs = uint16(len(order))
+	if glyphData != nil && maxp.Version == MAXP_VERSION_1_0 {
+		if err := maxp.setGlyphMaxima(order, glyphData); err != nil {
+			return nil, fmt.Errorf("subset: %w", err)
+		}
+	}
+	newMaxp, err := maxp.encode()
+	if err != nil {
+		return nil, err
+	}
+	newMapping := make(map[rune]uint16, len(mapping))
+	for r, gid := range mapping {
+		newMapping[r] = newID[gid]
+	}
+	newCmapTable, err := NewCmapTable(newMapping)
+	if err != nil {
+		return nil, err
+	}
+	if uvs != nil {
+		// (0, 5) sorts between the Unicode BMP and full repertoire records
+		// and those of the Windows platform
+		if sub := uvs.subsetVariations(mapping, newID); len(sub.VarSelectors) > 0 {
+			sub.PlatformID, sub.EncodingID = 0, 5
+			subtables := newCmapTable.EncodingSubtables
+			i := sort.Search(len(subtables), func(i int) bool { return subtables[i].PlatformID > 0 })
+			subtables = append(subtables[:i], append([]CmapSubTable{sub}, subtables[i:]...)...)
+			newCmapTable.EncodingSubtables = subtables
+			newCmapTable.NumberSubtables = uint16(len(subtables))
+		}
+	}
+	newCmap, err := newCmapTable.encode()
+	if err != nil {
+		return nil, err
+	}
+	if tables["hhea"], err = hhea.encode(); err != nil {
+		return nil, err
+	}
+	if tables["hmtx"], err = newHmtx.encode(); err != nil {
+		return nil, err
+	}
+	tables["maxp"], tables["cmap"] = newMaxp, newCmap
+
+	// GSUB substitutes and GPOS positions the retained glyphs, which GDEF
+	// classifies for both
+	if hasGSUB {
+		gsub = gsub.subset(newID)
+		if tables["GSUB"], err = gsub.encode(); err != nil {
+			return nil, err
+		}
+	}
+	if hasGPOS {
+		gpos = gpos.subset(newID)
+		if tables["GPOS"], err = gpos.encode(); err != nil {
+			return nil, err
+		}
+	}
+	if hasGDEF {
+		if tables["GDEF"], err = gdef.subset(newID).encode(); err != nil {
+			return nil, err
+		}
+	}
+
+	// OS/2 describes the retained characters and the context of the
+	// retained layout features
+	if hasOS2 {
+		chars := make([]rune, 0, len(mapping))
+		for r := range mapping {
+			chars = append(chars, r)
+		}
+		os2.setCharacters(chars)
+		os2.MaxContext = 0
+		if hasGSUB {
+			os2.MaxContext = uint16(gsub.MaxContext())
+		}
+		if hasGPOS {
+			os2.MaxContext = max(os2.MaxContext, uint16(gpos.MaxContext()))
+		}
+		if tables["OS/2"], err = os2.encode(); err != nil {
+			return nil, err
+		}
+	}
+
+	// glyph names follow the new glyph order
+	if hasPost {
+		if tables["post"], err = post.subset(order, opts.KeepGlyphNames).encode(); err != nil {
+			return nil, err
+		}
+	}
+	for tag := range subsetPassThrough {
+		if data := ttf.rawTable(tag); data != nil {
+			tables[tag] = data
+		}
+	}
+	return buildSFNT(scalerType, tables, nil), nil
+}
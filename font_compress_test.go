@@ -1,15 +1,26 @@
 package fontcompress_test
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"reflect"
 	"testing"
+	"testing/fstest"
 
 	font_compress "github.com/RustynailPlease/fontcompress"
 )
 
 func TestReadTTFInfo(t *testing.T) {
-	ttf, err := font_compress.NewTTF("./fonts/LXGWWenKai-Regular.ttf")
+	const fileName = "./fonts/LXGWWenKai-Regular.ttf"
+	if _, err := os.Stat(fileName); errors.Is(err, fs.ErrNotExist) {
+		t.Skip(fileName, "is not available")
+	}
+	ttf, err := font_compress.NewTTF(fileName)
 	if err != nil {
-		t.Error(err.Error())
+		t.Fatal(err.Error())
 	}
 	// t.Log("ttf tables:", ttf.Tables)
 	t.Log("ttf scaler type:", ttf.ScalerType)
@@ -26,7 +37,7 @@ func TestReadTTFInfo(t *testing.T) {
 		t.Log("table length:", table.Length)
 		switch font_compress.PrintTagName(table.Tag) {
 		case "cmap":
-			cmap := table.Table.(font_compress.CmapTable)
+			cmap := *cmapTable(t, ttf)
 			t.Log("cmap version:", cmap.Version)
 			for _, sub := range cmap.EncodingSubtables {
 				t.Log("cmap subtable platform ID:", sub.PlatformID)
@@ -36,7 +47,10 @@ func TestReadTTFInfo(t *testing.T) {
 			}
 			break
 		case "head":
-			head := table.Table.(font_compress.HeadTable)
+			head, err := ttf.Head()
+			if err != nil {
+				t.Fatal(err)
+			}
 			t.Log("head version:", head.Version)
 			t.Log("head font revision:", head.FontRevision)
 			t.Log("head check sum adjustment:", head.CheckSumAdjustment)
@@ -60,3 +74,193 @@ func TestReadTTFInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestSubset(t *testing.T) {
+	ttf, err := font_compress.NewTTF(writeFont(t, fixtureFont()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := font_compress.Subset(ttf, []rune("ÄÄz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sum uint32
+	for i := 0; i+4 <= len(out); i += 4 {
+		sum += binary.BigEndian.Uint32(out[i:])
+	}
+	if sum != 0xB1B0AFBA {
+		t.Errorf("font checksum = %#x, want 0xb1b0afba", sum)
+	}
+	// .notdef, A, dieresis and Adieresis
+	if n := binary.BigEndian.Uint16(fontTable(out, "maxp")[4:]); n != 4 {
+		t.Errorf("numGlyphs = %d, want 4", n)
+	}
+	loca := fontTable(out, "loca")
+	glyf := fontTable(out, "glyf")
+	composite := glyf[2*binary.BigEndian.Uint16(loca[6:]) : 2*binary.BigEndian.Uint16(loca[8:])]
+	if first, second := binary.BigEndian.Uint16(composite[12:]), binary.BigEndian.Uint16(composite[20:]); first != 1 || second != 2 {
+		t.Errorf("composite components = %d, %d, want 1, 2", first, second)
+	}
+	hhea := fontTable(out, "hhea")
+	if n := binary.BigEndian.Uint16(hhea[34:]); n != 2 {
+		t.Errorf("numberOfHMetrics = %d, want 2", n)
+	}
+	if n := len(fontTable(out, "hmtx")); n != 2*4+2*2 {
+		t.Errorf("hmtx length = %d, want 12", n)
+	}
+
+	subset, err := font_compress.NewTTF(writeFont(t, out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmap := cmapTable(t, subset); len(cmap.EncodingSubtables) != 2 || cmap.EncodingSubtables[0].Format != 4 {
+		t.Errorf("cmap subtables = %+v, want two format 4 records", cmap.EncodingSubtables)
+	}
+
+	// glyph names are dropped
+	out, err = font_compress.Subset(readFont(t, fixtureFontWith(map[string][]byte{"post": fixturePostTable()})), []rune("ÄÄz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post := fontTable(out, "post"); len(post) != 32 || binary.BigEndian.Uint32(post) != font_compress.POST_VERSION_3_0 {
+		t.Errorf("post of the subset = %x, want a version 3.0 header", post)
+	}
+}
+
+func TestSubsetChangedGlyf(t *testing.T) {
+	ttf := readFont(t, fixtureFont())
+	glyf := glyfTable(t, ttf)
+	glyf.Glyphs = append([]font_compress.Glyph(nil), glyf.Glyphs...)
+	a := glyf.Glyphs[1]
+	a.Points = append([]font_compress.GlyphPoint(nil), a.Points...)
+	for i := range a.Points {
+		a.Points[i].X += 10
+	}
+	a.XMin, a.XMax = a.XMin+10, a.XMax+10
+	glyf.Glyphs[1] = a
+	replaceTable(ttf, glyf)
+
+	out, err := font_compress.Subset(ttf, []rune("A"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := glyfTable(t, readFont(t, out)).Glyphs[1]; !reflect.DeepEqual(got.Points, a.Points) {
+		t.Errorf("glyph A of the subset has points %v, want %v", got.Points, a.Points)
+	}
+}
+
+func TestParseTTF(t *testing.T) {
+	font := fixtureFont()
+	want, err := font_compress.NewTTF(writeFont(t, font))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want.File == "" {
+		t.Error("NewTTF leaves File empty")
+	}
+	// Bytes updates the table directory, so it is compared on a copy
+	wantBytes, err := readFont(t, font).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{"fonts/fixture.ttf": {Data: font}}
+	for _, tt := range []struct {
+		name string
+		file string
+		open func() (*font_compress.TTF, error)
+	}{
+		{"ParseTTF", "", func() (*font_compress.TTF, error) { return font_compress.ParseTTF(font) }},
+		{"ReadTTF", "", func() (*font_compress.TTF, error) { return font_compress.ReadTTF(bytes.NewReader(font)) }},
+		{"OpenTTF", "fonts/fixture.ttf", func() (*font_compress.TTF, error) { return font_compress.OpenTTF(fsys, "fonts/fixture.ttf") }},
+	} {
+		ttf, err := tt.open()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if ttf.File != tt.file {
+			t.Errorf("%s: File = %q, want %q", tt.name, ttf.File, tt.file)
+		}
+		if !reflect.DeepEqual(ttf.Tables, want.Tables) {
+			t.Errorf("%s: tables differ from NewTTF", tt.name)
+		}
+		if out, err := ttf.Bytes(); err != nil || !bytes.Equal(out, wantBytes) {
+			t.Errorf("%s: Bytes differ from NewTTF (%v)", tt.name, err)
+		}
+	}
+	if _, err := font_compress.OpenTTF(fsys, "missing.ttf"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("OpenTTF of a missing file: %v, want fs.ErrNotExist", err)
+	}
+}
+
+func TestLazyDecoding(t *testing.T) {
+	ttf := readFont(t, fixtureFont())
+	decoded := func() map[string]bool {
+		tags := make(map[string]bool)
+		for _, table := range ttf.Tables {
+			if table.Table != nil {
+				tags[font_compress.PrintTagName(table.Tag)] = true
+			}
+		}
+		return tags
+	}
+	if len(ttf.Tables) != 8 || len(decoded()) != 0 {
+		t.Fatalf("%d tables with %v decoded, want 8 with none decoded", len(ttf.Tables), decoded())
+	}
+	glyf, err := ttf.Glyf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]bool{"head": true, "loca": true, "glyf": true, "maxp": true}; !reflect.DeepEqual(decoded(), want) {
+		t.Errorf("Glyf decoded %v, want %v", decoded(), want)
+	}
+	// later calls return the cached table
+	glyf.Glyphs[1].XMin = 42
+	if again, _ := ttf.Glyf(); again.Glyphs[1].XMin != 42 {
+		t.Error("Glyf decoded the table again")
+	}
+}
+
+func TestTable(t *testing.T) {
+	ttf := readFont(t, fixtureFont())
+	for _, tag := range []string{"cmap", "head", "loca", "glyf", "maxp", "hhea", "hmtx", "post"} {
+		table, err := ttf.Table(tag)
+		if err != nil {
+			t.Errorf("Table(%q): %v", tag, err)
+			continue
+		}
+		if table.Tag().String() != tag {
+			t.Errorf("Table(%q) is a %T tagged %q", tag, table, table.Tag())
+		}
+	}
+	if table, err := ttf.Table("cmap"); err != nil || !reflect.DeepEqual(table, *cmapTable(t, ttf)) {
+		t.Errorf("Table(\"cmap\") = %v, %v, want the table returned by Cmap", table, err)
+	}
+	if _, err := ttf.Table("CFF"); !errors.Is(err, font_compress.ErrNoTable) {
+		t.Errorf("Table(\"CFF\") of a TrueType font: %v, want ErrNoTable", err)
+	}
+	// tables without a parser are returned as they are
+	tables := fixtureTables()
+	tables["cvt "] = appendInt16(nil, 0, 50, 700)
+	if table, err := readFont(t, assembleFont(font_compress.TTF_MAGIC, tables)).Table("cvt"); err != nil {
+		t.Errorf("Table(\"cvt\"): %v", err)
+	} else if raw, ok := table.(font_compress.RawTable); !ok || !bytes.Equal(raw.Data, tables["cvt "]) {
+		t.Errorf("Table(\"cvt\") = %v, want the raw table", table)
+	}
+	if _, err := ttf.Table("cmap\x00"); err == nil {
+		t.Error("Table of an invalid tag succeeded")
+	}
+
+	cff := readFont(t, assembleFont(font_compress.OTF_MAGIC, fixtureVerticalTables(fixtureCFFTables(false))))
+	if table, err := cff.Table("CFF"); err != nil {
+		t.Errorf("Table(\"CFF\"): %v", err)
+	} else if _, ok := table.(font_compress.CFFTable); !ok {
+		t.Errorf("Table(\"CFF\") is a %T", table)
+	}
+	for _, tag := range []string{"vhea", "vmtx", "VORG"} {
+		if table, err := cff.Table(tag); err != nil || table.Tag().String() != tag {
+			t.Errorf("Table(%q) = %T, %v", tag, table, err)
+		}
+	}
+}
@@ -0,0 +1,480 @@
+package fontcompress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// glyph classes of the GDEF glyph class definition
+const (
+	GLYPH_CLASS_BASE      uint16 = 1 // single character, spacing glyph
+	GLYPH_CLASS_LIGATURE  uint16 = 2 // multiple character, spacing glyph
+	GLYPH_CLASS_MARK      uint16 = 3 // non-spacing combining glyph
+	GLYPH_CLASS_COMPONENT uint16 = 4 // part of a single character, spacing glyph
+)
+
+/*
+*
+uint16	majorVersion	Major version of the GDEF table, = 1
+uint16	minorVersion	Minor version of the GDEF table, = 0, 2 or 3
+Offset16	glyphClassDefOffset	Offset to class definition table for glyph type, from beginning of GDEF header (may be NULL)
+Offset16	attachListOffset	Offset to attachment point list table, from beginning of GDEF header (may be NULL)
+Offset16	ligCaretListOffset	Offset to ligature caret list table, from beginning of GDEF header (may be NULL)
+Offset16	markAttachClassDefOffset	Offset to class definition table for mark attachment type, from beginning of GDEF header (may be NULL)
+
+version 1.2:
+Offset16	markGlyphSetsDefOffset	Offset to the table of mark glyph set definitions, from beginning of GDEF header (may be NULL)
+
+version 1.3:
+Offset32	itemVarStoreOffset	Offset to the Item Variation Store table, from beginning of GDEF header (may be NULL)
+*/
+// GDEF — Glyph Definition. Tables the font does not have are nil.
+type GDEFTable struct {
+	MajorVersion uint16
+	MinorVersion uint16
+	// GlyphClassDef assigns glyphs to the GLYPH_CLASS_* classes.
+	GlyphClassDef ClassDef
+	// AttachList holds the contour points of the attachment points of
+	// glyphs, by glyph.
+	AttachList map[uint16][]uint16
+	// LigCaretList holds the caret positions between the components of
+	// ligatures, by glyph.
+	LigCaretList map[uint16][]CaretValue
+	// MarkAttachClassDef assigns marks to the classes that the
+	// LOOKUP_FLAG_MARK_ATTACHMENT_TYPE bits of lookup flags select.
+	MarkAttachClassDef ClassDef
+	// MarkGlyphSets are the mark sets lookups filter marks with; version 1.2.
+	MarkGlyphSets []Coverage
+	// ItemVarStore is the raw item variation store of variable fonts,
+	// from its offset to the end of the table; version 1.3.
+	ItemVarStore []byte
+}
+
+// CaretValue is the position of a ligature caret.
+type CaretValue struct {
+	Format     uint16 // 1: coordinate, 2: contour point, 3: coordinate and device table
+	Coordinate int16  // formats 1 and 3, in design units
+	PointIndex uint16 // format 2, the contour point of the glyph outline
+	Device     []byte // format 3, the raw device table; nil if none
+}
+
+func (GDEFTable) Tag() Tag { return tagGDEF }
+
+// GlyphClass returns the GLYPH_CLASS_* class of glyph gid; 0 if the table
+// does not classify it.
+func (gdef GDEFTable) GlyphClass(gid uint16) uint16 {
+	return gdef.GlyphClassDef[gid]
+}
+
+// read GDEF table
+func readGDEFTable(data []byte) (TTFTable, error) {
+	r := newLayoutReader("GDEF", data)
+	if err := r.check(0, 12); err != nil {
+		return nil, err
+	}
+	gdef := GDEFTable{MajorVersion: r.u16(0), MinorVersion: r.u16(2)}
+	if gdef.MajorVersion != 1 || (gdef.MinorVersion != 0 && gdef.MinorVersion != 2 && gdef.MinorVersion != 3) {
+		return nil, &ParseError{Table: "GDEF", Reason: fmt.Sprintf("unsupported version %d.%d", gdef.MajorVersion, gdef.MinorVersion)}
+	}
+	var err error
+	if off := int(r.u16(4)); off != 0 {
+		if gdef.GlyphClassDef, err = r.classDef(off); err != nil {
+			return nil, err
+		}
+	}
+	if off := int(r.u16(6)); off != 0 {
+		if gdef.AttachList, err = r.attachList(off); err != nil {
+			return nil, err
+		}
+	}
+	if off := int(r.u16(8)); off != 0 {
+		if gdef.LigCaretList, err = r.ligCaretList(off); err != nil {
+			return nil, err
+		}
+	}
+	if off := int(r.u16(10)); off != 0 {
+		if gdef.MarkAttachClassDef, err = r.classDef(off); err != nil {
+			return nil, err
+		}
+	}
+	if gdef.MinorVersion >= 2 {
+		if err := r.check(12, 2); err != nil {
+			return nil, err
+		}
+		if off := int(r.u16(12)); off != 0 {
+			if gdef.MarkGlyphSets, err = r.markGlyphSets(off); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if gdef.MinorVersion >= 3 {
+		if err := r.check(14, 4); err != nil {
+			return nil, err
+		}
+		if off := int(r.u32(14)); off != 0 {
+			if err := r.check(off, 8); err != nil {
+				return nil, err
+			}
+			gdef.ItemVarStore = append([]byte(nil), data[off:]...)
+		}
+	}
+	return gdef, nil
+}
+
+/*
+*
+Offset16	coverageOffset	Offset to Coverage table, from beginning of the AttachList (LigCaretList) table
+uint16	glyphCount	Number of glyphs with attachment points (ligatures)
+Offset16	offsets[glyphCount]	Array of offsets to AttachPoint (LigGlyph) tables, from beginning of the list, in Coverage Index order
+
+AttachPoint: uint16 pointCount, uint16 pointIndices[pointCount] in increasing numerical order
+LigGlyph: uint16 caretCount, Offset16 caretValueOffsets[caretCount] from beginning of the LigGlyph table, in increasing coordinate order
+*/
+// glyphList reads the coverage of an attach or ligature caret list at off
+// and the offsets of the tables of its glyphs, -1 if null.
+func (r *layoutReader) glyphList(off int) (Coverage, []int, error) {
+	if err := r.check(off, 4); err != nil {
+		return nil, nil, err
+	}
+	cov, err := r.coverage(off + int(r.u16(off)))
+	if err != nil {
+		return nil, nil, err
+	}
+	offs, err := r.offsets(off, off+4, int(r.u16(off+2)))
+	if err != nil {
+		return nil, nil, err
+	}
+	return cov, offs, nil
+}
+
+func (r *layoutReader) attachList(off int) (map[uint16][]uint16, error) {
+	cov, offs, err := r.glyphList(off)
+	if err != nil {
+		return nil, err
+	}
+	points := make(map[uint16][]uint16, len(cov))
+	for i := 0; i < len(cov) && i < len(offs); i++ {
+		if offs[i] < 0 {
+			continue
+		}
+		if err := r.check(offs[i], 2); err != nil {
+			return nil, err
+		}
+		if points[cov[i]], err = r.uint16s(offs[i]+2, int(r.u16(offs[i]))); err != nil {
+			return nil, err
+		}
+	}
+	return points, nil
+}
+
+func (r *layoutReader) ligCaretList(off int) (map[uint16][]CaretValue, error) {
+	cov, offs, err := r.glyphList(off)
+	if err != nil {
+		return nil, err
+	}
+	carets := make(map[uint16][]CaretValue, len(cov))
+	for i := 0; i < len(cov) && i < len(offs); i++ {
+		if offs[i] < 0 {
+			continue
+		}
+		if err := r.check(offs[i], 2); err != nil {
+			return nil, err
+		}
+		caretOffs, err := r.offsets(offs[i], offs[i]+2, int(r.u16(offs[i])))
+		if err != nil {
+			return nil, err
+		}
+		values := make([]CaretValue, len(caretOffs))
+		for j, caret := range caretOffs {
+			if caret < 0 {
+				return nil, &ParseError{Table: "GDEF", Offset: int64(offs[i] + 2 + 2*j), Reason: "caret value is missing"}
+			}
+			if values[j], err = r.caretValue(caret); err != nil {
+				return nil, err
+			}
+		}
+		carets[cov[i]] = values
+	}
+	return carets, nil
+}
+
+/*
+*
+caret value format 1:
+uint16	format	Format identifier: format = 1
+int16	coordinate	X or Y value, in design units
+
+caret value format 2:
+uint16	format	Format identifier: format = 2
+uint16	caretValuePointIndex	Contour point index on glyph
+
+caret value format 3:
+uint16	format	Format identifier: format = 3
+int16	coordinate	X or Y value, in design units
+Offset16	deviceOffset	Offset to Device table (non-variable font) / Variation Index table (variable font) for X or Y value, from beginning of CaretValue table
+*/
+func (r *layoutReader) caretValue(off int) (CaretValue, error) {
+	if err := r.check(off, 4); err != nil {
+		return CaretValue{}, err
+	}
+	caret := CaretValue{Format: r.u16(off)}
+	switch caret.Format {
+	case 1:
+		caret.Coordinate = int16(r.u16(off + 2))
+	case 2:
+		caret.PointIndex = r.u16(off + 2)
+	case 3:
+		if err := r.check(off, 6); err != nil {
+			return CaretValue{}, err
+		}
+		caret.Coordinate = int16(r.u16(off + 2))
+		if o := int(r.u16(off + 4)); o != 0 {
+			var err error
+			if caret.Device, err = r.device(off + o); err != nil {
+				return CaretValue{}, err
+			}
+		}
+	default:
+		return CaretValue{}, &ParseError{Table: "GDEF", Offset: int64(off), Reason: fmt.Sprintf("unknown caret value format %d", caret.Format)}
+	}
+	return caret, nil
+}
+
+/*
+*
+uint16	format	Format identifier == 1
+uint16	markGlyphSetCount	Number of mark glyph sets defined
+Offset32	coverageOffsets[markGlyphSetCount]	Array of offsets to mark glyph set coverage tables, from the start of the MarkGlyphSets table
+*/
+func (r *layoutReader) markGlyphSets(off int) ([]Coverage, error) {
+	if err := r.check(off, 4); err != nil {
+		return nil, err
+	}
+	if format := r.u16(off); format != 1 {
+		return nil, &ParseError{Table: "GDEF", Offset: int64(off), Reason: fmt.Sprintf("unknown mark glyph sets format %d", format)}
+	}
+	n := int(r.u16(off + 2))
+	if err := r.check(off+4, 4*n); err != nil {
+		return nil, err
+	}
+	sets := make([]Coverage, n)
+	for i := range sets {
+		var err error
+		if sets[i], err = r.coverage(off + int(r.u32(off+4+4*i))); err != nil {
+			return nil, err
+		}
+	}
+	return sets, nil
+}
+
+// encode serializes the GDEF table. The item variation store is written
+// last, as it is read to the end of the table.
+func (gdef GDEFTable) encode() ([]byte, error) {
+	var headerSize int
+	switch gdef.MinorVersion {
+	case 0:
+		headerSize = 12
+	case 2:
+		headerSize = 14
+	case 3:
+		headerSize = 18
+	default:
+		return nil, fmt.Errorf("GDEF version %d.%d cannot be serialized", gdef.MajorVersion, gdef.MinorVersion)
+	}
+	if gdef.MarkGlyphSets != nil && gdef.MinorVersion < 2 {
+		return nil, errors.New("mark glyph sets need GDEF version 1.2")
+	}
+	if gdef.ItemVarStore != nil && gdef.MinorVersion < 3 {
+		return nil, errors.New("item variation store needs GDEF version 1.3")
+	}
+	b := subtableBuffer{buf: make([]byte, headerSize)}
+	binary.BigEndian.PutUint16(b.buf[0:], gdef.MajorVersion)
+	binary.BigEndian.PutUint16(b.buf[2:], gdef.MinorVersion)
+	if gdef.GlyphClassDef != nil {
+		if err := b.link(4, gdef.GlyphClassDef.encode()); err != nil {
+			return nil, err
+		}
+	}
+	if gdef.AttachList != nil {
+		data, err := encodeAttachList(gdef.AttachList)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.link(6, data); err != nil {
+			return nil, err
+		}
+	}
+	if gdef.LigCaretList != nil {
+		data, err := encodeLigCaretList(gdef.LigCaretList)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.link(8, data); err != nil {
+			return nil, err
+		}
+	}
+	if gdef.MarkAttachClassDef != nil {
+		if err := b.link(10, gdef.MarkAttachClassDef.encode()); err != nil {
+			return nil, err
+		}
+	}
+	if gdef.MarkGlyphSets != nil {
+		if len(gdef.MarkGlyphSets) > 0xFFFF {
+			return nil, fmt.Errorf("GDEF has %d mark glyph sets", len(gdef.MarkGlyphSets))
+		}
+		sets := subtableBuffer{buf: appendUint16s(nil, 1, uint16(len(gdef.MarkGlyphSets)))}
+		sets.buf = append(sets.buf, make([]byte, 4*len(gdef.MarkGlyphSets))...)
+		for i, set := range gdef.MarkGlyphSets {
+			data, err := set.encode()
+			if err != nil {
+				return nil, err
+			}
+			sets.link32(4+4*i, data)
+		}
+		if err := b.link(12, sets.buf); err != nil {
+			return nil, err
+		}
+	}
+	if gdef.ItemVarStore != nil {
+		binary.BigEndian.PutUint32(b.buf[14:], uint32(len(b.buf)))
+		b.buf = append(b.buf, gdef.ItemVarStore...)
+	}
+	return b.buf, nil
+}
+
+// encodeGlyphList serializes an attach or ligature caret list of the
+// tables of its glyphs, sorted by glyph id.
+func encodeGlyphList(gids []uint16, tables [][]byte) ([]byte, error) {
+	if len(gids) > 0xFFFF {
+		return nil, fmt.Errorf("GDEF list has %d glyphs", len(gids))
+	}
+	cov, err := Coverage(gids).encode()
+	if err != nil {
+		return nil, err
+	}
+	b := subtableBuffer{buf: appendUint16s(nil, 0, uint16(len(gids)))}
+	b.buf = append(b.buf, make([]byte, 2*len(gids))...)
+	if err := b.link(0, cov); err != nil {
+		return nil, err
+	}
+	for i, table := range tables {
+		if err := b.link(4+2*i, table); err != nil {
+			return nil, err
+		}
+	}
+	return b.buf, nil
+}
+
+func encodeAttachList(points map[uint16][]uint16) ([]byte, error) {
+	gids := make([]uint16, 0, len(points))
+	for gid := range points {
+		gids = append(gids, gid)
+	}
+	tables := make([][]byte, len(gids))
+	for i, gid := range sortGlyphs(gids) {
+		if len(points[gid]) > 0xFFFF {
+			return nil, fmt.Errorf("glyph %d has %d attachment points", gid, len(points[gid]))
+		}
+		tables[i] = appendUint16s(appendUint16s(nil, uint16(len(points[gid]))), points[gid]...)
+	}
+	return encodeGlyphList(gids, tables)
+}
+
+func encodeLigCaretList(carets map[uint16][]CaretValue) ([]byte, error) {
+	gids := make([]uint16, 0, len(carets))
+	for gid := range carets {
+		gids = append(gids, gid)
+	}
+	tables := make([][]byte, len(gids))
+	for i, gid := range sortGlyphs(gids) {
+		values := carets[gid]
+		if len(values) > 0xFFFF {
+			return nil, fmt.Errorf("ligature %d has %d carets", gid, len(values))
+		}
+		lig := subtableBuffer{buf: appendUint16s(nil, uint16(len(values)))}
+		lig.buf = append(lig.buf, make([]byte, 2*len(values))...)
+		for j, caret := range values {
+			data, err := caret.encode()
+			if err != nil {
+				return nil, err
+			}
+			if err := lig.link(2+2*j, data); err != nil {
+				return nil, err
+			}
+		}
+		tables[i] = lig.buf
+	}
+	return encodeGlyphList(gids, tables)
+}
+
+func (caret CaretValue) encode() ([]byte, error) {
+	switch caret.Format {
+	case 1:
+		return appendUint16s(nil, 1, uint16(caret.Coordinate)), nil
+	case 2:
+		return appendUint16s(nil, 2, caret.PointIndex), nil
+	case 3:
+		b := subtableBuffer{buf: appendUint16s(nil, 3, uint16(caret.Coordinate), 0)}
+		if caret.Device != nil {
+			if err := b.link(4, caret.Device); err != nil {
+				return nil, err
+			}
+		}
+		return b.buf, nil
+	}
+	return nil, fmt.Errorf("unknown caret value format %d", caret.Format)
+}
+
+// subset returns the table for the glyphs of newID, renumbered. Mark glyph
+// sets are kept, possibly empty, since lookups refer to them by index. The
+// item variation store is dropped with the variation tables of the font.
+func (gdef GDEFTable) subset(newID map[uint16]uint16) GDEFTable {
+	sub := gdef
+	if gdef.GlyphClassDef != nil {
+		sub.GlyphClassDef = gdef.GlyphClassDef.subset(newID)
+	}
+	if gdef.AttachList != nil {
+		sub.AttachList = make(map[uint16][]uint16)
+		for gid, points := range gdef.AttachList {
+			if id, ok := newID[gid]; ok {
+				sub.AttachList[id] = points
+			}
+		}
+	}
+	if gdef.LigCaretList != nil {
+		sub.LigCaretList = make(map[uint16][]CaretValue)
+		for gid, carets := range gdef.LigCaretList {
+			if id, ok := newID[gid]; ok {
+				sub.LigCaretList[id] = carets
+			}
+		}
+	}
+	if gdef.MarkAttachClassDef != nil {
+		sub.MarkAttachClassDef = gdef.MarkAttachClassDef.subset(newID)
+	}
+	if gdef.MarkGlyphSets != nil {
+		sub.MarkGlyphSets = make([]Coverage, len(gdef.MarkGlyphSets))
+		for i, set := range gdef.MarkGlyphSets {
+			sub.MarkGlyphSets[i] = set.subset(newID)
+		}
+	}
+	if gdef.MinorVersion == 3 {
+		sub.MinorVersion = 2
+	}
+	sub.ItemVarStore = nil
+	return sub
+}
+
+// GDEF returns the GDEF table, decoding it on first use.
+func (ttf *TTF) GDEF() (GDEFTable, error) {
+	table, err := ttf.decodeTable(tagGDEF, readGDEFTable)
+	if err != nil {
+		return GDEFTable{}, err
+	}
+	gdef, ok := table.(GDEFTable)
+	if !ok {
+		return GDEFTable{}, fmt.Errorf("GDEF table holds a %T", table)
+	}
+	return gdef, nil
+}
@@ -0,0 +1,137 @@
+package fontcompress_test
+
+import (
+	"reflect"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+// fixtureGDEF returns a version 1.2 GDEF table for the fixture glyphs. The
+// Adieresis ligature has attachment points and carets, dieresis is a mark
+// of mark attachment class 1 and of mark glyph set 0.
+func fixtureGDEF() []byte {
+	coverage := appendInt16(nil, 1, 1, 4)
+	attachList := linkTables(appendInt16(nil, 0, 1, 0), link{0, coverage}, link{4, appendInt16(nil, 2, 3, 7)})
+	ligGlyph := linkTables(appendInt16(nil, 3, 0, 0, 0),
+		link{2, appendInt16(nil, 1, 300)},
+		link{4, appendInt16(nil, 2, 5)},
+		link{6, linkTables(appendInt16(nil, 3, 310, 0), link{4, fixtureDevice})})
+	ligCaretList := linkTables(appendInt16(nil, 0, 1, 0), link{0, coverage}, link{4, ligGlyph})
+	markGlyphSets := append(appendInt16(nil, 1, 1, 0, 8), appendInt16(nil, 1, 1, 3)...)
+	return linkTables(appendInt16(nil, 1, 2, 0, 0, 0, 0, 0),
+		link{4, appendInt16(nil, 1, 1, 5, 1, 1, 3, 2, 1)},
+		link{6, attachList},
+		link{8, ligCaretList},
+		link{10, appendInt16(nil, 2, 1, 3, 3, 1)},
+		link{12, markGlyphSets})
+}
+
+// fixtureGDEFTable is fixtureGDEF decoded.
+var fixtureGDEFTable = font_compress.GDEFTable{
+	MajorVersion:  1,
+	MinorVersion:  2,
+	GlyphClassDef: font_compress.ClassDef{1: 1, 2: 1, 3: 3, 4: 2, 5: 1},
+	AttachList:    map[uint16][]uint16{4: {3, 7}},
+	LigCaretList: map[uint16][]font_compress.CaretValue{4: {
+		{Format: 1, Coordinate: 300},
+		{Format: 2, PointIndex: 5},
+		{Format: 3, Coordinate: 310, Device: fixtureDevice},
+	}},
+	MarkAttachClassDef: font_compress.ClassDef{3: 1},
+	MarkGlyphSets:      []font_compress.Coverage{{3}},
+}
+
+func TestReadGDEFTable(t *testing.T) {
+	gdef, err := readFont(t, fixtureFontWith(map[string][]byte{"GDEF": fixtureGDEF()})).GDEF()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gdef, fixtureGDEFTable) {
+		t.Errorf("GDEF = %+v, want %+v", gdef, fixtureGDEFTable)
+	}
+	for gid, want := range []uint16{0, font_compress.GLYPH_CLASS_BASE, font_compress.GLYPH_CLASS_BASE, font_compress.GLYPH_CLASS_MARK,
+		font_compress.GLYPH_CLASS_LIGATURE, font_compress.GLYPH_CLASS_BASE, 0} {
+		if class := gdef.GlyphClass(uint16(gid)); class != want {
+			t.Errorf("GlyphClass(%d) = %d, want %d", gid, class, want)
+		}
+	}
+}
+
+func TestWriteGDEFTable(t *testing.T) {
+	for _, want := range []font_compress.GDEFTable{
+		{MajorVersion: 1, GlyphClassDef: font_compress.ClassDef{6: font_compress.GLYPH_CLASS_COMPONENT}},
+		{MajorVersion: 1, MinorVersion: 2, AttachList: map[uint16][]uint16{}, MarkGlyphSets: []font_compress.Coverage{{3}, nil, {1, 2, 5}}},
+		{MajorVersion: 1, MinorVersion: 3, GlyphClassDef: fixtureGDEFTable.GlyphClassDef, LigCaretList: fixtureGDEFTable.LigCaretList,
+			ItemVarStore: appendInt16(nil, 1, 0, 0, 0, 0)},
+	} {
+		ttf := readFont(t, fixtureFontWith(map[string][]byte{"GDEF": fixtureGDEF()}))
+		replaceTable(ttf, want)
+		font, err := ttf.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := readFont(t, font).GDEF()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GDEF written as %+v, want %+v", got, want)
+		}
+	}
+
+	ttf := readFont(t, fixtureFontWith(map[string][]byte{"GDEF": fixtureGDEF()}))
+	replaceTable(ttf, font_compress.GDEFTable{MajorVersion: 1, MarkGlyphSets: []font_compress.Coverage{{3}}})
+	if _, err := ttf.Bytes(); err == nil {
+		t.Error("mark glyph sets of GDEF version 1.0 written")
+	}
+}
+
+func TestSubsetGDEF(t *testing.T) {
+	ttf := readFont(t, fixtureFontWith(map[string][]byte{"GDEF": fixtureGDEF()}))
+	gdef := fixtureGDEFTable
+	gdef.MinorVersion = 3
+	gdef.ItemVarStore = appendInt16(nil, 1, 0, 0, 0, 0)
+	replaceTable(ttf, gdef)
+	font, err := ttf.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		runes string
+		want  font_compress.GDEFTable
+	}{
+		// glyphs 0, A, dieresis and Adieresis
+		{"Ä", font_compress.GDEFTable{
+			MajorVersion:       1,
+			MinorVersion:       2,
+			GlyphClassDef:      font_compress.ClassDef{1: 1, 2: 3, 3: 2},
+			AttachList:         map[uint16][]uint16{3: {3, 7}},
+			LigCaretList:       map[uint16][]font_compress.CaretValue{3: fixtureGDEFTable.LigCaretList[4]},
+			MarkAttachClassDef: font_compress.ClassDef{2: 1},
+			MarkGlyphSets:      []font_compress.Coverage{{2}},
+		}},
+		// glyphs 0, B and C; the mark glyph set is kept, empty
+		{"BC", font_compress.GDEFTable{
+			MajorVersion:       1,
+			MinorVersion:       2,
+			GlyphClassDef:      font_compress.ClassDef{1: 1, 2: 1},
+			AttachList:         map[uint16][]uint16{},
+			LigCaretList:       map[uint16][]font_compress.CaretValue{},
+			MarkAttachClassDef: font_compress.ClassDef{},
+			MarkGlyphSets:      []font_compress.Coverage{nil},
+		}},
+	} {
+		out, err := font_compress.Subset(readFont(t, font), []rune(tt.runes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := readFont(t, out).GDEF()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("GDEF of subset %q = %+v, want %+v", tt.runes, got, tt.want)
+		}
+	}
+}
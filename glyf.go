@@ -0,0 +1,626 @@
+package fontcompress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// simple glyph flags
+const (
+	glyfOnCurvePoint                  uint8 = 0x01 // the point is on the curve
+	glyfXShortVector                  uint8 = 0x02 // the x coordinate is 1 byte long
+	glyfYShortVector                  uint8 = 0x04 // the y coordinate is 1 byte long
+	glyfRepeatFlag                    uint8 = 0x08 // the next byte is a repeat count for this flag
+	glyfXIsSameOrPositiveXShortVector uint8 = 0x10 // sign of a short x, or x repeats the previous value
+	glyfYIsSameOrPositiveYShortVector uint8 = 0x20 // sign of a short y, or y repeats the previous value
+	glyfOverlapSimple                 uint8 = 0x40 // contours may overlap; only set on the first flag
+)
+
+// composite glyph flags
+const (
+	glyfArg1And2AreWords   uint16 = 0x0001 // arguments are 16-bit, otherwise 8-bit
+	glyfArgsAreXYValues    uint16 = 0x0002 // arguments are offsets, otherwise point numbers
+	glyfWeHaveAScale       uint16 = 0x0008 // a single F2Dot14 scale follows the arguments
+	glyfMoreComponents     uint16 = 0x0020 // at least one more component follows
+	glyfWeHaveAnXAndYScale uint16 = 0x0040 // separate x and y F2Dot14 scales follow
+	glyfWeHaveATwoByTwo    uint16 = 0x0080 // a 2x2 F2Dot14 transformation follows
+	glyfWeHaveInstructions uint16 = 0x0100 // instructions follow the last component
+)
+
+// loca — index to location
+type LocaTable struct {
+	// Offsets of each glyph from the beginning of the glyf table, numGlyphs+1
+	// entries. Short (format 0) offsets are already multiplied by two, so the
+	// data of glyph i is glyf[Offsets[i]:Offsets[i+1]].
+	Offsets []uint32
+}
+
+func (LocaTable) Tag() Tag { return tagLoca }
+
+// NumGlyphs returns the number of glyphs located by the table.
+func (loca LocaTable) NumGlyphs() int {
+	if len(loca.Offsets) == 0 {
+		return 0
+	}
+	return len(loca.Offsets) - 1
+}
+
+// GlyphPoint is a point of a simple glyph outline in font units.
+type GlyphPoint struct {
+	X, Y    int16
+	OnCurve bool
+}
+
+/*
+*
+uint16	flags	component flag
+uint16	glyphIndex	glyph index of component
+uint8, int8, uint16 or int16	argument1	x-offset for component or point number; type depends on bits 0 and 1 in component flags
+uint8, int8, uint16 or int16	argument2	y-offset for component or point number; type depends on bits 0 and 1 in component flags
+F2DOT14	scale, xscale/yscale or the 2x2 transformation, depending on the flags
+*/
+type GlyphComponent struct {
+	Flags      uint16 // component flags
+	GlyphIndex uint16 // glyph index of component
+	// x and y offsets when ARGS_ARE_XY_VALUES is set,
+	// otherwise the matching point numbers of the parent and the component
+	Argument1, Argument2 int32
+	// 2x2 transformation as F2Dot14 values; 0x4000 (1.0) on the diagonal
+	// when the flags carry no scale
+	XScale, Scale01, Scale10, YScale int16
+}
+
+// Glyph is one decoded glyf entry. A glyph without data (such as the space)
+// has no contours, points or components.
+type Glyph struct {
+	// If the number of contours is greater than or equal to zero, this is a simple glyph.
+	// If negative, this is a composite glyph
+	NumberOfContours int16
+	XMin             int16 // minimum x for coordinate data
+	YMin             int16 // minimum y for coordinate data
+	XMax             int16 // maximum x for coordinate data
+	YMax             int16 // maximum y for coordinate data
+
+	// simple glyph
+	// Array of point indices for the last point of each contour, in increasing numeric order
+	EndPtsOfContours []uint16
+	// Array of instruction byte code for the glyph
+	Instructions []uint8
+	// Flags of each point, with repeats expanded
+	Flags []uint8
+	// Points with absolute coordinates
+	Points []GlyphPoint
+
+	// composite glyph
+	Components []GlyphComponent
+}
+
+// IsComposite reports whether the glyph is built from other glyphs.
+func (g Glyph) IsComposite() bool {
+	return g.NumberOfContours < 0
+}
+
+// Contours returns the points of a simple glyph split by contour.
+func (g Glyph) Contours() [][]GlyphPoint {
+	contours := make([][]GlyphPoint, 0, len(g.EndPtsOfContours))
+	start := 0
+	for _, end := range g.EndPtsOfContours {
+		if int(end) >= len(g.Points) || int(end) < start {
+			break
+		}
+		contours = append(contours, g.Points[start:int(end)+1])
+		start = int(end) + 1
+	}
+	return contours
+}
+
+// glyf — glyph data
+type GlyfTable struct {
+	Glyphs []Glyph // glyphs indexed by glyph id
+}
+
+func (GlyfTable) Tag() Tag { return tagGlyf }
+
+// compositeComponents returns the positions of the component glyph indices
+// inside a composite glyph and the offset just past the last component
+// record. Simple and empty glyphs have no components.
+func compositeComponents(glyph []byte) (refs []int, end int, err error) {
+	if len(glyph) < 10 || int16(binary.BigEndian.Uint16(glyph)) >= 0 {
+		return nil, 0, nil
+	}
+	for pos := 10; ; {
+		if pos+4 > len(glyph) {
+			return nil, 0, errors.New("truncated composite glyph")
+		}
+		flags := binary.BigEndian.Uint16(glyph[pos:])
+		refs = append(refs, pos+2)
+		pos += 4
+		if flags&glyfArg1And2AreWords != 0 {
+			pos += 4
+		} else {
+			pos += 2
+		}
+		switch {
+		case flags&glyfWeHaveAScale != 0:
+			pos += 2
+		case flags&glyfWeHaveAnXAndYScale != 0:
+			pos += 4
+		case flags&glyfWeHaveATwoByTwo != 0:
+			pos += 8
+		}
+		if pos > len(glyph) {
+			return nil, 0, errors.New("truncated composite glyph")
+		}
+		if flags&glyfMoreComponents == 0 {
+			return refs, pos, nil
+		}
+	}
+}
+
+// read loca table
+func readLocaTable(data []byte, indexToLocFormat int16) (LocaTable, error) {
+	loca := LocaTable{}
+	if indexToLocFormat == 0 {
+		loca.Offsets = make([]uint32, len(data)/2)
+		for i := range loca.Offsets {
+			loca.Offsets[i] = uint32(binary.BigEndian.Uint16(data[2*i:])) * 2
+		}
+	} else {
+		loca.Offsets = make([]uint32, len(data)/4)
+		for i := range loca.Offsets {
+			loca.Offsets[i] = binary.BigEndian.Uint32(data[4*i:])
+		}
+	}
+	entrySize := 2
+	if indexToLocFormat != 0 {
+		entrySize = 4
+	}
+	for i := 1; i < len(loca.Offsets); i++ {
+		if loca.Offsets[i] < loca.Offsets[i-1] {
+			return loca, &ParseError{Table: "loca", Offset: int64(i * entrySize), Reason: "offsets are not in ascending order"}
+		}
+	}
+	return loca, nil
+}
+
+// read glyf table
+func readGlyfTable(data []byte, loca LocaTable) (GlyfTable, error) {
+	glyf := GlyfTable{Glyphs: make([]Glyph, loca.NumGlyphs())}
+	for i := range glyf.Glyphs {
+		start, end := loca.Offsets[i], loca.Offsets[i+1]
+		if end > uint32(len(data)) {
+			return glyf, &ParseError{Table: "glyf", Offset: int64(start), Reason: fmt.Sprintf("glyph %d extends beyond the end of the table", i)}
+		}
+		glyph, err := readGlyph(data[start:end])
+		if err != nil {
+			return glyf, &ParseError{Table: "glyf", Offset: int64(start), Reason: fmt.Sprintf("glyph %d: %v", i, err)}
+		}
+		glyf.Glyphs[i] = glyph
+	}
+	return glyf, nil
+}
+
+// readGlyph decodes the data of one glyph.
+func readGlyph(data []byte) (g Glyph, err error) {
+	if len(data) == 0 {
+		return g, nil
+	}
+	if len(data) < 10 {
+		return g, errors.New("truncated glyph header")
+	}
+	g.NumberOfContours = int16(binary.BigEndian.Uint16(data[0:]))
+	g.XMin = int16(binary.BigEndian.Uint16(data[2:]))
+	g.YMin = int16(binary.BigEndian.Uint16(data[4:]))
+	g.XMax = int16(binary.BigEndian.Uint16(data[6:]))
+	g.YMax = int16(binary.BigEndian.Uint16(data[8:]))
+	if g.NumberOfContours < 0 {
+		err = g.readComposite(data)
+	} else {
+		err = g.readSimple(data)
+	}
+	return g, err
+}
+
+func (g *Glyph) readSimple(data []byte) error {
+	pos := 10
+	if pos+2*int(g.NumberOfContours)+2 > len(data) {
+		return errors.New("truncated simple glyph")
+	}
+	g.EndPtsOfContours = make([]uint16, g.NumberOfContours)
+	for i := range g.EndPtsOfContours {
+		g.EndPtsOfContours[i] = binary.BigEndian.Uint16(data[pos:])
+		pos += 2
+	}
+	numPoints := 0
+	if n := len(g.EndPtsOfContours); n > 0 {
+		numPoints = int(g.EndPtsOfContours[n-1]) + 1
+	}
+	instructionLength := int(binary.BigEndian.Uint16(data[pos:]))
+	pos += 2
+	if pos+instructionLength > len(data) {
+		return errors.New("truncated glyph instructions")
+	}
+	g.Instructions = data[pos : pos+instructionLength]
+	pos += instructionLength
+
+	// flags
+	g.Flags = make([]uint8, 0, numPoints)
+	for len(g.Flags) < numPoints {
+		if pos >= len(data) {
+			return errors.New("truncated glyph flags")
+		}
+		flag := data[pos]
+		pos++
+		g.Flags = append(g.Flags, flag)
+		if flag&glyfRepeatFlag != 0 {
+			if pos >= len(data) {
+				return errors.New("truncated glyph flags")
+			}
+			for n := data[pos]; n > 0 && len(g.Flags) < numPoints; n-- {
+				g.Flags = append(g.Flags, flag)
+			}
+			pos++
+		}
+	}
+
+	// coordinates, stored as deltas from the previous point
+	g.Points = make([]GlyphPoint, numPoints)
+	var x, y int16
+	for i, flag := range g.Flags {
+		switch {
+		case flag&glyfXShortVector != 0:
+			if pos >= len(data) {
+				return errors.New("truncated glyph coordinates")
+			}
+			if flag&glyfXIsSameOrPositiveXShortVector != 0 {
+				x += int16(data[pos])
+			} else {
+				x -= int16(data[pos])
+			}
+			pos++
+		case flag&glyfXIsSameOrPositiveXShortVector == 0:
+			if pos+2 > len(data) {
+				return errors.New("truncated glyph coordinates")
+			}
+			x += int16(binary.BigEndian.Uint16(data[pos:]))
+			pos += 2
+		}
+		g.Points[i].X = x
+		g.Points[i].OnCurve = flag&glyfOnCurvePoint != 0
+	}
+	for i, flag := range g.Flags {
+		switch {
+		case flag&glyfYShortVector != 0:
+			if pos >= len(data) {
+				return errors.New("truncated glyph coordinates")
+			}
+			if flag&glyfYIsSameOrPositiveYShortVector != 0 {
+				y += int16(data[pos])
+			} else {
+				y -= int16(data[pos])
+			}
+			pos++
+		case flag&glyfYIsSameOrPositiveYShortVector == 0:
+			if pos+2 > len(data) {
+				return errors.New("truncated glyph coordinates")
+			}
+			y += int16(binary.BigEndian.Uint16(data[pos:]))
+			pos += 2
+		}
+		g.Points[i].Y = y
+	}
+	return nil
+}
+
+func (g *Glyph) readComposite(data []byte) error {
+	pos := 10
+	flags := glyfMoreComponents
+	// instructions follow if any component announces them
+	haveInstructions := false
+	for flags&glyfMoreComponents != 0 {
+		if pos+4 > len(data) {
+			return errors.New("truncated composite glyph")
+		}
+		c := GlyphComponent{
+			Flags:      binary.BigEndian.Uint16(data[pos:]),
+			GlyphIndex: binary.BigEndian.Uint16(data[pos+2:]),
+			XScale:     1 << 14,
+			YScale:     1 << 14,
+		}
+		flags = c.Flags
+		haveInstructions = haveInstructions || flags&glyfWeHaveInstructions != 0
+		pos += 4
+		size := 2
+		if flags&glyfArg1And2AreWords != 0 {
+			size = 4
+		}
+		switch {
+		case flags&glyfWeHaveAScale != 0:
+			size += 2
+		case flags&glyfWeHaveAnXAndYScale != 0:
+			size += 4
+		case flags&glyfWeHaveATwoByTwo != 0:
+			size += 8
+		}
+		if pos+size > len(data) {
+			return errors.New("truncated composite glyph")
+		}
+		switch {
+		case flags&glyfArg1And2AreWords != 0 && flags&glyfArgsAreXYValues != 0:
+			c.Argument1 = int32(int16(binary.BigEndian.Uint16(data[pos:])))
+			c.Argument2 = int32(int16(binary.BigEndian.Uint16(data[pos+2:])))
+			pos += 4
+		case flags&glyfArg1And2AreWords != 0:
+			c.Argument1 = int32(binary.BigEndian.Uint16(data[pos:]))
+			c.Argument2 = int32(binary.BigEndian.Uint16(data[pos+2:]))
+			pos += 4
+		case flags&glyfArgsAreXYValues != 0:
+			c.Argument1 = int32(int8(data[pos]))
+			c.Argument2 = int32(int8(data[pos+1]))
+			pos += 2
+		default:
+			c.Argument1 = int32(data[pos])
+			c.Argument2 = int32(data[pos+1])
+			pos += 2
+		}
+		f2dot14 := func() int16 {
+			v := int16(binary.BigEndian.Uint16(data[pos:]))
+			pos += 2
+			return v
+		}
+		switch {
+		case flags&glyfWeHaveAScale != 0:
+			c.XScale = f2dot14()
+			c.YScale = c.XScale
+		case flags&glyfWeHaveAnXAndYScale != 0:
+			c.XScale = f2dot14()
+			c.YScale = f2dot14()
+		case flags&glyfWeHaveATwoByTwo != 0:
+			c.XScale = f2dot14()
+			c.Scale01 = f2dot14()
+			c.Scale10 = f2dot14()
+			c.YScale = f2dot14()
+		}
+		g.Components = append(g.Components, c)
+	}
+	if haveInstructions {
+		if pos+2 > len(data) {
+			return errors.New("truncated composite glyph instructions")
+		}
+		n := int(binary.BigEndian.Uint16(data[pos:]))
+		pos += 2
+		if pos+n > len(data) {
+			return errors.New("truncated composite glyph instructions")
+		}
+		g.Instructions = data[pos : pos+n]
+	}
+	return nil
+}
+
+// Loca returns the loca table, decoding it on first use. Decoding it needs
+// head.IndexToLocFormat; it must locate at least the maxp.numGlyphs glyphs.
+func (ttf *TTF) Loca() (LocaTable, error) {
+	table, err := ttf.decodeTable(tagLoca, func(data []byte) (TTFTable, error) {
+		head, err := ttf.Head()
+		if err != nil {
+			return nil, err
+		}
+		loca, err := readLocaTable(data, head.IndexToLocFormat)
+		if err != nil {
+			return nil, err
+		}
+		numGlyphs, err := ttf.NumGlyphs()
+		switch {
+		case errors.Is(err, ErrNoTable):
+		case err != nil:
+			return nil, err
+		case loca.NumGlyphs() < numGlyphs:
+			return nil, &ParseError{Table: "loca", Offset: int64(len(data)), Reason: fmt.Sprintf("%d offsets locate fewer than the %d glyphs of maxp", len(loca.Offsets), numGlyphs)}
+		}
+		return loca, nil
+	})
+	if err != nil {
+		return LocaTable{}, err
+	}
+	loca, ok := table.(LocaTable)
+	if !ok {
+		return LocaTable{}, fmt.Errorf("loca table holds a %T", table)
+	}
+	return loca, nil
+}
+
+// Glyf returns the glyf table, decoding it and the loca table on first use.
+func (ttf *TTF) Glyf() (GlyfTable, error) {
+	table, err := ttf.decodeTable(tagGlyf, func(data []byte) (TTFTable, error) {
+		loca, err := ttf.Loca()
+		if err != nil {
+			return nil, err
+		}
+		glyf, err := readGlyfTable(data, loca)
+		if err != nil {
+			return nil, err
+		}
+		return glyf, nil
+	})
+	if err != nil {
+		return GlyfTable{}, err
+	}
+	glyf, ok := table.(GlyfTable)
+	if !ok {
+		return GlyfTable{}, fmt.Errorf("glyf table holds a %T", table)
+	}
+	return glyf, nil
+}
+
+// format returns the smallest indexToLocFormat able to hold the offsets.
+func (loca LocaTable) format() int16 {
+	if n := len(loca.Offsets); n > 0 && loca.Offsets[n-1] > 2*0xFFFF {
+		return 1
+	}
+	for _, offset := range loca.Offsets {
+		if offset%2 != 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// encode serializes the offsets using short (0) or long (1) entries.
+func (loca LocaTable) encode(indexToLocFormat int16) []byte {
+	if indexToLocFormat == 0 {
+		buf := make([]byte, 2*len(loca.Offsets))
+		for i, offset := range loca.Offsets {
+			binary.BigEndian.PutUint16(buf[2*i:], uint16(offset/2))
+		}
+		return buf
+	}
+	buf := make([]byte, 4*len(loca.Offsets))
+	for i, offset := range loca.Offsets {
+		binary.BigEndian.PutUint32(buf[4*i:], offset)
+	}
+	return buf
+}
+
+// encode serializes the glyphs and returns the matching loca offsets.
+// Glyphs are padded to an even length so short offsets can address them.
+func (glyf GlyfTable) encode() ([]byte, []uint32) {
+	buf := make([]byte, 0)
+	offsets := make([]uint32, 0, len(glyf.Glyphs)+1)
+	for _, g := range glyf.Glyphs {
+		offsets = append(offsets, uint32(len(buf)))
+		buf = g.appendTo(buf)
+		if len(buf)%2 != 0 {
+			buf = append(buf, 0)
+		}
+	}
+	return buf, append(offsets, uint32(len(buf)))
+}
+
+// appendTo appends the encoded glyph to buf. Flags and coordinates are
+// rewritten in their most compact form; the bounding box is kept as is.
+func (g Glyph) appendTo(buf []byte) []byte {
+	if g.NumberOfContours == 0 && len(g.Points) == 0 && len(g.Components) == 0 {
+		return buf
+	}
+	buf = g.appendHeader(buf)
+	if g.NumberOfContours < 0 {
+		return g.appendComposite(buf)
+	}
+	return g.appendSimple(buf)
+}
+
+// appendHeader appends the number of contours and the bounding box.
+func (g Glyph) appendHeader(buf []byte) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, uint16(g.NumberOfContours))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(g.XMin))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(g.YMin))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(g.XMax))
+	return binary.BigEndian.AppendUint16(buf, uint16(g.YMax))
+}
+
+func (g Glyph) appendSimple(buf []byte) []byte {
+	for _, end := range g.EndPtsOfContours {
+		buf = binary.BigEndian.AppendUint16(buf, end)
+	}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(g.Instructions)))
+	buf = append(buf, g.Instructions...)
+
+	flags := make([]uint8, len(g.Points))
+	var xs, ys []byte
+	var x, y int16
+	for i, p := range g.Points {
+		var flag uint8
+		if p.OnCurve {
+			flag |= glyfOnCurvePoint
+		}
+		if i < len(g.Flags) {
+			// keep OVERLAP_SIMPLE and the reserved bit
+			flag |= g.Flags[i] & 0xC0
+		}
+		dx, dy := int(p.X)-int(x), int(p.Y)-int(y)
+		x, y = p.X, p.Y
+		switch {
+		case dx == 0:
+			flag |= glyfXIsSameOrPositiveXShortVector
+		case dx > 0 && dx <= 0xFF:
+			flag |= glyfXShortVector | glyfXIsSameOrPositiveXShortVector
+			xs = append(xs, uint8(dx))
+		case dx < 0 && dx >= -0xFF:
+			flag |= glyfXShortVector
+			xs = append(xs, uint8(-dx))
+		default:
+			xs = binary.BigEndian.AppendUint16(xs, uint16(dx))
+		}
+		switch {
+		case dy == 0:
+			flag |= glyfYIsSameOrPositiveYShortVector
+		case dy > 0 && dy <= 0xFF:
+			flag |= glyfYShortVector | glyfYIsSameOrPositiveYShortVector
+			ys = append(ys, uint8(dy))
+		case dy < 0 && dy >= -0xFF:
+			flag |= glyfYShortVector
+			ys = append(ys, uint8(-dy))
+		default:
+			ys = binary.BigEndian.AppendUint16(ys, uint16(dy))
+		}
+		flags[i] = flag
+	}
+	for i := 0; i < len(flags); {
+		run := 1
+		for i+run < len(flags) && flags[i+run] == flags[i] && run < 256 {
+			run++
+		}
+		if run > 1 {
+			buf = append(buf, flags[i]|glyfRepeatFlag, uint8(run-1))
+		} else {
+			buf = append(buf, flags[i])
+		}
+		i += run
+	}
+	buf = append(buf, xs...)
+	return append(buf, ys...)
+}
+
+func (g Glyph) appendComposite(buf []byte) []byte {
+	for i, c := range g.Components {
+		flags := c.Flags &^ (glyfArg1And2AreWords | glyfMoreComponents | glyfWeHaveInstructions)
+		if i < len(g.Components)-1 {
+			flags |= glyfMoreComponents
+		} else if len(g.Instructions) > 0 {
+			flags |= glyfWeHaveInstructions
+		}
+		if flags&glyfArgsAreXYValues != 0 {
+			if c.Argument1 < -0x80 || c.Argument1 > 0x7F || c.Argument2 < -0x80 || c.Argument2 > 0x7F {
+				flags |= glyfArg1And2AreWords
+			}
+		} else if c.Argument1 < 0 || c.Argument1 > 0xFF || c.Argument2 < 0 || c.Argument2 > 0xFF {
+			flags |= glyfArg1And2AreWords
+		}
+		buf = binary.BigEndian.AppendUint16(buf, flags)
+		buf = binary.BigEndian.AppendUint16(buf, c.GlyphIndex)
+		if flags&glyfArg1And2AreWords != 0 {
+			buf = binary.BigEndian.AppendUint16(buf, uint16(c.Argument1))
+			buf = binary.BigEndian.AppendUint16(buf, uint16(c.Argument2))
+		} else {
+			buf = append(buf, uint8(c.Argument1), uint8(c.Argument2))
+		}
+		switch {
+		case flags&glyfWeHaveAScale != 0:
+			buf = binary.BigEndian.AppendUint16(buf, uint16(c.XScale))
+		case flags&glyfWeHaveAnXAndYScale != 0:
+			buf = binary.BigEndian.AppendUint16(buf, uint16(c.XScale))
+			buf = binary.BigEndian.AppendUint16(buf, uint16(c.YScale))
+		case flags&glyfWeHaveATwoByTwo != 0:
+			buf = binary.BigEndian.AppendUint16(buf, uint16(c.XScale))
+			buf = binary.BigEndian.AppendUint16(buf, uint16(c.Scale01))
+			buf = binary.BigEndian.AppendUint16(buf, uint16(c.Scale10))
+			buf = binary.BigEndian.AppendUint16(buf, uint16(c.YScale))
+		}
+	}
+	if len(g.Instructions) > 0 {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(g.Instructions)))
+		buf = append(buf, g.Instructions...)
+	}
+	return buf
+}
@@ -0,0 +1,76 @@
+package fontcompress_test
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+func TestReadGlyfTable(t *testing.T) {
+	ttf, err := font_compress.NewTTF(writeFont(t, fixtureFont()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	loca, err := ttf.Loca()
+	if err != nil {
+		t.Fatal(err)
+	}
+	glyf := glyfTable(t, ttf)
+	if loca.NumGlyphs() != len(fixtureGlyphs) || len(glyf.Glyphs) != len(fixtureGlyphs) {
+		t.Fatalf("got %d loca entries and %d glyphs, want %d", loca.NumGlyphs(), len(glyf.Glyphs), len(fixtureGlyphs))
+	}
+
+	for gid, want := range fixtureGlyphs {
+		g := glyf.Glyphs[gid]
+		xMin, yMin, xMax, yMax := glyphBounds(want)
+		if g.XMin != xMin || g.YMin != yMin || g.XMax != xMax || g.YMax != yMax {
+			t.Errorf("glyph %d bounds = %d %d %d %d, want %d %d %d %d", gid, g.XMin, g.YMin, g.XMax, g.YMax, xMin, yMin, xMax, yMax)
+		}
+		if len(want.components) > 0 {
+			if !g.IsComposite() || len(g.Components) != len(want.components) {
+				t.Fatalf("glyph %d components = %+v, want %v", gid, g.Components, want.components)
+			}
+			for i, c := range g.Components {
+				if c.GlyphIndex != want.components[i] || c.XScale != 1<<14 || c.YScale != 1<<14 {
+					t.Errorf("glyph %d component %d = %+v", gid, i, c)
+				}
+			}
+			continue
+		}
+		var points []font_compress.GlyphPoint
+		for _, p := range want.points {
+			points = append(points, font_compress.GlyphPoint{X: p[0], Y: p[1], OnCurve: true})
+		}
+		if contours := g.Contours(); !reflect.DeepEqual(contours, [][]font_compress.GlyphPoint{points}) {
+			t.Errorf("glyph %d contours = %v, want %v", gid, contours, points)
+		}
+	}
+}
+
+func TestReadCompositeInstructions(t *testing.T) {
+	// Adieresis announces its instructions on the first of its components
+	glyph := encodeFixtureGlyph(fixtureGlyphs[4])
+	binary.BigEndian.PutUint16(glyph[10:], binary.BigEndian.Uint16(glyph[10:])|0x0100) // WE_HAVE_INSTRUCTIONS
+	glyph = append(appendInt16(glyph, 2), 0xB0, 0x01)
+	ttf := readFont(t, assembleFont(font_compress.TTF_MAGIC, fixtureTablesWithGlyph(4, glyph)))
+	g := glyfTable(t, ttf).Glyphs[4]
+	if len(g.Components) != 2 || !reflect.DeepEqual(g.Instructions, []uint8{0xB0, 0x01}) {
+		t.Fatalf("glyph 4 = %+v, want 2 components and instructions b0 01", g)
+	}
+
+	// re-encoded, the instructions are announced on the last component
+	glyf := glyfTable(t, ttf)
+	glyf.Glyphs = append([]font_compress.Glyph(nil), glyf.Glyphs...)
+	glyf.Glyphs[4].Components = append([]font_compress.GlyphComponent(nil), g.Components...)
+	glyf.Glyphs[4].Components[0].Flags &^= 0x0100
+	replaceTable(ttf, glyf)
+	font, err := ttf.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := glyfTable(t, readFont(t, font)).Glyphs[4]; !reflect.DeepEqual(got.Instructions, g.Instructions) {
+		t.Errorf("glyph 4 written with instructions %x, want %x", got.Instructions, g.Instructions)
+	}
+}
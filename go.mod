@@ -1,3 +1,8 @@
 module github.com/RustynailPlease/fontcompress
 
 go 1.21.0
+
+require (
+	github.com/andybalholm/brotli v1.1.1
+	golang.org/x/text v0.21.0
+)
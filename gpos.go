@@ -0,0 +1,1151 @@
+package fontcompress
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/bits"
+	"sort"
+)
+
+// GPOS lookup types
+const (
+	GPOS_LOOKUP_SINGLE           uint16 = 1
+	GPOS_LOOKUP_PAIR             uint16 = 2
+	GPOS_LOOKUP_CURSIVE          uint16 = 3
+	GPOS_LOOKUP_MARK_TO_BASE     uint16 = 4
+	GPOS_LOOKUP_MARK_TO_LIGATURE uint16 = 5
+	GPOS_LOOKUP_MARK_TO_MARK     uint16 = 6
+	GPOS_LOOKUP_CONTEXT          uint16 = 7
+	GPOS_LOOKUP_CHAINED_CONTEXT  uint16 = 8
+	GPOS_LOOKUP_EXTENSION        uint16 = 9
+)
+
+// value formats, the fields a value record has
+const (
+	VALUE_FORMAT_X_PLACEMENT        uint16 = 0x0001
+	VALUE_FORMAT_Y_PLACEMENT        uint16 = 0x0002
+	VALUE_FORMAT_X_ADVANCE          uint16 = 0x0004
+	VALUE_FORMAT_Y_ADVANCE          uint16 = 0x0008
+	VALUE_FORMAT_X_PLACEMENT_DEVICE uint16 = 0x0010
+	VALUE_FORMAT_Y_PLACEMENT_DEVICE uint16 = 0x0020
+	VALUE_FORMAT_X_ADVANCE_DEVICE   uint16 = 0x0040
+	VALUE_FORMAT_Y_ADVANCE_DEVICE   uint16 = 0x0080
+)
+
+// GPOS — Glyph Positioning. Its lookup subtables are SinglePos, PairPos,
+// CursivePos, MarkBasePos, MarkLigPos, MarkMarkPos and SequenceContext.
+type GPOSTable LayoutTable
+
+func (GPOSTable) Tag() Tag { return tagGPOS }
+
+/*
+*
+int16	xPlacement	Horizontal adjustment for placement, in design units.
+int16	yPlacement	Vertical adjustment for placement, in design units.
+int16	xAdvance	Horizontal adjustment for advance, in design units — only used for horizontal layout.
+int16	yAdvance	Vertical adjustment for advance, in design units — only used for vertical layout.
+Offset16	xPlaDeviceOffset	Offset to Device table (non-variable font) / VariationIndex table (variable font) for horizontal placement, from beginning of the immediate parent table
+Offset16	yPlaDeviceOffset	Offset to Device table / VariationIndex table for vertical placement
+Offset16	xAdvDeviceOffset	Offset to Device table / VariationIndex table for horizontal advance
+Offset16	yAdvDeviceOffset	Offset to Device table / VariationIndex table for vertical advance
+
+Only the fields of the value format of the subtable are stored.
+*/
+// ValueRecord adjusts the position of a glyph. Device tables, or the
+// VariationIndex tables of variable fonts, are kept raw; nil if none.
+type ValueRecord struct {
+	XPlacement int16
+	YPlacement int16
+	XAdvance   int16
+	YAdvance   int16
+	XPlaDevice []byte
+	YPlaDevice []byte
+	XAdvDevice []byte
+	YAdvDevice []byte
+}
+
+// Anchor is the point of a glyph another glyph attaches to.
+type Anchor struct {
+	Format      uint16 // 1: coordinates, 2: and a contour point, 3: and device tables
+	X           int16
+	Y           int16
+	AnchorPoint uint16 // format 2, the contour point of the glyph outline
+	// device tables of format 3, kept raw; nil if none
+	XDevice []byte
+	YDevice []byte
+}
+
+// SinglePos adjusts the position of glyphs (lookup type 1).
+type SinglePos struct {
+	ValueFormat uint16 // VALUE_FORMAT_*
+	Values      map[uint16]ValueRecord
+}
+
+// PairPos adjusts the positions of pairs of glyphs, such as kerning pairs
+// (lookup type 2).
+type PairPos struct {
+	Format       uint16 // 1: glyph pairs, 2: class pairs
+	ValueFormat1 uint16 // VALUE_FORMAT_* of the first glyph
+	ValueFormat2 uint16 // VALUE_FORMAT_* of the second glyph
+	// Pairs are the pairs of format 1, by first glyph, sorted by second
+	// glyph.
+	Pairs map[uint16][]PairValue
+	// Coverage lists the first glyphs of format 2, whose pairs are those of
+	// the class of the first glyph in ClassDef1 and of the second one in
+	// ClassDef2.
+	Coverage      Coverage
+	ClassDef1     ClassDef
+	ClassDef2     ClassDef
+	Class1Records [][]Class2Record // by class of ClassDef1, then of ClassDef2
+}
+
+// PairValue is a pair of PairPos format 1.
+type PairValue struct {
+	SecondGlyph uint16
+	Value1      ValueRecord
+	Value2      ValueRecord
+}
+
+// Class2Record adjusts the glyphs of a pair of classes of PairPos format 2.
+type Class2Record struct {
+	Value1 ValueRecord
+	Value2 ValueRecord
+}
+
+// CursivePos connects the exit anchor of glyphs to the entry anchor of the
+// glyphs that follow them (lookup type 3).
+type CursivePos struct {
+	Anchors map[uint16]EntryExit
+}
+
+// EntryExit holds the anchors of a glyph of CursivePos; nil if it has none.
+type EntryExit struct {
+	Entry *Anchor
+	Exit  *Anchor
+}
+
+// MarkRecord is the class and anchor of a mark glyph.
+type MarkRecord struct {
+	Class  uint16
+	Anchor *Anchor
+}
+
+// MarkBasePos attaches marks to the base glyphs before them (lookup type 4).
+type MarkBasePos struct {
+	ClassCount uint16 // number of mark classes
+	Marks      map[uint16]MarkRecord
+	Bases      map[uint16][]*Anchor // by mark class; nil if the base has no anchor
+}
+
+// MarkLigPos attaches marks to the components of the ligatures before them
+// (lookup type 5).
+type MarkLigPos struct {
+	ClassCount uint16 // number of mark classes
+	Marks      map[uint16]MarkRecord
+	Ligatures  map[uint16][][]*Anchor // by component, then mark class
+}
+
+// MarkMarkPos attaches marks to the marks before them (lookup type 6).
+type MarkMarkPos struct {
+	ClassCount uint16 // number of mark classes
+	Marks      map[uint16]MarkRecord
+	BaseMarks  map[uint16][]*Anchor // by mark class; nil if the mark has no anchor
+}
+
+// read GPOS table
+func readGPOSTable(data []byte) (TTFTable, error) {
+	layout, err := readLayoutTable("GPOS", data, GPOS_LOOKUP_EXTENSION, readGPOSSubtable)
+	if err != nil {
+		return nil, err
+	}
+	return GPOSTable(layout), nil
+}
+
+/*
+*
+single adjustment format 1:
+uint16	posFormat	Format identifier: format = 1
+Offset16	coverageOffset	Offset to Coverage table, from beginning of SinglePos subtable
+uint16	valueFormat	Defines the types of data in the ValueRecord
+ValueRecord	valueRecord	Defines positioning value(s) — applied to all glyphs in the Coverage table
+
+single adjustment format 2:
+uint16	posFormat	Format identifier: format = 2
+Offset16	coverageOffset	Offset to Coverage table
+uint16	valueFormat	Defines the types of data in the ValueRecords
+uint16	valueCount	Number of ValueRecords — must equal glyphCount in the Coverage table
+ValueRecord	valueRecords[valueCount]	Array of ValueRecords — positioning values applied to glyphs, ordered by Coverage index
+
+pair adjustment format 1:
+uint16	posFormat	Format identifier: format = 1
+Offset16	coverageOffset	Offset to Coverage table, from beginning of PairPos subtable
+uint16	valueFormat1	Defines the types of data in valueRecord1 — for the first glyph in the pair (may be zero)
+uint16	valueFormat2	Defines the types of data in valueRecord2 — for the second glyph in the pair (may be zero)
+uint16	pairSetCount	Number of PairSet tables
+Offset16	pairSetOffsets[pairSetCount]	Array of offsets to PairSet tables, ordered by Coverage index
+PairSet: uint16 pairValueCount, PairValueRecord{uint16 secondGlyph, ValueRecord valueRecord1, ValueRecord valueRecord2} sorted by secondGlyph; device offsets are from the PairSet
+
+pair adjustment format 2:
+uint16	posFormat	Format identifier: format = 2
+Offset16	coverageOffset	Offset to Coverage table
+uint16	valueFormat1	ValueRecord definition — for the first glyph of the pair (may be zero)
+uint16	valueFormat2	ValueRecord definition — for the second glyph of the pair (may be zero)
+Offset16	classDef1Offset	Offset to ClassDef table, for the first glyph of the pair
+Offset16	classDef2Offset	Offset to ClassDef table, for the second glyph of the pair
+uint16	class1Count	Number of classes in classDef1 table — includes Class 0
+uint16	class2Count	Number of classes in classDef2 table — includes Class 0
+Class1Record	class1Records[class1Count]	Array of Class1 records, ordered by classes in classDef1: Class2Record{ValueRecord valueRecord1, ValueRecord valueRecord2}[class2Count]
+
+cursive attachment format 1:
+uint16	posFormat	Format identifier: format = 1
+Offset16	coverageOffset	Offset to Coverage table, from beginning of CursivePos subtable
+uint16	entryExitCount	Number of EntryExit records
+EntryExitRecord	entryExitRecord[entryExitCount]	Array of EntryExit records, in Coverage index order: Offset16 entryAnchorOffset, Offset16 exitAnchorOffset (may be NULL)
+
+mark-to-base, mark-to-ligature and mark-to-mark attachment format 1:
+uint16	posFormat	Format identifier: format = 1
+Offset16	markCoverageOffset	Offset to the mark (mark1) Coverage table, from beginning of the subtable
+Offset16	baseCoverageOffset	Offset to the base (ligature, mark2) Coverage table
+uint16	markClassCount	Number of classes defined for marks
+Offset16	markArrayOffset	Offset to the MarkArray (mark1 array) table: uint16 markCount, MarkRecord{uint16 markClass, Offset16 markAnchorOffset}[markCount]
+Offset16	baseArrayOffset	Offset to the BaseArray (LigatureArray, Mark2Array) table: uint16 count, Offset16 anchorOffsets[count][markClassCount], from the array
+
+LigatureArray: uint16 ligatureCount, Offset16 ligatureAttachOffsets[ligatureCount], each an anchor array of the components of a ligature
+*/
+func readGPOSSubtable(r *layoutReader, lookupType uint16, off int) (LookupSubtable, error) {
+	switch lookupType {
+	case GPOS_LOOKUP_CONTEXT:
+		return r.sequenceContext(off, false)
+	case GPOS_LOOKUP_CHAINED_CONTEXT:
+		return r.sequenceContext(off, true)
+	case GPOS_LOOKUP_SINGLE, GPOS_LOOKUP_PAIR, GPOS_LOOKUP_CURSIVE, GPOS_LOOKUP_MARK_TO_BASE, GPOS_LOOKUP_MARK_TO_LIGATURE, GPOS_LOOKUP_MARK_TO_MARK:
+	default:
+		return nil, &ParseError{Table: "GPOS", Offset: int64(off), Reason: fmt.Sprintf("unknown lookup type %d", lookupType)}
+	}
+	if err := r.check(off, 6); err != nil {
+		return nil, err
+	}
+	format := r.u16(off)
+	if format != 1 && (format != 2 || lookupType > GPOS_LOOKUP_PAIR) {
+		return nil, &ParseError{Table: "GPOS", Offset: int64(off), Reason: fmt.Sprintf("unknown format %d of lookup type %d", format, lookupType)}
+	}
+	cov, err := r.coverage(off + int(r.u16(off+2)))
+	if err != nil {
+		return nil, err
+	}
+	switch lookupType {
+	case GPOS_LOOKUP_SINGLE:
+		return r.singlePos(off, format, cov)
+	case GPOS_LOOKUP_PAIR:
+		return r.pairPos(off, format, cov)
+	case GPOS_LOOKUP_CURSIVE:
+		n := int(r.u16(off + 4))
+		if err := r.check(off+6, 4*n); err != nil {
+			return nil, err
+		}
+		st := CursivePos{Anchors: make(map[uint16]EntryExit, len(cov))}
+		for i := 0; i < len(cov) && i < n; i++ {
+			var ee EntryExit
+			if ee.Entry, err = r.anchorAt(off, off+6+4*i); err != nil {
+				return nil, err
+			}
+			if ee.Exit, err = r.anchorAt(off, off+6+4*i+2); err != nil {
+				return nil, err
+			}
+			st.Anchors[cov[i]] = ee
+		}
+		return st, nil
+	default: // mark attachment
+		if err := r.check(off, 12); err != nil {
+			return nil, err
+		}
+		bases, err := r.coverage(off + int(r.u16(off+4)))
+		if err != nil {
+			return nil, err
+		}
+		classCount := r.u16(off + 6)
+		marks, err := r.markArray(off+int(r.u16(off+8)), cov)
+		if err != nil {
+			return nil, err
+		}
+		array := off + int(r.u16(off+10))
+		if lookupType == GPOS_LOOKUP_MARK_TO_LIGATURE {
+			st := MarkLigPos{ClassCount: classCount, Marks: marks, Ligatures: make(map[uint16][][]*Anchor, len(bases))}
+			if err := r.check(array, 2); err != nil {
+				return nil, err
+			}
+			attach, err := r.offsets(array, array+2, int(r.u16(array)))
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < len(bases) && i < len(attach); i++ {
+				if attach[i] < 0 {
+					continue
+				}
+				if st.Ligatures[bases[i]], err = r.anchorArray(attach[i], int(classCount)); err != nil {
+					return nil, err
+				}
+			}
+			return st, nil
+		}
+		rows, err := r.anchorArray(array, int(classCount))
+		if err != nil {
+			return nil, err
+		}
+		anchors := make(map[uint16][]*Anchor, len(bases))
+		for i := 0; i < len(bases) && i < len(rows); i++ {
+			anchors[bases[i]] = rows[i]
+		}
+		if lookupType == GPOS_LOOKUP_MARK_TO_MARK {
+			return MarkMarkPos{ClassCount: classCount, Marks: marks, BaseMarks: anchors}, nil
+		}
+		return MarkBasePos{ClassCount: classCount, Marks: marks, Bases: anchors}, nil
+	}
+}
+
+func (r *layoutReader) singlePos(off int, format uint16, cov Coverage) (SinglePos, error) {
+	st := SinglePos{ValueFormat: r.u16(off + 4), Values: make(map[uint16]ValueRecord, len(cov))}
+	if err := checkValueFormat(off+4, st.ValueFormat); err != nil {
+		return SinglePos{}, err
+	}
+	if format == 1 {
+		v, err := r.valueRecord(off, off+6, st.ValueFormat)
+		if err != nil {
+			return SinglePos{}, err
+		}
+		for _, gid := range cov {
+			st.Values[gid] = v
+		}
+		return st, nil
+	}
+	if err := r.check(off+6, 2); err != nil {
+		return SinglePos{}, err
+	}
+	size := valueSize(st.ValueFormat)
+	n := int(r.u16(off + 6))
+	if err := r.check(off+8, n*size); err != nil {
+		return SinglePos{}, err
+	}
+	for i := 0; i < len(cov) && i < n; i++ {
+		v, err := r.valueRecord(off, off+8+i*size, st.ValueFormat)
+		if err != nil {
+			return SinglePos{}, err
+		}
+		st.Values[cov[i]] = v
+	}
+	return st, nil
+}
+
+func (r *layoutReader) pairPos(off int, format uint16, cov Coverage) (PairPos, error) {
+	if err := r.check(off, 10); err != nil {
+		return PairPos{}, err
+	}
+	st := PairPos{Format: format, ValueFormat1: r.u16(off + 4), ValueFormat2: r.u16(off + 6)}
+	if err := checkValueFormat(off+4, st.ValueFormat1); err != nil {
+		return PairPos{}, err
+	}
+	if err := checkValueFormat(off+6, st.ValueFormat2); err != nil {
+		return PairPos{}, err
+	}
+	size1, size2 := valueSize(st.ValueFormat1), valueSize(st.ValueFormat2)
+	var err error
+	if format == 1 {
+		sets, err := r.offsets(off, off+10, int(r.u16(off+8)))
+		if err != nil {
+			return PairPos{}, err
+		}
+		st.Pairs = make(map[uint16][]PairValue, len(cov))
+		for i := 0; i < len(cov) && i < len(sets); i++ {
+			set := sets[i]
+			if set < 0 {
+				continue
+			}
+			if err := r.check(set, 2); err != nil {
+				return PairPos{}, err
+			}
+			n := int(r.u16(set))
+			if err := r.check(set+2, n*(2+size1+size2)); err != nil {
+				return PairPos{}, err
+			}
+			pairs := make([]PairValue, n)
+			for j := range pairs {
+				rec := set + 2 + j*(2+size1+size2)
+				pairs[j].SecondGlyph = r.u16(rec)
+				if pairs[j].Value1, err = r.valueRecord(set, rec+2, st.ValueFormat1); err != nil {
+					return PairPos{}, err
+				}
+				if pairs[j].Value2, err = r.valueRecord(set, rec+2+size1, st.ValueFormat2); err != nil {
+					return PairPos{}, err
+				}
+			}
+			st.Pairs[cov[i]] = pairs
+		}
+		return st, nil
+	}
+
+	if err := r.check(off, 16); err != nil {
+		return PairPos{}, err
+	}
+	st.Coverage = cov
+	if st.ClassDef1, err = r.optionalClassDef(off, off+8); err != nil {
+		return PairPos{}, err
+	}
+	if st.ClassDef2, err = r.optionalClassDef(off, off+10); err != nil {
+		return PairPos{}, err
+	}
+	n1, n2 := int(r.u16(off+12)), int(r.u16(off+14))
+	if err := r.check(off+16, n1*n2*(size1+size2)); err != nil {
+		return PairPos{}, err
+	}
+	st.Class1Records = make([][]Class2Record, n1)
+	for i := range st.Class1Records {
+		st.Class1Records[i] = make([]Class2Record, n2)
+		for j := range st.Class1Records[i] {
+			rec := off + 16 + (i*n2+j)*(size1+size2)
+			if st.Class1Records[i][j].Value1, err = r.valueRecord(off, rec, st.ValueFormat1); err != nil {
+				return PairPos{}, err
+			}
+			if st.Class1Records[i][j].Value2, err = r.valueRecord(off, rec+size1, st.ValueFormat2); err != nil {
+				return PairPos{}, err
+			}
+		}
+	}
+	return st, nil
+}
+
+// checkValueFormat reports a *ParseError if the value format at off has
+// reserved bits.
+func checkValueFormat(off int, format uint16) error {
+	if format&0xFF00 != 0 {
+		return &ParseError{Table: "GPOS", Offset: int64(off), Reason: fmt.Sprintf("unknown value format %#04x", format)}
+	}
+	return nil
+}
+
+// valueSize returns the size of the value records of a value format.
+func valueSize(format uint16) int {
+	return 2 * bits.OnesCount16(format&0xFF)
+}
+
+// fields returns the coordinates and device tables of the value record, in
+// the order of the value format bits.
+func (v *ValueRecord) fields() ([4]*int16, [4]*[]byte) {
+	return [4]*int16{&v.XPlacement, &v.YPlacement, &v.XAdvance, &v.YAdvance},
+		[4]*[]byte{&v.XPlaDevice, &v.YPlaDevice, &v.XAdvDevice, &v.YAdvDevice}
+}
+
+// valueRecord reads the value record of a value format at at; device
+// offsets are relative to base.
+func (r *layoutReader) valueRecord(base, at int, format uint16) (ValueRecord, error) {
+	// value records may be empty, they are charged anyway
+	if err := r.check(at, valueSize(format)); err != nil {
+		return ValueRecord{}, err
+	}
+	if err := r.charge(at, 8); err != nil {
+		return ValueRecord{}, err
+	}
+	var v ValueRecord
+	coords, devices := v.fields()
+	for i := 0; i < 8; i++ {
+		if format&(1<<i) == 0 {
+			continue
+		}
+		value := r.u16(at)
+		at += 2
+		switch {
+		case i < 4:
+			*coords[i] = int16(value)
+		case value != 0:
+			dev, err := r.device(base + int(value))
+			if err != nil {
+				return ValueRecord{}, err
+			}
+			*devices[i-4] = dev
+		}
+	}
+	return v, nil
+}
+
+/*
+*
+anchor format 1:
+uint16	anchorFormat	Format identifier, = 1
+int16	xCoordinate	Horizontal value, in design units
+int16	yCoordinate	Vertical value, in design units
+
+anchor format 2 adds uint16 anchorPoint, the index to glyph contour point.
+anchor format 3 adds Offset16 xDeviceOffset and Offset16 yDeviceOffset, from beginning of the Anchor table (may be NULL).
+*/
+func (r *layoutReader) anchor(off int) (*Anchor, error) {
+	if err := r.check(off, 6); err != nil {
+		return nil, err
+	}
+	a := &Anchor{Format: r.u16(off), X: int16(r.u16(off + 2)), Y: int16(r.u16(off + 4))}
+	switch a.Format {
+	case 1:
+	case 2:
+		if err := r.check(off+6, 2); err != nil {
+			return nil, err
+		}
+		a.AnchorPoint = r.u16(off + 6)
+	case 3:
+		if err := r.check(off+6, 4); err != nil {
+			return nil, err
+		}
+		var err error
+		for i, dev := range []*[]byte{&a.XDevice, &a.YDevice} {
+			if o := int(r.u16(off + 6 + 2*i)); o != 0 {
+				if *dev, err = r.device(off + o); err != nil {
+					return nil, err
+				}
+			}
+		}
+	default:
+		return nil, &ParseError{Table: r.table, Offset: int64(off), Reason: fmt.Sprintf("unknown anchor format %d", a.Format)}
+	}
+	return a, nil
+}
+
+// anchorAt reads the anchor at the offset stored at at, relative to base;
+// nil for a null offset.
+func (r *layoutReader) anchorAt(base, at int) (*Anchor, error) {
+	if o := int(r.u16(at)); o != 0 {
+		return r.anchor(base + o)
+	}
+	return nil, nil
+}
+
+// markArray reads the mark array at off, of the marks of cov.
+func (r *layoutReader) markArray(off int, cov Coverage) (map[uint16]MarkRecord, error) {
+	if err := r.check(off, 2); err != nil {
+		return nil, err
+	}
+	n := int(r.u16(off))
+	if err := r.check(off+2, 4*n); err != nil {
+		return nil, err
+	}
+	marks := make(map[uint16]MarkRecord, len(cov))
+	for i := 0; i < len(cov) && i < n; i++ {
+		a, err := r.anchorAt(off, off+2+4*i+2)
+		if err != nil {
+			return nil, err
+		}
+		marks[cov[i]] = MarkRecord{Class: r.u16(off + 2 + 4*i), Anchor: a}
+	}
+	return marks, nil
+}
+
+// anchorArray reads the rows of classCount anchors at off.
+func (r *layoutReader) anchorArray(off, classCount int) ([][]*Anchor, error) {
+	if err := r.check(off, 2); err != nil {
+		return nil, err
+	}
+	n := int(r.u16(off))
+	offs, err := r.offsets(off, off+2, n*classCount)
+	if err != nil {
+		return nil, err
+	}
+	// rows without classes are charged anyway
+	if err := r.charge(off, 8*n); err != nil {
+		return nil, err
+	}
+	rows := make([][]*Anchor, n)
+	for i := range rows {
+		rows[i] = make([]*Anchor, classCount)
+		for j := range rows[i] {
+			if o := offs[i*classCount+j]; o >= 0 {
+				if rows[i][j], err = r.anchor(o); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return rows, nil
+}
+
+// encode serializes the GPOS table.
+func (gpos GPOSTable) encode() ([]byte, error) {
+	return LayoutTable(gpos).encode(GPOS_LOOKUP_EXTENSION)
+}
+
+// masked returns the value record with the fields of format only.
+func (v ValueRecord) masked(format uint16) ValueRecord {
+	coords, devices := v.fields()
+	for i := 0; i < 8; i++ {
+		switch {
+		case format&(1<<i) != 0:
+		case i < 4:
+			*coords[i] = 0
+		default:
+			*devices[i-4] = nil
+		}
+	}
+	return v
+}
+
+func (v ValueRecord) equal(w ValueRecord) bool {
+	return v.XPlacement == w.XPlacement && v.YPlacement == w.YPlacement && v.XAdvance == w.XAdvance && v.YAdvance == w.YAdvance &&
+		bytes.Equal(v.XPlaDevice, w.XPlaDevice) && bytes.Equal(v.YPlaDevice, w.YPlaDevice) &&
+		bytes.Equal(v.XAdvDevice, w.XAdvDevice) && bytes.Equal(v.YAdvDevice, w.YAdvDevice)
+}
+
+// appendValueRecord appends the fields of format of v; device offsets are
+// written by linkDevices.
+func appendValueRecord(buf []byte, v ValueRecord, format uint16) []byte {
+	coords, _ := v.fields()
+	for i := 0; i < 8; i++ {
+		if format&(1<<i) == 0 {
+			continue
+		}
+		value := uint16(0)
+		if i < 4 {
+			value = uint16(*coords[i])
+		}
+		buf = appendUint16s(buf, value)
+	}
+	return buf
+}
+
+// linkDevices stores the device tables of the value record of format
+// appended at at.
+func (b *subtableBuffer) linkDevices(at int, v ValueRecord, format uint16) error {
+	_, devices := v.fields()
+	for i := 0; i < 8; i++ {
+		if format&(1<<i) == 0 {
+			continue
+		}
+		if i >= 4 && *devices[i-4] != nil {
+			if err := b.link(at, *devices[i-4]); err != nil {
+				return err
+			}
+		}
+		at += 2
+	}
+	return nil
+}
+
+func (a Anchor) encode() ([]byte, error) {
+	switch a.Format {
+	case 1:
+		return appendUint16s(nil, 1, uint16(a.X), uint16(a.Y)), nil
+	case 2:
+		return appendUint16s(nil, 2, uint16(a.X), uint16(a.Y), a.AnchorPoint), nil
+	case 3:
+		b := subtableBuffer{buf: appendUint16s(nil, 3, uint16(a.X), uint16(a.Y), 0, 0)}
+		for i, dev := range [][]byte{a.XDevice, a.YDevice} {
+			if dev != nil {
+				if err := b.link(6+2*i, dev); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return b.buf, nil
+	}
+	return nil, fmt.Errorf("unknown anchor format %d", a.Format)
+}
+
+// linkAnchor stores the anchor and writes its offset at field; nil anchors
+// leave a null offset.
+func (b *subtableBuffer) linkAnchor(field int, a *Anchor) error {
+	if a == nil {
+		return nil
+	}
+	data, err := a.encode()
+	if err != nil {
+		return err
+	}
+	return b.link(field, data)
+}
+
+func (st SinglePos) encode() ([]byte, error) {
+	gids := make([]uint16, 0, len(st.Values))
+	for gid := range st.Values {
+		gids = append(gids, gid)
+	}
+	cov, err := Coverage(sortGlyphs(gids)).encode()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]ValueRecord, len(gids))
+	format1 := true
+	for i, gid := range gids {
+		values[i] = st.Values[gid].masked(st.ValueFormat)
+		format1 = format1 && values[i].equal(values[0])
+	}
+	if len(values) == 0 {
+		values = []ValueRecord{{}}
+	}
+	var b subtableBuffer
+	if format1 {
+		b.buf = appendValueRecord(appendUint16s(nil, 1, 0, st.ValueFormat), values[0], st.ValueFormat)
+		if err := b.linkDevices(6, values[0], st.ValueFormat); err != nil {
+			return nil, err
+		}
+	} else {
+		b.buf = appendUint16s(nil, 2, 0, st.ValueFormat, uint16(len(values)))
+		for _, v := range values {
+			b.buf = appendValueRecord(b.buf, v, st.ValueFormat)
+		}
+		for i, v := range values {
+			if err := b.linkDevices(8+i*valueSize(st.ValueFormat), v, st.ValueFormat); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := b.link(2, cov); err != nil {
+		return nil, err
+	}
+	return b.buf, nil
+}
+
+func (st PairPos) encode() ([]byte, error) {
+	size1, size2 := valueSize(st.ValueFormat1), valueSize(st.ValueFormat2)
+	switch st.Format {
+	case 1:
+		gids := make([]uint16, 0, len(st.Pairs))
+		for gid := range st.Pairs {
+			gids = append(gids, gid)
+		}
+		cov, err := Coverage(sortGlyphs(gids)).encode()
+		if err != nil {
+			return nil, err
+		}
+		b := subtableBuffer{buf: appendUint16s(nil, 1, 0, st.ValueFormat1, st.ValueFormat2, uint16(len(gids)))}
+		b.buf = append(b.buf, make([]byte, 2*len(gids))...)
+		if err := b.link(2, cov); err != nil {
+			return nil, err
+		}
+		for i, gid := range gids {
+			pairs := append([]PairValue(nil), st.Pairs[gid]...)
+			if len(pairs) > 0xFFFF {
+				return nil, fmt.Errorf("glyph %d has %d pairs", gid, len(pairs))
+			}
+			sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].SecondGlyph < pairs[j].SecondGlyph })
+			set := subtableBuffer{buf: appendUint16s(nil, uint16(len(pairs)))}
+			for _, p := range pairs {
+				set.buf = appendValueRecord(appendUint16s(set.buf, p.SecondGlyph), p.Value1, st.ValueFormat1)
+				set.buf = appendValueRecord(set.buf, p.Value2, st.ValueFormat2)
+			}
+			for j, p := range pairs {
+				rec := 2 + j*(2+size1+size2)
+				if err := set.linkDevices(rec+2, p.Value1, st.ValueFormat1); err != nil {
+					return nil, err
+				}
+				if err := set.linkDevices(rec+2+size1, p.Value2, st.ValueFormat2); err != nil {
+					return nil, err
+				}
+			}
+			if err := b.link(10+2*i, set.buf); err != nil {
+				return nil, err
+			}
+		}
+		return b.buf, nil
+	case 2:
+		cov, err := st.Coverage.encode()
+		if err != nil {
+			return nil, err
+		}
+		n1, n2 := len(st.Class1Records), 0
+		if n1 > 0 {
+			n2 = len(st.Class1Records[0])
+		}
+		if n1 > 0xFFFF || n2 > 0xFFFF {
+			return nil, fmt.Errorf("pair positioning has %d by %d classes", n1, n2)
+		}
+		b := subtableBuffer{buf: appendUint16s(nil, 2, 0, st.ValueFormat1, st.ValueFormat2, 0, 0, uint16(n1), uint16(n2))}
+		for _, row := range st.Class1Records {
+			if len(row) != n2 {
+				return nil, errors.New("pair positioning class records differ in length")
+			}
+			for _, rec := range row {
+				b.buf = appendValueRecord(b.buf, rec.Value1, st.ValueFormat1)
+				b.buf = appendValueRecord(b.buf, rec.Value2, st.ValueFormat2)
+			}
+		}
+		if err := b.link(2, cov); err != nil {
+			return nil, err
+		}
+		if err := b.link(8, st.ClassDef1.encode()); err != nil {
+			return nil, err
+		}
+		if err := b.link(10, st.ClassDef2.encode()); err != nil {
+			return nil, err
+		}
+		for i, row := range st.Class1Records {
+			for j, rec := range row {
+				at := 16 + (i*n2+j)*(size1+size2)
+				if err := b.linkDevices(at, rec.Value1, st.ValueFormat1); err != nil {
+					return nil, err
+				}
+				if err := b.linkDevices(at+size1, rec.Value2, st.ValueFormat2); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return b.buf, nil
+	}
+	return nil, fmt.Errorf("unknown pair positioning format %d", st.Format)
+}
+
+func (st CursivePos) encode() ([]byte, error) {
+	gids := make([]uint16, 0, len(st.Anchors))
+	for gid := range st.Anchors {
+		gids = append(gids, gid)
+	}
+	cov, err := Coverage(sortGlyphs(gids)).encode()
+	if err != nil {
+		return nil, err
+	}
+	b := subtableBuffer{buf: appendUint16s(nil, 1, 0, uint16(len(gids)))}
+	b.buf = append(b.buf, make([]byte, 4*len(gids))...)
+	if err := b.link(2, cov); err != nil {
+		return nil, err
+	}
+	for i, gid := range gids {
+		if err := b.linkAnchor(6+4*i, st.Anchors[gid].Entry); err != nil {
+			return nil, err
+		}
+		if err := b.linkAnchor(6+4*i+2, st.Anchors[gid].Exit); err != nil {
+			return nil, err
+		}
+	}
+	return b.buf, nil
+}
+
+func (st MarkBasePos) encode() ([]byte, error) {
+	return encodeMarkAttachment(st.Marks, st.ClassCount, st.Bases, nil)
+}
+
+func (st MarkLigPos) encode() ([]byte, error) {
+	return encodeMarkAttachment(st.Marks, st.ClassCount, nil, st.Ligatures)
+}
+
+func (st MarkMarkPos) encode() ([]byte, error) {
+	return encodeMarkAttachment(st.Marks, st.ClassCount, st.BaseMarks, nil)
+}
+
+// encodeMarkAttachment serializes a mark attachment subtable, with the
+// anchors of bases or, for mark-to-ligature subtables, of ligatures.
+func encodeMarkAttachment(marks map[uint16]MarkRecord, classCount uint16, bases map[uint16][]*Anchor, ligatures map[uint16][][]*Anchor) ([]byte, error) {
+	markGids := make([]uint16, 0, len(marks))
+	for gid := range marks {
+		markGids = append(markGids, gid)
+	}
+	markCov, err := Coverage(sortGlyphs(markGids)).encode()
+	if err != nil {
+		return nil, err
+	}
+	markArray := subtableBuffer{buf: appendUint16s(nil, uint16(len(markGids)))}
+	for _, gid := range markGids {
+		markArray.buf = appendUint16s(markArray.buf, marks[gid].Class, 0)
+	}
+	for i, gid := range markGids {
+		if err := markArray.linkAnchor(2+4*i+2, marks[gid].Anchor); err != nil {
+			return nil, err
+		}
+	}
+
+	var baseGids []uint16
+	for gid := range bases {
+		baseGids = append(baseGids, gid)
+	}
+	for gid := range ligatures {
+		baseGids = append(baseGids, gid)
+	}
+	baseCov, err := Coverage(sortGlyphs(baseGids)).encode()
+	if err != nil {
+		return nil, err
+	}
+	var baseArray []byte
+	if ligatures == nil {
+		rows := make([][]*Anchor, len(baseGids))
+		for i, gid := range baseGids {
+			rows[i] = bases[gid]
+		}
+		if baseArray, err = encodeAnchorArray(rows, classCount); err != nil {
+			return nil, err
+		}
+	} else {
+		ligArray := subtableBuffer{buf: appendUint16s(nil, uint16(len(baseGids)))}
+		ligArray.buf = append(ligArray.buf, make([]byte, 2*len(baseGids))...)
+		for i, gid := range baseGids {
+			attach, err := encodeAnchorArray(ligatures[gid], classCount)
+			if err != nil {
+				return nil, err
+			}
+			if err := ligArray.link(2+2*i, attach); err != nil {
+				return nil, err
+			}
+		}
+		baseArray = ligArray.buf
+	}
+
+	b := subtableBuffer{buf: appendUint16s(nil, 1, 0, 0, classCount, 0, 0)}
+	for _, link := range []struct {
+		field int
+		data  []byte
+	}{{2, markCov}, {4, baseCov}, {8, markArray.buf}, {10, baseArray}} {
+		if err := b.link(link.field, link.data); err != nil {
+			return nil, err
+		}
+	}
+	return b.buf, nil
+}
+
+// encodeAnchorArray serializes rows of classCount anchors.
+func encodeAnchorArray(rows [][]*Anchor, classCount uint16) ([]byte, error) {
+	if len(rows) > 0xFFFF {
+		return nil, fmt.Errorf("anchor array has %d rows", len(rows))
+	}
+	b := subtableBuffer{buf: appendUint16s(nil, uint16(len(rows)))}
+	b.buf = append(b.buf, make([]byte, 2*len(rows)*int(classCount))...)
+	for i, row := range rows {
+		if len(row) != int(classCount) {
+			return nil, fmt.Errorf("anchor array row has %d anchors for %d mark classes", len(row), classCount)
+		}
+		for j, a := range row {
+			if err := b.linkAnchor(2+2*(i*int(classCount)+j), a); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return b.buf, nil
+}
+
+func (st SinglePos) subset(newID map[uint16]uint16) LookupSubtable {
+	sub := SinglePos{ValueFormat: st.ValueFormat, Values: make(map[uint16]ValueRecord)}
+	for gid, v := range st.Values {
+		if id, ok := newID[gid]; ok {
+			sub.Values[id] = v
+		}
+	}
+	if len(sub.Values) == 0 {
+		return nil
+	}
+	return sub
+}
+
+func (st PairPos) subset(newID map[uint16]uint16) LookupSubtable {
+	sub := PairPos{Format: st.Format, ValueFormat1: st.ValueFormat1, ValueFormat2: st.ValueFormat2}
+	switch st.Format {
+	case 1:
+		sub.Pairs = make(map[uint16][]PairValue)
+		for gid, pairs := range st.Pairs {
+			id, ok := newID[gid]
+			if !ok {
+				continue
+			}
+			var kept []PairValue
+			for _, p := range pairs {
+				if second, ok := newID[p.SecondGlyph]; ok {
+					p.SecondGlyph = second
+					kept = append(kept, p)
+				}
+			}
+			if len(kept) > 0 {
+				sort.SliceStable(kept, func(i, j int) bool { return kept[i].SecondGlyph < kept[j].SecondGlyph })
+				sub.Pairs[id] = kept
+			}
+		}
+		if len(sub.Pairs) == 0 {
+			return nil
+		}
+	case 2:
+		if sub.Coverage = st.Coverage.subset(newID); len(sub.Coverage) == 0 {
+			return nil
+		}
+		// only the classes of the first glyphs of pairs matter in ClassDef1
+		first := make(ClassDef)
+		for _, gid := range st.Coverage {
+			if class, ok := st.ClassDef1[gid]; ok {
+				first[gid] = class
+			}
+		}
+		n2 := 0
+		if len(st.Class1Records) > 0 {
+			n2 = len(st.Class1Records[0])
+		}
+		var classes1, classes2 []uint16
+		sub.ClassDef1, classes1 = compactClasses(first.subset(newID), len(st.Class1Records))
+		sub.ClassDef2, classes2 = compactClasses(st.ClassDef2.subset(newID), n2)
+		sub.Class1Records = make([][]Class2Record, len(classes1))
+		for i, c1 := range classes1 {
+			sub.Class1Records[i] = make([]Class2Record, len(classes2))
+			for j, c2 := range classes2 {
+				if int(c2) < len(st.Class1Records[c1]) {
+					sub.Class1Records[i][j] = st.Class1Records[c1][c2]
+				}
+			}
+		}
+	default:
+		return nil
+	}
+	return sub
+}
+
+// compactClasses renumbers the classes below n that glyphs of cd are in
+// from 1, in order, and returns the new class definition and the old class
+// of each new class, starting with class 0. Glyphs of classes n and beyond
+// are dropped.
+func compactClasses(cd ClassDef, n int) (ClassDef, []uint16) {
+	used := make(map[uint16]bool)
+	for _, class := range cd {
+		if int(class) < n {
+			used[class] = true
+		}
+	}
+	old := []uint16{0}
+	for class := range used {
+		old = append(old, class)
+	}
+	sortGlyphs(old[1:])
+	renumbered := make(map[uint16]uint16, len(old))
+	for i, class := range old {
+		renumbered[class] = uint16(i)
+	}
+	sub := make(ClassDef, len(cd))
+	for gid, class := range cd {
+		if int(class) < n {
+			sub[gid] = renumbered[class]
+		}
+	}
+	if n == 0 {
+		old = nil
+	}
+	return sub, old
+}
+
+func (st CursivePos) subset(newID map[uint16]uint16) LookupSubtable {
+	sub := CursivePos{Anchors: make(map[uint16]EntryExit)}
+	for gid, ee := range st.Anchors {
+		if id, ok := newID[gid]; ok {
+			sub.Anchors[id] = ee
+		}
+	}
+	if len(sub.Anchors) == 0 {
+		return nil
+	}
+	return sub
+}
+
+// subsetMarks returns the retained marks, renumbered, with their classes
+// renumbered to those still in use, and the old class of each new class.
+func subsetMarks(marks map[uint16]MarkRecord, classCount uint16, newID map[uint16]uint16) (map[uint16]MarkRecord, []uint16) {
+	cd := make(ClassDef)
+	for gid, m := range marks {
+		if id, ok := newID[gid]; ok {
+			// class 0 of a ClassDef holds the glyphs it does not list
+			cd[id] = m.Class + 1
+		}
+	}
+	cd, old := compactClasses(cd, int(classCount)+1)
+	sub := make(map[uint16]MarkRecord, len(cd))
+	for gid, m := range marks {
+		if id, ok := newID[gid]; ok {
+			if class, ok := cd[id]; ok {
+				sub[id] = MarkRecord{Class: class - 1, Anchor: m.Anchor}
+			}
+		}
+	}
+	classes := old[1:]
+	for i := range classes {
+		classes[i]--
+	}
+	return sub, classes
+}
+
+// selectAnchors returns the anchors of classes.
+func selectAnchors(anchors []*Anchor, classes []uint16) []*Anchor {
+	sub := make([]*Anchor, len(classes))
+	for i, class := range classes {
+		if int(class) < len(anchors) {
+			sub[i] = anchors[class]
+		}
+	}
+	return sub
+}
+
+// subsetAnchors returns the anchors of the glyphs of newID, renumbered, for
+// the mark classes of classes.
+func subsetAnchors(bases map[uint16][]*Anchor, classes []uint16, newID map[uint16]uint16) map[uint16][]*Anchor {
+	sub := make(map[uint16][]*Anchor)
+	for gid, anchors := range bases {
+		if id, ok := newID[gid]; ok {
+			sub[id] = selectAnchors(anchors, classes)
+		}
+	}
+	return sub
+}
+
+func (st MarkBasePos) subset(newID map[uint16]uint16) LookupSubtable {
+	marks, classes := subsetMarks(st.Marks, st.ClassCount, newID)
+	bases := subsetAnchors(st.Bases, classes, newID)
+	if len(marks) == 0 || len(bases) == 0 {
+		return nil
+	}
+	return MarkBasePos{ClassCount: uint16(len(classes)), Marks: marks, Bases: bases}
+}
+
+func (st MarkLigPos) subset(newID map[uint16]uint16) LookupSubtable {
+	marks, classes := subsetMarks(st.Marks, st.ClassCount, newID)
+	ligatures := make(map[uint16][][]*Anchor)
+	for gid, components := range st.Ligatures {
+		id, ok := newID[gid]
+		if !ok {
+			continue
+		}
+		anchors := make([][]*Anchor, len(components))
+		for i, c := range components {
+			anchors[i] = selectAnchors(c, classes)
+		}
+		ligatures[id] = anchors
+	}
+	if len(marks) == 0 || len(ligatures) == 0 {
+		return nil
+	}
+	return MarkLigPos{ClassCount: uint16(len(classes)), Marks: marks, Ligatures: ligatures}
+}
+
+func (st MarkMarkPos) subset(newID map[uint16]uint16) LookupSubtable {
+	marks, classes := subsetMarks(st.Marks, st.ClassCount, newID)
+	bases := subsetAnchors(st.BaseMarks, classes, newID)
+	if len(marks) == 0 || len(bases) == 0 {
+		return nil
+	}
+	return MarkMarkPos{ClassCount: uint16(len(classes)), Marks: marks, BaseMarks: bases}
+}
+
+// Attachment lookups do not count towards usMaxContext.
+func (SinglePos) maxContext() int   { return 1 }
+func (PairPos) maxContext() int     { return 2 }
+func (CursivePos) maxContext() int  { return 0 }
+func (MarkBasePos) maxContext() int { return 0 }
+func (MarkLigPos) maxContext() int  { return 0 }
+func (MarkMarkPos) maxContext() int { return 0 }
+
+// subset returns the table for the glyphs of newID, renumbered, as
+// LayoutTable.subset does. Pairs and anchors of dropped glyphs are removed
+// and so are the classes and mark classes left without glyphs.
+func (gpos GPOSTable) subset(newID map[uint16]uint16) GPOSTable {
+	return GPOSTable(LayoutTable(gpos).subset(newID))
+}
+
+// MaxContext returns the length of the longest glyph context of the
+// lookups, as OS/2 usMaxContext counts it.
+func (gpos GPOSTable) MaxContext() int {
+	return LayoutTable(gpos).maxContext()
+}
+
+// GPOS returns the GPOS table, decoding it on first use.
+func (ttf *TTF) GPOS() (GPOSTable, error) {
+	table, err := ttf.decodeTable(tagGPOS, readGPOSTable)
+	if err != nil {
+		return GPOSTable{}, err
+	}
+	gpos, ok := table.(GPOSTable)
+	if !ok {
+		return GPOSTable{}, fmt.Errorf("GPOS table holds a %T", table)
+	}
+	return gpos, nil
+}
@@ -0,0 +1,234 @@
+package fontcompress_test
+
+import (
+	"reflect"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+// fixtureDevice corrects by 1, 1 and 0 units at 12 to 14 ppem.
+var fixtureDevice = appendInt16(nil, 12, 14, 1, 0x5400)
+
+// fixtureGPOS returns a GPOS table for the fixture glyphs. 'kern' kerns A
+// with B and C by glyph and by class and raises A and B through an
+// extension lookup, 'mark' attaches dieresis to A and B.
+func fixtureGPOS() []byte {
+	script := linkTables(appendInt16(nil, 0, 0), link{0, appendInt16(nil, 0, -1, 2, 0, 1)})
+	scriptList := linkTables(appendInt16(appendTag(appendInt16(nil, 1), "DFLT"), 0), link{2 + 4, script})
+
+	features := appendInt16(appendTag(appendInt16(nil, 2), "kern"), 0)
+	features = appendInt16(appendTag(features, "mark"), 0)
+	featureList := linkTables(features,
+		link{2 + 4, appendInt16(nil, 0, 3, 0, 1, 3)},
+		link{2 + 6 + 4, appendInt16(nil, 0, 1, 2)})
+
+	glyphPairs := linkTables(appendInt16(nil, 1, 0, 4, 0, 1, 0),
+		link{2, appendInt16(nil, 1, 1, 1)},
+		link{10, appendInt16(nil, 2, 2, -50, 5, -30)})
+	classPairs := linkTables(appendInt16(nil, 2, 0, 4, 0, 0, 0, 2, 3, 0, -10, -20, 0, -40, 0),
+		link{2, appendInt16(nil, 1, 3, 1, 2, 5)},
+		link{8, appendInt16(nil, 1, 2, 4, 1, 0, 0, 1)},
+		link{10, appendInt16(nil, 2, 2, 1, 1, 1, 6, 6, 2)})
+	markArray := linkTables(appendInt16(nil, 1, 0, 0), link{4, appendInt16(nil, 1, 250, 700)})
+	baseArray := linkTables(appendInt16(nil, 2, 0, 0),
+		link{2, appendInt16(nil, 2, 250, 650, 3)},
+		link{4, linkTables(appendInt16(nil, 3, 300, 650, 0, 0), link{6, fixtureDevice})})
+	markBase := linkTables(appendInt16(nil, 1, 0, 0, 1, 0, 0),
+		link{2, appendInt16(nil, 1, 1, 3)},
+		link{4, appendInt16(nil, 1, 2, 1, 2)},
+		link{8, markArray},
+		link{10, baseArray})
+	single := linkTables(appendInt16(nil, 1, 0, 2, 10), link{2, appendInt16(nil, 2, 1, 1, 2, 0)})
+	extension := append(appendInt16(nil, 1, 1, 0, 8), single...)
+	lookupList := linkTables(appendInt16(nil, 4, 0, 0, 0, 0),
+		link{2, linkTables(appendInt16(nil, 2, 0, 1, 0), link{6, glyphPairs})},
+		link{4, linkTables(appendInt16(nil, 2, 0, 1, 0), link{6, classPairs})},
+		link{6, linkTables(appendInt16(nil, 4, 0, 1, 0), link{6, markBase})},
+		link{8, linkTables(appendInt16(nil, 9, 0, 1, 0), link{6, extension})})
+
+	return linkTables(appendInt16(nil, 1, 0, 0, 0, 0), link{4, scriptList}, link{6, featureList}, link{8, lookupList})
+}
+
+// fixtureGPOSTable is fixtureGPOS decoded.
+var fixtureGPOSTable = font_compress.GPOSTable{
+	MajorVersion: 1,
+	Scripts: []font_compress.ScriptRecord{{
+		Tag:            mustTag("DFLT"),
+		DefaultLangSys: &font_compress.LangSys{RequiredFeatureIndex: 0xFFFF, FeatureIndices: []uint16{0, 1}},
+	}},
+	Features: []font_compress.FeatureRecord{
+		{Tag: mustTag("kern"), Feature: font_compress.Feature{LookupListIndices: []uint16{0, 1, 3}}},
+		{Tag: mustTag("mark"), Feature: font_compress.Feature{LookupListIndices: []uint16{2}}},
+	},
+	Lookups: []font_compress.Lookup{
+		{Type: font_compress.GPOS_LOOKUP_PAIR, Subtables: []font_compress.LookupSubtable{
+			font_compress.PairPos{Format: 1, ValueFormat1: font_compress.VALUE_FORMAT_X_ADVANCE, Pairs: map[uint16][]font_compress.PairValue{
+				1: {{SecondGlyph: 2, Value1: font_compress.ValueRecord{XAdvance: -50}}, {SecondGlyph: 5, Value1: font_compress.ValueRecord{XAdvance: -30}}},
+			}},
+		}},
+		{Type: font_compress.GPOS_LOOKUP_PAIR, Subtables: []font_compress.LookupSubtable{
+			font_compress.PairPos{Format: 2, ValueFormat1: font_compress.VALUE_FORMAT_X_ADVANCE,
+				Coverage: font_compress.Coverage{1, 2, 5}, ClassDef1: font_compress.ClassDef{2: 1, 5: 1}, ClassDef2: font_compress.ClassDef{1: 1, 6: 2},
+				Class1Records: [][]font_compress.Class2Record{
+					{{}, {Value1: font_compress.ValueRecord{XAdvance: -10}}, {Value1: font_compress.ValueRecord{XAdvance: -20}}},
+					{{}, {Value1: font_compress.ValueRecord{XAdvance: -40}}, {}},
+				}},
+		}},
+		{Type: font_compress.GPOS_LOOKUP_MARK_TO_BASE, Subtables: []font_compress.LookupSubtable{
+			font_compress.MarkBasePos{ClassCount: 1,
+				Marks: map[uint16]font_compress.MarkRecord{3: {Anchor: &font_compress.Anchor{Format: 1, X: 250, Y: 700}}},
+				Bases: map[uint16][]*font_compress.Anchor{
+					1: {{Format: 2, X: 250, Y: 650, AnchorPoint: 3}},
+					2: {{Format: 3, X: 300, Y: 650, XDevice: fixtureDevice}},
+				}},
+		}},
+		{Type: font_compress.GPOS_LOOKUP_SINGLE, Extension: true, Subtables: []font_compress.LookupSubtable{
+			font_compress.SinglePos{ValueFormat: font_compress.VALUE_FORMAT_Y_PLACEMENT, Values: map[uint16]font_compress.ValueRecord{
+				1: {YPlacement: 10}, 2: {YPlacement: 10},
+			}},
+		}},
+	},
+}
+
+func TestReadGPOSTable(t *testing.T) {
+	ttf := readFont(t, fixtureFontWith(map[string][]byte{"GPOS": fixtureGPOS()}))
+	gpos, err := ttf.GPOS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gpos, fixtureGPOSTable) {
+		t.Errorf("GPOS = %+v, want %+v", gpos, fixtureGPOSTable)
+	}
+	if n := gpos.MaxContext(); n != 2 {
+		t.Errorf("MaxContext = %d, want 2", n)
+	}
+}
+
+func TestWriteGPOSTable(t *testing.T) {
+	ttf := readFont(t, fixtureFontWith(map[string][]byte{"GPOS": fixtureGPOS()}))
+	gpos, err := ttf.GPOS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	anchor := &font_compress.Anchor{Format: 1, X: 100, Y: -20}
+	want := fixtureGPOSTable
+	want.Lookups = append(append([]font_compress.Lookup(nil), gpos.Lookups...), font_compress.Lookup{
+		Type: font_compress.GPOS_LOOKUP_SINGLE, Subtables: []font_compress.LookupSubtable{
+			font_compress.SinglePos{ValueFormat: font_compress.VALUE_FORMAT_X_PLACEMENT | font_compress.VALUE_FORMAT_X_PLACEMENT_DEVICE, Values: map[uint16]font_compress.ValueRecord{
+				1: {XPlacement: 5, XPlaDevice: fixtureDevice}, 5: {XPlacement: 6},
+			}},
+		},
+	}, font_compress.Lookup{
+		Type: font_compress.GPOS_LOOKUP_PAIR, Subtables: []font_compress.LookupSubtable{
+			font_compress.PairPos{Format: 1, ValueFormat2: font_compress.VALUE_FORMAT_X_ADVANCE | font_compress.VALUE_FORMAT_X_ADVANCE_DEVICE, Pairs: map[uint16][]font_compress.PairValue{
+				2: {{SecondGlyph: 1, Value2: font_compress.ValueRecord{XAdvance: 7, XAdvDevice: fixtureDevice}}},
+				5: {{SecondGlyph: 1, Value2: font_compress.ValueRecord{XAdvance: 8}}, {SecondGlyph: 6}},
+			}},
+		},
+	}, font_compress.Lookup{
+		Type: font_compress.GPOS_LOOKUP_CURSIVE, Flag: font_compress.LOOKUP_FLAG_RIGHT_TO_LEFT, Subtables: []font_compress.LookupSubtable{
+			font_compress.CursivePos{Anchors: map[uint16]font_compress.EntryExit{1: {Exit: anchor}, 2: {Entry: anchor, Exit: anchor}}},
+		},
+	}, font_compress.Lookup{
+		Type: font_compress.GPOS_LOOKUP_MARK_TO_LIGATURE, Subtables: []font_compress.LookupSubtable{
+			font_compress.MarkLigPos{ClassCount: 2,
+				Marks:     map[uint16]font_compress.MarkRecord{3: {Class: 1, Anchor: anchor}},
+				Ligatures: map[uint16][][]*font_compress.Anchor{4: {{nil, anchor}, {anchor, nil}}}},
+		},
+	}, font_compress.Lookup{
+		Type: font_compress.GPOS_LOOKUP_MARK_TO_MARK, Flag: font_compress.LOOKUP_FLAG_USE_MARK_FILTERING_SET, MarkFilteringSet: 0, Subtables: []font_compress.LookupSubtable{
+			font_compress.MarkMarkPos{ClassCount: 1,
+				Marks:     map[uint16]font_compress.MarkRecord{3: {Anchor: anchor}},
+				BaseMarks: map[uint16][]*font_compress.Anchor{3: {anchor}}},
+		},
+	}, font_compress.Lookup{
+		Type: font_compress.GPOS_LOOKUP_CHAINED_CONTEXT, Subtables: []font_compress.LookupSubtable{
+			font_compress.SequenceContext{Chained: true, Format: 3,
+				BacktrackCoverages: []font_compress.Coverage{{1}}, InputCoverages: []font_compress.Coverage{{2}, {3}}, LookaheadCoverages: []font_compress.Coverage{{5}},
+				Lookups: []font_compress.SequenceLookup{{SequenceIndex: 1, LookupListIndex: 2}}},
+		},
+	})
+	replaceTable(ttf, want)
+	font, err := ttf.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := readFont(t, font).GPOS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GPOS written as %+v, want %+v", got, want)
+	}
+	if n := got.MaxContext(); n != 3 {
+		t.Errorf("MaxContext = %d, want 3", n)
+	}
+}
+
+func TestSubsetGPOS(t *testing.T) {
+	ttf := readFont(t, fixtureFontWith(map[string][]byte{"GPOS": fixtureGPOS(), "OS/2": fixtureOS2Table(fixtureOS2)}))
+	out, err := font_compress.Subset(ttf, []rune("AC"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := readFont(t, out)
+	gpos, err := sub.GPOS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// C is glyph 2 of the subset, U+20000 and its class are gone
+	want := fixtureGPOSTable
+	want.Lookups = []font_compress.Lookup{
+		{Type: font_compress.GPOS_LOOKUP_PAIR, Subtables: []font_compress.LookupSubtable{
+			font_compress.PairPos{Format: 1, ValueFormat1: font_compress.VALUE_FORMAT_X_ADVANCE, Pairs: map[uint16][]font_compress.PairValue{
+				1: {{SecondGlyph: 2, Value1: font_compress.ValueRecord{XAdvance: -30}}},
+			}},
+		}},
+		{Type: font_compress.GPOS_LOOKUP_PAIR, Subtables: []font_compress.LookupSubtable{
+			font_compress.PairPos{Format: 2, ValueFormat1: font_compress.VALUE_FORMAT_X_ADVANCE,
+				Coverage: font_compress.Coverage{1, 2}, ClassDef1: font_compress.ClassDef{2: 1}, ClassDef2: font_compress.ClassDef{1: 1},
+				Class1Records: [][]font_compress.Class2Record{
+					{{}, {Value1: font_compress.ValueRecord{XAdvance: -10}}},
+					{{}, {Value1: font_compress.ValueRecord{XAdvance: -40}}},
+				}},
+		}},
+		{Type: font_compress.GPOS_LOOKUP_MARK_TO_BASE},
+		{Type: font_compress.GPOS_LOOKUP_SINGLE, Extension: true, Subtables: []font_compress.LookupSubtable{
+			font_compress.SinglePos{ValueFormat: font_compress.VALUE_FORMAT_Y_PLACEMENT, Values: map[uint16]font_compress.ValueRecord{1: {YPlacement: 10}}},
+		}},
+	}
+	if !reflect.DeepEqual(gpos, want) {
+		t.Errorf("GPOS of the subset = %+v, want %+v", gpos, want)
+	}
+	if os2, err := sub.OS2(); err != nil || os2.MaxContext != 2 {
+		t.Errorf("usMaxContext = %d (%v), want 2", os2.MaxContext, err)
+	}
+
+	// mark classes without marks are dropped
+	anchor := &font_compress.Anchor{Format: 1}
+	marks := fixtureGPOSTable
+	marks.Lookups = []font_compress.Lookup{{Type: font_compress.GPOS_LOOKUP_MARK_TO_BASE, Subtables: []font_compress.LookupSubtable{
+		font_compress.MarkBasePos{ClassCount: 2,
+			Marks: map[uint16]font_compress.MarkRecord{3: {Class: 1, Anchor: anchor}, 6: {Anchor: anchor}},
+			Bases: map[uint16][]*font_compress.Anchor{1: {nil, anchor}, 5: {anchor, anchor}}},
+	}}}
+	replaceTable(ttf, marks)
+	font, err := ttf.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err = font_compress.Subset(readFont(t, font), []rune("Ä"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gpos, err = readFont(t, out).GPOS(); err != nil {
+		t.Fatal(err)
+	}
+	wantMarks := font_compress.MarkBasePos{ClassCount: 1,
+		Marks: map[uint16]font_compress.MarkRecord{2: {Anchor: anchor}},
+		Bases: map[uint16][]*font_compress.Anchor{1: {anchor}}}
+	if len(gpos.Lookups) != 1 || !reflect.DeepEqual(gpos.Lookups[0].Subtables, []font_compress.LookupSubtable{wantMarks}) {
+		t.Errorf("GPOS lookups of the subset = %+v, want %+v", gpos.Lookups, wantMarks)
+	}
+}
@@ -0,0 +1,696 @@
+package fontcompress
+
+import (
+	"fmt"
+	"sort"
+)
+
+// GSUB lookup types
+const (
+	GSUB_LOOKUP_SINGLE                 uint16 = 1
+	GSUB_LOOKUP_MULTIPLE               uint16 = 2
+	GSUB_LOOKUP_ALTERNATE              uint16 = 3
+	GSUB_LOOKUP_LIGATURE               uint16 = 4
+	GSUB_LOOKUP_CONTEXT                uint16 = 5
+	GSUB_LOOKUP_CHAINED_CONTEXT        uint16 = 6
+	GSUB_LOOKUP_EXTENSION              uint16 = 7
+	GSUB_LOOKUP_REVERSE_CHAINED_SINGLE uint16 = 8
+)
+
+// GSUB — Glyph Substitution. Its lookup subtables are SingleSubst,
+// MultipleSubst, AlternateSubst, LigatureSubst, SequenceContext and
+// ReverseChainSingleSubst.
+type GSUBTable LayoutTable
+
+func (GSUBTable) Tag() Tag { return tagGSUB }
+
+// SingleSubst replaces glyphs by other glyphs (lookup type 1).
+type SingleSubst struct {
+	Substitutes map[uint16]uint16
+}
+
+// MultipleSubst replaces glyphs by sequences of glyphs (lookup type 2).
+type MultipleSubst struct {
+	Sequences map[uint16][]uint16
+}
+
+// AlternateSubst offers alternates for glyphs (lookup type 3).
+type AlternateSubst struct {
+	Alternates map[uint16][]uint16
+}
+
+// LigatureSubst replaces sequences of glyphs by ligatures (lookup type 4).
+// Ligatures are keyed by the first glyph of their sequence, in order of
+// preference.
+type LigatureSubst struct {
+	Ligatures map[uint16][]Ligature
+}
+
+// Ligature replaces the first glyph and its components by Glyph.
+type Ligature struct {
+	Components []uint16 // the glyphs following the first one
+	Glyph      uint16
+}
+
+// ReverseChainSingleSubst replaces glyphs by other glyphs in context, from
+// the end of the text to its start (lookup type 8).
+type ReverseChainSingleSubst struct {
+	Coverage           Coverage
+	BacktrackCoverages []Coverage // nearest glyph first
+	LookaheadCoverages []Coverage
+	Substitutes        []uint16 // by coverage index
+}
+
+// read GSUB table
+func readGSUBTable(data []byte) (TTFTable, error) {
+	layout, err := readLayoutTable("GSUB", data, GSUB_LOOKUP_EXTENSION, readGSUBSubtable)
+	if err != nil {
+		return nil, err
+	}
+	return GSUBTable(layout), nil
+}
+
+/*
+*
+single substitution format 1:
+uint16	substFormat	Format identifier: format = 1
+Offset16	coverageOffset	Offset to Coverage table, from beginning of substitution subtable
+int16	deltaGlyphID	Add to original glyph ID to get substitute glyph ID
+
+single substitution format 2:
+uint16	substFormat	Format identifier: format = 2
+Offset16	coverageOffset	Offset to Coverage table
+uint16	glyphCount	Number of glyph IDs in the substituteGlyphIDs array
+uint16	substituteGlyphIDs[glyphCount]	Array of substitute glyph IDs — ordered by Coverage index
+
+multiple and alternate substitution format 1:
+uint16	substFormat	Format identifier: format = 1
+Offset16	coverageOffset	Offset to Coverage table
+uint16	sequenceCount	Number of Sequence (AlternateSet) table offsets
+Offset16	sequenceOffsets[sequenceCount]	Array of offsets to Sequence (AlternateSet) tables: uint16 glyphCount, uint16 glyphs[glyphCount]
+
+ligature substitution format 1:
+uint16	substFormat	Format identifier: format = 1
+Offset16	coverageOffset	Offset to Coverage table
+uint16	ligatureSetCount	Number of LigatureSet tables
+Offset16	ligatureSetOffsets[ligatureSetCount]	Array of offsets to LigatureSet tables: uint16 ligatureCount, Offset16 ligatureOffsets[ligatureCount]
+ligature: uint16 ligatureGlyph, uint16 componentCount, uint16 componentGlyphIDs[componentCount - 1]
+
+reverse chaining contextual single substitution format 1:
+uint16	substFormat	Format identifier: format = 1
+Offset16	coverageOffset	Offset to Coverage table
+uint16	backtrackGlyphCount	Number of glyphs in the backtrack sequence
+Offset16	backtrackCoverageOffsets[backtrackGlyphCount]	Array of offsets to coverage tables in backtrack sequence
+uint16	lookaheadGlyphCount	Number of glyphs in lookahead sequence
+Offset16	lookaheadCoverageOffsets[lookaheadGlyphCount]	Array of offsets to coverage tables in lookahead sequence
+uint16	glyphCount	Number of glyph IDs in the substituteGlyphIDs array
+uint16	substituteGlyphIDs[glyphCount]	Array of substitute glyph IDs — ordered by Coverage index
+*/
+func readGSUBSubtable(r *layoutReader, lookupType uint16, off int) (LookupSubtable, error) {
+	switch lookupType {
+	case GSUB_LOOKUP_CONTEXT:
+		return r.sequenceContext(off, false)
+	case GSUB_LOOKUP_CHAINED_CONTEXT:
+		return r.sequenceContext(off, true)
+	case GSUB_LOOKUP_SINGLE, GSUB_LOOKUP_MULTIPLE, GSUB_LOOKUP_ALTERNATE, GSUB_LOOKUP_LIGATURE, GSUB_LOOKUP_REVERSE_CHAINED_SINGLE:
+	default:
+		return nil, &ParseError{Table: "GSUB", Offset: int64(off), Reason: fmt.Sprintf("unknown lookup type %d", lookupType)}
+	}
+	if err := r.check(off, 6); err != nil {
+		return nil, err
+	}
+	format := r.u16(off)
+	if format != 1 && (format != 2 || lookupType != GSUB_LOOKUP_SINGLE) {
+		return nil, &ParseError{Table: "GSUB", Offset: int64(off), Reason: fmt.Sprintf("unknown format %d of lookup type %d", format, lookupType)}
+	}
+	cov, err := r.coverage(off + int(r.u16(off+2)))
+	if err != nil {
+		return nil, err
+	}
+	switch lookupType {
+	case GSUB_LOOKUP_SINGLE:
+		st := SingleSubst{Substitutes: make(map[uint16]uint16, len(cov))}
+		if format == 1 {
+			delta := r.u16(off + 4)
+			for _, gid := range cov {
+				st.Substitutes[gid] = gid + delta
+			}
+			return st, nil
+		}
+		subs, err := r.uint16s(off+6, int(r.u16(off+4)))
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(cov) && i < len(subs); i++ {
+			st.Substitutes[cov[i]] = subs[i]
+		}
+		return st, nil
+	case GSUB_LOOKUP_MULTIPLE, GSUB_LOOKUP_ALTERNATE:
+		seqs, err := r.offsets(off, off+6, int(r.u16(off+4)))
+		if err != nil {
+			return nil, err
+		}
+		glyphs := make(map[uint16][]uint16, len(cov))
+		for i := 0; i < len(cov) && i < len(seqs); i++ {
+			if seqs[i] < 0 {
+				return nil, &ParseError{Table: "GSUB", Offset: int64(off + 6 + 2*i), Reason: "glyph sequence is missing"}
+			}
+			if err := r.check(seqs[i], 2); err != nil {
+				return nil, err
+			}
+			if glyphs[cov[i]], err = r.uint16s(seqs[i]+2, int(r.u16(seqs[i]))); err != nil {
+				return nil, err
+			}
+		}
+		if lookupType == GSUB_LOOKUP_MULTIPLE {
+			return MultipleSubst{Sequences: glyphs}, nil
+		}
+		return AlternateSubst{Alternates: glyphs}, nil
+	case GSUB_LOOKUP_LIGATURE:
+		sets, err := r.offsets(off, off+6, int(r.u16(off+4)))
+		if err != nil {
+			return nil, err
+		}
+		st := LigatureSubst{Ligatures: make(map[uint16][]Ligature, len(cov))}
+		for i := 0; i < len(cov) && i < len(sets); i++ {
+			if sets[i] < 0 {
+				continue
+			}
+			if err := r.check(sets[i], 2); err != nil {
+				return nil, err
+			}
+			ligs, err := r.offsets(sets[i], sets[i]+2, int(r.u16(sets[i])))
+			if err != nil {
+				return nil, err
+			}
+			for _, lig := range ligs {
+				if lig < 0 {
+					continue
+				}
+				if err := r.check(lig, 4); err != nil {
+					return nil, err
+				}
+				n := int(r.u16(lig + 2))
+				if n == 0 {
+					return nil, &ParseError{Table: "GSUB", Offset: int64(lig), Reason: "ligature has no components"}
+				}
+				components, err := r.uint16s(lig+4, n-1)
+				if err != nil {
+					return nil, err
+				}
+				st.Ligatures[cov[i]] = append(st.Ligatures[cov[i]], Ligature{Components: components, Glyph: r.u16(lig)})
+			}
+		}
+		return st, nil
+	default: // GSUB_LOOKUP_REVERSE_CHAINED_SINGLE
+		st := ReverseChainSingleSubst{Coverage: cov}
+		at := off + 4
+		for _, covs := range []*[]Coverage{&st.BacktrackCoverages, &st.LookaheadCoverages} {
+			n := int(r.u16(at))
+			if *covs, err = r.coverages(off, at+2, n); err != nil {
+				return nil, err
+			}
+			at += 2 + 2*n
+			if err := r.check(at, 2); err != nil {
+				return nil, err
+			}
+		}
+		if st.Substitutes, err = r.uint16s(at+2, int(r.u16(at))); err != nil {
+			return nil, err
+		}
+		if len(st.Substitutes) != len(cov) {
+			return nil, &ParseError{Table: "GSUB", Offset: int64(at), Reason: fmt.Sprintf("%d substitutes for %d glyphs", len(st.Substitutes), len(cov))}
+		}
+		return st, nil
+	}
+}
+
+// encode serializes the GSUB table.
+func (gsub GSUBTable) encode() ([]byte, error) {
+	return LayoutTable(gsub).encode(GSUB_LOOKUP_EXTENSION)
+}
+
+// sortGlyphs sorts glyph ids in place and returns them.
+func sortGlyphs(gids []uint16) []uint16 {
+	sort.Slice(gids, func(i, j int) bool { return gids[i] < gids[j] })
+	return gids
+}
+
+func (st SingleSubst) encode() ([]byte, error) {
+	gids := make([]uint16, 0, len(st.Substitutes))
+	for gid := range st.Substitutes {
+		gids = append(gids, gid)
+	}
+	cov, err := Coverage(sortGlyphs(gids)).encode()
+	if err != nil {
+		return nil, err
+	}
+	// format 1 if every glyph is replaced by the one a constant delta away
+	delta := uint16(0)
+	format1 := true
+	for i, gid := range gids {
+		if i == 0 {
+			delta = st.Substitutes[gid] - gid
+		} else if st.Substitutes[gid]-gid != delta {
+			format1 = false
+		}
+	}
+	b := subtableBuffer{buf: appendUint16s(nil, 1, 0, delta)}
+	if !format1 {
+		b.buf = appendUint16s(nil, 2, 0, uint16(len(gids)))
+		for _, gid := range gids {
+			b.buf = appendUint16s(b.buf, st.Substitutes[gid])
+		}
+	}
+	if err := b.link(2, cov); err != nil {
+		return nil, err
+	}
+	return b.buf, nil
+}
+
+func (st MultipleSubst) encode() ([]byte, error) { return encodeGlyphSequences(st.Sequences) }
+
+func (st AlternateSubst) encode() ([]byte, error) { return encodeGlyphSequences(st.Alternates) }
+
+// encodeGlyphSequences serializes a multiple or alternate substitution.
+func encodeGlyphSequences(seqs map[uint16][]uint16) ([]byte, error) {
+	gids := make([]uint16, 0, len(seqs))
+	for gid := range seqs {
+		gids = append(gids, gid)
+	}
+	cov, err := Coverage(sortGlyphs(gids)).encode()
+	if err != nil {
+		return nil, err
+	}
+	b := subtableBuffer{buf: appendUint16s(nil, 1, 0, uint16(len(gids)))}
+	b.buf = append(b.buf, make([]byte, 2*len(gids))...)
+	if err := b.link(2, cov); err != nil {
+		return nil, err
+	}
+	for i, gid := range gids {
+		if len(seqs[gid]) > 0xFFFF {
+			return nil, fmt.Errorf("glyph %d has %d substitutes", gid, len(seqs[gid]))
+		}
+		if err := b.link(6+2*i, appendUint16s(appendUint16s(nil, uint16(len(seqs[gid]))), seqs[gid]...)); err != nil {
+			return nil, err
+		}
+	}
+	return b.buf, nil
+}
+
+func (st LigatureSubst) encode() ([]byte, error) {
+	gids := make([]uint16, 0, len(st.Ligatures))
+	for gid := range st.Ligatures {
+		gids = append(gids, gid)
+	}
+	cov, err := Coverage(sortGlyphs(gids)).encode()
+	if err != nil {
+		return nil, err
+	}
+	b := subtableBuffer{buf: appendUint16s(nil, 1, 0, uint16(len(gids)))}
+	b.buf = append(b.buf, make([]byte, 2*len(gids))...)
+	if err := b.link(2, cov); err != nil {
+		return nil, err
+	}
+	for i, gid := range gids {
+		ligs := st.Ligatures[gid]
+		if len(ligs) > 0xFFFF {
+			return nil, fmt.Errorf("glyph %d starts %d ligatures", gid, len(ligs))
+		}
+		set := subtableBuffer{buf: appendUint16s(nil, uint16(len(ligs)))}
+		set.buf = append(set.buf, make([]byte, 2*len(ligs))...)
+		for j, lig := range ligs {
+			if len(lig.Components) >= 0xFFFF {
+				return nil, fmt.Errorf("ligature %d has %d components", lig.Glyph, len(lig.Components)+1)
+			}
+			if err := set.link(2+2*j, appendUint16s(appendUint16s(nil, lig.Glyph, uint16(len(lig.Components)+1)), lig.Components...)); err != nil {
+				return nil, err
+			}
+		}
+		if err := b.link(6+2*i, set.buf); err != nil {
+			return nil, err
+		}
+	}
+	return b.buf, nil
+}
+
+func (st ReverseChainSingleSubst) encode() ([]byte, error) {
+	if len(st.Substitutes) != len(st.Coverage) {
+		return nil, fmt.Errorf("reverse chained substitution has %d substitutes for %d glyphs", len(st.Substitutes), len(st.Coverage))
+	}
+	if len(st.BacktrackCoverages) > 0xFFFF || len(st.LookaheadCoverages) > 0xFFFF || len(st.Coverage) > 0xFFFF {
+		return nil, fmt.Errorf("reverse chained substitution is too large")
+	}
+	b := subtableBuffer{buf: appendUint16s(nil, 1, 0)}
+	fields := []int{2}
+	covs := []Coverage{st.Coverage}
+	for _, position := range [][]Coverage{st.BacktrackCoverages, st.LookaheadCoverages} {
+		b.buf = appendUint16s(b.buf, uint16(len(position)))
+		for _, cov := range position {
+			fields = append(fields, len(b.buf))
+			covs = append(covs, cov)
+			b.buf = appendUint16s(b.buf, 0)
+		}
+	}
+	b.buf = appendUint16s(appendUint16s(b.buf, uint16(len(st.Substitutes))), st.Substitutes...)
+	for i, cov := range covs {
+		data, err := cov.encode()
+		if err != nil {
+			return nil, err
+		}
+		if err := b.link(fields[i], data); err != nil {
+			return nil, err
+		}
+	}
+	return b.buf, nil
+}
+
+func (st SingleSubst) subset(newID map[uint16]uint16) LookupSubtable {
+	sub := SingleSubst{Substitutes: make(map[uint16]uint16)}
+	for gid, s := range st.Substitutes {
+		id, ok1 := newID[gid]
+		sid, ok2 := newID[s]
+		if ok1 && ok2 {
+			sub.Substitutes[id] = sid
+		}
+	}
+	if len(sub.Substitutes) == 0 {
+		return nil
+	}
+	return sub
+}
+
+func (st MultipleSubst) subset(newID map[uint16]uint16) LookupSubtable {
+	sub := MultipleSubst{Sequences: make(map[uint16][]uint16)}
+	for gid, seq := range st.Sequences {
+		id, ok := newID[gid]
+		if !ok {
+			continue
+		}
+		if ids, ok := remapGlyphs(seq, newID); ok {
+			sub.Sequences[id] = ids
+		}
+	}
+	if len(sub.Sequences) == 0 {
+		return nil
+	}
+	return sub
+}
+
+func (st AlternateSubst) subset(newID map[uint16]uint16) LookupSubtable {
+	sub := AlternateSubst{Alternates: make(map[uint16][]uint16)}
+	for gid, alts := range st.Alternates {
+		id, ok := newID[gid]
+		if !ok {
+			continue
+		}
+		var ids []uint16
+		for _, alt := range alts {
+			if aid, ok := newID[alt]; ok {
+				ids = append(ids, aid)
+			}
+		}
+		if len(ids) > 0 {
+			sub.Alternates[id] = ids
+		}
+	}
+	if len(sub.Alternates) == 0 {
+		return nil
+	}
+	return sub
+}
+
+func (st LigatureSubst) subset(newID map[uint16]uint16) LookupSubtable {
+	sub := LigatureSubst{Ligatures: make(map[uint16][]Ligature)}
+	for gid, ligs := range st.Ligatures {
+		id, ok := newID[gid]
+		if !ok {
+			continue
+		}
+		for _, lig := range ligs {
+			glyph, ok1 := newID[lig.Glyph]
+			components, ok2 := remapGlyphs(lig.Components, newID)
+			if ok1 && ok2 {
+				sub.Ligatures[id] = append(sub.Ligatures[id], Ligature{Components: components, Glyph: glyph})
+			}
+		}
+	}
+	if len(sub.Ligatures) == 0 {
+		return nil
+	}
+	return sub
+}
+
+func (st ReverseChainSingleSubst) subset(newID map[uint16]uint16) LookupSubtable {
+	var sub ReverseChainSingleSubst
+	var ok bool
+	if sub.BacktrackCoverages, ok = subsetCoverages(st.BacktrackCoverages, newID); !ok {
+		return nil
+	}
+	if sub.LookaheadCoverages, ok = subsetCoverages(st.LookaheadCoverages, newID); !ok {
+		return nil
+	}
+	// substitutes follow their glyphs, which are sorted again
+	subs := make(map[uint16]uint16)
+	for i, gid := range st.Coverage {
+		id, ok1 := newID[gid]
+		sid, ok2 := newID[st.Substitutes[i]]
+		if ok1 && ok2 {
+			subs[id] = sid
+		}
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+	for gid := range subs {
+		sub.Coverage = append(sub.Coverage, gid)
+	}
+	for _, gid := range sortGlyphs(sub.Coverage) {
+		sub.Substitutes = append(sub.Substitutes, subs[gid])
+	}
+	return sub
+}
+
+func (SingleSubst) maxContext() int    { return 1 }
+func (MultipleSubst) maxContext() int  { return 1 }
+func (AlternateSubst) maxContext() int { return 1 }
+
+func (st LigatureSubst) maxContext() int {
+	n := 0
+	for _, ligs := range st.Ligatures {
+		for _, lig := range ligs {
+			n = max(n, len(lig.Components)+1)
+		}
+	}
+	return n
+}
+
+func (st ReverseChainSingleSubst) maxContext() int { return 1 + len(st.LookaheadCoverages) }
+
+// subset returns the table for the glyphs of newID, renumbered, as
+// LayoutTable.subset does.
+func (gsub GSUBTable) subset(newID map[uint16]uint16) GSUBTable {
+	return GSUBTable(LayoutTable(gsub).subset(newID))
+}
+
+// MaxContext returns the length of the longest glyph context of the
+// lookups, as OS/2 usMaxContext counts it.
+func (gsub GSUBTable) MaxContext() int {
+	return LayoutTable(gsub).maxContext()
+}
+
+// Closure returns glyphs and the glyphs that the lookups of the features
+// of the table can substitute for them, directly or in turn, sorted.
+// Contextual lookups are followed whenever the glyphs can match their
+// context, wherever it occurs in the text, so the closure may hold glyphs
+// that no text reaches.
+func (gsub GSUBTable) Closure(glyphs []uint16) []uint16 {
+	keep := make(map[uint16]bool, len(glyphs))
+	for _, gid := range glyphs {
+		keep[gid] = true
+	}
+	gsub.closure(keep, 0x10000)
+	closure := make([]uint16, 0, len(keep))
+	for gid := range keep {
+		closure = append(closure, gid)
+	}
+	return sortGlyphs(closure)
+}
+
+// closure adds to keep the glyphs Closure reaches from them, but for glyph
+// ids of numGlyphs or more.
+func (gsub GSUBTable) closure(keep map[uint16]bool, numGlyphs int) {
+	// lookups of features apply, and so do those of the contextual lookups
+	// whose context can match
+	active := make([]bool, len(gsub.Lookups))
+	for _, f := range gsub.Features {
+		for _, i := range f.Feature.LookupListIndices {
+			if int(i) < len(active) {
+				active[i] = true
+			}
+		}
+	}
+	changed := true
+	add := func(gid uint16) {
+		if int(gid) < numGlyphs && !keep[gid] {
+			keep[gid] = true
+			changed = true
+		}
+	}
+	activate := func(i uint16) {
+		if int(i) < len(active) && !active[i] {
+			active[i] = true
+			changed = true
+		}
+	}
+	for changed {
+		changed = false
+		for i, l := range gsub.Lookups {
+			if !active[i] {
+				continue
+			}
+			for _, st := range l.Subtables {
+				switch st := st.(type) {
+				case SingleSubst:
+					for gid, s := range st.Substitutes {
+						if keep[gid] {
+							add(s)
+						}
+					}
+				case MultipleSubst:
+					for gid, seq := range st.Sequences {
+						for _, s := range seq {
+							if keep[gid] {
+								add(s)
+							}
+						}
+					}
+				case AlternateSubst:
+					for gid, alts := range st.Alternates {
+						for _, s := range alts {
+							if keep[gid] {
+								add(s)
+							}
+						}
+					}
+				case LigatureSubst:
+					for gid, ligs := range st.Ligatures {
+						for _, lig := range ligs {
+							if keep[gid] && keepsAll(keep, lig.Components) {
+								add(lig.Glyph)
+							}
+						}
+					}
+				case SequenceContext:
+					st.closureLookups(keep, activate)
+				case ReverseChainSingleSubst:
+					if !intersectsAll(keep, st.BacktrackCoverages) || !intersectsAll(keep, st.LookaheadCoverages) {
+						continue
+					}
+					for i, gid := range st.Coverage {
+						if keep[gid] && i < len(st.Substitutes) {
+							add(st.Substitutes[i])
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// keepsAll reports whether keep has all glyphs of gids.
+func keepsAll(keep map[uint16]bool, gids []uint16) bool {
+	for _, gid := range gids {
+		if !keep[gid] {
+			return false
+		}
+	}
+	return true
+}
+
+// intersectsAll reports whether keep has a glyph of each coverage.
+func intersectsAll(keep map[uint16]bool, covs []Coverage) bool {
+	for _, cov := range covs {
+		found := false
+		for _, gid := range cov {
+			if keep[gid] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// closureLookups activates the lookups of the rules whose sequences can
+// match glyphs of keep.
+func (sc SequenceContext) closureLookups(keep map[uint16]bool, activate func(uint16)) {
+	activateAll := func(lookups []SequenceLookup) {
+		for _, l := range lookups {
+			activate(l.LookupListIndex)
+		}
+	}
+	switch sc.Format {
+	case 1:
+		for i, gid := range sc.Coverage {
+			if !keep[gid] || i >= len(sc.Rules) {
+				continue
+			}
+			for _, rule := range sc.Rules[i] {
+				if keepsAll(keep, rule.Backtrack) && keepsAll(keep, rule.Input) && keepsAll(keep, rule.Lookahead) {
+					activateAll(rule.Lookups)
+				}
+			}
+		}
+	case 2:
+		// class 0 holds the glyphs a class definition does not list, which
+		// may well be kept
+		classes := func(cd ClassDef) map[uint16]bool {
+			classes := map[uint16]bool{0: true}
+			for gid := range keep {
+				classes[cd[gid]] = true
+			}
+			return classes
+		}
+		backtrack, input, lookahead := classes(sc.BacktrackClassDef), classes(sc.InputClassDef), classes(sc.LookaheadClassDef)
+		has := func(classes map[uint16]bool, seq []uint16) bool {
+			for _, class := range seq {
+				if !classes[class] {
+					return false
+				}
+			}
+			return true
+		}
+		for _, gid := range sc.Coverage {
+			class := int(sc.InputClassDef[gid])
+			if !keep[gid] || class >= len(sc.Rules) {
+				continue
+			}
+			for _, rule := range sc.Rules[class] {
+				if has(backtrack, rule.Backtrack) && has(input, rule.Input) && has(lookahead, rule.Lookahead) {
+					activateAll(rule.Lookups)
+				}
+			}
+		}
+	case 3:
+		if intersectsAll(keep, sc.BacktrackCoverages) && intersectsAll(keep, sc.InputCoverages) && intersectsAll(keep, sc.LookaheadCoverages) {
+			activateAll(sc.Lookups)
+		}
+	}
+}
+
+// GSUB returns the GSUB table, decoding it on first use.
+func (ttf *TTF) GSUB() (GSUBTable, error) {
+	table, err := ttf.decodeTable(tagGSUB, readGSUBTable)
+	if err != nil {
+		return GSUBTable{}, err
+	}
+	gsub, ok := table.(GSUBTable)
+	if !ok {
+		return GSUBTable{}, fmt.Errorf("GSUB table holds a %T", table)
+	}
+	return gsub, nil
+}
@@ -0,0 +1,219 @@
+package fontcompress_test
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+// link is a subtable and the 16-bit field of its parent that reaches it.
+type link struct {
+	field int
+	table []byte
+}
+
+// linkTables appends the subtables of links to table and writes their
+// offsets, relative to the start of table.
+func linkTables(table []byte, links ...link) []byte {
+	for _, l := range links {
+		binary.BigEndian.PutUint16(table[l.field:], uint16(len(table)))
+		table = append(table, l.table...)
+	}
+	return table
+}
+
+func mustTag(s string) font_compress.Tag {
+	tag, err := font_compress.ParseTag(s)
+	if err != nil {
+		panic(err)
+	}
+	return tag
+}
+
+func appendTag(b []byte, tag string) []byte {
+	return binary.BigEndian.AppendUint32(b, uint32(mustTag(tag)))
+}
+
+// fixtureGSUB returns a GSUB table for the fixture glyphs. 'liga' forms
+// Adieresis from A and dieresis, 'ss01' replaces B by C, and 'calt' replaces
+// A followed by B by U+20000 through an extension lookup.
+func fixtureGSUB() []byte {
+	script := linkTables(appendInt16(appendTag(appendInt16(nil, 0, 1), "TRK "), 0),
+		link{0, appendInt16(nil, 0, -1, 3, 0, 1, 2)},
+		link{2 + 2 + 4, appendInt16(nil, 0, -1, 1, 1)})
+	scriptList := linkTables(appendInt16(appendTag(appendInt16(nil, 1), "latn"), 0), link{2 + 4, script})
+
+	features := appendInt16(nil, 3)
+	features = appendInt16(appendTag(features, "liga"), 0)
+	features = appendInt16(appendTag(features, "ss01"), 0)
+	features = appendInt16(appendTag(features, "calt"), 0)
+	featureList := linkTables(features,
+		link{2 + 4, appendInt16(nil, 0, 1, 0)},
+		link{2 + 6 + 4, linkTables(appendInt16(nil, 0, 1, 1), link{0, appendInt16(nil, 0, 256)})},
+		link{2 + 12 + 4, appendInt16(nil, 0, 1, 2)})
+
+	coverageA := appendInt16(nil, 1, 1, 1)
+	ligature := linkTables(appendInt16(nil, 1, 0, 1, 0),
+		link{2, coverageA},
+		link{6, linkTables(appendInt16(nil, 1, 0), link{2, appendInt16(nil, 4, 2, 3)})})
+	single2 := linkTables(appendInt16(nil, 2, 0, 1, 5), link{2, appendInt16(nil, 2, 1, 2, 2, 0)})
+	chained := linkTables(appendInt16(nil, 1, 0, 1, 0),
+		link{2, coverageA},
+		link{6, linkTables(appendInt16(nil, 1, 0), link{2, appendInt16(nil, 0, 1, 1, 2, 1, 0, 3)})})
+	extension := append(appendInt16(nil, 1, 6, 0, 8), chained...)
+	single1 := linkTables(appendInt16(nil, 1, 0, 5), link{2, coverageA})
+	lookupList := linkTables(appendInt16(nil, 4, 0, 0, 0, 0),
+		link{2, linkTables(appendInt16(nil, 4, 0, 1, 0), link{6, ligature})},
+		link{4, linkTables(appendInt16(nil, 1, 0, 1, 0), link{6, single2})},
+		link{6, linkTables(appendInt16(nil, 7, 8, 1, 0), link{6, extension})},
+		link{8, linkTables(appendInt16(nil, 1, 0, 1, 0), link{6, single1})})
+
+	return linkTables(appendInt16(nil, 1, 0, 0, 0, 0), link{4, scriptList}, link{6, featureList}, link{8, lookupList})
+}
+
+// fixtureGSUBTable is fixtureGSUB decoded.
+var fixtureGSUBTable = font_compress.GSUBTable{
+	MajorVersion: 1,
+	Scripts: []font_compress.ScriptRecord{{
+		Tag:            mustTag("latn"),
+		DefaultLangSys: &font_compress.LangSys{RequiredFeatureIndex: 0xFFFF, FeatureIndices: []uint16{0, 1, 2}},
+		LangSysRecords: []font_compress.LangSysRecord{{Tag: mustTag("TRK"), LangSys: font_compress.LangSys{RequiredFeatureIndex: 0xFFFF, FeatureIndices: []uint16{1}}}},
+	}},
+	Features: []font_compress.FeatureRecord{
+		{Tag: mustTag("liga"), Feature: font_compress.Feature{LookupListIndices: []uint16{0}}},
+		{Tag: mustTag("ss01"), Feature: font_compress.Feature{Params: []byte{0, 0, 1, 0}, LookupListIndices: []uint16{1}}},
+		{Tag: mustTag("calt"), Feature: font_compress.Feature{LookupListIndices: []uint16{2}}},
+	},
+	Lookups: []font_compress.Lookup{
+		{Type: font_compress.GSUB_LOOKUP_LIGATURE, Subtables: []font_compress.LookupSubtable{
+			font_compress.LigatureSubst{Ligatures: map[uint16][]font_compress.Ligature{1: {{Components: []uint16{3}, Glyph: 4}}}},
+		}},
+		{Type: font_compress.GSUB_LOOKUP_SINGLE, Subtables: []font_compress.LookupSubtable{
+			font_compress.SingleSubst{Substitutes: map[uint16]uint16{2: 5}},
+		}},
+		{Type: font_compress.GSUB_LOOKUP_CHAINED_CONTEXT, Flag: font_compress.LOOKUP_FLAG_IGNORE_MARKS, Extension: true, Subtables: []font_compress.LookupSubtable{
+			font_compress.SequenceContext{Chained: true, Format: 1, Coverage: font_compress.Coverage{1}, Rules: [][]font_compress.SequenceRule{{
+				{Lookahead: []uint16{2}, Lookups: []font_compress.SequenceLookup{{SequenceIndex: 0, LookupListIndex: 3}}},
+			}}},
+		}},
+		{Type: font_compress.GSUB_LOOKUP_SINGLE, Subtables: []font_compress.LookupSubtable{
+			font_compress.SingleSubst{Substitutes: map[uint16]uint16{1: 6}},
+		}},
+	},
+}
+
+func TestReadGSUBTable(t *testing.T) {
+	ttf := readFont(t, fixtureFontWith(map[string][]byte{"GSUB": fixtureGSUB()}))
+	gsub, err := ttf.GSUB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gsub, fixtureGSUBTable) {
+		t.Errorf("GSUB = %+v, want %+v", gsub, fixtureGSUBTable)
+	}
+	if n := gsub.MaxContext(); n != 2 {
+		t.Errorf("MaxContext = %d, want 2", n)
+	}
+}
+
+func TestGSUBClosure(t *testing.T) {
+	for _, tt := range []struct {
+		glyphs, want []uint16
+	}{
+		{[]uint16{1}, []uint16{1}},
+		{[]uint16{3, 1}, []uint16{1, 3, 4}},
+		{[]uint16{2}, []uint16{2, 5}},
+		// the context of 'calt' holds
+		{[]uint16{1, 2}, []uint16{1, 2, 5, 6}},
+	} {
+		if got := fixtureGSUBTable.Closure(tt.glyphs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Closure(%v) = %v, want %v", tt.glyphs, got, tt.want)
+		}
+	}
+}
+
+func TestWriteGSUBTable(t *testing.T) {
+	ttf := readFont(t, fixtureFontWith(map[string][]byte{"GSUB": fixtureGSUB()}))
+	gsub, err := ttf.GSUB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a new table, sharing nothing with the decoded one
+	want := font_compress.GSUBTable(fixtureGSUBTable)
+	want.Lookups = append([]font_compress.Lookup(nil), gsub.Lookups...)
+	want.Lookups[1].Subtables = []font_compress.LookupSubtable{font_compress.SingleSubst{Substitutes: map[uint16]uint16{2: 5, 5: 2}}}
+	want.Lookups[2].Extension = false
+	want.Lookups = append(want.Lookups, font_compress.Lookup{Type: font_compress.GSUB_LOOKUP_CONTEXT, Subtables: []font_compress.LookupSubtable{
+		font_compress.SequenceContext{Format: 2, Coverage: font_compress.Coverage{1, 2}, InputClassDef: font_compress.ClassDef{1: 1, 2: 1, 5: 2},
+			Rules: [][]font_compress.SequenceRule{nil, {{Input: []uint16{2}, Lookups: []font_compress.SequenceLookup{{SequenceIndex: 1, LookupListIndex: 1}}}}}},
+		font_compress.SequenceContext{Format: 3, InputCoverages: []font_compress.Coverage{{1, 2, 3}, {5}},
+			Lookups: []font_compress.SequenceLookup{{SequenceIndex: 0, LookupListIndex: 3}}},
+	}}, font_compress.Lookup{Type: font_compress.GSUB_LOOKUP_REVERSE_CHAINED_SINGLE, Subtables: []font_compress.LookupSubtable{
+		font_compress.ReverseChainSingleSubst{Coverage: font_compress.Coverage{1, 2}, LookaheadCoverages: []font_compress.Coverage{{5}}, Substitutes: []uint16{6, 6}},
+	}}, font_compress.Lookup{Type: font_compress.GSUB_LOOKUP_MULTIPLE, Flag: font_compress.LOOKUP_FLAG_USE_MARK_FILTERING_SET, MarkFilteringSet: 1, Subtables: []font_compress.LookupSubtable{
+		font_compress.MultipleSubst{Sequences: map[uint16][]uint16{4: {1, 3}}},
+	}}, font_compress.Lookup{Type: font_compress.GSUB_LOOKUP_ALTERNATE, Subtables: []font_compress.LookupSubtable{
+		font_compress.AlternateSubst{Alternates: map[uint16][]uint16{1: {4, 6}, 2: {5}}},
+	}})
+	replaceTable(ttf, want)
+	font, err := ttf.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := readFont(t, font).GSUB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GSUB written as %+v, want %+v", got, want)
+	}
+	if n := got.MaxContext(); n != 2 {
+		t.Errorf("MaxContext = %d, want 2", n)
+	}
+}
+
+func TestSubsetGSUB(t *testing.T) {
+	ttf := readFont(t, fixtureFontWith(map[string][]byte{"GSUB": fixtureGSUB(), "OS/2": fixtureOS2Table(fixtureOS2)}))
+	out, err := font_compress.Subset(ttf, []rune("AB"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := readFont(t, out)
+	// C and U+20000 are substituted for A and B
+	if n, err := sub.NumGlyphs(); err != nil || n != 5 {
+		t.Fatalf("subset has %d glyphs (%v), want 5", n, err)
+	}
+	gsub, err := sub.GSUB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fixtureGSUBTable
+	want.Lookups = []font_compress.Lookup{
+		{Type: font_compress.GSUB_LOOKUP_LIGATURE},
+		{Type: font_compress.GSUB_LOOKUP_SINGLE, Subtables: []font_compress.LookupSubtable{
+			font_compress.SingleSubst{Substitutes: map[uint16]uint16{2: 3}},
+		}},
+		fixtureGSUBTable.Lookups[2],
+		{Type: font_compress.GSUB_LOOKUP_SINGLE, Subtables: []font_compress.LookupSubtable{
+			font_compress.SingleSubst{Substitutes: map[uint16]uint16{1: 4}},
+		}},
+	}
+	if !reflect.DeepEqual(gsub, want) {
+		t.Errorf("GSUB of the subset = %+v, want %+v", gsub, want)
+	}
+
+	for _, tt := range []struct {
+		runes string
+		want  uint16
+	}{{"AB", 2}, {"Ä", 2}, {"B", 1}} {
+		out, err := font_compress.Subset(ttf, []rune(tt.runes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if os2, err := readFont(t, out).OS2(); err != nil || os2.MaxContext != tt.want {
+			t.Errorf("subset %q: usMaxContext = %d (%v), want %d", tt.runes, os2.MaxContext, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package fontcompress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/*
+*
+uint16	majorVersion	Major version number of the horizontal header table — set to 1.
+uint16	minorVersion	Minor version number of the horizontal header table — set to 0.
+FWORD	ascender	Typographic ascent.
+FWORD	descender	Typographic descent.
+FWORD	lineGap	Typographic line gap. Negative lineGap values are treated as zero in some legacy platform implementations.
+UFWORD	advanceWidthMax	Maximum advance width value in 'hmtx' table.
+FWORD	minLeftSideBearing	Minimum left sidebearing value in 'hmtx' table for glyphs with contours (empty glyphs should be ignored).
+FWORD	minRightSideBearing	Minimum right sidebearing value; calculated as min(aw - (lsb + xMax - xMin)) for glyphs with contours (empty glyphs should be ignored).
+FWORD	xMaxExtent	Max(lsb + (xMax - xMin)).
+int16	caretSlopeRise	Used to calculate the slope of the cursor (rise/run); 1 for vertical.
+int16	caretSlopeRun	0 for vertical.
+int16	caretOffset	The amount by which a slanted highlight on a glyph needs to be shifted to produce the best appearance. Set to 0 for non-slanted fonts
+int16	(reserved)	set to 0
+int16	(reserved)	set to 0
+int16	(reserved)	set to 0
+int16	(reserved)	set to 0
+int16	metricDataFormat	0 for current format.
+uint16	numberOfHMetrics	Number of hMetric entries in 'hmtx' table
+*/
+type HheaTable struct {
+	Version             uint32   // 0x00010000 (1.0)
+	Ascender            int16    // typographic ascent
+	Descender           int16    // typographic descent
+	LineGap             int16    // typographic line gap
+	AdvanceWidthMax     uint16   // maximum advance width value in hmtx
+	MinLeftSideBearing  int16    // minimum left side bearing of the glyphs with contours
+	MinRightSideBearing int16    // minimum of aw - (lsb + xMax - xMin) for the glyphs with contours
+	XMaxExtent          int16    // maximum of lsb + (xMax - xMin)
+	CaretSlopeRise      int16    // used to calculate the slope of the cursor (rise/run); 1 for vertical
+	CaretSlopeRun       int16    // 0 for vertical
+	CaretOffset         int16    // shift of a slanted highlight; 0 for non-slanted fonts
+	Reserved            [4]int16 // set to 0
+	MetricDataFormat    int16    // 0 for current format
+	NumberOfHMetrics    uint16   // number of hMetric entries in hmtx
+}
+
+/*
+*
+uint16	advanceWidth	Advance width, in font design units.
+int16	lsb	Glyph left side bearing, in font design units.
+*/
+type LongHorMetric struct {
+	AdvanceWidth uint16 // advance width, in font design units
+	Lsb          int16  // glyph left side bearing, in font design units
+}
+
+// hmtx — horizontal metrics
+//
+// Glyphs past the long metrics only have a left side bearing and share the
+// advance width of the last long metric.
+type HmtxTable struct {
+	HMetrics         []LongHorMetric // hhea.numberOfHMetrics entries
+	LeftSideBearings []int16         // left side bearings of the remaining glyphs
+}
+
+func (HheaTable) Tag() Tag { return tagHhea }
+
+func (HmtxTable) Tag() Tag { return tagHmtx }
+
+// read hhea table
+func readHheaTable(data []byte) (TTFTable, error) {
+	if err := checkRange("hhea", data, 0, 36); err != nil {
+		return nil, err
+	}
+	int16At := func(off int) int16 { return int16(binary.BigEndian.Uint16(data[off:])) }
+	return HheaTable{
+		Version:             binary.BigEndian.Uint32(data[0:]),
+		Ascender:            int16At(4),
+		Descender:           int16At(6),
+		LineGap:             int16At(8),
+		AdvanceWidthMax:     binary.BigEndian.Uint16(data[10:]),
+		MinLeftSideBearing:  int16At(12),
+		MinRightSideBearing: int16At(14),
+		XMaxExtent:          int16At(16),
+		CaretSlopeRise:      int16At(18),
+		CaretSlopeRun:       int16At(20),
+		CaretOffset:         int16At(22),
+		Reserved:            [4]int16{int16At(24), int16At(26), int16At(28), int16At(30)},
+		MetricDataFormat:    int16At(32),
+		NumberOfHMetrics:    binary.BigEndian.Uint16(data[34:]),
+	}, nil
+}
+
+// encode serializes the hhea table.
+func (hhea HheaTable) encode() ([]byte, error) {
+	buf := binary.BigEndian.AppendUint32(make([]byte, 0, 36), hhea.Version)
+	for _, v := range []int16{
+		hhea.Ascender, hhea.Descender, hhea.LineGap, int16(hhea.AdvanceWidthMax),
+		hhea.MinLeftSideBearing, hhea.MinRightSideBearing, hhea.XMaxExtent,
+		hhea.CaretSlopeRise, hhea.CaretSlopeRun, hhea.CaretOffset,
+		hhea.Reserved[0], hhea.Reserved[1], hhea.Reserved[2], hhea.Reserved[3],
+		hhea.MetricDataFormat, int16(hhea.NumberOfHMetrics),
+	} {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(v))
+	}
+	return buf, nil
+}
+
+// read hmtx table; numGlyphs is maxp.numGlyphs, or -1 without a maxp table
+// to take every left side bearing the table holds.
+func readHmtxTable(data []byte, numberOfHMetrics uint16, numGlyphs int) (HmtxTable, error) {
+	n := int(numberOfHMetrics)
+	numBearings, err := metricsLayout("hmtx", "hhea", data, n, numGlyphs)
+	if err != nil {
+		return HmtxTable{}, err
+	}
+	hmtx := HmtxTable{
+		HMetrics:         make([]LongHorMetric, n),
+		LeftSideBearings: make([]int16, numBearings),
+	}
+	for i := range hmtx.HMetrics {
+		hmtx.HMetrics[i] = LongHorMetric{
+			AdvanceWidth: binary.BigEndian.Uint16(data[4*i:]),
+			Lsb:          int16(binary.BigEndian.Uint16(data[4*i+2:])),
+		}
+	}
+	for i := range hmtx.LeftSideBearings {
+		hmtx.LeftSideBearings[i] = int16(binary.BigEndian.Uint16(data[4*n+2*i:]))
+	}
+	return hmtx, nil
+}
+
+// metricsLayout checks that data holds n long metrics followed by the side
+// bearings of the remaining glyphs, and returns the number of those. It is
+// shared by hmtx and vmtx, whose counts of long metrics are held by the
+// header table.
+func metricsLayout(table, header string, data []byte, n, numGlyphs int) (int, error) {
+	if numGlyphs >= 0 && n > numGlyphs {
+		return 0, &ParseError{Table: table, Reason: fmt.Sprintf("%s has %d metrics for %d glyphs", header, n, numGlyphs)}
+	}
+	if n == 0 && numGlyphs != 0 {
+		return 0, &ParseError{Table: table, Reason: header + " has no metrics"}
+	}
+	if err := checkRange(table, data, 0, 4*uint64(n)); err != nil {
+		return 0, err
+	}
+	if numGlyphs < 0 {
+		return (len(data) - 4*n) / 2, nil
+	}
+	if err := checkRange(table, data, 4*uint64(n), 2*uint64(numGlyphs-n)); err != nil {
+		return 0, err
+	}
+	return numGlyphs - n, nil
+}
+
+// encode serializes the hmtx table. hhea.numberOfHMetrics must match the
+// number of long metrics; (*TTF).Bytes updates it.
+func (hmtx HmtxTable) encode() ([]byte, error) {
+	buf := make([]byte, 0, 4*len(hmtx.HMetrics)+2*len(hmtx.LeftSideBearings))
+	for _, m := range hmtx.HMetrics {
+		buf = binary.BigEndian.AppendUint16(buf, m.AdvanceWidth)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(m.Lsb))
+	}
+	for _, lsb := range hmtx.LeftSideBearings {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(lsb))
+	}
+	return buf, nil
+}
+
+// NumGlyphs returns the number of glyphs with metrics.
+func (hmtx HmtxTable) NumGlyphs() int {
+	return len(hmtx.HMetrics) + len(hmtx.LeftSideBearings)
+}
+
+// Metric returns the advance width and left side bearing of glyph gid,
+// zero if the glyph has no metrics.
+func (hmtx HmtxTable) Metric(gid uint16) LongHorMetric {
+	n := len(hmtx.HMetrics)
+	switch {
+	case int(gid) < n:
+		return hmtx.HMetrics[gid]
+	case int(gid) < hmtx.NumGlyphs() && n > 0:
+		return LongHorMetric{AdvanceWidth: hmtx.HMetrics[n-1].AdvanceWidth, Lsb: hmtx.LeftSideBearings[int(gid)-n]}
+	}
+	return LongHorMetric{}
+}
+
+// subset returns the metrics of the glyphs of order, in that order. Long
+// metrics stop after the last change of advance width.
+func (hmtx HmtxTable) subset(order []uint16) HmtxTable {
+	metrics := make([]LongHorMetric, len(order))
+	for i, gid := range order {
+		metrics[i] = hmtx.Metric(gid)
+	}
+	n := len(metrics)
+	for n > 1 && metrics[n-1].AdvanceWidth == metrics[n-2].AdvanceWidth {
+		n--
+	}
+	sub := HmtxTable{HMetrics: metrics[:n], LeftSideBearings: make([]int16, len(metrics)-n)}
+	for i, m := range metrics[n:] {
+		sub.LeftSideBearings[i] = m.Lsb
+	}
+	return sub
+}
+
+// Hhea returns the hhea table, decoding it on first use.
+func (ttf *TTF) Hhea() (HheaTable, error) {
+	table, err := ttf.decodeTable(tagHhea, readHheaTable)
+	if err != nil {
+		return HheaTable{}, err
+	}
+	hhea, ok := table.(HheaTable)
+	if !ok {
+		return HheaTable{}, fmt.Errorf("hhea table holds a %T", table)
+	}
+	return hhea, nil
+}
+
+// Hmtx returns the hmtx table, decoding it and hhea on first use. It holds
+// metrics for the maxp.numGlyphs glyphs.
+func (ttf *TTF) Hmtx() (HmtxTable, error) {
+	table, err := ttf.decodeTable(tagHmtx, func(data []byte) (TTFTable, error) {
+		hhea, err := ttf.Hhea()
+		if err != nil {
+			return nil, err
+		}
+		numGlyphs, err := ttf.NumGlyphs()
+		if errors.Is(err, ErrNoTable) {
+			numGlyphs = -1
+		} else if err != nil {
+			return nil, err
+		}
+		hmtx, err := readHmtxTable(data, hhea.NumberOfHMetrics, numGlyphs)
+		if err != nil {
+			return nil, err
+		}
+		return hmtx, nil
+	})
+	if err != nil {
+		return HmtxTable{}, err
+	}
+	hmtx, ok := table.(HmtxTable)
+	if !ok {
+		return HmtxTable{}, fmt.Errorf("hmtx table holds a %T", table)
+	}
+	return hmtx, nil
+}
+
+// Advance returns the advance width of glyph gid in font units, such as a
+// glyph found by (*CmapTable).Lookup.
+func (ttf *TTF) Advance(gid uint16) (uint16, error) {
+	hmtx, err := ttf.Hmtx()
+	if err != nil {
+		return 0, err
+	}
+	if int(gid) >= hmtx.NumGlyphs() {
+		return 0, fmt.Errorf("glyph %d is out of range, the font has %d glyphs", gid, hmtx.NumGlyphs())
+	}
+	return hmtx.Metric(gid).AdvanceWidth, nil
+}
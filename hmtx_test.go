@@ -0,0 +1,82 @@
+package fontcompress_test
+
+import (
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+func TestReadHmtxTable(t *testing.T) {
+	ttf := readFont(t, fixtureFont())
+	hhea, err := ttf.Hhea()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := font_compress.HheaTable{
+		Version:          0x00010000,
+		Ascender:         900,
+		Descender:        -200,
+		AdvanceWidthMax:  600,
+		XMaxExtent:       800,
+		CaretSlopeRise:   1,
+		NumberOfHMetrics: uint16(len(fixtureAdvances)),
+	}
+	if hhea != want {
+		t.Errorf("hhea = %+v, want %+v", hhea, want)
+	}
+
+	hmtx, err := ttf.Hmtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hmtx.HMetrics) != len(fixtureAdvances) || hmtx.NumGlyphs() != len(fixtureGlyphs) {
+		t.Fatalf("%d long metrics for %d glyphs, want %d for %d", len(hmtx.HMetrics), hmtx.NumGlyphs(), len(fixtureAdvances), len(fixtureGlyphs))
+	}
+	for gid, g := range fixtureGlyphs {
+		// the glyphs past the long metrics share the last advance width
+		advance := fixtureAdvances[min(gid, len(fixtureAdvances)-1)]
+		xMin, _, _, _ := glyphBounds(g)
+		if m := hmtx.Metric(uint16(gid)); m.AdvanceWidth != advance || m.Lsb != xMin {
+			t.Errorf("glyph %d metric = %+v, want advance %d and lsb %d", gid, m, advance, xMin)
+		}
+	}
+
+	// advances compose with cmap lookups
+	cmap := cmapTable(t, ttf)
+	for r := range fixtureCmap {
+		gid, _ := cmap.Lookup(r)
+		if advance, err := ttf.Advance(gid); err != nil || advance != fixtureAdvances[min(int(gid), len(fixtureAdvances)-1)] {
+			t.Errorf("Advance of %q (glyph %d) = %d, %v", r, gid, advance, err)
+		}
+	}
+	if _, err := ttf.Advance(uint16(len(fixtureGlyphs))); err == nil {
+		t.Error("Advance of a glyph out of range succeeded")
+	}
+}
+
+func TestWriteHmtxTable(t *testing.T) {
+	ttf := readFont(t, fixtureFont())
+	hmtx, err := ttf.Hmtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every glyph gets a long metric, the last one a wider advance
+	for _, lsb := range hmtx.LeftSideBearings {
+		hmtx.HMetrics = append(hmtx.HMetrics, font_compress.LongHorMetric{AdvanceWidth: 600, Lsb: lsb})
+	}
+	hmtx.HMetrics[len(hmtx.HMetrics)-1].AdvanceWidth = 900
+	hmtx.LeftSideBearings = nil
+	replaceTable(ttf, hmtx)
+	font, err := ttf.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reread := readFont(t, font)
+	if hhea, err := reread.Hhea(); err != nil || hhea.NumberOfHMetrics != uint16(len(fixtureGlyphs)) {
+		t.Errorf("hhea.NumberOfHMetrics = %d, %v, want %d", hhea.NumberOfHMetrics, err, len(fixtureGlyphs))
+	}
+	if advance, err := reread.Advance(uint16(len(fixtureGlyphs) - 1)); err != nil || advance != 900 {
+		t.Errorf("advance of the last glyph = %d, %v, want 900", advance, err)
+	}
+}
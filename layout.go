@@ -0,0 +1,1598 @@
+package fontcompress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// lookup flags of GSUB and GPOS lookups
+const (
+	LOOKUP_FLAG_RIGHT_TO_LEFT          uint16 = 0x0001
+	LOOKUP_FLAG_IGNORE_BASE_GLYPHS     uint16 = 0x0002
+	LOOKUP_FLAG_IGNORE_LIGATURES       uint16 = 0x0004
+	LOOKUP_FLAG_IGNORE_MARKS           uint16 = 0x0008
+	LOOKUP_FLAG_USE_MARK_FILTERING_SET uint16 = 0x0010
+	LOOKUP_FLAG_MARK_ATTACHMENT_TYPE   uint16 = 0xFF00
+)
+
+// errOffsetOverflow reports a subtable beyond the reach of its offset.
+var errOffsetOverflow = errors.New("layout subtable offset overflows")
+
+/*
+*
+uint16	majorVersion	Major version of the GSUB or GPOS table, = 1
+uint16	minorVersion	Minor version, = 0 or 1
+Offset16	scriptListOffset	Offset to ScriptList table, from beginning of the table
+Offset16	featureListOffset	Offset to FeatureList table, from beginning of the table
+Offset16	lookupListOffset	Offset to LookupList table, from beginning of the table
+Offset32	featureVariationsOffset	Offset to FeatureVariations table, from beginning of the table (may be NULL); version 1.1
+*/
+// LayoutTable is the common structure of the GSUB and GPOS tables: scripts
+// select features, which select lookups, which hold subtables of a type
+// particular to each table.
+type LayoutTable struct {
+	MajorVersion uint16
+	MinorVersion uint16
+	Scripts      []ScriptRecord
+	Features     []FeatureRecord
+	Lookups      []Lookup
+	// FeatureVariations substitutes features in regions of the design space
+	// of variable fonts; version 1.1 only.
+	FeatureVariations *FeatureVariations
+}
+
+// ScriptRecord holds the language systems of a script, sorted by tag.
+type ScriptRecord struct {
+	Tag            Tag
+	DefaultLangSys *LangSys // nil if the script has none
+	LangSysRecords []LangSysRecord
+}
+
+// LangSysRecord is a language system of a script.
+type LangSysRecord struct {
+	Tag     Tag
+	LangSys LangSys
+}
+
+// LangSys lists the features of a language system by their index in the
+// feature list.
+type LangSys struct {
+	RequiredFeatureIndex uint16 // 0xFFFF if no feature is required
+	FeatureIndices       []uint16
+}
+
+// FeatureRecord is a feature of the feature list, such as 'liga'.
+type FeatureRecord struct {
+	Tag     Tag
+	Feature Feature
+}
+
+// Feature lists the lookups of a feature by their index in the lookup list.
+type Feature struct {
+	// Params are the raw feature parameters of the 'size', 'ssXX' and
+	// 'cvXX' features; nil if the feature has none.
+	Params            []byte
+	LookupListIndices []uint16
+}
+
+// Lookup is a lookup of the lookup list. Subtables of extension lookups
+// are decoded as those of the lookup type they extend.
+type Lookup struct {
+	Type             uint16 // lookup type
+	Flag             uint16 // LOOKUP_FLAG_*
+	MarkFilteringSet uint16 // used if Flag has LOOKUP_FLAG_USE_MARK_FILTERING_SET
+	// Extension writes the subtables through extension subtables, which
+	// reach beyond 16-bit offsets. Lookups are also written that way when
+	// their subtables would not fit otherwise.
+	Extension bool
+	Subtables []LookupSubtable
+}
+
+// LookupSubtable is a subtable of a GSUB or GPOS lookup.
+type LookupSubtable interface {
+	encode() ([]byte, error)
+	// subset returns the subtable for the glyphs of newID, renumbered, or
+	// nil if nothing is left of it.
+	subset(newID map[uint16]uint16) LookupSubtable
+	// maxContext returns the length of the longest glyph context the
+	// subtable matches.
+	maxContext() int
+}
+
+// Coverage lists the glyphs a subtable applies to, sorted by glyph id. The
+// position of a glyph is its coverage index.
+type Coverage []uint16
+
+// ClassDef assigns glyphs to classes; glyphs it does not list are in
+// class 0.
+type ClassDef map[uint16]uint16
+
+// SequenceContext is a contextual (GSUB type 5, GPOS type 7) or chained
+// contextual (GSUB type 6, GPOS type 8) lookup subtable. It applies lookups
+// to the glyph sequences it matches. Backtrack sequences are stored as in
+// the font, nearest glyph first.
+type SequenceContext struct {
+	Chained bool
+	Format  uint16 // 1: glyph sequences, 2: class sequences, 3: coverage sequences
+	// Coverage lists the glyphs that start a sequence in formats 1 and 2.
+	Coverage Coverage
+	// Rules are the rules of each glyph of Coverage in format 1, and those
+	// of each input class in format 2.
+	Rules [][]SequenceRule
+	// class definitions of format 2; only InputClassDef is used unless the
+	// context is chained
+	BacktrackClassDef ClassDef
+	InputClassDef     ClassDef
+	LookaheadClassDef ClassDef
+	// coverages of each position of the sequence and the lookups applied
+	// to it in format 3
+	BacktrackCoverages []Coverage
+	InputCoverages     []Coverage
+	LookaheadCoverages []Coverage
+	Lookups            []SequenceLookup
+}
+
+// SequenceRule matches a sequence of glyphs, or of classes in format 2.
+// Input does not hold the first glyph of the sequence, which is that of the
+// rule set.
+type SequenceRule struct {
+	Backtrack []uint16
+	Input     []uint16
+	Lookahead []uint16
+	Lookups   []SequenceLookup
+}
+
+// SequenceLookup applies a lookup at a position of the input sequence.
+type SequenceLookup struct {
+	SequenceIndex   uint16
+	LookupListIndex uint16
+}
+
+// FeatureVariations substitutes features when all the conditions of a
+// record hold; the first such record applies.
+type FeatureVariations struct {
+	MajorVersion uint16
+	MinorVersion uint16
+	Records      []FeatureVariationRecord
+}
+
+// FeatureVariationRecord substitutes features in a region of the design
+// space.
+type FeatureVariationRecord struct {
+	Conditions    []Condition
+	Substitutions []FeatureSubstitution
+}
+
+// Condition holds when the normalized coordinate of an axis is within the
+// range, in F2DOT14.
+type Condition struct {
+	AxisIndex           uint16
+	FilterRangeMinValue int16
+	FilterRangeMaxValue int16
+}
+
+// FeatureSubstitution replaces the feature at an index of the feature list.
+type FeatureSubstitution struct {
+	FeatureIndex uint16
+	Feature      Feature
+}
+
+// layoutReader decodes the subtables of a GSUB or GPOS table. Subtables may
+// be shared, so the bytes decoded are bounded to keep hostile tables from
+// expanding without limit.
+type layoutReader struct {
+	table  string
+	data   []byte
+	budget int
+}
+
+func newLayoutReader(table string, data []byte) *layoutReader {
+	return &layoutReader{table: table, data: data, budget: 1<<20 + 64*len(data)}
+}
+
+// check reports a *ParseError unless the table holds n bytes at off.
+func (r *layoutReader) check(off, n int) error {
+	if err := checkRange(r.table, r.data, uint64(off), uint64(n)); err != nil {
+		return err
+	}
+	return r.charge(off, n)
+}
+
+// charge counts n decoded bytes against the budget.
+func (r *layoutReader) charge(off, n int) error {
+	if r.budget -= n; r.budget < 0 {
+		return &ParseError{Table: r.table, Offset: int64(off), Reason: "subtables expand beyond the size limit"}
+	}
+	return nil
+}
+
+func (r *layoutReader) u16(off int) uint16 { return binary.BigEndian.Uint16(r.data[off:]) }
+func (r *layoutReader) u32(off int) uint32 { return binary.BigEndian.Uint32(r.data[off:]) }
+
+// uint16s reads n values at off; nil if n is 0.
+func (r *layoutReader) uint16s(off, n int) ([]uint16, error) {
+	if err := r.check(off, 2*n); err != nil || n == 0 {
+		return nil, err
+	}
+	v := make([]uint16, n)
+	for i := range v {
+		v[i] = r.u16(off + 2*i)
+	}
+	return v, nil
+}
+
+// offsets reads n offsets at at, relative to base; null offsets are -1.
+func (r *layoutReader) offsets(base, at, n int) ([]int, error) {
+	if err := r.check(at, 2*n); err != nil {
+		return nil, err
+	}
+	offs := make([]int, n)
+	for i := range offs {
+		offs[i] = -1
+		if o := r.u16(at + 2*i); o != 0 {
+			offs[i] = base + int(o)
+		}
+	}
+	return offs, nil
+}
+
+// readLayoutTable reads a GSUB or GPOS table. readSubtable decodes the
+// subtables of each lookup type but the extension type.
+func readLayoutTable(table string, data []byte, extensionType uint16, readSubtable func(r *layoutReader, lookupType uint16, off int) (LookupSubtable, error)) (LayoutTable, error) {
+	r := newLayoutReader(table, data)
+	if err := r.check(0, 10); err != nil {
+		return LayoutTable{}, err
+	}
+	layout := LayoutTable{MajorVersion: r.u16(0), MinorVersion: r.u16(2)}
+	if layout.MajorVersion != 1 || layout.MinorVersion > 1 {
+		return LayoutTable{}, &ParseError{Table: table, Reason: fmt.Sprintf("unsupported version %d.%d", layout.MajorVersion, layout.MinorVersion)}
+	}
+	var err error
+	if off := int(r.u16(4)); off != 0 {
+		if layout.Scripts, err = r.scriptList(off); err != nil {
+			return LayoutTable{}, err
+		}
+	}
+	if off := int(r.u16(6)); off != 0 {
+		if layout.Features, err = r.featureList(off); err != nil {
+			return LayoutTable{}, err
+		}
+	}
+	if off := int(r.u16(8)); off != 0 {
+		if layout.Lookups, err = r.lookupList(off, extensionType, readSubtable); err != nil {
+			return LayoutTable{}, err
+		}
+	}
+	if layout.MinorVersion == 1 {
+		if err := r.check(10, 4); err != nil {
+			return LayoutTable{}, err
+		}
+		if off := int(r.u32(10)); off != 0 {
+			fv, err := r.featureVariations(off, layout.Features)
+			if err != nil {
+				return LayoutTable{}, err
+			}
+			layout.FeatureVariations = &fv
+		}
+	}
+	return layout, nil
+}
+
+func (r *layoutReader) scriptList(off int) ([]ScriptRecord, error) {
+	if err := r.check(off, 2); err != nil {
+		return nil, err
+	}
+	n := int(r.u16(off))
+	if err := r.check(off+2, 6*n); err != nil {
+		return nil, err
+	}
+	scripts := make([]ScriptRecord, n)
+	for i := range scripts {
+		rec := off + 2 + 6*i
+		script := off + int(r.u16(rec+4))
+		if err := r.check(script, 4); err != nil {
+			return nil, err
+		}
+		scripts[i].Tag = Tag(r.u32(rec))
+		if d := int(r.u16(script)); d != 0 {
+			ls, err := r.langSys(script + d)
+			if err != nil {
+				return nil, err
+			}
+			scripts[i].DefaultLangSys = &ls
+		}
+		m := int(r.u16(script + 2))
+		if err := r.check(script+4, 6*m); err != nil {
+			return nil, err
+		}
+		for j := 0; j < m; j++ {
+			rec := script + 4 + 6*j
+			ls, err := r.langSys(script + int(r.u16(rec+4)))
+			if err != nil {
+				return nil, err
+			}
+			scripts[i].LangSysRecords = append(scripts[i].LangSysRecords, LangSysRecord{Tag: Tag(r.u32(rec)), LangSys: ls})
+		}
+	}
+	return scripts, nil
+}
+
+func (r *layoutReader) langSys(off int) (LangSys, error) {
+	if err := r.check(off, 6); err != nil {
+		return LangSys{}, err
+	}
+	indices, err := r.uint16s(off+6, int(r.u16(off+4)))
+	if err != nil {
+		return LangSys{}, err
+	}
+	return LangSys{RequiredFeatureIndex: r.u16(off + 2), FeatureIndices: indices}, nil
+}
+
+func (r *layoutReader) featureList(off int) ([]FeatureRecord, error) {
+	if err := r.check(off, 2); err != nil {
+		return nil, err
+	}
+	n := int(r.u16(off))
+	if err := r.check(off+2, 6*n); err != nil {
+		return nil, err
+	}
+	features := make([]FeatureRecord, n)
+	for i := range features {
+		rec := off + 2 + 6*i
+		features[i].Tag = Tag(r.u32(rec))
+		f, err := r.feature(features[i].Tag, off+int(r.u16(rec+4)))
+		if err != nil {
+			return nil, err
+		}
+		features[i].Feature = f
+	}
+	return features, nil
+}
+
+func (r *layoutReader) feature(tag Tag, off int) (Feature, error) {
+	if err := r.check(off, 4); err != nil {
+		return Feature{}, err
+	}
+	indices, err := r.uint16s(off+4, int(r.u16(off+2)))
+	if err != nil {
+		return Feature{}, err
+	}
+	f := Feature{LookupListIndices: indices}
+	if p := int(r.u16(off)); p != 0 {
+		if f.Params, err = r.featureParams(tag, off+p); err != nil {
+			return Feature{}, err
+		}
+	}
+	return f, nil
+}
+
+// featureParams returns the raw parameters of the features that define
+// them; those of other features are dropped.
+func (r *layoutReader) featureParams(tag Tag, off int) ([]byte, error) {
+	var n int
+	switch s := tag.String(); {
+	case s == "size":
+		n = 10
+	case strings.HasPrefix(s, "ss"):
+		n = 4
+	case strings.HasPrefix(s, "cv"):
+		if err := r.check(off, 14); err != nil {
+			return nil, err
+		}
+		n = 14 + 3*int(r.u16(off+12))
+	default:
+		return nil, nil
+	}
+	if err := r.check(off, n); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), r.data[off:off+n]...), nil
+}
+
+func (r *layoutReader) lookupList(off int, extensionType uint16, readSubtable func(r *layoutReader, lookupType uint16, off int) (LookupSubtable, error)) ([]Lookup, error) {
+	if err := r.check(off, 2); err != nil {
+		return nil, err
+	}
+	offs, err := r.offsets(off, off+2, int(r.u16(off)))
+	if err != nil {
+		return nil, err
+	}
+	lookups := make([]Lookup, len(offs))
+	for i, lookup := range offs {
+		if lookup < 0 {
+			return nil, &ParseError{Table: r.table, Offset: int64(off + 2 + 2*i), Reason: fmt.Sprintf("lookup %d is missing", i)}
+		}
+		if err := r.check(lookup, 6); err != nil {
+			return nil, err
+		}
+		l := Lookup{Type: r.u16(lookup), Flag: r.u16(lookup + 2)}
+		n := int(r.u16(lookup + 4))
+		subs, err := r.offsets(lookup, lookup+6, n)
+		if err != nil {
+			return nil, err
+		}
+		if l.Flag&LOOKUP_FLAG_USE_MARK_FILTERING_SET != 0 {
+			if err := r.check(lookup+6+2*n, 2); err != nil {
+				return nil, err
+			}
+			l.MarkFilteringSet = r.u16(lookup + 6 + 2*n)
+		}
+		l.Extension = l.Type == extensionType
+		for j, sub := range subs {
+			if sub < 0 {
+				return nil, &ParseError{Table: r.table, Offset: int64(lookup + 6 + 2*j), Reason: fmt.Sprintf("subtable %d of lookup %d is missing", j, i)}
+			}
+			lookupType := l.Type
+			if l.Extension {
+				if err := r.check(sub, 8); err != nil {
+					return nil, err
+				}
+				lookupType = r.u16(sub + 2)
+				switch {
+				case r.u16(sub) != 1:
+					return nil, &ParseError{Table: r.table, Offset: int64(sub), Reason: fmt.Sprintf("unknown extension format %d", r.u16(sub))}
+				case lookupType == extensionType:
+					return nil, &ParseError{Table: r.table, Offset: int64(sub), Reason: "extension of an extension subtable"}
+				case j > 0 && lookupType != l.Type:
+					return nil, &ParseError{Table: r.table, Offset: int64(sub), Reason: fmt.Sprintf("extension subtables of lookup %d differ in type", i)}
+				}
+				l.Type = lookupType
+				sub += int(r.u32(sub + 4))
+			}
+			st, err := readSubtable(r, lookupType, sub)
+			if err != nil {
+				return nil, err
+			}
+			l.Subtables = append(l.Subtables, st)
+		}
+		lookups[i] = l
+	}
+	return lookups, nil
+}
+
+func (r *layoutReader) featureVariations(off int, features []FeatureRecord) (FeatureVariations, error) {
+	if err := r.check(off, 8); err != nil {
+		return FeatureVariations{}, err
+	}
+	fv := FeatureVariations{MajorVersion: r.u16(off), MinorVersion: r.u16(off + 2)}
+	if fv.MajorVersion != 1 {
+		return FeatureVariations{}, &ParseError{Table: r.table, Offset: int64(off), Reason: fmt.Sprintf("unsupported feature variations version %d.%d", fv.MajorVersion, fv.MinorVersion)}
+	}
+	n := int(r.u32(off + 4))
+	if err := r.check(off+8, 8*n); err != nil {
+		return FeatureVariations{}, err
+	}
+	fv.Records = make([]FeatureVariationRecord, n)
+	for i := range fv.Records {
+		rec := off + 8 + 8*i
+		if set := int(r.u32(rec)); set != 0 {
+			set += off
+			if err := r.check(set, 2); err != nil {
+				return FeatureVariations{}, err
+			}
+			m := int(r.u16(set))
+			if err := r.check(set+2, 4*m); err != nil {
+				return FeatureVariations{}, err
+			}
+			for j := 0; j < m; j++ {
+				cond := set + int(r.u32(set+2+4*j))
+				if err := r.check(cond, 8); err != nil {
+					return FeatureVariations{}, err
+				}
+				if format := r.u16(cond); format != 1 {
+					return FeatureVariations{}, &ParseError{Table: r.table, Offset: int64(cond), Reason: fmt.Sprintf("unknown condition format %d", format)}
+				}
+				fv.Records[i].Conditions = append(fv.Records[i].Conditions, Condition{
+					AxisIndex:           r.u16(cond + 2),
+					FilterRangeMinValue: int16(r.u16(cond + 4)),
+					FilterRangeMaxValue: int16(r.u16(cond + 6)),
+				})
+			}
+		}
+		if subst := int(r.u32(rec + 4)); subst != 0 {
+			subst += off
+			if err := r.check(subst, 6); err != nil {
+				return FeatureVariations{}, err
+			}
+			m := int(r.u16(subst + 4))
+			if err := r.check(subst+6, 6*m); err != nil {
+				return FeatureVariations{}, err
+			}
+			for j := 0; j < m; j++ {
+				rec := subst + 6 + 6*j
+				index := r.u16(rec)
+				var tag Tag
+				if int(index) < len(features) {
+					tag = features[index].Tag
+				}
+				f, err := r.feature(tag, subst+int(r.u32(rec+2)))
+				if err != nil {
+					return FeatureVariations{}, err
+				}
+				fv.Records[i].Substitutions = append(fv.Records[i].Substitutions, FeatureSubstitution{FeatureIndex: index, Feature: f})
+			}
+		}
+	}
+	return fv, nil
+}
+
+/*
+*
+coverage format 1:
+uint16	coverageFormat	Format identifier — format = 1
+uint16	glyphCount	Number of glyphs in the glyph array
+uint16	glyphArray[glyphCount]	Array of glyph IDs — in numerical order
+
+coverage format 2:
+uint16	coverageFormat	Format identifier — format = 2
+uint16	rangeCount	Number of RangeRecords
+RangeRecord	rangeRecords[rangeCount]	Array of glyph ranges — ordered by startGlyphID: startGlyphID, endGlyphID, startCoverageIndex
+*/
+func (r *layoutReader) coverage(off int) (Coverage, error) {
+	if err := r.check(off, 4); err != nil {
+		return nil, err
+	}
+	format, n := r.u16(off), int(r.u16(off+2))
+	switch format {
+	case 1:
+		glyphs, err := r.uint16s(off+4, n)
+		return Coverage(glyphs), err
+	case 2:
+		if err := r.check(off+4, 6*n); err != nil {
+			return nil, err
+		}
+		var cov Coverage
+		for i := 0; i < n; i++ {
+			rec := off + 4 + 6*i
+			start, end := int(r.u16(rec)), int(r.u16(rec+2))
+			if end < start {
+				return nil, &ParseError{Table: r.table, Offset: int64(rec), Reason: "coverage range ends before it starts"}
+			}
+			if err := r.charge(rec, 2*(end-start+1)); err != nil {
+				return nil, err
+			}
+			for gid := start; gid <= end; gid++ {
+				cov = append(cov, uint16(gid))
+			}
+		}
+		return cov, nil
+	}
+	return nil, &ParseError{Table: r.table, Offset: int64(off), Reason: fmt.Sprintf("unknown coverage format %d", format)}
+}
+
+/*
+*
+class definition format 1:
+uint16	classFormat	Format identifier — format = 1
+uint16	startGlyphID	First glyph ID of the classValueArray
+uint16	glyphCount	Size of the classValueArray
+uint16	classValueArray[glyphCount]	Array of Class Values — one per glyph ID
+
+class definition format 2:
+uint16	classFormat	Format identifier — format = 2
+uint16	classRangeCount	Number of ClassRangeRecords
+ClassRangeRecord	classRangeRecords[classRangeCount]	Array of ClassRangeRecords — ordered by startGlyphID: startGlyphID, endGlyphID, class
+*/
+func (r *layoutReader) classDef(off int) (ClassDef, error) {
+	if err := r.check(off, 4); err != nil {
+		return nil, err
+	}
+	cd := ClassDef{}
+	switch format := r.u16(off); format {
+	case 1:
+		if err := r.check(off, 6); err != nil {
+			return nil, err
+		}
+		start, n := int(r.u16(off+2)), int(r.u16(off+4))
+		classes, err := r.uint16s(off+6, n)
+		if err != nil {
+			return nil, err
+		}
+		for i, class := range classes {
+			if class != 0 && start+i <= 0xFFFF {
+				cd[uint16(start+i)] = class
+			}
+		}
+	case 2:
+		n := int(r.u16(off + 2))
+		if err := r.check(off+4, 6*n); err != nil {
+			return nil, err
+		}
+		for i := 0; i < n; i++ {
+			rec := off + 4 + 6*i
+			start, end, class := int(r.u16(rec)), int(r.u16(rec+2)), r.u16(rec+4)
+			if end < start {
+				return nil, &ParseError{Table: r.table, Offset: int64(rec), Reason: "class range ends before it starts"}
+			}
+			if err := r.charge(rec, 4*(end-start+1)); err != nil {
+				return nil, err
+			}
+			for gid := start; gid <= end && class != 0; gid++ {
+				cd[uint16(gid)] = class
+			}
+		}
+	default:
+		return nil, &ParseError{Table: r.table, Offset: int64(off), Reason: fmt.Sprintf("unknown class definition format %d", format)}
+	}
+	return cd, nil
+}
+
+// optionalClassDef reads the class definition at the offset stored at at,
+// relative to base; a null offset is an empty class definition.
+func (r *layoutReader) optionalClassDef(base, at int) (ClassDef, error) {
+	if o := int(r.u16(at)); o != 0 {
+		return r.classDef(base + o)
+	}
+	return ClassDef{}, nil
+}
+
+// coverages reads n coverage offsets at at, relative to base, and the
+// coverages they point to.
+func (r *layoutReader) coverages(base, at, n int) ([]Coverage, error) {
+	offs, err := r.offsets(base, at, n)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	covs := make([]Coverage, n)
+	for i, off := range offs {
+		if off < 0 {
+			return nil, &ParseError{Table: r.table, Offset: int64(at + 2*i), Reason: "coverage is missing"}
+		}
+		if covs[i], err = r.coverage(off); err != nil {
+			return nil, err
+		}
+	}
+	return covs, nil
+}
+
+/*
+*
+uint16	startSize	Smallest size to correct, in ppem
+uint16	endSize	Largest size to correct, in ppem
+uint16	deltaFormat	Format of deltaValue array data: 0x0001, 0x0002 or 0x0003
+uint16	deltaValue[ ]	Array of compressed data, 2, 4 or 8 bits per size
+
+VariationIndex table:
+uint16	deltaSetOuterIndex	A delta-set outer index — used to select an item variation data subtable within the item variation store.
+uint16	deltaSetInnerIndex	A delta-set inner index — used to select a delta-set row within an item variation data subtable.
+uint16	deltaFormat	Format, = 0x8000
+*/
+// device reads the raw Device or VariationIndex table at off.
+func (r *layoutReader) device(off int) ([]byte, error) {
+	if err := r.check(off, 6); err != nil {
+		return nil, err
+	}
+	n := 6
+	switch format := r.u16(off + 4); format {
+	case 1, 2, 3:
+		if sizes := int(r.u16(off+2)) - int(r.u16(off)) + 1; sizes > 0 {
+			n += 2 * ((sizes<<format + 15) / 16)
+		}
+	case 0x8000:
+	default:
+		return nil, &ParseError{Table: r.table, Offset: int64(off), Reason: fmt.Sprintf("unknown device format %#04x", format)}
+	}
+	if err := r.check(off, n); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), r.data[off:off+n]...), nil
+}
+
+func (r *layoutReader) sequenceLookups(off, n int) ([]SequenceLookup, error) {
+	if err := r.check(off, 4*n); err != nil || n == 0 {
+		return nil, err
+	}
+	records := make([]SequenceLookup, n)
+	for i := range records {
+		records[i] = SequenceLookup{SequenceIndex: r.u16(off + 4*i), LookupListIndex: r.u16(off + 4*i + 2)}
+	}
+	return records, nil
+}
+
+/*
+*
+sequence context format 1:
+uint16	format	Format identifier: format = 1
+Offset16	coverageOffset	Offset to Coverage table, from beginning of SequenceContextFormat1 table
+uint16	seqRuleSetCount	Number of SequenceRuleSet tables
+Offset16	seqRuleSetOffsets[seqRuleSetCount]	Array of offsets to SequenceRuleSet tables, ordered by coverage index (offsets may be NULL)
+
+sequence context format 2:
+uint16	format	Format identifier: format = 2
+Offset16	coverageOffset	Offset to Coverage table
+Offset16	classDefOffset	Offset to ClassDef table
+uint16	classSeqRuleSetCount	Number of ClassSequenceRuleSet tables
+Offset16	classSeqRuleSetOffsets[classSeqRuleSetCount]	Array of offsets to ClassSequenceRuleSet tables, ordered by class (offsets may be NULL)
+
+sequence context format 3:
+uint16	format	Format identifier: format = 3
+uint16	glyphCount	Number of glyphs in the input sequence
+uint16	seqLookupCount	Number of SequenceLookupRecords
+Offset16	coverageOffsets[glyphCount]	Array of offsets to Coverage tables, in glyph sequence order
+SequenceLookupRecord	seqLookupRecords[seqLookupCount]	Array of SequenceLookupRecords
+
+chained sequence context format 2 has backtrack, input and lookahead class definitions, format 3 backtrack, input and lookahead coverages.
+*/
+func (r *layoutReader) sequenceContext(off int, chained bool) (SequenceContext, error) {
+	if err := r.check(off, 6); err != nil {
+		return SequenceContext{}, err
+	}
+	sc := SequenceContext{Chained: chained, Format: r.u16(off)}
+	var err error
+	switch sc.Format {
+	case 1, 2:
+		if sc.Coverage, err = r.coverage(off + int(r.u16(off+2))); err != nil {
+			return SequenceContext{}, err
+		}
+		at := off + 4
+		if sc.Format == 2 {
+			classDefs := []*ClassDef{&sc.InputClassDef}
+			if chained {
+				classDefs = []*ClassDef{&sc.BacktrackClassDef, &sc.InputClassDef, &sc.LookaheadClassDef}
+			}
+			if err := r.check(at, 2*len(classDefs)); err != nil {
+				return SequenceContext{}, err
+			}
+			for _, cd := range classDefs {
+				if *cd, err = r.optionalClassDef(off, at); err != nil {
+					return SequenceContext{}, err
+				}
+				at += 2
+			}
+		}
+		if err := r.check(at, 2); err != nil {
+			return SequenceContext{}, err
+		}
+		sets, err := r.offsets(off, at+2, int(r.u16(at)))
+		if err != nil {
+			return SequenceContext{}, err
+		}
+		sc.Rules = make([][]SequenceRule, len(sets))
+		for i, set := range sets {
+			if set < 0 {
+				continue
+			}
+			if err := r.check(set, 2); err != nil {
+				return SequenceContext{}, err
+			}
+			rules, err := r.offsets(set, set+2, int(r.u16(set)))
+			if err != nil {
+				return SequenceContext{}, err
+			}
+			for _, rule := range rules {
+				if rule < 0 {
+					continue
+				}
+				sr, err := r.sequenceRule(rule, chained)
+				if err != nil {
+					return SequenceContext{}, err
+				}
+				sc.Rules[i] = append(sc.Rules[i], sr)
+			}
+		}
+	case 3:
+		at := off + 2
+		positions := []*[]Coverage{&sc.InputCoverages}
+		if chained {
+			positions = []*[]Coverage{&sc.BacktrackCoverages, &sc.InputCoverages, &sc.LookaheadCoverages}
+		}
+		var n int
+		for i, covs := range positions {
+			if err := r.check(at, 2); err != nil {
+				return SequenceContext{}, err
+			}
+			n = int(r.u16(at))
+			if !chained {
+				// the lookup count precedes the coverages
+				at += 2
+			}
+			if *covs, err = r.coverages(off, at+2, n); err != nil {
+				return SequenceContext{}, err
+			}
+			if i < len(positions)-1 {
+				at += 2 + 2*n
+			}
+		}
+		if len(sc.InputCoverages) == 0 {
+			return SequenceContext{}, &ParseError{Table: r.table, Offset: int64(off), Reason: "empty input sequence"}
+		}
+		if chained {
+			at += 2 + 2*n
+			if err := r.check(at, 2); err != nil {
+				return SequenceContext{}, err
+			}
+			sc.Lookups, err = r.sequenceLookups(at+2, int(r.u16(at)))
+		} else {
+			sc.Lookups, err = r.sequenceLookups(off+6+2*n, int(r.u16(off+4)))
+		}
+		if err != nil {
+			return SequenceContext{}, err
+		}
+	default:
+		return SequenceContext{}, &ParseError{Table: r.table, Offset: int64(off), Reason: fmt.Sprintf("unknown sequence context format %d", sc.Format)}
+	}
+	return sc, nil
+}
+
+/*
+*
+sequence rule:
+uint16	glyphCount	Number of glyphs in the input glyph sequence
+uint16	seqLookupCount	Number of SequenceLookupRecords
+uint16	inputSequence[glyphCount - 1]	Array of input glyph IDs — starting with the second glyph
+SequenceLookupRecord	seqLookupRecords[seqLookupCount]	Array of Sequence lookup records
+
+chained sequence rule:
+uint16	backtrackGlyphCount	Number of glyphs in the backtrack sequence
+uint16	backtrackSequence[backtrackGlyphCount]	Array of backtrack glyph IDs
+uint16	inputGlyphCount	Number of glyphs in the input sequence
+uint16	inputSequence[inputGlyphCount - 1]	Array of input glyph IDs — start with second glyph
+uint16	lookaheadGlyphCount	Number of glyphs in the lookahead sequence
+uint16	lookaheadSequence[lookaheadGlyphCount]	Array of lookahead glyph IDs
+uint16	seqLookupCount	Number of SequenceLookupRecords
+SequenceLookupRecord	seqLookupRecords[seqLookupCount]	Array of SequenceLookupRecords
+*/
+func (r *layoutReader) sequenceRule(off int, chained bool) (SequenceRule, error) {
+	var rule SequenceRule
+	var err error
+	if !chained {
+		if err := r.check(off, 4); err != nil {
+			return SequenceRule{}, err
+		}
+		n := int(r.u16(off))
+		if n == 0 {
+			return SequenceRule{}, &ParseError{Table: r.table, Offset: int64(off), Reason: "empty input sequence"}
+		}
+		if rule.Input, err = r.uint16s(off+4, n-1); err != nil {
+			return SequenceRule{}, err
+		}
+		rule.Lookups, err = r.sequenceLookups(off+4+2*(n-1), int(r.u16(off+2)))
+		return rule, err
+	}
+	at := off
+	for i, seq := range []*[]uint16{&rule.Backtrack, &rule.Input, &rule.Lookahead} {
+		if err := r.check(at, 2); err != nil {
+			return SequenceRule{}, err
+		}
+		n := int(r.u16(at))
+		if i == 1 {
+			if n == 0 {
+				return SequenceRule{}, &ParseError{Table: r.table, Offset: int64(at), Reason: "empty input sequence"}
+			}
+			n--
+		}
+		if *seq, err = r.uint16s(at+2, n); err != nil {
+			return SequenceRule{}, err
+		}
+		at += 2 + 2*n
+	}
+	if err := r.check(at, 2); err != nil {
+		return SequenceRule{}, err
+	}
+	rule.Lookups, err = r.sequenceLookups(at+2, int(r.u16(at)))
+	return rule, err
+}
+
+// subtableBuffer holds a table followed by the subtables it reaches by
+// offsets from its start. Identical subtables are stored once.
+type subtableBuffer struct {
+	buf    []byte
+	stored map[string]int
+}
+
+// link stores child unless an identical subtable is stored and writes its
+// offset as the 16-bit field at field.
+func (b *subtableBuffer) link(field int, child []byte) error {
+	off := b.store(child)
+	if off > 0xFFFF {
+		return errOffsetOverflow
+	}
+	binary.BigEndian.PutUint16(b.buf[field:], uint16(off))
+	return nil
+}
+
+// link32 is link for 32-bit offset fields.
+func (b *subtableBuffer) link32(field int, child []byte) {
+	off := b.store(child)
+	binary.BigEndian.PutUint32(b.buf[field:], uint32(off))
+}
+
+func (b *subtableBuffer) store(child []byte) int {
+	if b.stored == nil {
+		b.stored = make(map[string]int)
+	}
+	off, ok := b.stored[string(child)]
+	if !ok {
+		off = len(b.buf)
+		b.buf = append(b.buf, child...)
+		b.stored[string(child)] = off
+	}
+	return off
+}
+
+func appendUint16s(buf []byte, values ...uint16) []byte {
+	for _, v := range values {
+		buf = binary.BigEndian.AppendUint16(buf, v)
+	}
+	return buf
+}
+
+// encode serializes a GSUB or GPOS table. Lookups are written through
+// extension subtables of extensionType if they request it, or if their
+// subtables are beyond the reach of 16-bit offsets.
+func (layout LayoutTable) encode(extensionType uint16) ([]byte, error) {
+	scripts, err := encodeScriptList(layout.Scripts)
+	if err != nil {
+		return nil, err
+	}
+	features, err := encodeFeatureList(layout.Features)
+	if err != nil {
+		return nil, err
+	}
+	subtables := make([][][]byte, len(layout.Lookups))
+	extension := make([]bool, len(layout.Lookups))
+	for i, l := range layout.Lookups {
+		extension[i] = l.Extension
+		for _, st := range l.Subtables {
+			data, err := st.encode()
+			if err != nil {
+				return nil, err
+			}
+			subtables[i] = append(subtables[i], data)
+		}
+	}
+	var lookups []byte
+	var extensions []extensionSubtable
+	for {
+		lookups, extensions, err = encodeLookupList(layout.Lookups, subtables, extensionType, extension)
+		var overflow lookupOverflow
+		if !errors.As(err, &overflow) {
+			break
+		}
+		// the largest subtables in the way are moved beyond the others
+		largest, size := overflow.lookup, 0
+		for i := 0; i <= overflow.lookup; i++ {
+			n := 0
+			for _, data := range subtables[i] {
+				n += len(data)
+			}
+			if !extension[i] && n > size {
+				largest, size = i, n
+			}
+		}
+		extension[largest] = true
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	headerSize := 10
+	if layout.MinorVersion >= 1 {
+		headerSize = 14
+	} else if layout.FeatureVariations != nil {
+		return nil, errors.New("feature variations need layout table version 1.1")
+	}
+	b := subtableBuffer{buf: make([]byte, headerSize)}
+	binary.BigEndian.PutUint16(b.buf[0:], layout.MajorVersion)
+	binary.BigEndian.PutUint16(b.buf[2:], layout.MinorVersion)
+	if err := b.link(4, scripts); err != nil {
+		return nil, err
+	}
+	if err := b.link(6, features); err != nil {
+		return nil, err
+	}
+	// the lookup list is not shared, it is patched below
+	lookupList := len(b.buf)
+	if lookupList > 0xFFFF {
+		return nil, errOffsetOverflow
+	}
+	binary.BigEndian.PutUint16(b.buf[8:], uint16(lookupList))
+	b.buf = append(b.buf, lookups...)
+	if layout.FeatureVariations != nil {
+		fv, err := layout.FeatureVariations.encode()
+		if err != nil {
+			return nil, err
+		}
+		b.link32(10, fv)
+	}
+	for _, ext := range extensions {
+		stub := lookupList + ext.stub
+		binary.BigEndian.PutUint32(b.buf[stub+4:], uint32(len(b.buf)-stub))
+		b.buf = append(b.buf, ext.subtable...)
+	}
+	return b.buf, nil
+}
+
+// extensionSubtable is a subtable reached through the extension subtable at
+// offset stub of the lookup list.
+type extensionSubtable struct {
+	stub     int
+	subtable []byte
+}
+
+func encodeScriptList(scripts []ScriptRecord) ([]byte, error) {
+	if len(scripts) > 0xFFFF {
+		return nil, fmt.Errorf("layout table has %d scripts", len(scripts))
+	}
+	b := subtableBuffer{buf: make([]byte, 2+6*len(scripts))}
+	binary.BigEndian.PutUint16(b.buf, uint16(len(scripts)))
+	for i, script := range scripts {
+		binary.BigEndian.PutUint32(b.buf[2+6*i:], uint32(script.Tag))
+		data, err := script.encode()
+		if err != nil {
+			return nil, err
+		}
+		if err := b.link(2+6*i+4, data); err != nil {
+			return nil, err
+		}
+	}
+	return b.buf, nil
+}
+
+func (script ScriptRecord) encode() ([]byte, error) {
+	n := len(script.LangSysRecords)
+	if n > 0xFFFF {
+		return nil, fmt.Errorf("script %s has %d language systems", script.Tag, n)
+	}
+	b := subtableBuffer{buf: make([]byte, 4+6*n)}
+	binary.BigEndian.PutUint16(b.buf[2:], uint16(n))
+	if script.DefaultLangSys != nil {
+		data, err := script.DefaultLangSys.encode()
+		if err != nil {
+			return nil, err
+		}
+		if err := b.link(0, data); err != nil {
+			return nil, err
+		}
+	}
+	for i, rec := range script.LangSysRecords {
+		binary.BigEndian.PutUint32(b.buf[4+6*i:], uint32(rec.Tag))
+		data, err := rec.LangSys.encode()
+		if err != nil {
+			return nil, err
+		}
+		if err := b.link(4+6*i+4, data); err != nil {
+			return nil, err
+		}
+	}
+	return b.buf, nil
+}
+
+func (ls LangSys) encode() ([]byte, error) {
+	if len(ls.FeatureIndices) > 0xFFFF {
+		return nil, fmt.Errorf("language system has %d features", len(ls.FeatureIndices))
+	}
+	return appendUint16s(appendUint16s(nil, 0, ls.RequiredFeatureIndex, uint16(len(ls.FeatureIndices))), ls.FeatureIndices...), nil
+}
+
+func encodeFeatureList(features []FeatureRecord) ([]byte, error) {
+	if len(features) > 0xFFFF {
+		return nil, fmt.Errorf("layout table has %d features", len(features))
+	}
+	b := subtableBuffer{buf: make([]byte, 2+6*len(features))}
+	binary.BigEndian.PutUint16(b.buf, uint16(len(features)))
+	for i, rec := range features {
+		binary.BigEndian.PutUint32(b.buf[2+6*i:], uint32(rec.Tag))
+		data, err := rec.Feature.encode()
+		if err != nil {
+			return nil, err
+		}
+		if err := b.link(2+6*i+4, data); err != nil {
+			return nil, err
+		}
+	}
+	return b.buf, nil
+}
+
+func (f Feature) encode() ([]byte, error) {
+	if len(f.LookupListIndices) > 0xFFFF {
+		return nil, fmt.Errorf("feature has %d lookups", len(f.LookupListIndices))
+	}
+	b := subtableBuffer{buf: appendUint16s(appendUint16s(nil, 0, uint16(len(f.LookupListIndices))), f.LookupListIndices...)}
+	if f.Params != nil {
+		if err := b.link(0, f.Params); err != nil {
+			return nil, err
+		}
+	}
+	return b.buf, nil
+}
+
+// lookupOverflow reports a lookup whose subtables are beyond the reach of
+// its 16-bit offsets.
+type lookupOverflow struct {
+	lookup int
+}
+
+func (e lookupOverflow) Error() string {
+	return fmt.Sprintf("subtables of lookup %d overflow their offsets", e.lookup)
+}
+
+// encodeLookupList serializes the lookup list, with the encoded subtables
+// of each lookup, and returns the subtables of the extension subtables it
+// holds, which are stored after the lookup list. Lookups are written
+// through extension subtables where extension is set. Lookup tables follow
+// the list and their subtables follow them, so that the list reaches as
+// many lookups as possible.
+func encodeLookupList(lookups []Lookup, subtables [][][]byte, extensionType uint16, extension []bool) ([]byte, []extensionSubtable, error) {
+	if len(lookups) > 0xFFFF {
+		return nil, nil, fmt.Errorf("layout table has %d lookups", len(lookups))
+	}
+	b := subtableBuffer{buf: appendUint16s(make([]byte, 0, 2+2*len(lookups)), uint16(len(lookups)))}
+	b.buf = append(b.buf, make([]byte, 2*len(lookups))...)
+	// subtables to link once every lookup table is stored
+	type link struct {
+		lookup, table, field int
+		data                 []byte
+	}
+	var links []link
+	var extensions []extensionSubtable
+	for i, l := range lookups {
+		table := len(b.buf)
+		if table > 0xFFFF {
+			return nil, nil, errOffsetOverflow
+		}
+		binary.BigEndian.PutUint16(b.buf[2+2*i:], uint16(table))
+		n := len(subtables[i])
+		if n > 0xFFFF {
+			return nil, nil, fmt.Errorf("lookup %d has %d subtables", i, n)
+		}
+		lookupType := l.Type
+		if extension[i] {
+			lookupType = extensionType
+		}
+		b.buf = appendUint16s(b.buf, lookupType, l.Flag, uint16(n))
+		b.buf = append(b.buf, make([]byte, 2*n)...)
+		if l.Flag&LOOKUP_FLAG_USE_MARK_FILTERING_SET != 0 {
+			b.buf = appendUint16s(b.buf, l.MarkFilteringSet)
+		}
+		for j, data := range subtables[i] {
+			field := table + 6 + 2*j
+			if !extension[i] {
+				links = append(links, link{i, table, field, data})
+				continue
+			}
+			// each extension subtable is patched with the offset of its
+			// subtable, so they are not shared
+			binary.BigEndian.PutUint16(b.buf[field:], uint16(len(b.buf)-table))
+			extensions = append(extensions, extensionSubtable{stub: len(b.buf), subtable: data})
+			b.buf = appendUint16s(b.buf, 1, l.Type, 0, 0)
+		}
+	}
+	for _, l := range links {
+		off := b.store(l.data) - l.table
+		if off > 0xFFFF {
+			return nil, nil, lookupOverflow{l.lookup}
+		}
+		binary.BigEndian.PutUint16(b.buf[l.field:], uint16(off))
+	}
+	return b.buf, extensions, nil
+}
+
+func (fv FeatureVariations) encode() ([]byte, error) {
+	b := subtableBuffer{buf: make([]byte, 8+8*len(fv.Records))}
+	binary.BigEndian.PutUint16(b.buf[0:], fv.MajorVersion)
+	binary.BigEndian.PutUint16(b.buf[2:], fv.MinorVersion)
+	binary.BigEndian.PutUint32(b.buf[4:], uint32(len(fv.Records)))
+	for i, rec := range fv.Records {
+		if len(rec.Conditions) > 0xFFFF || len(rec.Substitutions) > 0xFFFF {
+			return nil, fmt.Errorf("feature variation record %d is too large", i)
+		}
+		set := subtableBuffer{buf: make([]byte, 2+4*len(rec.Conditions))}
+		binary.BigEndian.PutUint16(set.buf, uint16(len(rec.Conditions)))
+		for j, c := range rec.Conditions {
+			set.link32(2+4*j, appendUint16s(nil, 1, c.AxisIndex, uint16(c.FilterRangeMinValue), uint16(c.FilterRangeMaxValue)))
+		}
+		b.link32(8+8*i, set.buf)
+
+		subst := subtableBuffer{buf: make([]byte, 6+6*len(rec.Substitutions))}
+		binary.BigEndian.PutUint16(subst.buf[0:], 1)
+		binary.BigEndian.PutUint16(subst.buf[4:], uint16(len(rec.Substitutions)))
+		for j, s := range rec.Substitutions {
+			binary.BigEndian.PutUint16(subst.buf[6+6*j:], s.FeatureIndex)
+			data, err := s.Feature.encode()
+			if err != nil {
+				return nil, err
+			}
+			subst.link32(6+6*j+2, data)
+		}
+		b.link32(8+8*i+4, subst.buf)
+	}
+	return b.buf, nil
+}
+
+// encode serializes the coverage in the smaller of its formats.
+func (cov Coverage) encode() ([]byte, error) {
+	ranges := 0
+	for i := range cov {
+		if i > 0 && cov[i] <= cov[i-1] {
+			return nil, errors.New("coverage glyphs are not sorted")
+		}
+		if i == 0 || cov[i] != cov[i-1]+1 {
+			ranges++
+		}
+	}
+	if 2*len(cov) <= 6*ranges {
+		return appendUint16s(appendUint16s(nil, 1, uint16(len(cov))), cov...), nil
+	}
+	buf := appendUint16s(nil, 2, uint16(ranges))
+	for i := 0; i < len(cov); {
+		j := i + 1
+		for j < len(cov) && cov[j] == cov[j-1]+1 {
+			j++
+		}
+		buf = appendUint16s(buf, cov[i], cov[j-1], uint16(i))
+		i = j
+	}
+	return buf, nil
+}
+
+// encode serializes the class definition in the smaller of its formats.
+func (cd ClassDef) encode() []byte {
+	glyphs := make([]uint16, 0, len(cd))
+	for gid, class := range cd {
+		if class != 0 {
+			glyphs = append(glyphs, gid)
+		}
+	}
+	sort.Slice(glyphs, func(i, j int) bool { return glyphs[i] < glyphs[j] })
+	ranges := 0
+	for i, gid := range glyphs {
+		if i == 0 || gid != glyphs[i-1]+1 || cd[gid] != cd[glyphs[i-1]] {
+			ranges++
+		}
+	}
+	if n := len(glyphs); n > 0 {
+		if span := int(glyphs[n-1]-glyphs[0]) + 1; span <= 0xFFFF && 6+2*span <= 4+6*ranges {
+			buf := appendUint16s(nil, 1, glyphs[0], uint16(span))
+			for gid := int(glyphs[0]); gid <= int(glyphs[n-1]); gid++ {
+				buf = appendUint16s(buf, cd[uint16(gid)])
+			}
+			return buf
+		}
+	}
+	buf := appendUint16s(nil, 2, uint16(ranges))
+	for i := 0; i < len(glyphs); {
+		j := i + 1
+		for j < len(glyphs) && glyphs[j] == glyphs[j-1]+1 && cd[glyphs[j]] == cd[glyphs[i]] {
+			j++
+		}
+		buf = appendUint16s(buf, glyphs[i], glyphs[j-1], cd[glyphs[i]])
+		i = j
+	}
+	return buf
+}
+
+// subset returns the glyphs of newID, renumbered and sorted.
+func (cov Coverage) subset(newID map[uint16]uint16) Coverage {
+	var sub Coverage
+	for _, gid := range cov {
+		if id, ok := newID[gid]; ok {
+			sub = append(sub, id)
+		}
+	}
+	sort.Slice(sub, func(i, j int) bool { return sub[i] < sub[j] })
+	return sub
+}
+
+// subset returns the classes of the glyphs of newID, renumbered.
+func (cd ClassDef) subset(newID map[uint16]uint16) ClassDef {
+	sub := ClassDef{}
+	for gid, class := range cd {
+		if id, ok := newID[gid]; ok {
+			sub[id] = class
+		}
+	}
+	return sub
+}
+
+// classes returns the classes of the class definition, with class 0.
+func (cd ClassDef) classes() map[uint16]bool {
+	classes := map[uint16]bool{0: true}
+	for _, class := range cd {
+		classes[class] = true
+	}
+	return classes
+}
+
+// remapGlyphs renumbers gids with newID; false if a glyph is not kept.
+func remapGlyphs(gids []uint16, newID map[uint16]uint16) ([]uint16, bool) {
+	if gids == nil {
+		return nil, true
+	}
+	ids := make([]uint16, len(gids))
+	for i, gid := range gids {
+		id, ok := newID[gid]
+		if !ok {
+			return nil, false
+		}
+		ids[i] = id
+	}
+	return ids, true
+}
+
+// encode serializes the rule in the layout of a chained context or not.
+func (rule SequenceRule) encode(chained bool) ([]byte, error) {
+	if len(rule.Input) >= 0xFFFF || len(rule.Backtrack) > 0xFFFF || len(rule.Lookahead) > 0xFFFF || len(rule.Lookups) > 0xFFFF {
+		return nil, errors.New("sequence rule is too long")
+	}
+	var buf []byte
+	if chained {
+		buf = appendUint16s(appendUint16s(nil, uint16(len(rule.Backtrack))), rule.Backtrack...)
+		buf = appendUint16s(appendUint16s(buf, uint16(len(rule.Input)+1)), rule.Input...)
+		buf = appendUint16s(appendUint16s(buf, uint16(len(rule.Lookahead))), rule.Lookahead...)
+		buf = appendUint16s(buf, uint16(len(rule.Lookups)))
+	} else {
+		buf = appendUint16s(appendUint16s(nil, uint16(len(rule.Input)+1), uint16(len(rule.Lookups))), rule.Input...)
+	}
+	return appendSequenceLookups(buf, rule.Lookups), nil
+}
+
+func appendSequenceLookups(buf []byte, lookups []SequenceLookup) []byte {
+	for _, l := range lookups {
+		buf = appendUint16s(buf, l.SequenceIndex, l.LookupListIndex)
+	}
+	return buf
+}
+
+func (sc SequenceContext) encode() ([]byte, error) {
+	switch sc.Format {
+	case 1, 2:
+		if sc.Format == 1 && len(sc.Rules) != len(sc.Coverage) {
+			return nil, fmt.Errorf("sequence context has %d rule sets for %d glyphs", len(sc.Rules), len(sc.Coverage))
+		}
+		if len(sc.Rules) > 0xFFFF {
+			return nil, fmt.Errorf("sequence context has %d rule sets", len(sc.Rules))
+		}
+		var classDefs []ClassDef
+		if sc.Format == 2 {
+			classDefs = []ClassDef{sc.InputClassDef}
+			if sc.Chained {
+				classDefs = []ClassDef{sc.BacktrackClassDef, sc.InputClassDef, sc.LookaheadClassDef}
+			}
+		}
+		sets := 6 + 2*len(classDefs)
+		b := subtableBuffer{buf: make([]byte, sets+2*len(sc.Rules))}
+		binary.BigEndian.PutUint16(b.buf[0:], sc.Format)
+		binary.BigEndian.PutUint16(b.buf[sets-2:], uint16(len(sc.Rules)))
+		cov, err := sc.Coverage.encode()
+		if err != nil {
+			return nil, err
+		}
+		if err := b.link(2, cov); err != nil {
+			return nil, err
+		}
+		for i, cd := range classDefs {
+			if err := b.link(4+2*i, cd.encode()); err != nil {
+				return nil, err
+			}
+		}
+		for i, rules := range sc.Rules {
+			if len(rules) == 0 {
+				continue
+			}
+			if len(rules) > 0xFFFF {
+				return nil, fmt.Errorf("sequence context has %d rules in a set", len(rules))
+			}
+			set := subtableBuffer{buf: make([]byte, 2+2*len(rules))}
+			binary.BigEndian.PutUint16(set.buf, uint16(len(rules)))
+			for j, rule := range rules {
+				data, err := rule.encode(sc.Chained)
+				if err != nil {
+					return nil, err
+				}
+				if err := set.link(2+2*j, data); err != nil {
+					return nil, err
+				}
+			}
+			if err := b.link(sets+2*i, set.buf); err != nil {
+				return nil, err
+			}
+		}
+		return b.buf, nil
+	case 3:
+		positions := [][]Coverage{sc.InputCoverages}
+		if sc.Chained {
+			positions = [][]Coverage{sc.BacktrackCoverages, sc.InputCoverages, sc.LookaheadCoverages}
+		}
+		if len(sc.Lookups) > 0xFFFF {
+			return nil, fmt.Errorf("sequence context has %d lookups", len(sc.Lookups))
+		}
+		b := subtableBuffer{buf: appendUint16s(nil, 3)}
+		var fields []int
+		var covs []Coverage
+		for _, position := range positions {
+			if len(position) > 0xFFFF {
+				return nil, fmt.Errorf("sequence context has %d coverages", len(position))
+			}
+			b.buf = appendUint16s(b.buf, uint16(len(position)))
+			if !sc.Chained {
+				b.buf = appendUint16s(b.buf, uint16(len(sc.Lookups)))
+			}
+			for _, cov := range position {
+				fields = append(fields, len(b.buf))
+				covs = append(covs, cov)
+				b.buf = appendUint16s(b.buf, 0)
+			}
+		}
+		if sc.Chained {
+			b.buf = appendUint16s(b.buf, uint16(len(sc.Lookups)))
+		}
+		b.buf = appendSequenceLookups(b.buf, sc.Lookups)
+		for i, cov := range covs {
+			data, err := cov.encode()
+			if err != nil {
+				return nil, err
+			}
+			if err := b.link(fields[i], data); err != nil {
+				return nil, err
+			}
+		}
+		return b.buf, nil
+	}
+	return nil, fmt.Errorf("unknown sequence context format %d", sc.Format)
+}
+
+func (sc SequenceContext) subset(newID map[uint16]uint16) LookupSubtable {
+	sub := SequenceContext{Chained: sc.Chained, Format: sc.Format}
+	switch sc.Format {
+	case 1:
+		// rule sets follow their glyphs, which are sorted again
+		type ruleSet struct {
+			gid   uint16
+			rules []SequenceRule
+		}
+		var sets []ruleSet
+		for i, gid := range sc.Coverage {
+			id, ok := newID[gid]
+			if !ok || i >= len(sc.Rules) {
+				continue
+			}
+			var rules []SequenceRule
+			for _, rule := range sc.Rules[i] {
+				if r, ok := rule.remap(newID); ok {
+					rules = append(rules, r)
+				}
+			}
+			if len(rules) > 0 {
+				sets = append(sets, ruleSet{id, rules})
+			}
+		}
+		sort.Slice(sets, func(i, j int) bool { return sets[i].gid < sets[j].gid })
+		for _, set := range sets {
+			sub.Coverage = append(sub.Coverage, set.gid)
+			sub.Rules = append(sub.Rules, set.rules)
+		}
+	case 2:
+		sub.Coverage = sc.Coverage.subset(newID)
+		sub.InputClassDef = sc.InputClassDef.subset(newID)
+		if sc.Chained {
+			sub.BacktrackClassDef = sc.BacktrackClassDef.subset(newID)
+			sub.LookaheadClassDef = sc.LookaheadClassDef.subset(newID)
+		}
+		// rules of classes without glyphs cannot match
+		backtrack, input, lookahead := sub.BacktrackClassDef.classes(), sub.InputClassDef.classes(), sub.LookaheadClassDef.classes()
+		has := func(classes map[uint16]bool, seq []uint16) bool {
+			for _, class := range seq {
+				if !classes[class] {
+					return false
+				}
+			}
+			return true
+		}
+		matched := false
+		sub.Rules = make([][]SequenceRule, len(sc.Rules))
+		for class, rules := range sc.Rules {
+			if !input[uint16(class)] {
+				continue
+			}
+			for _, rule := range rules {
+				if has(backtrack, rule.Backtrack) && has(input, rule.Input) && has(lookahead, rule.Lookahead) {
+					sub.Rules[class] = append(sub.Rules[class], rule)
+					matched = true
+				}
+			}
+		}
+		if !matched {
+			return nil
+		}
+	case 3:
+		var ok bool
+		if sub.InputCoverages, ok = subsetCoverages(sc.InputCoverages, newID); !ok {
+			return nil
+		}
+		if sub.BacktrackCoverages, ok = subsetCoverages(sc.BacktrackCoverages, newID); !ok {
+			return nil
+		}
+		if sub.LookaheadCoverages, ok = subsetCoverages(sc.LookaheadCoverages, newID); !ok {
+			return nil
+		}
+		sub.Lookups = sc.Lookups
+		return sub
+	default:
+		return nil
+	}
+	if len(sub.Coverage) == 0 {
+		return nil
+	}
+	return sub
+}
+
+// remap renumbers the glyphs of a format 1 rule; false if one is not kept.
+func (rule SequenceRule) remap(newID map[uint16]uint16) (SequenceRule, bool) {
+	r := SequenceRule{Lookups: rule.Lookups}
+	var ok1, ok2, ok3 bool
+	r.Backtrack, ok1 = remapGlyphs(rule.Backtrack, newID)
+	r.Input, ok2 = remapGlyphs(rule.Input, newID)
+	r.Lookahead, ok3 = remapGlyphs(rule.Lookahead, newID)
+	return r, ok1 && ok2 && ok3
+}
+
+// subsetCoverages subsets each coverage; false if one is left empty.
+func subsetCoverages(covs []Coverage, newID map[uint16]uint16) ([]Coverage, bool) {
+	if covs == nil {
+		return nil, true
+	}
+	sub := make([]Coverage, len(covs))
+	for i, cov := range covs {
+		if sub[i] = cov.subset(newID); len(sub[i]) == 0 {
+			return nil, false
+		}
+	}
+	return sub, true
+}
+
+func (sc SequenceContext) maxContext() int {
+	if sc.Format == 3 {
+		if sc.Chained {
+			return len(sc.InputCoverages) + len(sc.LookaheadCoverages)
+		}
+		return len(sc.InputCoverages)
+	}
+	n := 0
+	for _, rules := range sc.Rules {
+		for _, rule := range rules {
+			if sc.Chained {
+				n = max(n, len(rule.Input)+1+len(rule.Lookahead))
+			} else {
+				n = max(n, len(rule.Input)+1)
+			}
+		}
+	}
+	return n
+}
+
+// subset returns the table for the glyphs of newID, renumbered. Scripts,
+// features and lookups are kept so that their indices hold, subtables are
+// pruned. Feature variations are dropped with the variation tables of the
+// font.
+func (layout LayoutTable) subset(newID map[uint16]uint16) LayoutTable {
+	sub := layout
+	sub.MinorVersion = 0
+	sub.FeatureVariations = nil
+	sub.Lookups = make([]Lookup, len(layout.Lookups))
+	for i, l := range layout.Lookups {
+		sub.Lookups[i] = l
+		sub.Lookups[i].Subtables = nil
+		for _, st := range l.Subtables {
+			if s := st.subset(newID); s != nil {
+				sub.Lookups[i].Subtables = append(sub.Lookups[i].Subtables, s)
+			}
+		}
+	}
+	return sub
+}
+
+// maxContext returns the length of the longest glyph context of the
+// lookups, as OS/2 usMaxContext counts it.
+func (layout LayoutTable) maxContext() int {
+	n := 0
+	for _, l := range layout.Lookups {
+		for _, st := range l.Subtables {
+			n = max(n, st.maxContext())
+		}
+	}
+	return n
+}
@@ -0,0 +1,211 @@
+package fontcompress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// maxp version 0.5, fonts with CFF outlines
+	MAXP_VERSION_0_5 uint32 = 0x00005000
+	// maxp version 1.0, fonts with TrueType outlines
+	MAXP_VERSION_1_0 uint32 = 0x00010000
+)
+
+/*
+*
+Version16Dot16	version	0x00005000 for version 0.5, 0x00010000 for version 1.0.
+uint16	numGlyphs	The number of glyphs in the font.
+uint16	maxPoints	Maximum points in a non-composite glyph.
+uint16	maxContours	Maximum contours in a non-composite glyph.
+uint16	maxCompositePoints	Maximum points in a composite glyph.
+uint16	maxCompositeContours	Maximum contours in a composite glyph.
+uint16	maxZones	1 if instructions do not use the twilight zone (Z0), or 2 if instructions do use Z0; should be set to 2 in most cases.
+uint16	maxTwilightPoints	Maximum points used in Z0.
+uint16	maxStorage	Number of Storage Area locations.
+uint16	maxFunctionDefs	Number of FDEFs, equal to the highest function number + 1.
+uint16	maxInstructionDefs	Number of IDEFs.
+uint16	maxStackElements	Maximum stack depth across Font Program ('fpgm' table), CVT Program ('prep' table) and all glyph instructions (in the 'glyf' table).
+uint16	maxSizeOfInstructions	Maximum byte count for glyph instructions.
+uint16	maxComponentElements	Maximum number of components referenced at "top level" for any composite glyph.
+uint16	maxComponentDepth	Maximum levels of recursion; 1 for simple components.
+*/
+// maxp — maximum profile
+//
+// Version 0.5 tables only hold NumGlyphs; the other fields are zero.
+type MaxpTable struct {
+	Version               uint32 // MAXP_VERSION_0_5 or MAXP_VERSION_1_0
+	NumGlyphs             uint16 // the number of glyphs in the font
+	MaxPoints             uint16 // maximum points in a non-composite glyph
+	MaxContours           uint16 // maximum contours in a non-composite glyph
+	MaxCompositePoints    uint16 // maximum points in a composite glyph
+	MaxCompositeContours  uint16 // maximum contours in a composite glyph
+	MaxZones              uint16 // 1 if instructions do not use the twilight zone (Z0), 2 if they do
+	MaxTwilightPoints     uint16 // maximum points used in Z0
+	MaxStorage            uint16 // number of Storage Area locations
+	MaxFunctionDefs       uint16 // number of FDEFs, equal to the highest function number + 1
+	MaxInstructionDefs    uint16 // number of IDEFs
+	MaxStackElements      uint16 // maximum stack depth across fpgm, prep and all glyph instructions
+	MaxSizeOfInstructions uint16 // maximum byte count for glyph instructions
+	MaxComponentElements  uint16 // maximum number of components referenced at "top level" for any composite glyph
+	MaxComponentDepth     uint16 // maximum levels of recursion; 1 for simple components
+}
+
+func (MaxpTable) Tag() Tag { return tagMaxp }
+
+// read maxp table
+func readMaxpTable(data []byte) (TTFTable, error) {
+	if err := checkRange("maxp", data, 0, 6); err != nil {
+		return nil, err
+	}
+	maxp := MaxpTable{
+		Version:   binary.BigEndian.Uint32(data[0:]),
+		NumGlyphs: binary.BigEndian.Uint16(data[4:]),
+	}
+	switch maxp.Version {
+	case MAXP_VERSION_0_5:
+		return maxp, nil
+	case MAXP_VERSION_1_0:
+	default:
+		return nil, &ParseError{Table: "maxp", Reason: fmt.Sprintf("unsupported version %#08x", maxp.Version)}
+	}
+	if err := checkRange("maxp", data, 0, 32); err != nil {
+		return nil, err
+	}
+	fields := []*uint16{
+		&maxp.MaxPoints, &maxp.MaxContours, &maxp.MaxCompositePoints, &maxp.MaxCompositeContours,
+		&maxp.MaxZones, &maxp.MaxTwilightPoints, &maxp.MaxStorage, &maxp.MaxFunctionDefs,
+		&maxp.MaxInstructionDefs, &maxp.MaxStackElements, &maxp.MaxSizeOfInstructions,
+		&maxp.MaxComponentElements, &maxp.MaxComponentDepth,
+	}
+	for i, field := range fields {
+		*field = binary.BigEndian.Uint16(data[6+2*i:])
+	}
+	return maxp, nil
+}
+
+// encode serializes the maxp table; version 0.5 tables stop after
+// numGlyphs.
+func (maxp MaxpTable) encode() ([]byte, error) {
+	buf := binary.BigEndian.AppendUint32(make([]byte, 0, 32), maxp.Version)
+	buf = binary.BigEndian.AppendUint16(buf, maxp.NumGlyphs)
+	switch maxp.Version {
+	case MAXP_VERSION_0_5:
+		return buf, nil
+	case MAXP_VERSION_1_0:
+	default:
+		return nil, fmt.Errorf("maxp version %#08x cannot be serialized", maxp.Version)
+	}
+	for _, v := range []uint16{
+		maxp.MaxPoints, maxp.MaxContours, maxp.MaxCompositePoints, maxp.MaxCompositeContours,
+		maxp.MaxZones, maxp.MaxTwilightPoints, maxp.MaxStorage, maxp.MaxFunctionDefs,
+		maxp.MaxInstructionDefs, maxp.MaxStackElements, maxp.MaxSizeOfInstructions,
+		maxp.MaxComponentElements, maxp.MaxComponentDepth,
+	} {
+		buf = binary.BigEndian.AppendUint16(buf, v)
+	}
+	return buf, nil
+}
+
+// setGlyphMaxima sets the maxima describing glyph outlines to those of
+// glyphs, whose data is returned by glyphData. The limits of the hinting
+// programs (zones, twilight points, storage, function and instruction
+// definitions, stack elements) cannot be told without running them and are
+// left as they are.
+func (maxp *MaxpTable) setGlyphMaxima(glyphs []uint16, glyphData func(gid uint16) []byte) error {
+	// points and contours of a glyph, components included, and how deep its
+	// components nest
+	type outline struct {
+		glyph                   Glyph
+		points, contours, depth int
+	}
+	outlines := make(map[uint16]outline)
+	visiting := make(map[uint16]bool)
+	var measure func(gid uint16) (outline, error)
+	measure = func(gid uint16) (outline, error) {
+		if o, ok := outlines[gid]; ok {
+			return o, nil
+		}
+		if visiting[gid] {
+			return outline{}, fmt.Errorf("composite glyph %d contains itself", gid)
+		}
+		g, err := readGlyph(glyphData(gid))
+		if err != nil {
+			return outline{}, fmt.Errorf("glyph %d: %w", gid, err)
+		}
+		o := outline{glyph: g, points: len(g.Points), contours: len(g.EndPtsOfContours)}
+		visiting[gid] = true
+		for _, c := range g.Components {
+			co, err := measure(c.GlyphIndex)
+			if err != nil {
+				return outline{}, err
+			}
+			o.points += co.points
+			o.contours += co.contours
+			o.depth = max(o.depth, co.depth+1)
+		}
+		delete(visiting, gid)
+		outlines[gid] = o
+		return o, nil
+	}
+
+	var maxima MaxpTable
+	for _, gid := range glyphs {
+		o, err := measure(gid)
+		if err != nil {
+			return err
+		}
+		if o.points > 0xFFFF || o.contours > 0xFFFF {
+			return fmt.Errorf("composite glyph %d has more than 65535 points", gid)
+		}
+		if o.glyph.IsComposite() {
+			maxima.MaxCompositePoints = max(maxima.MaxCompositePoints, uint16(o.points))
+			maxima.MaxCompositeContours = max(maxima.MaxCompositeContours, uint16(o.contours))
+			maxima.MaxComponentElements = max(maxima.MaxComponentElements, uint16(len(o.glyph.Components)))
+			maxima.MaxComponentDepth = max(maxima.MaxComponentDepth, uint16(o.depth))
+		} else {
+			maxima.MaxPoints = max(maxima.MaxPoints, uint16(o.points))
+			maxima.MaxContours = max(maxima.MaxContours, uint16(o.contours))
+		}
+		maxima.MaxSizeOfInstructions = max(maxima.MaxSizeOfInstructions, uint16(len(o.glyph.Instructions)))
+	}
+	maxp.MaxPoints, maxp.MaxContours = maxima.MaxPoints, maxima.MaxContours
+	maxp.MaxCompositePoints, maxp.MaxCompositeContours = maxima.MaxCompositePoints, maxima.MaxCompositeContours
+	maxp.MaxComponentElements, maxp.MaxComponentDepth = maxima.MaxComponentElements, maxima.MaxComponentDepth
+	maxp.MaxSizeOfInstructions = maxima.MaxSizeOfInstructions
+	return nil
+}
+
+// Maxp returns the maxp table, decoding it on first use.
+func (ttf *TTF) Maxp() (MaxpTable, error) {
+	table, err := ttf.decodeTable(tagMaxp, readMaxpTable)
+	if err != nil {
+		return MaxpTable{}, err
+	}
+	maxp, ok := table.(MaxpTable)
+	if !ok {
+		return MaxpTable{}, fmt.Errorf("maxp table holds a %T", table)
+	}
+	return maxp, nil
+}
+
+// NumGlyphs returns the number of glyphs of the font, maxp.numGlyphs.
+func (ttf *TTF) NumGlyphs() (int, error) {
+	maxp, err := ttf.Maxp()
+	if err != nil {
+		return 0, err
+	}
+	return int(maxp.NumGlyphs), nil
+}
+
+// glyphLimit returns the number of glyphs that tables referring to glyph
+// ids are checked against: maxp.numGlyphs, or every glyph id if the font
+// has no maxp table.
+func (ttf *TTF) glyphLimit() (int, error) {
+	numGlyphs, err := ttf.NumGlyphs()
+	if errors.Is(err, ErrNoTable) {
+		return 0x10000, nil
+	}
+	return numGlyphs, err
+}
@@ -0,0 +1,102 @@
+package fontcompress_test
+
+import (
+	"bytes"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+func TestReadMaxpTable(t *testing.T) {
+	ttf := readFont(t, fixtureFont())
+	maxp, err := ttf.Maxp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := font_compress.MaxpTable{
+		Version:              font_compress.MAXP_VERSION_1_0,
+		NumGlyphs:            uint16(len(fixtureGlyphs)),
+		MaxPoints:            4,
+		MaxContours:          1,
+		MaxCompositePoints:   6,
+		MaxCompositeContours: 2,
+		MaxZones:             2,
+		MaxComponentElements: 2,
+		MaxComponentDepth:    1,
+	}
+	if maxp != want {
+		t.Errorf("maxp = %+v, want %+v", maxp, want)
+	}
+	if n, err := ttf.NumGlyphs(); err != nil || n != len(fixtureGlyphs) {
+		t.Errorf("NumGlyphs = %d, %v, want %d", n, err, len(fixtureGlyphs))
+	}
+
+	cff := readFont(t, fixtureCFFFont(false))
+	maxp, err = cff.Maxp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (font_compress.MaxpTable{Version: font_compress.MAXP_VERSION_0_5, NumGlyphs: uint16(len(fixtureGlyphs))}); maxp != want {
+		t.Errorf("version 0.5 maxp = %+v, want %+v", maxp, want)
+	}
+
+	// both versions are encoded when changed
+	for _, tt := range []struct {
+		font   []byte
+		change func(*font_compress.MaxpTable)
+		offset int
+	}{
+		{fixtureFont(), func(maxp *font_compress.MaxpTable) { maxp.MaxStorage = 5 }, 18},
+		{fixtureCFFFont(false), func(maxp *font_compress.MaxpTable) { maxp.NumGlyphs = 5 }, 4},
+	} {
+		ttf := readFont(t, tt.font)
+		maxp, err := ttf.Maxp()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.change(&maxp)
+		replaceTable(ttf, maxp)
+		font, err := ttf.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := fontTable(font, "maxp"), patchUint16(fontTable(tt.font, "maxp"), tt.offset, 5); !bytes.Equal(got, want) {
+			t.Errorf("maxp version %#x encoded as %x, want %x", maxp.Version, got, want)
+		}
+	}
+}
+
+// replaceTable replaces the decoded table of ttf with the same tag.
+func replaceTable(ttf *font_compress.TTF, table font_compress.TTFTable) {
+	for i := range ttf.Tables {
+		if font_compress.Tag(ttf.Tables[i].Tag) == table.Tag() {
+			ttf.Tables[i].Table = table
+		}
+	}
+}
+
+func TestSubsetMaxp(t *testing.T) {
+	for _, tt := range []struct {
+		runes string
+		want  font_compress.MaxpTable
+	}{
+		// .notdef, A, dieresis and Adieresis
+		{"Ä", font_compress.MaxpTable{NumGlyphs: 4, MaxPoints: 4, MaxContours: 1, MaxCompositePoints: 6, MaxCompositeContours: 2, MaxComponentElements: 2, MaxComponentDepth: 1}},
+		// .notdef and A
+		{"A", font_compress.MaxpTable{NumGlyphs: 2, MaxPoints: 4, MaxContours: 1}},
+	} {
+		out, err := font_compress.Subset(readFont(t, fixtureFont()), []rune(tt.runes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		maxp, err := readFont(t, out).Maxp()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the limits of the hinting programs are kept
+		tt.want.Version, tt.want.MaxZones = font_compress.MAXP_VERSION_1_0, 2
+		if maxp != tt.want {
+			t.Errorf("maxp of the %q subset = %+v, want %+v", tt.runes, maxp, tt.want)
+		}
+	}
+}
@@ -0,0 +1,425 @@
+package fontcompress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// NameID identifies the kind of string held by a name record.
+type NameID uint16
+
+const (
+	NameCopyright              NameID = 0  // copyright notice
+	NameFamily                 NameID = 1  // font family name
+	NameSubfamily              NameID = 2  // font subfamily name, such as "Bold"
+	NameUniqueID               NameID = 3  // unique font identifier
+	NameFull                   NameID = 4  // full font name
+	NameVersion                NameID = 5  // version string, "Version x.y"
+	NamePostScript             NameID = 6  // PostScript name
+	NameTrademark              NameID = 7  // trademark notice
+	NameManufacturer           NameID = 8  // manufacturer name
+	NameDesigner               NameID = 9  // designer name
+	NameDescription            NameID = 10 // description of the typeface
+	NameVendorURL              NameID = 11 // URL of the font vendor
+	NameDesignerURL            NameID = 12 // URL of the typeface designer
+	NameLicense                NameID = 13 // license description
+	NameLicenseURL             NameID = 14 // URL of the license
+	NameTypographicFamily      NameID = 16 // family name when it has more than four styles
+	NameTypographicSubfamily   NameID = 17 // subfamily name within the typographic family
+	NameSampleText             NameID = 19 // sample text
+	NameVariationsPSNamePrefix NameID = 25 // PostScript name prefix of variation instances
+)
+
+/*
+*
+uint16	version	Table version number (=0 or 1).
+uint16	count	Number of name records.
+Offset16	storageOffset	Offset to start of string storage (from start of table).
+NameRecord	nameRecord[count]	The name records where count is the number of records.
+uint16	langTagCount	Number of language-tag records. (version 1 only)
+LangTagRecord	langTagRecord[langTagCount]	The language-tag records where langTagCount is the number of records. (version 1 only)
+*/
+// name — naming table
+type NameTable struct {
+	Format      uint16       // 0, or 1 with language tags
+	NameRecords []NameRecord // sorted by platform, encoding, language and name id
+	// LangTags are the IETF BCP 47 language tags of format 1 tables, UTF-16BE
+	// encoded in the font. Language id 0x8000+i refers to LangTags[i].
+	LangTags []string
+}
+
+/*
+*
+uint16	platformID	Platform ID.
+uint16	encodingID	Platform-specific encoding ID.
+uint16	languageID	Language ID.
+uint16	nameID	Name ID.
+uint16	length	String length (in bytes).
+Offset16	stringOffset	String offset from start of storage area (in bytes).
+*/
+type NameRecord struct {
+	PlatformID uint16
+	EncodingID uint16
+	LanguageID uint16
+	NameID     NameID
+	Value      []byte // the string in the encoding of the platform and encoding ids
+}
+
+func (NameTable) Tag() Tag { return tagName }
+
+// read name table
+func readNameTable(data []byte) (TTFTable, error) {
+	if err := checkRange("name", data, 0, 6); err != nil {
+		return nil, err
+	}
+	name := NameTable{Format: binary.BigEndian.Uint16(data[0:])}
+	if name.Format > 1 {
+		return nil, &ParseError{Table: "name", Reason: fmt.Sprintf("unsupported format %d", name.Format)}
+	}
+	count := int(binary.BigEndian.Uint16(data[2:]))
+	storage := uint64(binary.BigEndian.Uint16(data[4:]))
+	if err := checkRange("name", data, 6, 12*uint64(count)); err != nil {
+		return nil, err
+	}
+	// str returns the string of length bytes at offset of the storage area,
+	// described at off
+	str := func(off int, length, offset uint16) ([]byte, error) {
+		if err := checkRange("name", data, storage+uint64(offset), uint64(length)); err != nil {
+			return nil, &ParseError{Table: "name", Offset: int64(off), Reason: "string beyond the end of the table"}
+		}
+		return data[storage+uint64(offset) : storage+uint64(offset)+uint64(length)], nil
+	}
+	name.NameRecords = make([]NameRecord, count)
+	for i := range name.NameRecords {
+		rec := data[6+12*i:]
+		value, err := str(6+12*i, binary.BigEndian.Uint16(rec[8:]), binary.BigEndian.Uint16(rec[10:]))
+		if err != nil {
+			return nil, err
+		}
+		name.NameRecords[i] = NameRecord{
+			PlatformID: binary.BigEndian.Uint16(rec[0:]),
+			EncodingID: binary.BigEndian.Uint16(rec[2:]),
+			LanguageID: binary.BigEndian.Uint16(rec[4:]),
+			NameID:     NameID(binary.BigEndian.Uint16(rec[6:])),
+			Value:      value,
+		}
+	}
+	if name.Format == 0 {
+		return name, nil
+	}
+	off := 6 + 12*count
+	if err := checkRange("name", data, uint64(off), 2); err != nil {
+		return nil, err
+	}
+	langTagCount := int(binary.BigEndian.Uint16(data[off:]))
+	if err := checkRange("name", data, uint64(off+2), 4*uint64(langTagCount)); err != nil {
+		return nil, err
+	}
+	name.LangTags = make([]string, langTagCount)
+	for i := range name.LangTags {
+		rec := data[off+2+4*i:]
+		value, err := str(off+2+4*i, binary.BigEndian.Uint16(rec[0:]), binary.BigEndian.Uint16(rec[2:]))
+		if err != nil {
+			return nil, err
+		}
+		tag, err := decodeUTF16BE(value)
+		if err != nil {
+			return nil, &ParseError{Table: "name", Offset: int64(off + 2 + 4*i), Reason: "language tag: " + err.Error()}
+		}
+		name.LangTags[i] = tag
+	}
+	return name, nil
+}
+
+// encode serializes the name table. Identical strings share their storage.
+func (name NameTable) encode() ([]byte, error) {
+	if name.Format > 1 {
+		return nil, fmt.Errorf("name format %d cannot be serialized", name.Format)
+	}
+	if name.Format == 0 && len(name.LangTags) > 0 {
+		return nil, errors.New("name format 0 cannot hold language tags")
+	}
+	headerLen := 6 + 12*len(name.NameRecords)
+	if name.Format == 1 {
+		headerLen += 2 + 4*len(name.LangTags)
+	}
+	if len(name.NameRecords) > 0xFFFF || len(name.LangTags) > 0xFFFF || headerLen > 0xFFFF {
+		return nil, fmt.Errorf("name table has %d records and %d language tags", len(name.NameRecords), len(name.LangTags))
+	}
+
+	var storage []byte
+	offsets := make(map[string]int)
+	// store appends a record of the length and offset of value to buf
+	store := func(buf, value []byte) ([]byte, error) {
+		off, ok := offsets[string(value)]
+		if !ok {
+			off = len(storage)
+			offsets[string(value)] = off
+			storage = append(storage, value...)
+		}
+		if len(value) > 0xFFFF || off > 0xFFFF {
+			return nil, errors.New("name table strings exceed 64KB")
+		}
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(value)))
+		return binary.BigEndian.AppendUint16(buf, uint16(off)), nil
+	}
+
+	buf := make([]byte, 0, headerLen)
+	buf = binary.BigEndian.AppendUint16(buf, name.Format)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(name.NameRecords)))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(headerLen))
+	var err error
+	for _, r := range name.NameRecords {
+		buf = binary.BigEndian.AppendUint16(buf, r.PlatformID)
+		buf = binary.BigEndian.AppendUint16(buf, r.EncodingID)
+		buf = binary.BigEndian.AppendUint16(buf, r.LanguageID)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(r.NameID))
+		if buf, err = store(buf, r.Value); err != nil {
+			return nil, err
+		}
+	}
+	if name.Format == 1 {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(name.LangTags)))
+		for _, tag := range name.LangTags {
+			if buf, err = store(buf, encodeUTF16BE(tag)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return append(buf, storage...), nil
+}
+
+// Decode returns the string of the record. Unicode and Windows strings are
+// UTF-16BE; Macintosh strings are decoded from Mac Roman, Japanese, Chinese
+// or Korean. Other encodings are reported as an error.
+func (r NameRecord) Decode() (string, error) {
+	var enc encoding.Encoding
+	switch r.PlatformID {
+	case 0:
+		return decodeUTF16BE(r.Value)
+	case 1:
+		switch r.EncodingID {
+		case 0:
+			enc = charmap.Macintosh
+		case 1:
+			enc = japanese.ShiftJIS
+		case 2:
+			enc = traditionalchinese.Big5
+		case 3:
+			enc = korean.EUCKR
+		case 25:
+			enc = simplifiedchinese.GBK
+		}
+	case 3:
+		switch r.EncodingID {
+		case 0, 1, 10:
+			return decodeUTF16BE(r.Value)
+		case 2:
+			enc = japanese.ShiftJIS
+		case 3:
+			enc = simplifiedchinese.GBK
+		case 4:
+			enc = traditionalchinese.Big5
+		case 5:
+			enc = korean.EUCKR
+		}
+	}
+	if enc == nil {
+		return "", fmt.Errorf("name record encoding (%d, %d) is not supported", r.PlatformID, r.EncodingID)
+	}
+	s, err := enc.NewDecoder().Bytes(r.Value)
+	if err != nil {
+		return "", err
+	}
+	return string(s), nil
+}
+
+func decodeUTF16BE(b []byte) (string, error) {
+	if len(b)%2 != 0 {
+		return "", errors.New("odd length UTF-16 string")
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u)), nil
+}
+
+func encodeUTF16BE(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 0, 2*len(u))
+	for _, v := range u {
+		b = binary.BigEndian.AppendUint16(b, v)
+	}
+	return b
+}
+
+// language tags of common Windows language ids
+var windowsLanguages = map[uint16]string{
+	0x0401: "ar-SA", 0x0404: "zh-TW", 0x0405: "cs-CZ", 0x0406: "da-DK",
+	0x0407: "de-DE", 0x0408: "el-GR", 0x0409: "en-US", 0x040B: "fi-FI",
+	0x040C: "fr-FR", 0x040D: "he-IL", 0x040E: "hu-HU", 0x0410: "it-IT",
+	0x0411: "ja-JP", 0x0412: "ko-KR", 0x0413: "nl-NL", 0x0414: "nb-NO",
+	0x0415: "pl-PL", 0x0416: "pt-BR", 0x0419: "ru-RU", 0x041D: "sv-SE",
+	0x041E: "th-TH", 0x041F: "tr-TR", 0x0421: "id-ID", 0x0422: "uk-UA",
+	0x042A: "vi-VN", 0x0804: "zh-CN", 0x0807: "de-CH", 0x0809: "en-GB",
+	0x080A: "es-MX", 0x080C: "fr-BE", 0x0816: "pt-PT", 0x0C04: "zh-HK",
+	0x0C09: "en-AU", 0x0C0A: "es-ES", 0x0C0C: "fr-CA", 0x1004: "zh-SG",
+	0x1009: "en-CA", 0x1404: "zh-MO",
+}
+
+// language tags of the Macintosh language ids
+var macLanguages = map[uint16]string{
+	0: "en", 1: "fr", 2: "de", 3: "it", 4: "nl", 5: "sv", 6: "es", 7: "da",
+	8: "pt", 9: "nb", 10: "he", 11: "ja", 12: "ar", 13: "fi", 14: "el",
+	15: "is", 16: "mt", 17: "tr", 18: "hr", 19: "zh-Hant", 20: "ur",
+	21: "hi", 22: "th", 23: "ko", 24: "lt", 25: "pl", 26: "hu", 27: "et",
+	28: "lv", 30: "fo", 31: "fa", 32: "ru", 33: "zh-Hans", 34: "nl-BE",
+	35: "ga", 36: "sq", 37: "ro", 38: "cs", 39: "sk", 40: "sl", 42: "sr",
+	43: "mk", 44: "bg", 45: "uk", 46: "be", 80: "vi", 81: "id",
+}
+
+// Language returns the IETF BCP 47 language tag of record r, or "" if the
+// language id is unknown or, for Unicode platform records, unspecified.
+func (name NameTable) Language(r NameRecord) string {
+	if r.LanguageID >= 0x8000 {
+		if i := int(r.LanguageID - 0x8000); (r.PlatformID == 0 || r.PlatformID == 3) && i < len(name.LangTags) {
+			return name.LangTags[i]
+		}
+		return ""
+	}
+	switch r.PlatformID {
+	case 1:
+		return macLanguages[r.LanguageID]
+	case 3:
+		return windowsLanguages[r.LanguageID]
+	}
+	return ""
+}
+
+// languageMatch rates how well tag serves a request for lang: 3 for the same
+// or a more specific tag, 2 for the same primary language, 1 for English,
+// the fallback of most fonts, and 0 otherwise.
+func languageMatch(tag, lang string) int {
+	tag, lang = strings.ToLower(tag), strings.ToLower(lang)
+	primary := func(s string) string {
+		if i := strings.IndexByte(s, '-'); i >= 0 {
+			return s[:i]
+		}
+		return s
+	}
+	switch {
+	case tag == "":
+		return 0
+	case tag == lang, lang != "" && strings.HasPrefix(tag, lang+"-"):
+		return 3
+	case lang != "" && primary(tag) == primary(lang):
+		return 2
+	case primary(tag) == "en":
+		return 1
+	}
+	return 0
+}
+
+// Lookup returns the string of name id in the language best matching lang,
+// an IETF BCP 47 tag such as "en", "ja-JP" or "zh-Hant"; an empty lang
+// prefers English. Records in the same language prefer the Windows, then
+// the Unicode, then the Macintosh platform. Records whose encoding is not
+// supported are skipped.
+func (name NameTable) Lookup(id NameID, lang string) (string, bool) {
+	if lang == "" {
+		lang = "en"
+	}
+	platformRank := map[uint16]int{3: 3, 0: 2, 1: 1}
+	records := make([]NameRecord, 0, 8)
+	for _, r := range name.NameRecords {
+		if r.NameID == id {
+			records = append(records, r)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		mi, mj := languageMatch(name.Language(records[i]), lang), languageMatch(name.Language(records[j]), lang)
+		if mi != mj {
+			return mi > mj
+		}
+		return platformRank[records[i].PlatformID] > platformRank[records[j].PlatformID]
+	})
+	for _, r := range records {
+		if s, err := r.Decode(); err == nil {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// Name returns the name table, decoding it on first use.
+func (ttf *TTF) Name() (NameTable, error) {
+	table, err := ttf.decodeTable(tagName, readNameTable)
+	if err != nil {
+		return NameTable{}, err
+	}
+	name, ok := table.(NameTable)
+	if !ok {
+		return NameTable{}, fmt.Errorf("name table holds a %T", table)
+	}
+	return name, nil
+}
+
+// NameString returns the string of name id in the language best matching
+// lang, as chosen by (NameTable).Lookup.
+func (ttf *TTF) NameString(id NameID, lang string) (string, error) {
+	name, err := ttf.Name()
+	if err != nil {
+		return "", err
+	}
+	s, ok := name.Lookup(id, lang)
+	if !ok {
+		return "", fmt.Errorf("name table has no decodable record for name id %d", id)
+	}
+	return s, nil
+}
+
+// FamilyName returns the font family name in the language best matching
+// lang. See (NameTable).Lookup for how records are chosen.
+func (ttf *TTF) FamilyName(lang string) (string, error) {
+	return ttf.NameString(NameFamily, lang)
+}
+
+// SubfamilyName returns the font subfamily name, such as "Bold Italic", in
+// the language best matching lang.
+func (ttf *TTF) SubfamilyName(lang string) (string, error) {
+	return ttf.NameString(NameSubfamily, lang)
+}
+
+// FullName returns the full font name in the language best matching lang.
+func (ttf *TTF) FullName(lang string) (string, error) {
+	return ttf.NameString(NameFull, lang)
+}
+
+// VersionString returns the version string of the font, such as
+// "Version 1.000".
+func (ttf *TTF) VersionString() (string, error) {
+	return ttf.NameString(NameVersion, "")
+}
+
+// License returns the license description in the language best matching
+// lang.
+func (ttf *TTF) License(lang string) (string, error) {
+	return ttf.NameString(NameLicense, lang)
+}
+
+// PostScriptName returns the PostScript name of the font.
+func (ttf *TTF) PostScriptName() (string, error) {
+	return ttf.NameString(NamePostScript, "")
+}
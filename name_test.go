@@ -0,0 +1,118 @@
+package fontcompress_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"unicode/utf16"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+func utf16BE(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = binary.BigEndian.AppendUint16(b, u)
+	}
+	return b
+}
+
+// fixtureNameRecords are the records of the fixture name table, in a
+// Mac Roman, a Shift-JIS and several UTF-16BE encodings.
+var fixtureNameRecords = []font_compress.NameRecord{
+	{PlatformID: 1, EncodingID: 0, LanguageID: 0, NameID: font_compress.NameFamily, Value: []byte("Fixt\x9Fre")},
+	{PlatformID: 1, EncodingID: 0, LanguageID: 0, NameID: font_compress.NamePostScript, Value: []byte("Fixture-Regular")},
+	{PlatformID: 1, EncodingID: 1, LanguageID: 11, NameID: font_compress.NameFamily, Value: []byte{0x93, 0xFA, 0x96, 0x7B}},
+	{PlatformID: 3, EncodingID: 1, LanguageID: 0x0409, NameID: font_compress.NameFamily, Value: utf16BE("Fixture")},
+	{PlatformID: 3, EncodingID: 1, LanguageID: 0x0409, NameID: font_compress.NameSubfamily, Value: utf16BE("Regular")},
+	{PlatformID: 3, EncodingID: 1, LanguageID: 0x0804, NameID: font_compress.NameFamily, Value: utf16BE("简体")},
+	{PlatformID: 3, EncodingID: 1, LanguageID: 0x8000, NameID: font_compress.NameFamily, Value: utf16BE("繁體")},
+}
+
+// fixtureNameTable encodes fixtureNameRecords as a format 1 name table
+// with the language tag zh-Hant.
+func fixtureNameTable() []byte {
+	langTag := utf16BE("zh-Hant")
+	header := 6 + 12*len(fixtureNameRecords) + 2 + 4
+	name := appendInt16(nil, 1, int16(len(fixtureNameRecords)), int16(header))
+	var storage []byte
+	for _, r := range fixtureNameRecords {
+		name = appendInt16(name, int16(r.PlatformID), int16(r.EncodingID), int16(r.LanguageID), int16(r.NameID))
+		name = appendInt16(name, int16(len(r.Value)), int16(len(storage)))
+		storage = append(storage, r.Value...)
+	}
+	name = appendInt16(name, 1, int16(len(langTag)), int16(len(storage)))
+	storage = append(storage, langTag...)
+	return append(name, storage...)
+}
+
+func TestReadNameTable(t *testing.T) {
+	ttf := readFont(t, fixtureFontWith(map[string][]byte{"name": fixtureNameTable()}))
+	name, err := ttf.Name()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name.Format != 1 || !reflect.DeepEqual(name.NameRecords, fixtureNameRecords) || !reflect.DeepEqual(name.LangTags, []string{"zh-Hant"}) {
+		t.Errorf("name = %+v", name)
+	}
+	for i, want := range []string{"Fixtüre", "Fixture-Regular", "日本", "Fixture", "Regular", "简体", "繁體"} {
+		if s, err := name.NameRecords[i].Decode(); err != nil || s != want {
+			t.Errorf("record %d decodes to %q, %v, want %q", i, s, err, want)
+		}
+	}
+
+	for _, tt := range []struct {
+		lang, want string
+	}{
+		{"", "Fixture"},      // English, Windows before Macintosh
+		{"en-GB", "Fixture"}, // same primary language
+		{"fr", "Fixture"},    // English fallback
+		{"ja", "日本"},         // Macintosh Japanese
+		{"ja-JP", "日本"},
+		{"zh-Hant", "繁體"}, // format 1 language tag
+		{"zh-CN", "简体"},
+	} {
+		if s, err := ttf.FamilyName(tt.lang); err != nil || s != tt.want {
+			t.Errorf("FamilyName(%q) = %q, %v, want %q", tt.lang, s, err, tt.want)
+		}
+	}
+	if s, err := ttf.SubfamilyName("ja"); err != nil || s != "Regular" {
+		t.Errorf("SubfamilyName = %q, %v", s, err)
+	}
+	if s, err := ttf.PostScriptName(); err != nil || s != "Fixture-Regular" {
+		t.Errorf("PostScriptName = %q, %v", s, err)
+	}
+	if _, err := ttf.VersionString(); err == nil {
+		t.Error("VersionString of a font without version record succeeded")
+	}
+	if _, err := readFont(t, fixtureFont()).FamilyName(""); !errors.Is(err, font_compress.ErrNoTable) {
+		t.Errorf("FamilyName of a font without name: %v, want ErrNoTable", err)
+	}
+	if _, err := (font_compress.NameRecord{PlatformID: 1, EncodingID: 7}).Decode(); err == nil {
+		t.Error("Decode of an unsupported encoding succeeded")
+	}
+}
+
+func TestWriteNameTable(t *testing.T) {
+	ttf := readFont(t, fixtureFontWith(map[string][]byte{"name": fixtureNameTable()}))
+	name, err := ttf.Name()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name.NameRecords = append(name.NameRecords[:len(name.NameRecords):len(name.NameRecords)], font_compress.NameRecord{
+		PlatformID: 3, EncodingID: 1, LanguageID: 0x0409, NameID: font_compress.NameVersion, Value: utf16BE("Version 1.000"),
+	})
+	replaceTable(ttf, name)
+	font, err := ttf.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reread := readFont(t, font)
+	if got, err := reread.Name(); err != nil || !reflect.DeepEqual(got, name) {
+		t.Errorf("name written as %+v, %v, want %+v", got, err, name)
+	}
+	if s, err := reread.VersionString(); err != nil || s != "Version 1.000" {
+		t.Errorf("VersionString = %q, %v", s, err)
+	}
+}
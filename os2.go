@@ -0,0 +1,240 @@
+package fontcompress
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// OS/2 fsType embedding permissions. The low four bits hold the usage
+// permission, 0 for installable embedding.
+const (
+	// the font must not be modified, embedded or exchanged
+	FS_TYPE_RESTRICTED_LICENSE uint16 = 0x0002
+	// the font may be embedded in documents that are only previewed and printed
+	FS_TYPE_PREVIEW_AND_PRINT uint16 = 0x0004
+	// the font may be embedded in documents that are edited
+	FS_TYPE_EDITABLE uint16 = 0x0008
+	// the font must not be subset before embedding
+	FS_TYPE_NO_SUBSETTING uint16 = 0x0100
+	// only the bitmaps of the font may be embedded
+	FS_TYPE_BITMAP_EMBEDDING_ONLY uint16 = 0x0200
+)
+
+/*
+*
+uint16	version	0x0000 to 0x0005
+FWORD	xAvgCharWidth	Average weighted advance width of lower case letters and space (v0-2), or of all non-zero width glyphs (v3+).
+uint16	usWeightClass	Visual weight (degree of blackness or thickness) of stroke in glyphs.
+uint16	usWidthClass	Relative change from the normal aspect ratio (width to height ratio).
+uint16	fsType	Font embedding licensing rights.
+FWORD	ySubscriptXSize	Horizontal size of subscripts.
+FWORD	ySubscriptYSize	Vertical size of subscripts.
+FWORD	ySubscriptXOffset	Horizontal offset of subscripts.
+FWORD	ySubscriptYOffset	Vertical offset of subscripts, from the baseline.
+FWORD	ySuperscriptXSize	Horizontal size of superscripts.
+FWORD	ySuperscriptYSize	Vertical size of superscripts.
+FWORD	ySuperscriptXOffset	Horizontal offset of superscripts.
+FWORD	ySuperscriptYOffset	Vertical offset of superscripts, from the baseline.
+FWORD	yStrikeoutSize	Thickness of the strikeout stroke.
+FWORD	yStrikeoutPosition	Position of the top of the strikeout stroke relative to the baseline.
+int16	sFamilyClass	Classification of font-family design.
+uint8	panose[10]	PANOSE classification number.
+uint32	ulUnicodeRange1	Bits 0–31, Unicode blocks supported by the font.
+uint32	ulUnicodeRange2	Bits 32–63
+uint32	ulUnicodeRange3	Bits 64–95
+uint32	ulUnicodeRange4	Bits 96–127
+Tag	achVendID	Font vendor identification.
+uint16	fsSelection	Font selection flags.
+uint16	usFirstCharIndex	The minimum Unicode index (character code) in this font, 0xFFFF if it is beyond the BMP.
+uint16	usLastCharIndex	The maximum Unicode index (character code) in this font, 0xFFFF if it is beyond the BMP.
+FWORD	sTypoAscender	The typographic ascender for this font.
+FWORD	sTypoDescender	The typographic descender for this font.
+FWORD	sTypoLineGap	The typographic line gap for this font.
+UFWORD	usWinAscent	The “Windows ascender” metric.
+UFWORD	usWinDescent	The “Windows descender” metric.
+uint32	ulCodePageRange1	Bits 0–31, code pages supported by the font (v1+).
+uint32	ulCodePageRange2	Bits 32–63 (v1+).
+FWORD	sxHeight	Distance between the baseline and the approximate height of non-ascending lowercase letters (v2+).
+FWORD	sCapHeight	Distance between the baseline and the approximate height of uppercase letters (v2+).
+uint16	usDefaultChar	Default character for characters not provided in the font (v2+).
+uint16	usBreakChar	Break character (v2+).
+uint16	usMaxContext	Maximum length of a target glyph context for any feature in this font (v2+).
+uint16	usLowerOpticalPointSize	Lower end of the range of optical sizes, in TWIPs (v5).
+uint16	usUpperOpticalPointSize	Upper end of the range of optical sizes, in TWIPs (v5).
+*/
+// OS/2 — OS/2 and Windows metrics
+//
+// Fields beyond those of Version are zero. Version 0 tables written before
+// the OpenType specification end after LastCharIndex; they are read with
+// zero typographic and Windows metrics and written at the full length.
+type OS2Table struct {
+	Version               uint16    // 0 to 5
+	XAvgCharWidth         int16     // average weighted advance width
+	WeightClass           uint16    // visual weight, 1 to 1000; 400 is regular
+	WidthClass            uint16    // relative change of the aspect ratio, 1 to 9; 5 is normal
+	FsType                uint16    // embedding permissions, FS_TYPE_*
+	SubscriptXSize        int16     // horizontal size of subscripts
+	SubscriptYSize        int16     // vertical size of subscripts
+	SubscriptXOffset      int16     // horizontal offset of subscripts
+	SubscriptYOffset      int16     // vertical offset of subscripts, from the baseline
+	SuperscriptXSize      int16     // horizontal size of superscripts
+	SuperscriptYSize      int16     // vertical size of superscripts
+	SuperscriptXOffset    int16     // horizontal offset of superscripts
+	SuperscriptYOffset    int16     // vertical offset of superscripts, from the baseline
+	StrikeoutSize         int16     // thickness of the strikeout stroke
+	StrikeoutPosition     int16     // top of the strikeout stroke relative to the baseline
+	FamilyClass           int16     // classification of font-family design
+	Panose                [10]uint8 // PANOSE classification number
+	UnicodeRange          [4]uint32 // ulUnicodeRange1-4, Unicode blocks supported by the font
+	VendID                [4]byte   // font vendor identification
+	FsSelection           uint16    // font selection flags
+	FirstCharIndex        uint16    // minimum character code, at most 0xFFFF
+	LastCharIndex         uint16    // maximum character code, at most 0xFFFF
+	TypoAscender          int16     // typographic ascender
+	TypoDescender         int16     // typographic descender
+	TypoLineGap           int16     // typographic line gap
+	WinAscent             uint16    // Windows ascender
+	WinDescent            uint16    // Windows descender
+	CodePageRange         [2]uint32 // ulCodePageRange1-2, code pages supported by the font (v1+)
+	XHeight               int16     // height of non-ascending lowercase letters (v2+)
+	CapHeight             int16     // height of uppercase letters (v2+)
+	DefaultChar           uint16    // character for those not provided by the font (v2+)
+	BreakChar             uint16    // break character (v2+)
+	MaxContext            uint16    // maximum length of a glyph context of any layout feature (v2+)
+	LowerOpticalPointSize uint16    // lower end of the optical size range, in TWIPs (v5)
+	UpperOpticalPointSize uint16    // upper end of the optical size range, in TWIPs (v5)
+}
+
+func (OS2Table) Tag() Tag { return tagOS2 }
+
+// os2Length returns the length of an OS/2 table of version.
+func os2Length(version uint16) int {
+	switch version {
+	case 0:
+		return 78
+	case 1:
+		return 86
+	case 5:
+		return 100
+	}
+	return 96
+}
+
+// read OS/2 table
+func readOS2Table(data []byte) (TTFTable, error) {
+	if err := checkRange("OS/2", data, 0, 2); err != nil {
+		return nil, err
+	}
+	os2 := OS2Table{Version: binary.BigEndian.Uint16(data)}
+	if os2.Version > 5 {
+		return nil, &ParseError{Table: "OS/2", Reason: fmt.Sprintf("unsupported version %d", os2.Version)}
+	}
+	n := os2Length(os2.Version)
+	if os2.Version == 0 && len(data) < n {
+		// the Apple version 0 layout
+		n = 68
+	}
+	if err := checkRange("OS/2", data, 0, uint64(n)); err != nil {
+		return nil, err
+	}
+	u16 := func(off int) uint16 { return binary.BigEndian.Uint16(data[off:]) }
+	i16 := func(off int) int16 { return int16(binary.BigEndian.Uint16(data[off:])) }
+	u32 := func(off int) uint32 { return binary.BigEndian.Uint32(data[off:]) }
+	os2.XAvgCharWidth = i16(2)
+	os2.WeightClass, os2.WidthClass, os2.FsType = u16(4), u16(6), u16(8)
+	os2.SubscriptXSize, os2.SubscriptYSize, os2.SubscriptXOffset, os2.SubscriptYOffset = i16(10), i16(12), i16(14), i16(16)
+	os2.SuperscriptXSize, os2.SuperscriptYSize, os2.SuperscriptXOffset, os2.SuperscriptYOffset = i16(18), i16(20), i16(22), i16(24)
+	os2.StrikeoutSize, os2.StrikeoutPosition, os2.FamilyClass = i16(26), i16(28), i16(30)
+	copy(os2.Panose[:], data[32:42])
+	os2.UnicodeRange = [4]uint32{u32(42), u32(46), u32(50), u32(54)}
+	copy(os2.VendID[:], data[58:62])
+	os2.FsSelection, os2.FirstCharIndex, os2.LastCharIndex = u16(62), u16(64), u16(66)
+	if n >= 78 {
+		os2.TypoAscender, os2.TypoDescender, os2.TypoLineGap = i16(68), i16(70), i16(72)
+		os2.WinAscent, os2.WinDescent = u16(74), u16(76)
+	}
+	if n >= 86 {
+		os2.CodePageRange = [2]uint32{u32(78), u32(82)}
+	}
+	if n >= 96 {
+		os2.XHeight, os2.CapHeight = i16(86), i16(88)
+		os2.DefaultChar, os2.BreakChar, os2.MaxContext = u16(90), u16(92), u16(94)
+	}
+	if n >= 100 {
+		os2.LowerOpticalPointSize, os2.UpperOpticalPointSize = u16(96), u16(98)
+	}
+	return os2, nil
+}
+
+// encode serializes the OS/2 table at the length of its version.
+func (os2 OS2Table) encode() ([]byte, error) {
+	if os2.Version > 5 {
+		return nil, fmt.Errorf("OS/2 version %d cannot be serialized", os2.Version)
+	}
+	n := os2Length(os2.Version)
+	buf := make([]byte, 0, n)
+	for _, v := range []uint16{
+		os2.Version, uint16(os2.XAvgCharWidth), os2.WeightClass, os2.WidthClass, os2.FsType,
+		uint16(os2.SubscriptXSize), uint16(os2.SubscriptYSize), uint16(os2.SubscriptXOffset), uint16(os2.SubscriptYOffset),
+		uint16(os2.SuperscriptXSize), uint16(os2.SuperscriptYSize), uint16(os2.SuperscriptXOffset), uint16(os2.SuperscriptYOffset),
+		uint16(os2.StrikeoutSize), uint16(os2.StrikeoutPosition), uint16(os2.FamilyClass),
+	} {
+		buf = binary.BigEndian.AppendUint16(buf, v)
+	}
+	buf = append(buf, os2.Panose[:]...)
+	for _, v := range os2.UnicodeRange {
+		buf = binary.BigEndian.AppendUint32(buf, v)
+	}
+	buf = append(buf, os2.VendID[:]...)
+	for _, v := range []uint16{
+		os2.FsSelection, os2.FirstCharIndex, os2.LastCharIndex,
+		uint16(os2.TypoAscender), uint16(os2.TypoDescender), uint16(os2.TypoLineGap),
+		os2.WinAscent, os2.WinDescent,
+	} {
+		buf = binary.BigEndian.AppendUint16(buf, v)
+	}
+	for _, v := range os2.CodePageRange {
+		buf = binary.BigEndian.AppendUint32(buf, v)
+	}
+	for _, v := range []uint16{
+		uint16(os2.XHeight), uint16(os2.CapHeight), os2.DefaultChar, os2.BreakChar, os2.MaxContext,
+		os2.LowerOpticalPointSize, os2.UpperOpticalPointSize,
+	} {
+		buf = binary.BigEndian.AppendUint16(buf, v)
+	}
+	return buf[:n], nil
+}
+
+// SubsettingAllowed reports whether fsType permits subsetting the font:
+// neither FS_TYPE_NO_SUBSETTING nor the usage permission
+// FS_TYPE_RESTRICTED_LICENSE may be set.
+func (os2 OS2Table) SubsettingAllowed() bool {
+	return os2.FsType&FS_TYPE_NO_SUBSETTING == 0 && os2.FsType&0x000F != FS_TYPE_RESTRICTED_LICENSE
+}
+
+// setCharacters sets the Unicode range bits and the first and last
+// character indices to those of a font mapping runes.
+func (os2 *OS2Table) setCharacters(runes []rune) {
+	os2.UnicodeRange = unicodeRangeBits(runes)
+	os2.FirstCharIndex, os2.LastCharIndex = 0, 0
+	for i, r := range runes {
+		c := uint16(min(r, 0xFFFF))
+		if i == 0 || c < os2.FirstCharIndex {
+			os2.FirstCharIndex = c
+		}
+		os2.LastCharIndex = max(os2.LastCharIndex, c)
+	}
+}
+
+// OS2 returns the OS/2 table, decoding it on first use.
+func (ttf *TTF) OS2() (OS2Table, error) {
+	table, err := ttf.decodeTable(tagOS2, readOS2Table)
+	if err != nil {
+		return OS2Table{}, err
+	}
+	os2, ok := table.(OS2Table)
+	if !ok {
+		return OS2Table{}, fmt.Errorf("OS/2 table holds a %T", table)
+	}
+	return os2, nil
+}
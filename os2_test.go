@@ -0,0 +1,154 @@
+package fontcompress_test
+
+import (
+	"errors"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+// fixtureOS2 is the OS/2 table of fixtureOS2Font, claiming Basic Latin and
+// an ASCII character range.
+var fixtureOS2 = font_compress.OS2Table{
+	Version:           4,
+	XAvgCharWidth:     580,
+	WeightClass:       400,
+	WidthClass:        5,
+	SubscriptXSize:    650,
+	SubscriptYSize:    600,
+	SubscriptYOffset:  75,
+	StrikeoutSize:     50,
+	StrikeoutPosition: 250,
+	Panose:            [10]uint8{2, 11, 5, 2, 4, 5, 4, 2, 2, 4},
+	UnicodeRange:      [4]uint32{1, 0, 0, 0},
+	VendID:            [4]byte{'F', 'I', 'X', 'T'},
+	FsSelection:       0x0040,
+	FirstCharIndex:    0x20,
+	LastCharIndex:     0x7E,
+	TypoAscender:      800,
+	TypoDescender:     -200,
+	TypoLineGap:       100,
+	WinAscent:         900,
+	WinDescent:        200,
+	CodePageRange:     [2]uint32{1, 0},
+	XHeight:           500,
+	CapHeight:         700,
+	BreakChar:         0x20,
+	MaxContext:        3,
+}
+
+// fixtureOS2Table encodes os2 at the length of its version.
+func fixtureOS2Table(os2 font_compress.OS2Table) []byte {
+	b := appendInt16(nil, int16(os2.Version), os2.XAvgCharWidth, int16(os2.WeightClass), int16(os2.WidthClass), int16(os2.FsType),
+		os2.SubscriptXSize, os2.SubscriptYSize, os2.SubscriptXOffset, os2.SubscriptYOffset,
+		os2.SuperscriptXSize, os2.SuperscriptYSize, os2.SuperscriptXOffset, os2.SuperscriptYOffset,
+		os2.StrikeoutSize, os2.StrikeoutPosition, os2.FamilyClass)
+	b = append(b, os2.Panose[:]...)
+	for _, v := range os2.UnicodeRange {
+		b = appendInt16(b, int16(v>>16), int16(v))
+	}
+	b = append(b, os2.VendID[:]...)
+	b = appendInt16(b, int16(os2.FsSelection), int16(os2.FirstCharIndex), int16(os2.LastCharIndex),
+		os2.TypoAscender, os2.TypoDescender, os2.TypoLineGap, int16(os2.WinAscent), int16(os2.WinDescent))
+	for _, v := range os2.CodePageRange {
+		b = appendInt16(b, int16(v>>16), int16(v))
+	}
+	b = appendInt16(b, os2.XHeight, os2.CapHeight, int16(os2.DefaultChar), int16(os2.BreakChar), int16(os2.MaxContext),
+		int16(os2.LowerOpticalPointSize), int16(os2.UpperOpticalPointSize))
+	switch os2.Version {
+	case 0:
+		return b[:78]
+	case 1:
+		return b[:86]
+	case 5:
+		return b
+	}
+	return b[:96]
+}
+
+func TestReadOS2Table(t *testing.T) {
+	for version, length := range []int{78, 86, 96, 96, 96, 100} {
+		want := fixtureOS2
+		want.Version = uint16(version)
+		if version < 5 {
+			want.LowerOpticalPointSize, want.UpperOpticalPointSize = 0, 0
+		} else {
+			want.LowerOpticalPointSize, want.UpperOpticalPointSize = 160, 480
+		}
+		if version < 2 {
+			want.XHeight, want.CapHeight, want.BreakChar, want.MaxContext = 0, 0, 0, 0
+		}
+		if version < 1 {
+			want.CodePageRange = [2]uint32{}
+		}
+		font := fixtureFontWith(map[string][]byte{"OS/2": fixtureOS2Table(want)})
+		if n := len(fontTable(font, "OS/2")); n != length {
+			t.Fatalf("version %d fixture is %d bytes long, want %d", version, n, length)
+		}
+		ttf := readFont(t, font)
+		os2, err := ttf.OS2()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if os2 != want {
+			t.Errorf("version %d OS/2 = %+v, want %+v", version, os2, want)
+		}
+
+		// written back at the length of its version
+		os2.WeightClass = 700
+		replaceTable(ttf, os2)
+		out, err := ttf.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := readFont(t, out).OS2(); err != nil || got != os2 || len(fontTable(out, "OS/2")) != length {
+			t.Errorf("version %d OS/2 written as %+v, %v", version, got, err)
+		}
+	}
+
+	// the Apple version 0 table ends after usLastCharIndex
+	apple := fixtureFontWith(map[string][]byte{"OS/2": fixtureOS2Table(font_compress.OS2Table{WeightClass: 400})[:68]})
+	if os2, err := readFont(t, apple).OS2(); err != nil || os2.WeightClass != 400 {
+		t.Errorf("68 byte OS/2 = %+v, %v", os2, err)
+	}
+}
+
+func TestSubsetOS2(t *testing.T) {
+	out, err := font_compress.Subset(readFont(t, fixtureFontWith(map[string][]byte{"OS/2": fixtureOS2Table(fixtureOS2)})), []rune{'A', 'Ä', 0x20000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	os2, err := readFont(t, out).OS2()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fixtureOS2
+	// Basic Latin, Latin-1 Supplement, non-plane 0 and CJK Unified Ideographs
+	want.UnicodeRange = [4]uint32{1<<0 | 1<<1, 1<<(57-32) | 1<<(59-32), 0, 0}
+	want.FirstCharIndex, want.LastCharIndex = 'A', 0xFFFF
+	// GSUB and GPOS are not kept
+	want.MaxContext = 0
+	if os2 != want {
+		t.Errorf("OS/2 of the subset = %+v, want %+v", os2, want)
+	}
+
+	for _, tt := range []struct {
+		fsType    uint16
+		forbidden bool
+	}{
+		{font_compress.FS_TYPE_NO_SUBSETTING, true},
+		{font_compress.FS_TYPE_RESTRICTED_LICENSE, true},
+		{font_compress.FS_TYPE_PREVIEW_AND_PRINT | font_compress.FS_TYPE_NO_SUBSETTING, true},
+		{font_compress.FS_TYPE_PREVIEW_AND_PRINT, false},
+	} {
+		restricted := fixtureOS2
+		restricted.FsType = tt.fsType
+		ttf := readFont(t, fixtureFontWith(map[string][]byte{"OS/2": fixtureOS2Table(restricted)}))
+		if _, err := font_compress.Subset(ttf, []rune("A")); tt.forbidden != errors.Is(err, font_compress.ErrSubsettingForbidden) {
+			t.Errorf("fsType %#04x: Subset returned %v", tt.fsType, err)
+		}
+		if _, err := font_compress.SubsetWithOptions(ttf, []rune("A"), font_compress.SubsetOptions{IgnoreEmbeddingPermissions: true}); err != nil {
+			t.Errorf("fsType %#04x: SubsetWithOptions ignoring the embedding permissions: %v", tt.fsType, err)
+		}
+	}
+}
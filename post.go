@@ -0,0 +1,264 @@
+package fontcompress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	// post version 1.0, the glyphs are the standard Macintosh glyphs
+	POST_VERSION_1_0 uint32 = 0x00010000
+	// post version 2.0, glyph names are stored in the table
+	POST_VERSION_2_0 uint32 = 0x00020000
+	// post version 2.5, the glyphs are a reordered subset of the standard
+	// Macintosh glyphs; deprecated
+	POST_VERSION_2_5 uint32 = 0x00025000
+	// post version 3.0, no glyph names
+	POST_VERSION_3_0 uint32 = 0x00030000
+)
+
+/*
+*
+Version16Dot16	version	0x00010000 for version 1.0, 0x00020000 for version 2.0, 0x00025000 for version 2.5 (deprecated), 0x00030000 for version 3.0
+Fixed	italicAngle	Italic angle in counter-clockwise degrees from the vertical. Zero for upright text, negative for text that leans to the right (forward).
+FWORD	underlinePosition	Suggested y-coordinate of the top of the underline.
+FWORD	underlineThickness	Suggested values for the underline thickness.
+uint32	isFixedPitch	Set to 0 if the font is proportionally spaced, non-zero if the font is not proportionally spaced (i.e. monospaced).
+uint32	minMemType42	Minimum memory usage when an OpenType font is downloaded.
+uint32	maxMemType42	Maximum memory usage when an OpenType font is downloaded.
+uint32	minMemType1	Minimum memory usage when an OpenType font is downloaded as a Type 1 font.
+uint32	maxMemType1	Maximum memory usage when an OpenType font is downloaded as a Type 1 font.
+
+version 2.0:
+uint16	numGlyphs	Number of glyphs (this should be the same as numGlyphs in 'maxp' table).
+uint16	glyphNameIndex[numGlyphs]	Array of indices into the string data.
+uint8	stringData[variable]	Storage for the string data, Pascal strings.
+
+version 2.5:
+uint16	numGlyphs	Number of glyphs.
+int8	offset[numGlyphs]	Difference between graphic index and standard order of glyph.
+*/
+// post — PostScript
+type PostTable struct {
+	Version            uint32 // POST_VERSION_*
+	ItalicAngle        int32  // 16.16 fixed, counter-clockwise degrees from the vertical
+	UnderlinePosition  int16  // suggested y-coordinate of the top of the underline
+	UnderlineThickness int16  // suggested underline thickness
+	IsFixedPitch       uint32 // non-zero for monospaced fonts
+	MinMemType42       uint32 // minimum memory usage when downloaded
+	MaxMemType42       uint32 // maximum memory usage when downloaded
+	MinMemType1        uint32 // minimum memory usage when downloaded as a Type 1 font
+	MaxMemType1        uint32 // maximum memory usage when downloaded as a Type 1 font
+	// GlyphNames are the names of the glyphs, indexed by glyph id; nil for
+	// version 3.0.
+	GlyphNames []string
+}
+
+func (PostTable) Tag() Tag { return tagPost }
+
+// read post table
+func readPostTable(data []byte) (TTFTable, error) {
+	if err := checkRange("post", data, 0, 32); err != nil {
+		return nil, err
+	}
+	post := PostTable{
+		Version:            binary.BigEndian.Uint32(data[0:]),
+		ItalicAngle:        int32(binary.BigEndian.Uint32(data[4:])),
+		UnderlinePosition:  int16(binary.BigEndian.Uint16(data[8:])),
+		UnderlineThickness: int16(binary.BigEndian.Uint16(data[10:])),
+		IsFixedPitch:       binary.BigEndian.Uint32(data[12:]),
+		MinMemType42:       binary.BigEndian.Uint32(data[16:]),
+		MaxMemType42:       binary.BigEndian.Uint32(data[20:]),
+		MinMemType1:        binary.BigEndian.Uint32(data[24:]),
+		MaxMemType1:        binary.BigEndian.Uint32(data[28:]),
+	}
+	switch post.Version {
+	case POST_VERSION_1_0:
+		post.GlyphNames = append([]string(nil), postStandardNames[:]...)
+		return post, nil
+	case POST_VERSION_3_0:
+		return post, nil
+	case POST_VERSION_2_0, POST_VERSION_2_5:
+	default:
+		return nil, &ParseError{Table: "post", Reason: fmt.Sprintf("unsupported version %#08x", post.Version)}
+	}
+
+	if err := checkRange("post", data, 32, 2); err != nil {
+		return nil, err
+	}
+	numGlyphs := int(binary.BigEndian.Uint16(data[32:]))
+	post.GlyphNames = make([]string, numGlyphs)
+	if post.Version == POST_VERSION_2_5 {
+		if err := checkRange("post", data, 34, uint64(numGlyphs)); err != nil {
+			return nil, err
+		}
+		for gid := range post.GlyphNames {
+			i := gid + int(int8(data[34+gid]))
+			if i < 0 || i >= len(postStandardNames) {
+				return nil, &ParseError{Table: "post", Offset: int64(34 + gid), Reason: fmt.Sprintf("glyph %d has no standard name", gid)}
+			}
+			post.GlyphNames[gid] = postStandardNames[i]
+		}
+		return post, nil
+	}
+
+	if err := checkRange("post", data, 34, 2*uint64(numGlyphs)); err != nil {
+		return nil, err
+	}
+	var names []string
+	for off := 34 + 2*numGlyphs; off < len(data); {
+		n := int(data[off])
+		if err := checkRange("post", data, uint64(off+1), uint64(n)); err != nil {
+			return nil, err
+		}
+		names = append(names, string(data[off+1:off+1+n]))
+		off += 1 + n
+	}
+	for gid := range post.GlyphNames {
+		i := int(binary.BigEndian.Uint16(data[34+2*gid:]))
+		switch {
+		case i < len(postStandardNames):
+			post.GlyphNames[gid] = postStandardNames[i]
+		case i-len(postStandardNames) < len(names):
+			post.GlyphNames[gid] = names[i-len(postStandardNames)]
+		default:
+			return nil, &ParseError{Table: "post", Offset: int64(34 + 2*gid), Reason: fmt.Sprintf("glyph name index %d beyond the %d names", i, len(names))}
+		}
+	}
+	return post, nil
+}
+
+// encode serializes the post table. Version 1.0 and 2.5 tables must name
+// their glyphs with the standard Macintosh names they can hold.
+func (post PostTable) encode() ([]byte, error) {
+	buf := make([]byte, 0, 34+2*len(post.GlyphNames))
+	buf = binary.BigEndian.AppendUint32(buf, post.Version)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(post.ItalicAngle))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(post.UnderlinePosition))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(post.UnderlineThickness))
+	for _, v := range []uint32{post.IsFixedPitch, post.MinMemType42, post.MaxMemType42, post.MinMemType1, post.MaxMemType1} {
+		buf = binary.BigEndian.AppendUint32(buf, v)
+	}
+
+	standard := make(map[string]int, len(postStandardNames))
+	for i, name := range postStandardNames {
+		standard[name] = i
+	}
+	switch post.Version {
+	case POST_VERSION_1_0:
+		if len(post.GlyphNames) != len(postStandardNames) {
+			return nil, errors.New("post version 1.0 must name the 258 standard glyphs")
+		}
+		for gid, name := range post.GlyphNames {
+			if name != postStandardNames[gid] {
+				return nil, fmt.Errorf("post version 1.0 cannot name glyph %d %q", gid, name)
+			}
+		}
+		return buf, nil
+	case POST_VERSION_3_0:
+		return buf, nil
+	case POST_VERSION_2_0, POST_VERSION_2_5:
+	default:
+		return nil, fmt.Errorf("post version %#08x cannot be serialized", post.Version)
+	}
+	if len(post.GlyphNames) > 0xFFFF {
+		return nil, fmt.Errorf("post table has %d glyph names", len(post.GlyphNames))
+	}
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(post.GlyphNames)))
+
+	if post.Version == POST_VERSION_2_5 {
+		for gid, name := range post.GlyphNames {
+			i, ok := standard[name]
+			if !ok || i-gid < -128 || i-gid > 127 {
+				return nil, fmt.Errorf("post version 2.5 cannot name glyph %d %q", gid, name)
+			}
+			buf = append(buf, byte(int8(i-gid)))
+		}
+		return buf, nil
+	}
+
+	// names beyond the standard ones are stored once, in order of first use
+	var strs []byte
+	custom := make(map[string]int)
+	for _, name := range post.GlyphNames {
+		i, ok := standard[name]
+		if !ok {
+			if i, ok = custom[name]; !ok {
+				if len(name) > 255 {
+					return nil, fmt.Errorf("glyph name %q is longer than 255 bytes", name)
+				}
+				i = len(postStandardNames) + len(custom)
+				if i > 0xFFFF {
+					return nil, errors.New("post table has more than 65535 glyph names")
+				}
+				custom[name] = i
+				strs = append(append(strs, byte(len(name))), name...)
+			}
+		}
+		buf = binary.BigEndian.AppendUint16(buf, uint16(i))
+	}
+	return append(buf, strs...), nil
+}
+
+// subset returns the table naming the glyphs of order, in that order.
+// Glyph names are kept as a version 2.0 table if keepNames is set and the
+// font has them; otherwise the table is version 3.0.
+func (post PostTable) subset(order []uint16, keepNames bool) PostTable {
+	sub := post
+	sub.GlyphNames = nil
+	if !keepNames || post.GlyphNames == nil {
+		sub.Version = POST_VERSION_3_0
+		return sub
+	}
+	sub.Version = POST_VERSION_2_0
+	sub.GlyphNames = make([]string, len(order))
+	for i, gid := range order {
+		if int(gid) < len(post.GlyphNames) {
+			sub.GlyphNames[i] = post.GlyphNames[gid]
+		} else {
+			sub.GlyphNames[i] = fmt.Sprintf("glyph%05d", gid)
+		}
+	}
+	return sub
+}
+
+// Post returns the post table, decoding it on first use.
+func (ttf *TTF) Post() (PostTable, error) {
+	table, err := ttf.decodeTable(tagPost, readPostTable)
+	if err != nil {
+		return PostTable{}, err
+	}
+	post, ok := table.(PostTable)
+	if !ok {
+		return PostTable{}, fmt.Errorf("post table holds a %T", table)
+	}
+	return post, nil
+}
+
+// GlyphName returns the name of glyph gid from the post table or, for fonts
+// whose post table has no names, from the charset of the CFF table.
+// CID-keyed CFF fonts name their glyphs "cid" followed by the CID.
+func (ttf *TTF) GlyphName(gid uint16) (string, error) {
+	post, err := ttf.Post()
+	if err != nil && !errors.Is(err, ErrNoTable) {
+		return "", err
+	}
+	if post.GlyphNames != nil {
+		if int(gid) >= len(post.GlyphNames) {
+			return "", fmt.Errorf("glyph %d is out of range, post names %d glyphs", gid, len(post.GlyphNames))
+		}
+		return post.GlyphNames[gid], nil
+	}
+	if ttf.tableInfo(tagCFF) == nil {
+		return "", errors.New("font has no glyph names")
+	}
+	cff, err := ttf.CFF()
+	if err != nil {
+		return "", err
+	}
+	if int(gid) >= cff.NumGlyphs() {
+		return "", fmt.Errorf("glyph %d is out of range, the font has %d glyphs", gid, cff.NumGlyphs())
+	}
+	return cff.GlyphName(gid), nil
+}
@@ -0,0 +1,118 @@
+package fontcompress_test
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+// fixtureGlyphNames are the names of the fixture glyphs; all but the last
+// are standard Macintosh names.
+var fixtureGlyphNames = []string{".notdef", "A", "B", "dieresis", "Adieresis", "C", "u20000"}
+
+// fixturePostTable returns a version 2.0 post table naming the fixture
+// glyphs, with an italic angle of -12 degrees.
+func fixturePostTable() []byte {
+	post := binary.BigEndian.AppendUint32(nil, font_compress.POST_VERSION_2_0)
+	post = binary.BigEndian.AppendUint32(post, 0xFFF40000) // -12.0
+	post = appendInt16(post, -100, 50)
+	post = append(post, make([]byte, 20)...)
+	post = binary.BigEndian.AppendUint16(post, uint16(len(fixtureGlyphNames)))
+	post = appendInt16(post, 0, 36, 37, 142, 98, 38, 258)
+	return append(append(post, 6), "u20000"...)
+}
+
+func TestReadPostTable(t *testing.T) {
+	ttf := readFont(t, fixtureFontWith(map[string][]byte{"post": fixturePostTable()}))
+	post, err := ttf.Post()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := font_compress.PostTable{
+		Version:            font_compress.POST_VERSION_2_0,
+		ItalicAngle:        -12 << 16,
+		UnderlinePosition:  -100,
+		UnderlineThickness: 50,
+		GlyphNames:         fixtureGlyphNames,
+	}
+	if !reflect.DeepEqual(post, want) {
+		t.Errorf("post = %+v, want %+v", post, want)
+	}
+	for gid, name := range fixtureGlyphNames {
+		if got, err := ttf.GlyphName(uint16(gid)); err != nil || got != name {
+			t.Errorf("GlyphName(%d) = %q, %v, want %q", gid, got, err, name)
+		}
+	}
+	if _, err := ttf.GlyphName(uint16(len(fixtureGlyphNames))); err == nil {
+		t.Error("GlyphName of a glyph out of range succeeded")
+	}
+
+	// version 1.0 names the standard glyphs, version 2.5 reorders them
+	v1 := append(binary.BigEndian.AppendUint32(nil, font_compress.POST_VERSION_1_0), make([]byte, 28)...)
+	if name, err := readFont(t, fixtureFontWith(map[string][]byte{"post": v1})).GlyphName(142); err != nil || name != "dieresis" {
+		t.Errorf("version 1.0 GlyphName(142) = %q, %v, want dieresis", name, err)
+	}
+	v25 := append(binary.BigEndian.AppendUint32(nil, font_compress.POST_VERSION_2_5), make([]byte, 28)...)
+	v25 = append(binary.BigEndian.AppendUint16(v25, 3), 0, 35, 35)
+	post, err = readFont(t, fixtureFontWith(map[string][]byte{"post": v25})).Post()
+	if err != nil || !reflect.DeepEqual(post.GlyphNames, []string{".notdef", "A", "B"}) {
+		t.Errorf("version 2.5 glyph names = %q, %v", post.GlyphNames, err)
+	}
+
+	// without names in post, CFF fonts are named by their charset
+	if _, err := readFont(t, fixtureFont()).GlyphName(1); err == nil {
+		t.Error("GlyphName of a TrueType font with a version 3.0 post table succeeded")
+	}
+	for _, tt := range []struct {
+		cid  bool
+		want string
+	}{{false, "Adieresis"}, {true, "cid00004"}} {
+		if name, err := readFont(t, fixtureCFFFont(tt.cid)).GlyphName(4); err != nil || name != tt.want {
+			t.Errorf("CFF GlyphName(4) = %q, %v, want %q", name, err, tt.want)
+		}
+	}
+}
+
+func TestWritePostTable(t *testing.T) {
+	ttf := readFont(t, fixtureFontWith(map[string][]byte{"post": fixturePostTable()}))
+	post, err := ttf.Post()
+	if err != nil {
+		t.Fatal(err)
+	}
+	post.GlyphNames = []string{".notdef", "A", "B", "uni0308", "Adieresis", "C", "uni0308"}
+	replaceTable(ttf, post)
+	font, err := ttf.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readFont(t, font).Post(); err != nil || !reflect.DeepEqual(got, post) {
+		t.Errorf("post written as %+v, %v, want %+v", got, err, post)
+	}
+	// the name shared by two glyphs is stored once
+	if got, want := len(fontTable(font, "post")), 34+2*len(post.GlyphNames)+1+len("uni0308"); got != want {
+		t.Errorf("post is %d bytes long, want %d", got, want)
+	}
+}
+
+func TestSubsetPost(t *testing.T) {
+	ttf := readFont(t, fixtureFontWith(map[string][]byte{"post": fixturePostTable()}))
+	out, err := font_compress.Subset(ttf, []rune("Ä"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := readFont(t, out).Post()
+	if want := (font_compress.PostTable{Version: font_compress.POST_VERSION_3_0, ItalicAngle: -12 << 16, UnderlinePosition: -100, UnderlineThickness: 50}); err != nil || !reflect.DeepEqual(post, want) {
+		t.Errorf("post of the subset = %+v, %v, want %+v", post, err, want)
+	}
+
+	out, err = font_compress.SubsetWithOptions(ttf, []rune("Ä"), font_compress.SubsetOptions{KeepGlyphNames: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err = readFont(t, out).Post()
+	if want := []string{".notdef", "A", "dieresis", "Adieresis"}; err != nil || post.Version != font_compress.POST_VERSION_2_0 || !reflect.DeepEqual(post.GlyphNames, want) {
+		t.Errorf("post of the subset with names = %+v, %v, want names %q", post, err, want)
+	}
+}
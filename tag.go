@@ -0,0 +1,57 @@
+package fontcompress
+
+import "fmt"
+
+// Tag is a 4-byte table identifier, such as 'cmap'.
+type Tag uint32
+
+// tags of the tables decoded by this package
+const (
+	tagCFF  Tag = 0x43464620 // 'CFF '
+	tagGDEF Tag = 0x47444546 // 'GDEF'
+	tagGPOS Tag = 0x47504F53 // 'GPOS'
+	tagGSUB Tag = 0x47535542 // 'GSUB'
+	tagOS2  Tag = 0x4F532F32 // 'OS/2'
+	tagVORG Tag = 0x564F5247 // 'VORG'
+	tagCmap Tag = 0x636D6170 // 'cmap'
+	tagGlyf Tag = 0x676C7966 // 'glyf'
+	tagHead Tag = 0x68656164 // 'head'
+	tagHhea Tag = 0x68686561 // 'hhea'
+	tagHmtx Tag = 0x686D7478 // 'hmtx'
+	tagLoca Tag = 0x6C6F6361 // 'loca'
+	tagMaxp Tag = 0x6D617870 // 'maxp'
+	tagName Tag = 0x6E616D65 // 'name'
+	tagPost Tag = 0x706F7374 // 'post'
+	tagVhea Tag = 0x76686561 // 'vhea'
+	tagVmtx Tag = 0x766D7478 // 'vmtx'
+)
+
+// ParseTag returns the tag spelled by s. Tags are 1 to 4 printable ASCII
+// characters; shorter ones are padded with spaces, so "CFF" is 'CFF '.
+func ParseTag(s string) (Tag, error) {
+	if len(s) == 0 || len(s) > 4 {
+		return 0, fmt.Errorf("tag %q is not 1 to 4 characters long", s)
+	}
+	var tag Tag
+	for i := 0; i < 4; i++ {
+		c := byte(' ')
+		if i < len(s) {
+			c = s[i]
+		}
+		if c < 0x20 || c > 0x7E {
+			return 0, fmt.Errorf("tag %q has a non-printable character", s)
+		}
+		tag = tag<<8 | Tag(c)
+	}
+	return tag, nil
+}
+
+// String returns the 4 characters of the tag, including trailing spaces.
+func (tag Tag) String() string {
+	return string([]byte{byte(tag >> 24), byte(tag >> 16), byte(tag >> 8), byte(tag)})
+}
+
+// PrintTagName returns the 4 characters of tag, as Tag(tag).String does.
+func PrintTagName(tag uint32) string {
+	return Tag(tag).String()
+}
@@ -0,0 +1,36 @@
+package fontcompress_test
+
+import (
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+func TestParseTag(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want font_compress.Tag
+		str  string
+	}{
+		{"cmap", 0x636D6170, "cmap"},
+		{"OS/2", 0x4F532F32, "OS/2"},
+		{"CFF ", 0x43464620, "CFF "},
+		{"CFF", 0x43464620, "CFF "},
+		{"cvt", 0x63767420, "cvt "},
+		{"a", 0x61202020, "a   "},
+	} {
+		tag, err := font_compress.ParseTag(tt.s)
+		if err != nil {
+			t.Errorf("ParseTag(%q): %v", tt.s, err)
+			continue
+		}
+		if tag != tt.want || tag.String() != tt.str {
+			t.Errorf("ParseTag(%q) = %#x %q, want %#x %q", tt.s, uint32(tag), tag, uint32(tt.want), tt.str)
+		}
+	}
+	for _, s := range []string{"", "glyph", "cm\x00p", "\xe9t\xe9"} {
+		if tag, err := font_compress.ParseTag(s); err == nil {
+			t.Errorf("ParseTag(%q) = %q, want an error", s, tag)
+		}
+	}
+}
@@ -1,37 +1,80 @@
 package fontcompress
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
 )
 
 const (
 	// TTF
 	TTF_MAGIC uint32 = 0x00010000
-	// OTF
-	OTF_MAGIC uint32 = 0x74727565
+	// OTF, CFF outlines
+	OTF_MAGIC uint32 = 0x4F54544F // 'OTTO'
+	// Apple TrueType
+	TRUE_MAGIC uint32 = 0x74727565 // 'true'
 )
 
-type TTFTable interface{}
+// Flavor is the kind of font announced by the sfnt version.
+type Flavor int
+
+const (
+	FlavorTrueType      Flavor = iota // TrueType outlines, 0x00010000
+	FlavorCFF                         // CFF outlines, 'OTTO'
+	FlavorAppleTrueType               // TrueType outlines in an Apple font, 'true'
+)
+
+func (f Flavor) String() string {
+	switch f {
+	case FlavorTrueType:
+		return "TrueType"
+	case FlavorCFF:
+		return "CFF"
+	case FlavorAppleTrueType:
+		return "Apple TrueType"
+	}
+	return "unknown"
+}
+
+// TTFTable is a decoded table, such as CmapTable. Use the accessors of TTF,
+// such as Cmap or Table, to obtain one.
+type TTFTable interface {
+	Tag() Tag // tag of the table
+}
 
 type TTFTableInfo struct {
-	Tag      uint32 // 4-byte identifier;
+	Tag      uint32 // 4-byte identifier
 	CheckSum uint32 // CheckSum for this table
 	Offset   uint32 // Offset from beginning of TrueType font file
 	Length   uint32 // Length of this table
 
+	// Raw bytes of the table as read, or as last written by Bytes. Tables
+	// without a decoded Table are written from Data.
+	Data []byte
+	// Decoded table, nil until it is first accessed
 	Table TTFTable
 }
 
+// RawTable is a table this package has no decoder for, as returned by
+// (*TTF).Table.
+type RawTable struct {
+	tag  Tag
+	Data []byte // bytes of the table
+}
+
+func (raw RawTable) Tag() Tag { return raw.tag }
+
 type CmapSubHeader struct {
-	// First character code covered
+	// First valid low byte for this subHeader
 	FirstCode uint16
-	// Last character code covered
+	// Number of valid low bytes for this subHeader
 	EntryCount uint16
-	// Glyph index array
+	// Added to non-zero values of the glyph index array
 	IdDelta uint16
-	// Number of idRangeOffsets that follow
+	// Offset in bytes from this field to the glyph index array element of FirstCode
 	IdRangeOffset uint16
 }
 
@@ -68,19 +111,24 @@ type CmapSubTable struct {
 	// 2 - High-byte mapping through table
 	// 4 - Segment mapping to delta values
 	// 6 - Trimmed table mapping
+	// 8 - Mixed 16-bit and 32-bit coverage
+	// 10 - Trimmed array
+	// 12 - Segmented coverage
+	// 13 - Many-to-one range mappings
+	// 14 - Unicode Variation Sequences
 	Format uint16 // Format number is set to 0
 	// length:
 	// This is the length in bytes of the subtable.
 	// If it is not exactly the size needed to contain the subtable,
 	// then the subtable should be treated as if this field were set to 0.
 	// See the note below for more information.
-	Length uint16 // Length in bytes of the subtable (including this header)
+	Length uint32 // Length in bytes of the subtable (including this header), 32-bit for formats 8, 10, 12, 13 and 14
 	// language:
 	// For requirements on use of the language field,
 	// see “Use of the language field in ‘cmap’ subtables” in this document.
 	// For information on the language field for Windows platforms,
 	// see the “EncodingID” field description in the “name” table chapter.
-	Language uint16 // Language code for this encoding subtable, or zero if language-independent
+	Language uint32 // Language code for this encoding subtable, or zero if language-independent, 32-bit for formats 8, 10, 12 and 13
 	// An array that maps character codes to glyph index values
 	GlyphIndexArray []uint8
 
@@ -130,7 +178,16 @@ type CmapSubTable struct {
 	FirstCode  uint16
 	EntryCount uint16
 
-	// 'cmap' format 8–Mixed 16-bit and 32-bit coverage
+	// format 10
+	/**
+	UInt32	startCharCode	First character code covered
+	UInt32	numChars	Number of character codes covered
+	UInt16	glyphs[]	Array of glyph indices for the character codes covered, kept in GlyphIndexArray16
+	*/
+	StartCharCode uint32
+	NumChars      uint32
+
+	// 'cmap' format 8–Mixed 16-bit and 32-bit coverage, also used by formats 10, 12 and 13
 	// UInt16	reserved	Set to 0
 	Reserved uint16
 	// is32:
@@ -138,15 +195,56 @@ type CmapSubTable struct {
 	Is32    []uint8 // otherwise it is the lowest byte of a two-byte character code range.
 	NGroups uint32  // Number of groupings which follow
 
-	// Mixed 16-bit and 32-bit coverage table
+	// Mixed 16-bit and 32-bit coverage table; the map groups of formats 12 and 13.
+	// In format 13 every character of a group maps to StartGlyphCode.
 	Groups []CmapSubTableFormatMixGroup
+
+	// format 14
+	/**
+	UInt32	numVarSelectorRecords	Number of variation Selector Records
+	VariationSelector	varSelector[numVarSelectorRecords]	Array of VariationSelector records, sorted by varSelector
+	*/
+	NumVarSelectorRecords uint32
+	VarSelectors          []CmapVariationSelector
+}
+
+/*
+*
+uint24	varSelector	Variation selector
+Offset32	defaultUVSOffset	Offset from the start of the format 14 subtable to Default UVS Table. May be 0.
+Offset32	nonDefaultUVSOffset	Offset from the start of the format 14 subtable to Non-Default UVS Table. May be 0.
+*/
+type CmapVariationSelector struct {
+	VarSelector uint32
+	// Base characters whose variation sequence uses the glyph of the base character
+	DefaultUVS []CmapUnicodeRange
+	// Base characters whose variation sequence maps to a glyph of its own
+	NonDefaultUVS []CmapUVSMapping
+}
+
+/*
+*
+uint24	startUnicodeValue	First value in this range
+uint8	additionalCount	Number of additional values in this range
+*/
+type CmapUnicodeRange struct {
+	StartUnicodeValue uint32
+	AdditionalCount   uint8
+}
+
+/*
+*
+uint24	unicodeValue	Base Unicode value of the UVS
+uint16	glyphID	Glyph ID of the UVS
+*/
+type CmapUVSMapping struct {
+	UnicodeValue uint32
+	GlyphID      uint16
 }
 
 // required tables
 // cmap — character to glyph mapping
 type CmapTable struct {
-	TTFTable
-
 	Version         uint16 // Version number (Set to zero)
 	NumberSubtables uint16 // Number of encoding subtables
 
@@ -197,7 +295,6 @@ int16	indexToLocFormat	0 for short offsets, 1 for long
 int16	glyphDataFormat	0 for current format
 */
 type HeadTable struct {
-	TTFTable
 	Version            uint32 // 0x00010000 if (version 1.0)
 	FontRevision       uint32 // set by font manufacturer
 	CheckSumAdjustment uint32 // To compute: set it to 0, calculate the checksum for the 'head' table and put it in the table directory, sum the entire font as a uint32_t, then store 0xB1B0AFBA - sum. (The checksum for the 'head' table will be wrong as a result. That is OK; do not reset it.)
@@ -231,214 +328,624 @@ type HeadTable struct {
 	// -2 Like -1 but also contains neutrals
 	IndexToLocFormat int16 // 0 for short offsets, 1 for long
 	GlyphDataFormat  int16 // 0 for current format
-
 }
 
+func (CmapTable) Tag() Tag { return tagCmap }
+
+func (HeadTable) Tag() Tag { return tagHead }
+
+// TTF is a TrueType or OpenType font. Its tables are decoded when first
+// accessed, so a TTF must not be used from several goroutines at once.
 type TTF struct {
-	File string
+	File string // path or name the font was read from, empty for fonts parsed from memory or a reader
 
-	ScalerType    uint32 // 0x00010000(65546) for TTF or 0x74727565(1953658213) for OTF
+	ScalerType    uint32 // 0x00010000 for TTF, 0x4F54544F ('OTTO') for OTF or 0x74727565 ('true') for Apple TTF
 	NumTables     uint16 // number of tables
 	SearchRange   uint16 // (maximum power of 2 <= numTables)*16
 	EntrySelector uint16 // log2(maximum power of 2 <= numTables)
 	RangeShift    uint16 // numTables*16-searchRange
 
 	Tables []TTFTableInfo // tables
+
+	buf    []byte // raw font data
+	offset int    // offset of the offset table in buf, non-zero for collection members
 }
 
+// readTTF reads the whole of ttf.File.
 func (ttf *TTF) readTTF() (buf []byte, err error) {
 	file, err := os.OpenFile(ttf.File, os.O_RDONLY, 0)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 	return io.ReadAll(file)
 }
 
 func (ttf *TTF) readTTFInfo(buf []byte) error {
+	if len(buf) < 12 {
+		return &ParseError{Reason: "truncated offset table"}
+	}
 	ttf.ScalerType = uint32(buf[0])<<24 | uint32(buf[1])<<16 | uint32(buf[2])<<8 | uint32(buf[3])
 	ttf.NumTables = uint16(buf[4])<<8 | uint16(buf[5])
 	ttf.SearchRange = uint16(buf[6])<<8 | uint16(buf[7])
 	ttf.EntrySelector = uint16(buf[8])<<8 | uint16(buf[9])
 	ttf.RangeShift = uint16(buf[10])<<8 | uint16(buf[11])
 
-	if ttf.ScalerType != TTF_MAGIC && ttf.ScalerType != OTF_MAGIC {
-		return errors.New("not a ttf or otf file")
+	switch ttf.ScalerType {
+	case TTF_MAGIC, OTF_MAGIC, TRUE_MAGIC:
+	default:
+		return &ParseError{Reason: "not a ttf or otf file"}
+	}
+	if 12+16*int(ttf.NumTables) > len(buf) {
+		return &ParseError{Offset: 12, Reason: fmt.Sprintf("table directory of %d entries is truncated", ttf.NumTables)}
 	}
 	return nil
 }
 
+// Flavor returns the kind of font announced by the sfnt version.
+func (ttf *TTF) Flavor() Flavor {
+	switch ttf.ScalerType {
+	case OTF_MAGIC:
+		return FlavorCFF
+	case TRUE_MAGIC:
+		return FlavorAppleTrueType
+	}
+	return FlavorTrueType
+}
+
 // read cmap table
-func readCmapTable(buf []byte, i int) (ti TTFTableInfo) {
-	tableInfo := TTFTableInfo{
-		Tag:      uint32(buf[12+i*16])<<24 | uint32(buf[13+i*16])<<16 | uint32(buf[14+i*16])<<8 | uint32(buf[15+i*16]),
-		CheckSum: uint32(buf[16+i*16])<<24 | uint32(buf[17+i*16])<<16 | uint32(buf[18+i*16])<<8 | uint32(buf[19+i*16]),
-		Offset:   uint32(buf[20+i*16])<<24 | uint32(buf[21+i*16])<<16 | uint32(buf[22+i*16])<<8 | uint32(buf[23+i*16]),
-		Length:   uint32(buf[24+i*16])<<24 | uint32(buf[25+i*16])<<16 | uint32(buf[26+i*16])<<8 | uint32(buf[27+i*16]),
-	}
-	// read cmap table
+func readCmapTable(data []byte) (CmapTable, error) {
+	if err := checkRange("cmap", data, 0, 4); err != nil {
+		return CmapTable{}, err
+	}
 	cmapTable := CmapTable{
-		Version:         uint16(buf[tableInfo.Offset+0])<<8 | uint16(buf[tableInfo.Offset+1]),
-		NumberSubtables: uint16(buf[tableInfo.Offset+2])<<8 | uint16(buf[tableInfo.Offset+3]),
+		Version:         binary.BigEndian.Uint16(data[0:]),
+		NumberSubtables: binary.BigEndian.Uint16(data[2:]),
+	}
+	if err := checkRange("cmap", data, 4, 8*uint64(cmapTable.NumberSubtables)); err != nil {
+		return CmapTable{}, err
 	}
 	// read encoding subtables
 	cmapTable.EncodingSubtables = make([]CmapSubTable, cmapTable.NumberSubtables)
-	for j := uint32(0); j < uint32(cmapTable.NumberSubtables); j++ {
+	for j := range cmapTable.EncodingSubtables {
+		record := data[4+8*j:]
 		encodingSubtable := CmapSubTable{
-			PlatformID: uint16(buf[int(tableInfo.Offset+uint32(4)+j*uint32(8))])<<8 | uint16(buf[tableInfo.Offset+5+j*8]),
-			EncodingID: uint16(buf[tableInfo.Offset+6+j*8])<<8 | uint16(buf[tableInfo.Offset+7+j*8]),
-			SubOffset:  uint32(buf[tableInfo.Offset+8+j*8])<<24 | uint32(buf[tableInfo.Offset+9+j*8])<<16 | uint32(buf[tableInfo.Offset+10+j*8])<<8 | uint32(buf[tableInfo.Offset+11+j*8]),
-		}
-		// read subtable
-		encodingSubtable.Format = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+0])<<8 | uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+1])
-		encodingSubtable.Length = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+2])<<8 | uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+3])
-		encodingSubtable.Language = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+4])<<8 | uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+5])
+			PlatformID: binary.BigEndian.Uint16(record[0:]),
+			EncodingID: binary.BigEndian.Uint16(record[2:]),
+			SubOffset:  binary.BigEndian.Uint32(record[4:]),
+		}
+		if err := readCmapSubtable(data, &encodingSubtable); err != nil {
+			return CmapTable{}, err
+		}
+		// append encoding subtable
+		cmapTable.EncodingSubtables[j] = encodingSubtable
+	}
+	return cmapTable, nil
+}
+
+// readCmapSubtable reads the subtable at encodingSubtable.SubOffset of the
+// cmap table data.
+func readCmapSubtable(data []byte, encodingSubtable *CmapSubTable) error {
+	start := uint64(encodingSubtable.SubOffset)
+	fail := func(off uint64, reason string) error {
+		return &ParseError{Table: "cmap", Offset: int64(start + off), Reason: reason}
+	}
+	if err := checkRange("cmap", data, start, 4); err != nil {
+		return err
+	}
+	encodingSubtable.Format = binary.BigEndian.Uint16(data[start:])
+	headerSize := uint64(6)
+	switch encodingSubtable.Format {
+	case 8, 10, 12, 13:
+		headerSize = 12
+	case 14:
+		headerSize = 10
+	}
+	if err := checkRange("cmap", data, start, headerSize); err != nil {
+		return err
+	}
+	sub := data[start:]
+	switch encodingSubtable.Format {
+	case 8, 10, 12, 13:
+		// 32-bit length and language after a reserved field
+		encodingSubtable.Reserved = binary.BigEndian.Uint16(sub[2:])
+		encodingSubtable.Length = binary.BigEndian.Uint32(sub[4:])
+		encodingSubtable.Language = binary.BigEndian.Uint32(sub[8:])
+	case 14:
+		// 32-bit length, no language
+		encodingSubtable.Length = binary.BigEndian.Uint32(sub[2:])
+	default:
+		encodingSubtable.Length = uint32(binary.BigEndian.Uint16(sub[2:]))
+		encodingSubtable.Language = uint32(binary.BigEndian.Uint16(sub[4:]))
+	}
+	if uint64(encodingSubtable.Length) < headerSize {
+		return fail(2, fmt.Sprintf("format %d subtable length %d is shorter than its header", encodingSubtable.Format, encodingSubtable.Length))
+	}
+	if err := checkRange("cmap", data, start, uint64(encodingSubtable.Length)); err != nil {
+		return err
+	}
+	// everything below reads inside the subtable
+	sub = sub[:encodingSubtable.Length]
+	need := func(n uint64) error {
+		if n > uint64(len(sub)) {
+			return fail(0, fmt.Sprintf("format %d subtable needs %d bytes, its length is %d", encodingSubtable.Format, n, len(sub)))
+		}
+		return nil
+	}
+	switch encodingSubtable.Format {
+	case 8, 10, 12, 13, 14:
+	default:
 		// read glyph index array
-		encodingSubtable.GlyphIndexArray = make([]uint8, int(encodingSubtable.Length-6))
-		for k := 0; k < int(encodingSubtable.Length-6); k++ {
-			index := int(tableInfo.Offset) + int(encodingSubtable.SubOffset) + 6 + k
-			encodingSubtable.GlyphIndexArray[k] = buf[index]
-		}
-		// read subtable
-		switch encodingSubtable.Format {
-		case 2:
-			encodingSubtable.SubHeaderKeys = make([]uint16, uint32(encodingSubtable.Length)-6)
-			for k := uint32(0); k < uint32(uint32(encodingSubtable.Length)-6); k++ {
-				encodingSubtable.SubHeaderKeys[k] = uint16(buf[int(tableInfo.Offset+encodingSubtable.SubOffset+6+k)])
-			}
-			// read subHeaders
-			encodingSubtable.SubHeaders = make([]CmapSubHeader, uint32(encodingSubtable.Length)-6)
-			for k := uint32(0); k < uint32(uint32(encodingSubtable.Length)-6); k++ {
-				encodingSubtable.SubHeaders[k].FirstCode = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+6+k])
-				encodingSubtable.SubHeaders[k].EntryCount = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+6+k])
-				encodingSubtable.SubHeaders[k].IdDelta = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+6+k])
-				encodingSubtable.SubHeaders[k].IdRangeOffset = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+6+k])
-			}
-			// read glyph index array
-			encodingSubtable.GlyphIndexArray16 = make([]uint16, uint32(encodingSubtable.Length)-6)
-			for k := uint32(0); k < uint32(uint32(encodingSubtable.Length)-6); k++ {
-				encodingSubtable.GlyphIndexArray16[k] = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+6+k])
-			}
-		case 4:
-			encodingSubtable.SegCountX2 = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+6])<<8 | uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+7])
-			encodingSubtable.SearchRange = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+8])<<8 | uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+9])
-			encodingSubtable.EntrySelector = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+10])<<8 | uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+11])
-			encodingSubtable.RangeShift = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+12])<<8 | uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+13])
-			// read end code
-			encodingSubtable.EndCode = make([]uint16, uint32(encodingSubtable.SegCountX2)/2)
-			for k := uint32(0); k < uint32(uint32(encodingSubtable.SegCountX2)/2); k++ {
-				encodingSubtable.EndCode[k] = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+14+k*2])<<8 | uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+15+k*2])
+		encodingSubtable.GlyphIndexArray = append([]uint8{}, sub[6:]...)
+	}
+	// read subtable
+	switch encodingSubtable.Format {
+	case 2:
+		// subHeaderKeys are the subHeader index times 8; subHeader 0 maps single bytes
+		if err := need(518); err != nil {
+			return err
+		}
+		encodingSubtable.SubHeaderKeys = make([]uint16, 256)
+		numSubHeaders := 0
+		for k := range encodingSubtable.SubHeaderKeys {
+			encodingSubtable.SubHeaderKeys[k] = binary.BigEndian.Uint16(sub[6+2*k:])
+			numSubHeaders = max(numSubHeaders, int(encodingSubtable.SubHeaderKeys[k])/8+1)
+		}
+		if err := need(518 + 8*uint64(numSubHeaders)); err != nil {
+			return err
+		}
+		encodingSubtable.SubHeaders = make([]CmapSubHeader, numSubHeaders)
+		for k := range encodingSubtable.SubHeaders {
+			header := sub[518+8*k:]
+			encodingSubtable.SubHeaders[k] = CmapSubHeader{
+				FirstCode:     binary.BigEndian.Uint16(header[0:]),
+				EntryCount:    binary.BigEndian.Uint16(header[2:]),
+				IdDelta:       binary.BigEndian.Uint16(header[4:]),
+				IdRangeOffset: binary.BigEndian.Uint16(header[6:]),
 			}
-			encodingSubtable.ReservedPad = uint16(buf[int(tableInfo.Offset+encodingSubtable.SubOffset+14+uint32(uint32(encodingSubtable.SegCountX2)/2*2))])<<8 | uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+15+uint32(encodingSubtable.SegCountX2)/2*2])
-			// read start code
-			encodingSubtable.StartCode = make([]uint16, uint32(encodingSubtable.SegCountX2)/2)
-			for k := uint32(0); k < uint32(uint32(encodingSubtable.SegCountX2)/2); k++ {
-				encodingSubtable.StartCode[k] = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+16+uint32(uint32(encodingSubtable.SegCountX2)/2*2)+k*2])<<8 | uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+17+uint32(encodingSubtable.SegCountX2)/2*2+k*2])
+		}
+		// the glyph index array fills the rest of the subtable
+		glyphs := sub[518+8*numSubHeaders:]
+		encodingSubtable.GlyphIndexArray16 = make([]uint16, len(glyphs)/2)
+		for k := range encodingSubtable.GlyphIndexArray16 {
+			encodingSubtable.GlyphIndexArray16[k] = binary.BigEndian.Uint16(glyphs[2*k:])
+		}
+	case 4:
+		if err := need(14); err != nil {
+			return err
+		}
+		encodingSubtable.SegCountX2 = binary.BigEndian.Uint16(sub[6:])
+		encodingSubtable.SearchRange = binary.BigEndian.Uint16(sub[8:])
+		encodingSubtable.EntrySelector = binary.BigEndian.Uint16(sub[10:])
+		encodingSubtable.RangeShift = binary.BigEndian.Uint16(sub[12:])
+		segCount := int(encodingSubtable.SegCountX2) / 2
+		if err := need(16 + 8*uint64(segCount)); err != nil {
+			return err
+		}
+		segments := func(pos int) []uint16 {
+			values := make([]uint16, segCount)
+			for k := range values {
+				values[k] = binary.BigEndian.Uint16(sub[pos+2*k:])
 			}
-			// read id delta
-			encodingSubtable.IdDelta = make([]uint16, uint32(encodingSubtable.SegCountX2)/2)
-			for k := uint32(0); k < uint32(uint32(encodingSubtable.SegCountX2)/2); k++ {
-				encodingSubtable.IdDelta[k] = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+16+uint32(uint32(encodingSubtable.SegCountX2)/2*4)+k*2])<<8 | uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+17+uint32(encodingSubtable.SegCountX2)/2*4+k*2])
+			return values
+		}
+		// endCode, reservedPad, startCode, idDelta and idRangeOffset
+		encodingSubtable.EndCode = segments(14)
+		encodingSubtable.ReservedPad = binary.BigEndian.Uint16(sub[14+2*segCount:])
+		encodingSubtable.StartCode = segments(16 + 2*segCount)
+		encodingSubtable.IdDelta = segments(16 + 4*segCount)
+		encodingSubtable.IdRangeOffset = segments(16 + 6*segCount)
+	case 6:
+		if err := need(10); err != nil {
+			return err
+		}
+		encodingSubtable.FirstCode = binary.BigEndian.Uint16(sub[6:])
+		encodingSubtable.EntryCount = binary.BigEndian.Uint16(sub[8:])
+	case 8:
+		// is32 is a bit array over the high 16 bits of 32-bit character codes
+		if err := need(16 + 8192); err != nil {
+			return err
+		}
+		encodingSubtable.Is32 = append([]uint8(nil), sub[12:12+8192]...)
+		encodingSubtable.NGroups = binary.BigEndian.Uint32(sub[12+8192:])
+		if err := need(16 + 8192 + 12*uint64(encodingSubtable.NGroups)); err != nil {
+			return err
+		}
+		encodingSubtable.Groups = readCmapGroups(sub[16+8192:], encodingSubtable.NGroups)
+	case 10:
+		if err := need(20); err != nil {
+			return err
+		}
+		encodingSubtable.StartCharCode = binary.BigEndian.Uint32(sub[12:])
+		encodingSubtable.NumChars = binary.BigEndian.Uint32(sub[16:])
+		if err := need(20 + 2*uint64(encodingSubtable.NumChars)); err != nil {
+			return err
+		}
+		encodingSubtable.GlyphIndexArray16 = make([]uint16, encodingSubtable.NumChars)
+		for k := range encodingSubtable.GlyphIndexArray16 {
+			encodingSubtable.GlyphIndexArray16[k] = binary.BigEndian.Uint16(sub[20+2*k:])
+		}
+	case 12, 13:
+		if err := need(16); err != nil {
+			return err
+		}
+		encodingSubtable.NGroups = binary.BigEndian.Uint32(sub[12:])
+		if err := need(16 + 12*uint64(encodingSubtable.NGroups)); err != nil {
+			return err
+		}
+		encodingSubtable.Groups = readCmapGroups(sub[16:], encodingSubtable.NGroups)
+	case 14:
+		if err := need(10); err != nil {
+			return err
+		}
+		encodingSubtable.NumVarSelectorRecords = binary.BigEndian.Uint32(sub[6:])
+		if err := need(10 + 11*uint64(encodingSubtable.NumVarSelectorRecords)); err != nil {
+			return err
+		}
+		var err error
+		if encodingSubtable.VarSelectors, err = readCmapVarSelectors(sub, encodingSubtable.NumVarSelectorRecords); err != nil {
+			return fail(0, err.Error())
+		}
+	}
+	return nil
+}
+
+// readCmapGroups reads the sequential (format 8, 12) or constant (format 13)
+// map groups of a cmap subtable.
+func readCmapGroups(data []byte, nGroups uint32) []CmapSubTableFormatMixGroup {
+	groups := make([]CmapSubTableFormatMixGroup, nGroups)
+	for k := range groups {
+		group := data[12*k:]
+		groups[k] = CmapSubTableFormatMixGroup{
+			StartCharCode:  binary.BigEndian.Uint32(group[0:]),
+			EndCharCode:    binary.BigEndian.Uint32(group[4:]),
+			StartGlyphCode: binary.BigEndian.Uint32(group[8:]),
+		}
+	}
+	return groups
+}
+
+// readCmapVarSelectors reads the variation selector records of the format 14
+// subtable sub; the UVS table offsets are relative to sub.
+func readCmapVarSelectors(sub []byte, numRecords uint32) ([]CmapVariationSelector, error) {
+	uint24 := func(b []byte) uint32 { return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]) }
+	// uvsTable returns the entries of the UVS table at offset
+	uvsTable := func(offset uint32, entrySize uint64) ([]byte, uint32, error) {
+		if uint64(offset)+4 > uint64(len(sub)) {
+			return nil, 0, fmt.Errorf("UVS table offset %d out of range", offset)
+		}
+		count := binary.BigEndian.Uint32(sub[offset:])
+		if uint64(offset)+4+entrySize*uint64(count) > uint64(len(sub)) {
+			return nil, 0, fmt.Errorf("UVS table at %d with %d entries is truncated", offset, count)
+		}
+		return sub[offset+4:], count, nil
+	}
+	selectors := make([]CmapVariationSelector, numRecords)
+	for k := range selectors {
+		record := sub[10+11*k:]
+		selectors[k].VarSelector = uint24(record)
+		if offset := binary.BigEndian.Uint32(record[3:]); offset != 0 {
+			table, count, err := uvsTable(offset, 4)
+			if err != nil {
+				return nil, err
 			}
-			// read id range offset
-			encodingSubtable.IdRangeOffset = make([]uint16, uint32(encodingSubtable.SegCountX2)/2)
-			for k := uint32(0); k < uint32(uint32(encodingSubtable.SegCountX2)/2); k++ {
-				encodingSubtable.IdRangeOffset[k] = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+16+uint32(uint32(encodingSubtable.SegCountX2)/2*6)+k*2])<<8 | uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+17+uint32(encodingSubtable.SegCountX2)/2*6+k*2])
+			selectors[k].DefaultUVS = make([]CmapUnicodeRange, count)
+			for i := range selectors[k].DefaultUVS {
+				selectors[k].DefaultUVS[i] = CmapUnicodeRange{
+					StartUnicodeValue: uint24(table[4*i:]),
+					AdditionalCount:   table[4*i+3],
+				}
 			}
-		case 6:
-			encodingSubtable.FirstCode = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+6])<<8 | uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+7])
-			encodingSubtable.EntryCount = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+8])<<8 | uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+9])
-		case 8:
-			encodingSubtable.Reserved = uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+6])<<8 | uint16(buf[tableInfo.Offset+encodingSubtable.SubOffset+7])
-			encodingSubtable.Is32 = make([]uint8, uint32(encodingSubtable.Length)-6)
-			for k := uint32(0); k < uint32(uint32(encodingSubtable.Length)-6); k++ {
-				encodingSubtable.Is32[k] = buf[tableInfo.Offset+encodingSubtable.SubOffset+8+k]
+		}
+		if offset := binary.BigEndian.Uint32(record[7:]); offset != 0 {
+			table, count, err := uvsTable(offset, 5)
+			if err != nil {
+				return nil, err
 			}
-			encodingSubtable.NGroups = uint32(buf[int(tableInfo.Offset+encodingSubtable.SubOffset+8+uint32(uint32(encodingSubtable.Length))-6)])<<24 | uint32(buf[tableInfo.Offset+encodingSubtable.SubOffset+9+uint32(encodingSubtable.Length)-6])<<16 | uint32(buf[tableInfo.Offset+encodingSubtable.SubOffset+10+uint32(encodingSubtable.Length)-6])<<8 | uint32(buf[tableInfo.Offset+encodingSubtable.SubOffset+11+uint32(encodingSubtable.Length)-6])
-			// read groups
-			encodingSubtable.Groups = make([]CmapSubTableFormatMixGroup, encodingSubtable.NGroups)
-			for k := uint32(0); k < uint32(encodingSubtable.NGroups); k++ {
-				encodingSubtable.Groups[k].StartCharCode = uint32(buf[tableInfo.Offset+encodingSubtable.SubOffset+12+uint32(encodingSubtable.Length)-6+k*12])<<24 | uint32(buf[tableInfo.Offset+encodingSubtable.SubOffset+13+uint32(encodingSubtable.Length)-6+k*12])<<16 | uint32(buf[tableInfo.Offset+encodingSubtable.SubOffset+14+uint32(encodingSubtable.Length)-6+k*12])<<8 | uint32(buf[tableInfo.Offset+encodingSubtable.SubOffset+15+uint32(encodingSubtable.Length)-6+k*12])
-				encodingSubtable.Groups[k].EndCharCode = uint32(buf[tableInfo.Offset+encodingSubtable.SubOffset+16+uint32(encodingSubtable.Length)-6+k*12])<<24 | uint32(buf[tableInfo.Offset+encodingSubtable.SubOffset+17+uint32(encodingSubtable.Length)-6+k*12])<<16 | uint32(buf[tableInfo.Offset+encodingSubtable.SubOffset+18+uint32(encodingSubtable.Length)-6+k*12])<<8 | uint32(buf[tableInfo.Offset+encodingSubtable.SubOffset+19+uint32(encodingSubtable.Length)-6+k*12])
-				encodingSubtable.Groups[k].StartGlyphCode = uint32(buf[tableInfo.Offset+encodingSubtable.SubOffset+20+uint32(encodingSubtable.Length)-6+k*12])<<24 | uint32(buf[tableInfo.Offset+encodingSubtable.SubOffset+21+uint32(encodingSubtable.Length)-6+k*12])<<16 | uint32(buf[tableInfo.Offset+encodingSubtable.SubOffset+22+uint32(encodingSubtable.Length)-6+k*12])<<8 | uint32(buf[tableInfo.Offset+encodingSubtable.SubOffset+23+uint32(encodingSubtable.Length)-6+k*12])
+			selectors[k].NonDefaultUVS = make([]CmapUVSMapping, count)
+			for i := range selectors[k].NonDefaultUVS {
+				selectors[k].NonDefaultUVS[i] = CmapUVSMapping{
+					UnicodeValue: uint24(table[5*i:]),
+					GlyphID:      binary.BigEndian.Uint16(table[5*i+3:]),
+				}
 			}
 		}
-		// append encoding subtable
-		cmapTable.EncodingSubtables[j] = encodingSubtable
 	}
-	tableInfo.Table = cmapTable
-	return tableInfo
+	return selectors, nil
 }
 
 // read head table
-func readHeadTable(buf []byte, i int) (ti TTFTableInfo) {
-	ti = TTFTableInfo{
-		Tag:      uint32(buf[12+i*16])<<24 | uint32(buf[13+i*16])<<16 | uint32(buf[14+i*16])<<8 | uint32(buf[15+i*16]),
-		CheckSum: uint32(buf[16+i*16])<<24 | uint32(buf[17+i*16])<<16 | uint32(buf[18+i*16])<<8 | uint32(buf[19+i*16]),
-		Offset:   uint32(buf[20+i*16])<<24 | uint32(buf[21+i*16])<<16 | uint32(buf[22+i*16])<<8 | uint32(buf[23+i*16]),
-		Length:   uint32(buf[24+i*16])<<24 | uint32(buf[25+i*16])<<16 | uint32(buf[26+i*16])<<8 | uint32(buf[27+i*16]),
-
-		Table: HeadTable{
-			Version:            uint32(buf[ti.Offset+0])<<24 | uint32(buf[ti.Offset+1])<<16 | uint32(buf[ti.Offset+2])<<8 | uint32(buf[ti.Offset+3]),
-			FontRevision:       uint32(buf[ti.Offset+4])<<24 | uint32(buf[ti.Offset+5])<<16 | uint32(buf[ti.Offset+6])<<8 | uint32(buf[ti.Offset+7]),
-			CheckSumAdjustment: uint32(buf[ti.Offset+8])<<24 | uint32(buf[ti.Offset+9])<<16 | uint32(buf[ti.Offset+10])<<8 | uint32(buf[ti.Offset+11]),
-			MagicNumber:        uint32(buf[ti.Offset+12])<<24 | uint32(buf[ti.Offset+13])<<16 | uint32(buf[ti.Offset+14])<<8 | uint32(buf[ti.Offset+15]),
-			Flags:              uint16(buf[ti.Offset+16])<<8 | uint16(buf[ti.Offset+17]),
-			UnitPerEm:          uint16(buf[ti.Offset+18])<<8 | uint16(buf[ti.Offset+19]),
-			Created:            uint64(buf[ti.Offset+20])<<56 | uint64(buf[ti.Offset+21])<<48 | uint64(buf[ti.Offset+22])<<40 | uint64(buf[ti.Offset+23])<<32 | uint64(buf[ti.Offset+24])<<24 | uint64(buf[ti.Offset+25])<<16 | uint64(buf[ti.Offset+26])<<8 | uint64(buf[ti.Offset+27]),
-			Modified:           uint64(buf[ti.Offset+28])<<56 | uint64(buf[ti.Offset+29])<<48 | uint64(buf[ti.Offset+30])<<40 | uint64(buf[ti.Offset+31])<<32 | uint64(buf[ti.Offset+32])<<24 | uint64(buf[ti.Offset+33])<<16 | uint64(buf[ti.Offset+34])<<8 | uint64(buf[ti.Offset+35]),
-			XMin:               int16(buf[ti.Offset+36])<<8 | int16(buf[ti.Offset+37]),
-			YMin:               int16(buf[ti.Offset+38])<<8 | int16(buf[ti.Offset+39]),
-			XMax:               int16(buf[ti.Offset+40])<<8 | int16(buf[ti.Offset+41]),
-			YMax:               int16(buf[ti.Offset+42])<<8 | int16(buf[ti.Offset+43]),
-			MacStyle:           uint16(buf[ti.Offset+44])<<8 | uint16(buf[ti.Offset+45]),
-			LowestRecPPEM:      uint16(buf[ti.Offset+46])<<8 | uint16(buf[ti.Offset+47]),
-			FontDirectionHint:  int16(buf[ti.Offset+48])<<8 | int16(buf[ti.Offset+49]),
-			IndexToLocFormat:   int16(buf[ti.Offset+50])<<8 | int16(buf[ti.Offset+51]),
-			GlyphDataFormat:    int16(buf[ti.Offset+52])<<8 | int16(buf[ti.Offset+53]),
-		},
-	}
-	return ti
+func readHeadTable(data []byte) (TTFTable, error) {
+	if err := checkRange("head", data, 0, 54); err != nil {
+		return nil, err
+	}
+	return HeadTable{
+		Version:            uint32(data[0])<<24 | uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3]),
+		FontRevision:       uint32(data[4])<<24 | uint32(data[5])<<16 | uint32(data[6])<<8 | uint32(data[7]),
+		CheckSumAdjustment: uint32(data[8])<<24 | uint32(data[9])<<16 | uint32(data[10])<<8 | uint32(data[11]),
+		MagicNumber:        uint32(data[12])<<24 | uint32(data[13])<<16 | uint32(data[14])<<8 | uint32(data[15]),
+		Flags:              uint16(data[16])<<8 | uint16(data[17]),
+		UnitPerEm:          uint16(data[18])<<8 | uint16(data[19]),
+		Created:            uint64(data[20])<<56 | uint64(data[21])<<48 | uint64(data[22])<<40 | uint64(data[23])<<32 | uint64(data[24])<<24 | uint64(data[25])<<16 | uint64(data[26])<<8 | uint64(data[27]),
+		Modified:           uint64(data[28])<<56 | uint64(data[29])<<48 | uint64(data[30])<<40 | uint64(data[31])<<32 | uint64(data[32])<<24 | uint64(data[33])<<16 | uint64(data[34])<<8 | uint64(data[35]),
+		XMin:               int16(data[36])<<8 | int16(data[37]),
+		YMin:               int16(data[38])<<8 | int16(data[39]),
+		XMax:               int16(data[40])<<8 | int16(data[41]),
+		YMax:               int16(data[42])<<8 | int16(data[43]),
+		MacStyle:           uint16(data[44])<<8 | uint16(data[45]),
+		LowestRecPPEM:      uint16(data[46])<<8 | uint16(data[47]),
+		FontDirectionHint:  int16(data[48])<<8 | int16(data[49]),
+		IndexToLocFormat:   int16(data[50])<<8 | int16(data[51]),
+		GlyphDataFormat:    int16(data[52])<<8 | int16(data[53]),
+	}, nil
 }
 
+// readTTFTables reads the table directory. Tables are decoded on first use
+// by the accessors such as Cmap and Head.
 func (ttf *TTF) readTTFTables(buf []byte) error {
+	ttf.Tables = make([]TTFTableInfo, 0, ttf.NumTables)
 	for i := 0; i < int(ttf.NumTables); i++ {
-		tag := string([]byte{buf[12+i*16], buf[13+i*16], buf[14+i*16], buf[15+i*16]})
-		switch tag {
-		case "cmap":
-			tableInfo := readCmapTable(buf, i)
-			ttf.Tables = append(ttf.Tables, tableInfo)
-			break
-		case "head":
-			tableInfo := readHeadTable(buf, i)
-			ttf.Tables = append(ttf.Tables, tableInfo)
-			break
+		// table offsets are relative to buf, even for collection members
+		ti := readTableInfo(buf[ttf.offset:], i)
+		data, err := tableData(buf, ti)
+		if err != nil {
+			return err
 		}
+		ti.Data = data
+		ttf.Tables = append(ttf.Tables, ti)
 	}
 	return nil
 }
 
-func NewTTF(fileName string) (*TTF, error) {
-	ttf := &TTF{
-		File:   fileName,
-		Tables: make([]TTFTableInfo, 0),
+// readTableInfo reads the i-th table directory entry.
+func readTableInfo(buf []byte, i int) TTFTableInfo {
+	rec := buf[12+i*16:]
+	return TTFTableInfo{
+		Tag:      binary.BigEndian.Uint32(rec[0:]),
+		CheckSum: binary.BigEndian.Uint32(rec[4:]),
+		Offset:   binary.BigEndian.Uint32(rec[8:]),
+		Length:   binary.BigEndian.Uint32(rec[12:]),
+	}
+}
+
+// tableData returns the bytes of the table described by ti.
+func tableData(buf []byte, ti TTFTableInfo) ([]byte, error) {
+	if uint64(ti.Offset)+uint64(ti.Length) > uint64(len(buf)) {
+		return nil, &ParseError{
+			Table:  PrintTagName(ti.Tag),
+			Reason: fmt.Sprintf("table at %d with length %d extends beyond the end of the file", ti.Offset, ti.Length),
+		}
+	}
+	return buf[ti.Offset : ti.Offset+ti.Length], nil
+}
+
+// tableInfo returns the directory entry of the table tag, or nil if the
+// font has no such table.
+func (ttf *TTF) tableInfo(tag Tag) *TTFTableInfo {
+	for i := range ttf.Tables {
+		if Tag(ttf.Tables[i].Tag) == tag {
+			return &ttf.Tables[i]
+		}
+	}
+	return nil
+}
+
+// decodeTable returns the decoded table tag. The table is decoded from its
+// Data by read on first use and cached in ttf.Tables.
+func (ttf *TTF) decodeTable(tag Tag, read func(data []byte) (TTFTable, error)) (TTFTable, error) {
+	ti := ttf.tableInfo(tag)
+	if ti == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoTable, tag)
+	}
+	if ti.Table == nil {
+		table, err := read(ti.Data)
+		if err != nil {
+			return nil, err
+		}
+		ti.Table = table
+	}
+	return ti.Table, nil
+}
+
+// Table returns the table tagged tag, such as "cmap", decoding it on first
+// use. Its dynamic type is that of the typed accessor of the table, such as
+// CmapTable for Cmap, or RawTable for tables without a decoder. Tags
+// shorter than 4 characters are padded with spaces.
+func (ttf *TTF) Table(tag string) (TTFTable, error) {
+	t, err := ParseTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case tagCmap:
+		_, err = ttf.Cmap()
+	case tagHead:
+		_, err = ttf.Head()
+	case tagLoca:
+		_, err = ttf.Loca()
+	case tagGlyf:
+		_, err = ttf.Glyf()
+	case tagCFF:
+		_, err = ttf.CFF()
+	case tagGDEF:
+		_, err = ttf.GDEF()
+	case tagGPOS:
+		_, err = ttf.GPOS()
+	case tagGSUB:
+		_, err = ttf.GSUB()
+	case tagMaxp:
+		_, err = ttf.Maxp()
+	case tagHhea:
+		_, err = ttf.Hhea()
+	case tagHmtx:
+		_, err = ttf.Hmtx()
+	case tagName:
+		_, err = ttf.Name()
+	case tagOS2:
+		_, err = ttf.OS2()
+	case tagPost:
+		_, err = ttf.Post()
+	case tagVhea:
+		_, err = ttf.Vhea()
+	case tagVmtx:
+		_, err = ttf.Vmtx()
+	case tagVORG:
+		_, err = ttf.Vorg()
+	default:
+		ti := ttf.tableInfo(t)
+		if ti == nil {
+			return nil, fmt.Errorf("%w: %s", ErrNoTable, t)
+		}
+		if ti.Table == nil {
+			return RawTable{tag: t, Data: ti.Data}, nil
+		}
+	}
+	if err != nil {
+		return nil, err
 	}
+	return ttf.tableInfo(t).Table, nil
+}
+
+// Cmap returns the cmap table, decoding it on first use. Glyph ids beyond
+// maxp.numGlyphs are reported as a *ParseError.
+func (ttf *TTF) Cmap() (CmapTable, error) {
+	table, err := ttf.decodeTable(tagCmap, func(data []byte) (TTFTable, error) {
+		cmap, err := readCmapTable(data)
+		if err != nil {
+			return nil, err
+		}
+		numGlyphs, err := ttf.glyphLimit()
+		if err != nil {
+			return nil, err
+		}
+		// encoding records may share a subtable
+		checked := make(map[uint32]bool)
+		for _, sub := range cmap.EncodingSubtables {
+			if checked[sub.SubOffset] {
+				continue
+			}
+			checked[sub.SubOffset] = true
+			if err := sub.checkGlyphs(numGlyphs); err != nil {
+				return nil, &ParseError{Table: "cmap", Offset: int64(sub.SubOffset), Reason: err.Error()}
+			}
+		}
+		return cmap, nil
+	})
+	if err != nil {
+		return CmapTable{}, err
+	}
+	cmap, ok := table.(CmapTable)
+	if !ok {
+		return CmapTable{}, fmt.Errorf("cmap table holds a %T", table)
+	}
+	return cmap, nil
+}
+
+// Head returns the head table, decoding it on first use.
+func (ttf *TTF) Head() (HeadTable, error) {
+	table, err := ttf.decodeTable(tagHead, readHeadTable)
+	if err != nil {
+		return HeadTable{}, err
+	}
+	head, ok := table.(HeadTable)
+	if !ok {
+		return HeadTable{}, fmt.Errorf("head table holds a %T", table)
+	}
+	return head, nil
+}
+
+// NewTTF reads the font file fileName. TrueType and OpenType fonts are
+// accepted, as well as WOFF and WOFF2 files, which are decoded.
+func NewTTF(fileName string) (*TTF, error) {
+	ttf := &TTF{File: fileName}
 	buf, err := ttf.readTTF()
 	if err != nil {
 		return nil, err
 	}
-	// header
-	err = ttf.readTTFInfo(buf)
+	if err := ttf.parse(buf); err != nil {
+		return nil, err
+	}
+	return ttf, nil
+}
+
+// ParseTTF parses a font held in memory, in any of the formats accepted by
+// NewTTF. The TTF keeps a reference to data, which must not be modified
+// afterwards.
+func ParseTTF(data []byte) (*TTF, error) {
+	ttf := &TTF{}
+	if err := ttf.parse(data); err != nil {
+		return nil, err
+	}
+	return ttf, nil
+}
+
+// ReadTTF parses a font read from r until EOF.
+func ReadTTF(r io.Reader) (*TTF, error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
-	// tables
-	err = ttf.readTTFTables(buf)
+	return ParseTTF(data)
+}
+
+// OpenTTF parses the font file name of fsys, such as an embed.FS. File is
+// set to name.
+func OpenTTF(fsys fs.FS, name string) (*TTF, error) {
+	data, err := fs.ReadFile(fsys, name)
 	if err != nil {
 		return nil, err
 	}
+	ttf, err := ParseTTF(data)
+	if err != nil {
+		return nil, err
+	}
+	ttf.File = name
 	return ttf, nil
 }
 
-func PrintTagName(tag uint32) string {
-	return string([]byte{byte(tag >> 24), byte(tag >> 16), byte(tag >> 8), byte(tag)})
+// parse decodes web fonts to plain sfnt data, then reads the offset table
+// and the tables of buf.
+func (ttf *TTF) parse(buf []byte) (err error) {
+	ttf.Tables = make([]TTFTableInfo, 0)
+	// web fonts are decoded to plain sfnt data
+	if len(buf) >= 4 {
+		switch binary.BigEndian.Uint32(buf) {
+		case WOFF_MAGIC:
+			buf, err = decodeWOFF(buf)
+		case WOFF2_MAGIC:
+			buf, err = decodeWOFF2(buf)
+		case TTC_MAGIC:
+			return errors.New("font is a collection, use NewCollection")
+		}
+		if err != nil {
+			return parseError("", err)
+		}
+	}
+	ttf.buf = buf
+	// header
+	if err := ttf.readTTFInfo(buf); err != nil {
+		return err
+	}
+	// tables
+	return ttf.readTTFTables(buf)
+}
+
+// rawTable returns the bytes of the table with the given tag, or nil if the
+// font has no such table.
+func (ttf *TTF) rawTable(tag string) []byte {
+	for _, ti := range ttf.Tables {
+		if PrintTagName(ti.Tag) == tag {
+			return ti.Data
+		}
+	}
+	return nil
+}
+
+// rawTables returns the bytes of every table of the font, keyed by tag.
+func (ttf *TTF) rawTables() map[string][]byte {
+	tables := make(map[string][]byte, len(ttf.Tables))
+	for _, ti := range ttf.Tables {
+		tables[PrintTagName(ti.Tag)] = ti.Data
+	}
+	return tables
 }
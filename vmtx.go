@@ -0,0 +1,379 @@
+package fontcompress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	// vhea version 1.0
+	VHEA_VERSION_1_0 uint32 = 0x00010000
+	// vhea version 1.1, which names the typographic ascender, descender and
+	// line gap fields
+	VHEA_VERSION_1_1 uint32 = 0x00011000
+)
+
+/*
+*
+Version16Dot16	version	Version number of the vertical header table; 0x00010000 for version 1.0, 0x00011000 for version 1.1.
+FWORD	vertTypoAscender	The vertical typographic ascender for this font (ascent in version 1.0).
+FWORD	vertTypoDescender	The vertical typographic descender for this font (descent in version 1.0).
+FWORD	vertTypoLineGap	The vertical typographic line gap for this font (lineGap in version 1.0).
+UFWORD	advanceHeightMax	The maximum advance height measurement found in the font.
+FWORD	minTopSideBearing	The minimum top side bearing measurement found in the font.
+FWORD	minBottomSideBearing	The minimum bottom side bearing measurement found in the font.
+FWORD	yMaxExtent	This is defined as the value of the minTopSideBearing field added to the result of the value of the yMin field subtracted from the value of the yMax field.
+int16	caretSlopeRise	The value of the caretSlopeRise field divided by the value of the caretSlopeRun field determines the slope of the caret.
+int16	caretSlopeRun	See the caretSlopeRise field. Value = 1 for nonslanted vertical fonts.
+int16	caretOffset	The amount by which the highlight on a slanted glyph needs to be shifted away from the glyph in order to produce the best appearance. Set value equal to 0 for nonslanted fonts.
+int16	reserved	Set to 0.
+int16	reserved	Set to 0.
+int16	reserved	Set to 0.
+int16	reserved	Set to 0.
+int16	metricDataFormat	Set to 0.
+uint16	numOfLongVerMetrics	Number of advance heights in the vertical metrics table.
+*/
+type VheaTable struct {
+	Version              uint32   // VHEA_VERSION_1_0 or VHEA_VERSION_1_1
+	VertTypoAscender     int16    // vertical typographic ascender
+	VertTypoDescender    int16    // vertical typographic descender
+	VertTypoLineGap      int16    // vertical typographic line gap
+	AdvanceHeightMax     uint16   // maximum advance height value in vmtx
+	MinTopSideBearing    int16    // minimum top side bearing of the glyphs with contours
+	MinBottomSideBearing int16    // minimum of ah - (tsb + yMax - yMin) for the glyphs with contours
+	YMaxExtent           int16    // maximum of tsb + (yMax - yMin)
+	CaretSlopeRise       int16    // used to calculate the slope of the caret (rise/run); 0 for nonslanted vertical fonts
+	CaretSlopeRun        int16    // 1 for nonslanted vertical fonts
+	CaretOffset          int16    // shift of a slanted highlight; 0 for nonslanted fonts
+	Reserved             [4]int16 // set to 0
+	MetricDataFormat     int16    // 0 for current format
+	NumOfLongVerMetrics  uint16   // number of vMetric entries in vmtx
+}
+
+/*
+*
+uint16	advanceHeight	The advance height of the glyph. Unsigned integer in font design units.
+int16	topSideBearing	The top sidebearing of the glyph. Signed integer in font design units.
+*/
+type LongVerMetric struct {
+	AdvanceHeight  uint16 // advance height, in font design units
+	TopSideBearing int16  // glyph top side bearing, in font design units
+}
+
+// vmtx — vertical metrics
+//
+// Glyphs past the long metrics only have a top side bearing and share the
+// advance height of the last long metric.
+type VmtxTable struct {
+	VMetrics        []LongVerMetric // vhea.numOfLongVerMetrics entries
+	TopSideBearings []int16         // top side bearings of the remaining glyphs
+}
+
+/*
+*
+uint16	majorVersion	Major version (starting at 1). Set to 1.
+uint16	minorVersion	Minor version (starting at 0). Set to 0.
+int16	defaultVertOriginY	The y coordinate of a glyph’s vertical origin, in the font’s design coordinate system, to be used if no entry is present for the glyph in the vertOriginYMetrics array.
+uint16	numVertOriginYMetrics	Number of elements in the vertOriginYMetrics array.
+VertOriginYMetrics	vertOriginYMetrics[numVertOriginYMetrics]	Array of VertOriginYMetrics records, sorted by glyph ID.
+*/
+// VORG — vertical origin, for fonts with CFF outlines
+type VorgTable struct {
+	MajorVersion       uint16              // set to 1
+	MinorVersion       uint16              // set to 0
+	DefaultVertOriginY int16               // vertical origin of the glyphs without a record
+	VertOriginYMetrics []VertOriginYMetric // sorted by glyph id
+}
+
+/*
+*
+uint16	glyphIndex	Glyph index.
+int16	vertOriginY	Y coordinate, in the font’s design coordinate system, of the glyph’s vertical origin.
+*/
+type VertOriginYMetric struct {
+	GlyphIndex  uint16 // glyph index
+	VertOriginY int16  // y coordinate of the glyph's vertical origin
+}
+
+func (VheaTable) Tag() Tag { return tagVhea }
+
+func (VmtxTable) Tag() Tag { return tagVmtx }
+
+func (VorgTable) Tag() Tag { return tagVORG }
+
+// read vhea table
+func readVheaTable(data []byte) (TTFTable, error) {
+	if err := checkRange("vhea", data, 0, 36); err != nil {
+		return nil, err
+	}
+	int16At := func(off int) int16 { return int16(binary.BigEndian.Uint16(data[off:])) }
+	vhea := VheaTable{
+		Version:              binary.BigEndian.Uint32(data[0:]),
+		VertTypoAscender:     int16At(4),
+		VertTypoDescender:    int16At(6),
+		VertTypoLineGap:      int16At(8),
+		AdvanceHeightMax:     binary.BigEndian.Uint16(data[10:]),
+		MinTopSideBearing:    int16At(12),
+		MinBottomSideBearing: int16At(14),
+		YMaxExtent:           int16At(16),
+		CaretSlopeRise:       int16At(18),
+		CaretSlopeRun:        int16At(20),
+		CaretOffset:          int16At(22),
+		Reserved:             [4]int16{int16At(24), int16At(26), int16At(28), int16At(30)},
+		MetricDataFormat:     int16At(32),
+		NumOfLongVerMetrics:  binary.BigEndian.Uint16(data[34:]),
+	}
+	if vhea.Version != VHEA_VERSION_1_0 && vhea.Version != VHEA_VERSION_1_1 {
+		return nil, &ParseError{Table: "vhea", Reason: fmt.Sprintf("unsupported version %#08x", vhea.Version)}
+	}
+	return vhea, nil
+}
+
+// encode serializes the vhea table.
+func (vhea VheaTable) encode() ([]byte, error) {
+	buf := binary.BigEndian.AppendUint32(make([]byte, 0, 36), vhea.Version)
+	for _, v := range []int16{
+		vhea.VertTypoAscender, vhea.VertTypoDescender, vhea.VertTypoLineGap, int16(vhea.AdvanceHeightMax),
+		vhea.MinTopSideBearing, vhea.MinBottomSideBearing, vhea.YMaxExtent,
+		vhea.CaretSlopeRise, vhea.CaretSlopeRun, vhea.CaretOffset,
+		vhea.Reserved[0], vhea.Reserved[1], vhea.Reserved[2], vhea.Reserved[3],
+		vhea.MetricDataFormat, int16(vhea.NumOfLongVerMetrics),
+	} {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(v))
+	}
+	return buf, nil
+}
+
+// read vmtx table; numGlyphs is maxp.numGlyphs, or -1 without a maxp table
+// to take every top side bearing the table holds.
+func readVmtxTable(data []byte, numOfLongVerMetrics uint16, numGlyphs int) (VmtxTable, error) {
+	n := int(numOfLongVerMetrics)
+	numBearings, err := metricsLayout("vmtx", "vhea", data, n, numGlyphs)
+	if err != nil {
+		return VmtxTable{}, err
+	}
+	vmtx := VmtxTable{
+		VMetrics:        make([]LongVerMetric, n),
+		TopSideBearings: make([]int16, numBearings),
+	}
+	for i := range vmtx.VMetrics {
+		vmtx.VMetrics[i] = LongVerMetric{
+			AdvanceHeight:  binary.BigEndian.Uint16(data[4*i:]),
+			TopSideBearing: int16(binary.BigEndian.Uint16(data[4*i+2:])),
+		}
+	}
+	for i := range vmtx.TopSideBearings {
+		vmtx.TopSideBearings[i] = int16(binary.BigEndian.Uint16(data[4*n+2*i:]))
+	}
+	return vmtx, nil
+}
+
+// encode serializes the vmtx table. vhea.numOfLongVerMetrics must match the
+// number of long metrics; (*TTF).Bytes updates it.
+func (vmtx VmtxTable) encode() ([]byte, error) {
+	buf := make([]byte, 0, 4*len(vmtx.VMetrics)+2*len(vmtx.TopSideBearings))
+	for _, m := range vmtx.VMetrics {
+		buf = binary.BigEndian.AppendUint16(buf, m.AdvanceHeight)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(m.TopSideBearing))
+	}
+	for _, tsb := range vmtx.TopSideBearings {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(tsb))
+	}
+	return buf, nil
+}
+
+// NumGlyphs returns the number of glyphs with metrics.
+func (vmtx VmtxTable) NumGlyphs() int {
+	return len(vmtx.VMetrics) + len(vmtx.TopSideBearings)
+}
+
+// Metric returns the advance height and top side bearing of glyph gid,
+// zero if the glyph has no metrics.
+func (vmtx VmtxTable) Metric(gid uint16) LongVerMetric {
+	n := len(vmtx.VMetrics)
+	switch {
+	case int(gid) < n:
+		return vmtx.VMetrics[gid]
+	case int(gid) < vmtx.NumGlyphs() && n > 0:
+		return LongVerMetric{AdvanceHeight: vmtx.VMetrics[n-1].AdvanceHeight, TopSideBearing: vmtx.TopSideBearings[int(gid)-n]}
+	}
+	return LongVerMetric{}
+}
+
+// subset returns the metrics of the glyphs of order, in that order. Long
+// metrics stop after the last change of advance height.
+func (vmtx VmtxTable) subset(order []uint16) VmtxTable {
+	metrics := make([]LongVerMetric, len(order))
+	for i, gid := range order {
+		metrics[i] = vmtx.Metric(gid)
+	}
+	n := len(metrics)
+	for n > 1 && metrics[n-1].AdvanceHeight == metrics[n-2].AdvanceHeight {
+		n--
+	}
+	sub := VmtxTable{VMetrics: metrics[:n], TopSideBearings: make([]int16, len(metrics)-n)}
+	for i, m := range metrics[n:] {
+		sub.TopSideBearings[i] = m.TopSideBearing
+	}
+	return sub
+}
+
+// read VORG table
+func readVorgTable(data []byte) (TTFTable, error) {
+	if err := checkRange("VORG", data, 0, 8); err != nil {
+		return nil, err
+	}
+	vorg := VorgTable{
+		MajorVersion:       binary.BigEndian.Uint16(data[0:]),
+		MinorVersion:       binary.BigEndian.Uint16(data[2:]),
+		DefaultVertOriginY: int16(binary.BigEndian.Uint16(data[4:])),
+	}
+	if vorg.MajorVersion != 1 {
+		return nil, &ParseError{Table: "VORG", Reason: fmt.Sprintf("unsupported version %d.%d", vorg.MajorVersion, vorg.MinorVersion)}
+	}
+	n := int(binary.BigEndian.Uint16(data[6:]))
+	if err := checkRange("VORG", data, 8, 4*uint64(n)); err != nil {
+		return nil, err
+	}
+	vorg.VertOriginYMetrics = make([]VertOriginYMetric, n)
+	for i := range vorg.VertOriginYMetrics {
+		rec := data[8+4*i:]
+		vorg.VertOriginYMetrics[i] = VertOriginYMetric{
+			GlyphIndex:  binary.BigEndian.Uint16(rec[0:]),
+			VertOriginY: int16(binary.BigEndian.Uint16(rec[2:])),
+		}
+		if i > 0 && vorg.VertOriginYMetrics[i].GlyphIndex <= vorg.VertOriginYMetrics[i-1].GlyphIndex {
+			return nil, &ParseError{Table: "VORG", Offset: int64(8 + 4*i), Reason: "records are not sorted by glyph id"}
+		}
+	}
+	return vorg, nil
+}
+
+// encode serializes the VORG table.
+func (vorg VorgTable) encode() ([]byte, error) {
+	if len(vorg.VertOriginYMetrics) > 0xFFFF {
+		return nil, fmt.Errorf("VORG table has %d records", len(vorg.VertOriginYMetrics))
+	}
+	buf := make([]byte, 0, 8+4*len(vorg.VertOriginYMetrics))
+	buf = binary.BigEndian.AppendUint16(buf, vorg.MajorVersion)
+	buf = binary.BigEndian.AppendUint16(buf, vorg.MinorVersion)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(vorg.DefaultVertOriginY))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(vorg.VertOriginYMetrics)))
+	for _, m := range vorg.VertOriginYMetrics {
+		buf = binary.BigEndian.AppendUint16(buf, m.GlyphIndex)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(m.VertOriginY))
+	}
+	return buf, nil
+}
+
+// OriginY returns the y coordinate of the vertical origin of glyph gid.
+func (vorg VorgTable) OriginY(gid uint16) int16 {
+	records := vorg.VertOriginYMetrics
+	i := sort.Search(len(records), func(i int) bool { return records[i].GlyphIndex >= gid })
+	if i < len(records) && records[i].GlyphIndex == gid {
+		return records[i].VertOriginY
+	}
+	return vorg.DefaultVertOriginY
+}
+
+// subset keeps the records of the glyphs of newID, renumbered.
+func (vorg VorgTable) subset(newID map[uint16]uint16) VorgTable {
+	sub := vorg
+	sub.VertOriginYMetrics = nil
+	for _, m := range vorg.VertOriginYMetrics {
+		if gid, ok := newID[m.GlyphIndex]; ok {
+			sub.VertOriginYMetrics = append(sub.VertOriginYMetrics, VertOriginYMetric{GlyphIndex: gid, VertOriginY: m.VertOriginY})
+		}
+	}
+	sort.Slice(sub.VertOriginYMetrics, func(i, j int) bool {
+		return sub.VertOriginYMetrics[i].GlyphIndex < sub.VertOriginYMetrics[j].GlyphIndex
+	})
+	return sub
+}
+
+// Vhea returns the vhea table, decoding it on first use.
+func (ttf *TTF) Vhea() (VheaTable, error) {
+	table, err := ttf.decodeTable(tagVhea, readVheaTable)
+	if err != nil {
+		return VheaTable{}, err
+	}
+	vhea, ok := table.(VheaTable)
+	if !ok {
+		return VheaTable{}, fmt.Errorf("vhea table holds a %T", table)
+	}
+	return vhea, nil
+}
+
+// Vmtx returns the vmtx table, decoding it and vhea on first use. It holds
+// metrics for the maxp.numGlyphs glyphs.
+func (ttf *TTF) Vmtx() (VmtxTable, error) {
+	table, err := ttf.decodeTable(tagVmtx, func(data []byte) (TTFTable, error) {
+		vhea, err := ttf.Vhea()
+		if err != nil {
+			return nil, err
+		}
+		numGlyphs, err := ttf.NumGlyphs()
+		if errors.Is(err, ErrNoTable) {
+			numGlyphs = -1
+		} else if err != nil {
+			return nil, err
+		}
+		vmtx, err := readVmtxTable(data, vhea.NumOfLongVerMetrics, numGlyphs)
+		if err != nil {
+			return nil, err
+		}
+		return vmtx, nil
+	})
+	if err != nil {
+		return VmtxTable{}, err
+	}
+	vmtx, ok := table.(VmtxTable)
+	if !ok {
+		return VmtxTable{}, fmt.Errorf("vmtx table holds a %T", table)
+	}
+	return vmtx, nil
+}
+
+// Vorg returns the VORG table, decoding it on first use. Glyph ids beyond
+// maxp.numGlyphs are reported as a *ParseError.
+func (ttf *TTF) Vorg() (VorgTable, error) {
+	table, err := ttf.decodeTable(tagVORG, func(data []byte) (TTFTable, error) {
+		table, err := readVorgTable(data)
+		if err != nil {
+			return nil, err
+		}
+		numGlyphs, err := ttf.glyphLimit()
+		if err != nil {
+			return nil, err
+		}
+		records := table.(VorgTable).VertOriginYMetrics
+		if n := len(records); n > 0 && int(records[n-1].GlyphIndex) >= numGlyphs {
+			return nil, &ParseError{Table: "VORG", Offset: int64(8 + 4*(n-1)), Reason: fmt.Sprintf("glyph %d is beyond the %d glyphs of the font", records[n-1].GlyphIndex, numGlyphs)}
+		}
+		return table, nil
+	})
+	if err != nil {
+		return VorgTable{}, err
+	}
+	vorg, ok := table.(VorgTable)
+	if !ok {
+		return VorgTable{}, fmt.Errorf("VORG table holds a %T", table)
+	}
+	return vorg, nil
+}
+
+// VerticalMetric returns the advance height and top side bearing of glyph
+// gid in font units, such as a glyph found by (*CmapTable).Lookup. Fonts
+// without vertical metrics report ErrNoTable.
+func (ttf *TTF) VerticalMetric(gid uint16) (LongVerMetric, error) {
+	vmtx, err := ttf.Vmtx()
+	if err != nil {
+		return LongVerMetric{}, err
+	}
+	if int(gid) >= vmtx.NumGlyphs() {
+		return LongVerMetric{}, fmt.Errorf("glyph %d is out of range, the font has %d glyphs", gid, vmtx.NumGlyphs())
+	}
+	return vmtx.Metric(gid), nil
+}
@@ -0,0 +1,145 @@
+package fontcompress_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+// fixtureVAdvances are the advance heights of the fixture glyphs; the
+// remaining glyphs share the final long metric.
+var fixtureVAdvances = []uint16{1000, 1100, 1000}
+
+// fixtureVerticalTables adds vhea and vmtx to tables, with the glyph tops
+// hanging from a vertical ascender of 900, and VORG if it has CFF outlines.
+func fixtureVerticalTables(tables map[string][]byte) map[string][]byte {
+	vhea := binary.BigEndian.AppendUint32(nil, font_compress.VHEA_VERSION_1_1)
+	vhea = appendInt16(vhea, 500, -500, 0, 1100, 0, 100, 900, 0, 1, 0, 0, 0, 0, 0, 0)
+	vhea = binary.BigEndian.AppendUint16(vhea, uint16(len(fixtureVAdvances)))
+	var vmtx []byte
+	for gid, g := range fixtureGlyphs {
+		_, _, _, yMax := glyphBounds(g)
+		if gid < len(fixtureVAdvances) {
+			vmtx = binary.BigEndian.AppendUint16(vmtx, fixtureVAdvances[gid])
+		}
+		vmtx = appendInt16(vmtx, 900-yMax)
+	}
+	tables["vhea"], tables["vmtx"] = vhea, vmtx
+	if tables["CFF "] != nil {
+		// dieresis and U+20000 have their own vertical origin
+		tables["VORG"] = appendInt16(nil, 1, 0, 900, 2, 3, 950, 6, 880)
+	}
+	return tables
+}
+
+func TestReadVmtxTable(t *testing.T) {
+	ttf := readFont(t, assembleFont(font_compress.TTF_MAGIC, fixtureVerticalTables(fixtureTables())))
+	vhea, err := ttf.Vhea()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := font_compress.VheaTable{
+		Version:              font_compress.VHEA_VERSION_1_1,
+		VertTypoAscender:     500,
+		VertTypoDescender:    -500,
+		AdvanceHeightMax:     1100,
+		MinBottomSideBearing: 100,
+		YMaxExtent:           900,
+		CaretSlopeRun:        1,
+		NumOfLongVerMetrics:  uint16(len(fixtureVAdvances)),
+	}
+	if vhea != want {
+		t.Errorf("vhea = %+v, want %+v", vhea, want)
+	}
+	for gid, g := range fixtureGlyphs {
+		advance := fixtureVAdvances[min(gid, len(fixtureVAdvances)-1)]
+		_, _, _, yMax := glyphBounds(g)
+		m, err := ttf.VerticalMetric(uint16(gid))
+		if err != nil || m.AdvanceHeight != advance || m.TopSideBearing != 900-yMax {
+			t.Errorf("glyph %d vertical metric = %+v, %v, want advance %d and tsb %d", gid, m, err, advance, 900-yMax)
+		}
+	}
+	if _, err := ttf.VerticalMetric(uint16(len(fixtureGlyphs))); err == nil {
+		t.Error("VerticalMetric of a glyph out of range succeeded")
+	}
+	if _, err := readFont(t, fixtureFont()).VerticalMetric(1); !errors.Is(err, font_compress.ErrNoTable) {
+		t.Errorf("VerticalMetric of a font without vmtx: %v, want ErrNoTable", err)
+	}
+
+	cff := assembleFont(font_compress.OTF_MAGIC, fixtureVerticalTables(fixtureCFFTables(false)))
+	vorg, err := readFont(t, cff).Vorg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for gid, y := range map[uint16]int16{0: 900, 3: 950, 5: 900, 6: 880} {
+		if got := vorg.OriginY(gid); got != y {
+			t.Errorf("vertical origin of glyph %d = %d, want %d", gid, got, y)
+		}
+	}
+
+	// vhea.numOfLongVerMetrics follows a changed vmtx table
+	vmtx, err := ttf.Vmtx()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vmtx.VMetrics, vmtx.TopSideBearings = vmtx.VMetrics[:1], append([]int16{vmtx.VMetrics[1].TopSideBearing, vmtx.VMetrics[2].TopSideBearing}, vmtx.TopSideBearings...)
+	replaceTable(ttf, vmtx)
+	font, err := ttf.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reread := readFont(t, font)
+	if vhea, err := reread.Vhea(); err != nil || vhea.NumOfLongVerMetrics != 1 {
+		t.Errorf("vhea.NumOfLongVerMetrics = %d, %v, want 1", vhea.NumOfLongVerMetrics, err)
+	}
+	if m, err := reread.VerticalMetric(1); err != nil || m.AdvanceHeight != 1000 {
+		t.Errorf("vertical metric of glyph 1 = %+v, %v, want advance 1000", m, err)
+	}
+}
+
+func TestSubsetVerticalMetrics(t *testing.T) {
+	for _, tt := range []struct {
+		runes string
+		want  font_compress.VheaTable
+	}{
+		// .notdef and B share one advance height
+		{"B", font_compress.VheaTable{AdvanceHeightMax: 1000, MinTopSideBearing: 200, MinBottomSideBearing: 100, YMaxExtent: 900, NumOfLongVerMetrics: 1}},
+		// .notdef, A, dieresis and Adieresis
+		{"Ä", font_compress.VheaTable{AdvanceHeightMax: 1100, MinBottomSideBearing: 100, YMaxExtent: 900, NumOfLongVerMetrics: 3}},
+	} {
+		font := assembleFont(font_compress.TTF_MAGIC, fixtureVerticalTables(fixtureTables()))
+		out, err := font_compress.Subset(readFont(t, font), []rune(tt.runes))
+		if err != nil {
+			t.Fatal(err)
+		}
+		vhea, err := readFont(t, out).Vhea()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.want.Version, tt.want.VertTypoAscender, tt.want.VertTypoDescender, tt.want.CaretSlopeRun = font_compress.VHEA_VERSION_1_1, 500, -500, 1
+		if vhea != tt.want {
+			t.Errorf("vhea of the %q subset = %+v, want %+v", tt.runes, vhea, tt.want)
+		}
+	}
+
+	// CFF fonts keep the vertical origins of the retained glyphs
+	cff := assembleFont(font_compress.OTF_MAGIC, fixtureVerticalTables(fixtureCFFTables(false)))
+	out, err := font_compress.Subset(readFont(t, cff), []rune{'A', 0x20000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := readFont(t, out)
+	vorg, err := sub.Vorg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []font_compress.VertOriginYMetric{{GlyphIndex: 2, VertOriginY: 880}}
+	if len(vorg.VertOriginYMetrics) != 1 || vorg.VertOriginYMetrics[0] != want[0] || vorg.DefaultVertOriginY != 900 {
+		t.Errorf("VORG of the subset = %+v, want records %+v", vorg, want)
+	}
+	if m, err := sub.VerticalMetric(2); err != nil || m.AdvanceHeight != 1000 || m.TopSideBearing != 100 {
+		t.Errorf("vertical metric of U+20000 in the subset = %+v, %v", m, err)
+	}
+}
@@ -0,0 +1,234 @@
+package fontcompress
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+const (
+	// WOFF
+	WOFF_MAGIC uint32 = 0x774F4646 // 'wOFF'
+
+	woffHeaderSize     = 44
+	woffTableEntrySize = 20
+)
+
+/*
+*
+UInt32	signature	0x774F4646 'wOFF'
+UInt32	flavor	The "sfnt version" of the input font.
+UInt32	length	Total size of the WOFF file.
+UInt16	numTables	Number of entries in directory of font tables.
+UInt16	reserved	Reserved; set to zero.
+UInt32	totalSfntSize	Total size needed for the uncompressed font data, including the sfnt header, directory, and font tables (including padding).
+UInt16	majorVersion	Major version of the WOFF file.
+UInt16	minorVersion	Minor version of the WOFF file.
+UInt32	metaOffset	Offset to metadata block, from beginning of WOFF file.
+UInt32	metaLength	Length of compressed metadata block.
+UInt32	metaOrigLength	Uncompressed size of metadata block.
+UInt32	privOffset	Offset to private data block, from beginning of WOFF file.
+UInt32	privLength	Length of private data block.
+*/
+type woffHeader struct {
+	Signature      uint32
+	Flavor         uint32
+	Length         uint32
+	NumTables      uint16
+	Reserved       uint16
+	TotalSfntSize  uint32
+	MajorVersion   uint16
+	MinorVersion   uint16
+	MetaOffset     uint32
+	MetaLength     uint32
+	MetaOrigLength uint32
+	PrivOffset     uint32
+	PrivLength     uint32
+}
+
+/*
+*
+UInt32	tag	4-byte sfnt table identifier.
+UInt32	offset	Offset to the data, from beginning of WOFF file.
+UInt32	compLength	Length of the compressed data, excluding padding.
+UInt32	origLength	Length of the uncompressed table, excluding padding.
+UInt32	origChecksum	Checksum of the uncompressed table.
+*/
+type woffTableEntry struct {
+	Tag          Tag
+	Offset       uint32
+	CompLength   uint32
+	OrigLength   uint32
+	OrigChecksum uint32
+}
+
+// WOFF encodes the font as a WOFF 1.0 file. Each table is zlib compressed
+// unless compression does not make it smaller.
+func (ttf *TTF) WOFF() ([]byte, error) {
+	tables, err := ttf.encodeTables()
+	if err != nil {
+		return nil, err
+	}
+	return encodeWOFF(ttf.ScalerType, tables)
+}
+
+// WriteWOFF writes the font to w as a WOFF 1.0 file.
+func (ttf *TTF) WriteWOFF(w io.Writer) (int64, error) {
+	buf, err := ttf.WOFF()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// EncodeWOFF converts a TrueType or OpenType font, such as the output of
+// Subset, to WOFF 1.0.
+func EncodeWOFF(font []byte) ([]byte, error) {
+	flavor, tables, err := sfntTables(font)
+	if err != nil {
+		return nil, err
+	}
+	return encodeWOFF(flavor, tables)
+}
+
+// sfntTables splits an sfnt font into its tables, keyed by tag.
+func sfntTables(font []byte) (uint32, map[string][]byte, error) {
+	ttf := &TTF{buf: font}
+	if len(font) < 12 {
+		return 0, nil, errors.New("not a ttf or otf file")
+	}
+	if err := ttf.readTTFInfo(font); err != nil {
+		return 0, nil, err
+	}
+	if err := ttf.readTTFTables(font); err != nil {
+		return 0, nil, err
+	}
+	return ttf.ScalerType, ttf.rawTables(), nil
+}
+
+// encodeWOFF builds a WOFF file from sfnt tables keyed by tag.
+func encodeWOFF(flavor uint32, tables map[string][]byte) ([]byte, error) {
+	// lay the font out once so checksums and head.checkSumAdjustment are final
+	sfnt := buildSFNT(flavor, tables, nil)
+	numTables := int(binary.BigEndian.Uint16(sfnt[4:]))
+
+	entries := make([]woffTableEntry, numTables)
+	data := make([][]byte, numTables)
+	for i := range entries {
+		ti := readTableInfo(sfnt, i)
+		orig := sfnt[ti.Offset : ti.Offset+ti.Length]
+		entries[i] = woffTableEntry{
+			Tag:          Tag(ti.Tag),
+			CompLength:   ti.Length,
+			OrigLength:   ti.Length,
+			OrigChecksum: ti.CheckSum,
+		}
+		data[i] = orig
+		var compressed bytes.Buffer
+		zw, err := zlib.NewWriterLevel(&compressed, zlib.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := zw.Write(orig); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		if compressed.Len() < len(orig) {
+			entries[i].CompLength = uint32(compressed.Len())
+			data[i] = compressed.Bytes()
+		}
+	}
+
+	offset := woffHeaderSize + woffTableEntrySize*numTables
+	for i := range entries {
+		entries[i].Offset = uint32(offset)
+		offset += (len(data[i]) + 3) &^ 3
+	}
+	header := woffHeader{
+		Signature:     WOFF_MAGIC,
+		Flavor:        flavor,
+		Length:        uint32(offset),
+		NumTables:     uint16(numTables),
+		TotalSfntSize: uint32(len(sfnt)),
+		MajorVersion:  1,
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, offset))
+	if err := binary.Write(buf, binary.BigEndian, header); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(buf, binary.BigEndian, entries); err != nil {
+		return nil, err
+	}
+	for _, d := range data {
+		buf.Write(d)
+		buf.Write(make([]byte, (4-len(d)%4)%4))
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeWOFF decompresses a WOFF 1.0 file into an sfnt font.
+func decodeWOFF(data []byte) ([]byte, error) {
+	if len(data) < woffHeaderSize {
+		return nil, errors.New("truncated woff header")
+	}
+	header := woffHeader{}
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.Signature != WOFF_MAGIC {
+		return nil, errors.New("not a woff file")
+	}
+	if header.NumTables == 0 || int(header.Length) > len(data) ||
+		woffHeaderSize+woffTableEntrySize*int(header.NumTables) > len(data) {
+		return nil, errors.New("invalid woff header")
+	}
+	entries := make([]woffTableEntry, header.NumTables)
+	if err := binary.Read(bytes.NewReader(data[woffHeaderSize:]), binary.BigEndian, entries); err != nil {
+		return nil, err
+	}
+	// checked before decompressing, which allocates the tables
+	if header.TotalSfntSize > maxSfntSize {
+		return nil, errors.New("woff font exceeds the size limit")
+	}
+	sfntSize := uint64(12 + 16*len(entries))
+	for _, entry := range entries {
+		sfntSize += (uint64(entry.OrigLength) + 3) &^ 3
+	}
+	if sfntSize > uint64(header.TotalSfntSize) {
+		return nil, errors.New("woff tables exceed totalSfntSize")
+	}
+
+	tables := make(map[string][]byte, len(entries))
+	for _, entry := range entries {
+		tag := entry.Tag.String()
+		if _, ok := tables[tag]; ok {
+			return nil, errors.New("duplicate woff table " + tag)
+		}
+		if uint64(entry.Offset)+uint64(entry.CompLength) > uint64(len(data)) || entry.CompLength > entry.OrigLength {
+			return nil, errors.New("invalid woff table entry " + tag)
+		}
+		stored := data[entry.Offset : entry.Offset+entry.CompLength]
+		if entry.CompLength == entry.OrigLength {
+			tables[tag] = stored
+			continue
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(stored))
+		if err != nil {
+			return nil, err
+		}
+		table, err := io.ReadAll(io.LimitReader(zr, int64(entry.OrigLength)+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(table) != int(entry.OrigLength) {
+			return nil, errors.New("woff table " + tag + " does not decompress to its original length")
+		}
+		tables[tag] = table
+	}
+	return buildSFNT(header.Flavor, tables, nil), nil
+}
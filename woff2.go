@@ -0,0 +1,861 @@
+package fontcompress
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/andybalholm/brotli"
+)
+
+const (
+	// WOFF2
+	WOFF2_MAGIC uint32 = 0x774F4632 // 'wOF2'
+
+	woff2HeaderSize        = 48
+	woff2GlyfHeaderSize    = 36
+	woff2UnknownTagIndex   = 63
+	woff2NullTransform     = 0 // transform version of untransformed tables other than glyf and loca
+	woff2GlyfNullTransform = 3 // transform version of untransformed glyf and loca tables
+
+	// maxSfntSize bounds the font data a WOFF or WOFF2 file decompresses
+	// to, as in the WOFF2 reference decoder and OTS
+	maxSfntSize = 30 << 20
+)
+
+// woff2KnownTags are the tags that can be encoded in the flags byte of a
+// WOFF2 table directory entry, by index.
+var woff2KnownTags = [...]string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post",
+	"cvt ", "fpgm", "glyf", "loca", "prep", "CFF ", "VORG", "EBDT",
+	"EBLC", "gasp", "hdmx", "kern", "LTSH", "PCLT", "VDMX", "vhea",
+	"vmtx", "BASE", "GDEF", "GPOS", "GSUB", "EBSC", "JSTF", "MATH",
+	"CBDT", "CBLC", "COLR", "CPAL", "SVG ", "sbix", "acnt", "avar",
+	"bdat", "bloc", "bsln", "cvar", "fdsc", "feat", "fmtx", "fvar",
+	"gvar", "hsty", "just", "lcar", "mort", "morx", "opbd", "prop",
+	"trak", "Zapf", "Silf", "Glat", "Gloc", "Feat", "Sill",
+}
+
+/*
+*
+UInt32	signature	0x774F4632 'wOF2'
+UInt32	flavor	The "sfnt version" of the input font.
+UInt32	length	Total size of the WOFF file.
+UInt16	numTables	Number of entries in directory of font tables.
+UInt16	reserved	Reserved; set to 0.
+UInt32	totalSfntSize	Total size needed for the uncompressed font data, including the sfnt header, directory, and font tables (including padding).
+UInt32	totalCompressedSize	Total length of the compressed data block.
+UInt16	majorVersion	Major version of the WOFF file.
+UInt16	minorVersion	Minor version of the WOFF file.
+UInt32	metaOffset	Offset to metadata block, from beginning of WOFF file.
+UInt32	metaLength	Length of compressed metadata block.
+UInt32	metaOrigLength	Uncompressed size of metadata block.
+UInt32	privOffset	Offset to private data block, from beginning of WOFF file.
+UInt32	privLength	Length of private data block.
+*/
+type woff2Header struct {
+	Signature           uint32
+	Flavor              uint32
+	Length              uint32
+	NumTables           uint16
+	Reserved            uint16
+	TotalSfntSize       uint32
+	TotalCompressedSize uint32
+	MajorVersion        uint16
+	MinorVersion        uint16
+	MetaOffset          uint32
+	MetaLength          uint32
+	MetaOrigLength      uint32
+	PrivOffset          uint32
+	PrivLength          uint32
+}
+
+// woff2TableEntry is one WOFF2 table directory entry.
+type woff2TableEntry struct {
+	Tag             string
+	TransformVer    uint8
+	OrigLength      uint32
+	TransformLength uint32 // only meaningful when transformed
+}
+
+// transformed reports whether the table data is stored transformed.
+func (e woff2TableEntry) transformed() bool {
+	if e.Tag == "glyf" || e.Tag == "loca" {
+		return e.TransformVer != woff2GlyfNullTransform
+	}
+	return e.TransformVer != woff2NullTransform
+}
+
+// WOFF2 encodes the font as a WOFF2 file. The glyf and loca tables are
+// stored transformed; every table is Brotli compressed as one stream.
+func (ttf *TTF) WOFF2() ([]byte, error) {
+	tables, err := ttf.encodeTables()
+	if err != nil {
+		return nil, err
+	}
+	return encodeWOFF2(ttf.ScalerType, tables)
+}
+
+// WriteWOFF2 writes the font to w as a WOFF2 file.
+func (ttf *TTF) WriteWOFF2(w io.Writer) (int64, error) {
+	buf, err := ttf.WOFF2()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// EncodeWOFF2 converts a TrueType or OpenType font, such as the output of
+// Subset, to WOFF2.
+func EncodeWOFF2(font []byte) ([]byte, error) {
+	flavor, tables, err := sfntTables(font)
+	if err != nil {
+		return nil, err
+	}
+	return encodeWOFF2(flavor, tables)
+}
+
+// encodeWOFF2 builds a WOFF2 file from sfnt tables keyed by tag.
+func encodeWOFF2(flavor uint32, tables map[string][]byte) ([]byte, error) {
+	// lay the font out once so head.checkSumAdjustment is final
+	flavor, tables, err := sfntTables(buildSFNT(flavor, tables, nil))
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		if tag != "loca" {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	// loca must immediately follow glyf
+	if _, ok := tables["loca"]; ok {
+		i := sort.SearchStrings(tags, "glyf")
+		if i == len(tags) || tags[i] != "glyf" {
+			return nil, errors.New("loca table without glyf table")
+		}
+		tags = append(tags[:i+1], append([]string{"loca"}, tags[i+1:]...)...)
+	}
+
+	var transformedGlyf []byte
+	if _, ok := tables["glyf"]; ok {
+		if _, ok := tables["loca"]; !ok {
+			return nil, errors.New("glyf table without loca table")
+		}
+		transformedGlyf, err = transformGlyf(tables["glyf"], tables["loca"], tables["head"])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var directory, stream []byte
+	sfntSize := 12 + 16*len(tags)
+	for _, tag := range tags {
+		data := tables[tag]
+		sfntSize += (len(data) + 3) &^ 3
+		entry := woff2TableEntry{Tag: tag, OrigLength: uint32(len(data))}
+		switch tag {
+		case "glyf":
+			entry.TransformLength = uint32(len(transformedGlyf))
+			data = transformedGlyf
+		case "loca":
+			data = nil
+		}
+		directory = entry.appendTo(directory)
+		stream = append(stream, data...)
+	}
+
+	var compressed bytes.Buffer
+	bw := brotli.NewWriterLevel(&compressed, brotli.BestCompression)
+	if _, err := bw.Write(stream); err != nil {
+		return nil, err
+	}
+	if err := bw.Close(); err != nil {
+		return nil, err
+	}
+
+	length := woff2HeaderSize + len(directory) + compressed.Len()
+	length = (length + 3) &^ 3
+	buf := make([]byte, 0, length)
+	buf = binary.BigEndian.AppendUint32(buf, WOFF2_MAGIC)
+	buf = binary.BigEndian.AppendUint32(buf, flavor)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(length))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(tags)))
+	buf = binary.BigEndian.AppendUint16(buf, 0)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(sfntSize))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(compressed.Len()))
+	buf = binary.BigEndian.AppendUint16(buf, 1)
+	buf = binary.BigEndian.AppendUint16(buf, 0)
+	buf = append(buf, make([]byte, 20)...) // no metadata or private data
+	buf = append(buf, directory...)
+	buf = append(buf, compressed.Bytes()...)
+	return append(buf, make([]byte, length-len(buf))...), nil
+}
+
+// appendTo appends the encoded directory entry to buf. glyf and loca are
+// always stored with the glyf transform, other tables untransformed.
+func (e woff2TableEntry) appendTo(buf []byte) []byte {
+	flags := uint8(woff2UnknownTagIndex)
+	for i, tag := range woff2KnownTags {
+		if tag == e.Tag {
+			flags = uint8(i)
+			break
+		}
+	}
+	buf = append(buf, flags) // transform version 0
+	if flags == woff2UnknownTagIndex {
+		buf = append(buf, e.Tag...)
+	}
+	buf = appendUIntBase128(buf, e.OrigLength)
+	if e.Tag == "glyf" || e.Tag == "loca" {
+		buf = appendUIntBase128(buf, e.TransformLength)
+	}
+	return buf
+}
+
+// decodeWOFF2 decompresses a WOFF2 file into an sfnt font.
+func decodeWOFF2(data []byte) ([]byte, error) {
+	if len(data) < woff2HeaderSize {
+		return nil, errors.New("truncated woff2 header")
+	}
+	header := woff2Header{}
+	if err := binary.Read(bytes.NewReader(data), binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+	if header.Signature != WOFF2_MAGIC {
+		return nil, errors.New("not a woff2 file")
+	}
+	if header.Flavor == 0x74746366 { // 'ttcf'
+		return nil, errors.New("woff2 font collections are not supported")
+	}
+	if header.NumTables == 0 || int(header.Length) > len(data) {
+		return nil, errors.New("invalid woff2 header")
+	}
+	if header.TotalSfntSize > maxSfntSize {
+		return nil, errors.New("woff2 font exceeds the size limit")
+	}
+
+	pos := woff2HeaderSize
+	entries := make([]woff2TableEntry, header.NumTables)
+	streamSize, sfntSize := uint64(0), uint64(12+16*int(header.NumTables))
+	for i := range entries {
+		if pos >= len(data) {
+			return nil, errors.New("truncated woff2 table directory")
+		}
+		flags := data[pos]
+		pos++
+		entry := &entries[i]
+		entry.TransformVer = flags >> 6
+		if index := flags & 0x3F; index == woff2UnknownTagIndex {
+			if pos+4 > len(data) {
+				return nil, errors.New("truncated woff2 table directory")
+			}
+			entry.Tag = string(data[pos : pos+4])
+			pos += 4
+		} else if int(index) < len(woff2KnownTags) {
+			entry.Tag = woff2KnownTags[index]
+		} else {
+			return nil, errors.New("invalid woff2 table tag index")
+		}
+		var err error
+		if entry.OrigLength, pos, err = readUIntBase128(data, pos); err != nil {
+			return nil, err
+		}
+		entry.TransformLength = entry.OrigLength
+		if entry.transformed() {
+			if entry.TransformLength, pos, err = readUIntBase128(data, pos); err != nil {
+				return nil, err
+			}
+		}
+		if entry.Tag == "loca" && entry.transformed() && entry.TransformLength != 0 {
+			return nil, errors.New("woff2 loca table must have an empty transform")
+		}
+		streamSize += uint64(entry.TransformLength)
+		sfntSize += (uint64(entry.OrigLength) + 3) &^ 3
+	}
+	// checked before decompressing, which allocates the stream
+	if sfntSize > uint64(header.TotalSfntSize) {
+		return nil, errors.New("woff2 tables exceed totalSfntSize")
+	}
+	if streamSize > maxSfntSize {
+		return nil, errors.New("woff2 table data exceeds the size limit")
+	}
+
+	if uint64(pos)+uint64(header.TotalCompressedSize) > uint64(len(data)) {
+		return nil, errors.New("truncated woff2 compressed data")
+	}
+	br := brotli.NewReader(bytes.NewReader(data[pos : pos+int(header.TotalCompressedSize)]))
+	stream, err := io.ReadAll(io.LimitReader(br, int64(streamSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(stream)) != streamSize {
+		return nil, errors.New("woff2 decompressed size does not match the table directory")
+	}
+
+	tables := make(map[string][]byte, len(entries))
+	var glyfEntry, hmtxEntry *woff2TableEntry
+	for i := range entries {
+		entry := &entries[i]
+		if _, ok := tables[entry.Tag]; ok {
+			return nil, errors.New("duplicate woff2 table " + entry.Tag)
+		}
+		tables[entry.Tag] = stream[:entry.TransformLength]
+		stream = stream[entry.TransformLength:]
+		switch {
+		case !entry.transformed():
+		case entry.Tag == "glyf":
+			glyfEntry = entry
+		case entry.Tag == "hmtx":
+			hmtxEntry = entry
+		case entry.Tag != "loca":
+			return nil, errors.New("unknown woff2 transform of table " + entry.Tag)
+		}
+	}
+
+	var xMins []int16
+	if glyfEntry != nil {
+		if _, ok := tables["loca"]; !ok {
+			return nil, errors.New("transformed woff2 glyf table without loca table")
+		}
+		glyf, loca, indexFormat, mins, err := reconstructGlyf(tables["glyf"])
+		if err != nil {
+			return nil, err
+		}
+		tables["glyf"], tables["loca"], xMins = glyf, loca, mins
+		if head := tables["head"]; len(head) >= 54 {
+			head = append([]byte(nil), head...)
+			binary.BigEndian.PutUint16(head[50:], indexFormat)
+			tables["head"] = head
+		}
+	}
+	if hmtxEntry != nil {
+		if xMins == nil {
+			return nil, errors.New("transformed woff2 hmtx table requires a transformed glyf table")
+		}
+		hmtx, err := reconstructHmtx(tables["hmtx"], tables["hhea"], xMins)
+		if err != nil {
+			return nil, err
+		}
+		tables["hmtx"] = hmtx
+	}
+	return buildSFNT(header.Flavor, tables, nil), nil
+}
+
+// transformGlyf applies the WOFF2 glyf transform to the glyf and loca tables.
+func transformGlyf(glyf, loca, head []byte) ([]byte, error) {
+	if len(head) < 54 {
+		return nil, errors.New("missing or truncated head table")
+	}
+	indexFormat := int16(binary.BigEndian.Uint16(head[50:]))
+	locaTable, err := readLocaTable(loca, indexFormat)
+	if err != nil {
+		return nil, err
+	}
+	numGlyphs := locaTable.NumGlyphs()
+	if len(locaTable.Offsets) == 0 || numGlyphs > 0xFFFF || locaTable.Offsets[numGlyphs] > uint32(len(glyf)) {
+		return nil, errors.New("loca table does not match the glyf table")
+	}
+
+	var nContours, nPoints, flags, glyphs, composites, bboxes, instructions []byte
+	bboxBitmap := make([]byte, 4*((numGlyphs+31)/32))
+	overlapBitmap := make([]byte, (numGlyphs+7)/8)
+	hasOverlap := false
+	for gid := 0; gid < numGlyphs; gid++ {
+		data := glyf[locaTable.Offsets[gid]:locaTable.Offsets[gid+1]]
+		g, err := readGlyph(data)
+		if err != nil {
+			return nil, err
+		}
+		nContours = binary.BigEndian.AppendUint16(nContours, uint16(g.NumberOfContours))
+		explicitBBox := false
+		switch {
+		case len(data) == 0 || g.NumberOfContours == 0:
+			// rebuilt as an empty glyph
+			continue
+		case g.IsComposite():
+			refs, end, err := compositeComponents(data)
+			if err != nil {
+				return nil, err
+			}
+			composites = append(composites, data[10:end]...)
+			// the length follows whenever a component announces
+			// instructions, even if there are none
+			var flags uint16
+			for _, ref := range refs {
+				flags |= binary.BigEndian.Uint16(data[ref-2:])
+			}
+			if flags&glyfWeHaveInstructions != 0 {
+				glyphs = append255UInt16(glyphs, uint16(len(g.Instructions)))
+				instructions = append(instructions, g.Instructions...)
+			}
+			explicitBBox = true
+		default:
+			start := 0
+			for _, end := range g.EndPtsOfContours {
+				nPoints = append255UInt16(nPoints, end+1-uint16(start))
+				start = int(end) + 1
+			}
+			var x, y int16
+			for _, p := range g.Points {
+				var flag uint8
+				flag, glyphs = appendTriplet(glyphs, p.OnCurve, int(p.X)-int(x), int(p.Y)-int(y))
+				flags = append(flags, flag)
+				x, y = p.X, p.Y
+			}
+			glyphs = append255UInt16(glyphs, uint16(len(g.Instructions)))
+			instructions = append(instructions, g.Instructions...)
+			if len(g.Flags) > 0 && g.Flags[0]&glyfOverlapSimple != 0 {
+				overlapBitmap[gid>>3] |= 0x80 >> (gid & 7)
+				hasOverlap = true
+			}
+			xMin, yMin, xMax, yMax := pointBounds(g.Points)
+			explicitBBox = g.XMin != xMin || g.YMin != yMin || g.XMax != xMax || g.YMax != yMax
+		}
+		if explicitBBox {
+			bboxBitmap[gid>>3] |= 0x80 >> (gid & 7)
+			for _, v := range []int16{g.XMin, g.YMin, g.XMax, g.YMax} {
+				bboxes = binary.BigEndian.AppendUint16(bboxes, uint16(v))
+			}
+		}
+	}
+	bboxes = append(bboxBitmap, bboxes...)
+
+	var optionFlags uint16
+	if hasOverlap {
+		optionFlags |= 1
+	}
+	buf := make([]byte, 0, woff2GlyfHeaderSize+len(nContours)+len(nPoints)+len(flags)+len(glyphs)+len(composites)+len(bboxes)+len(instructions))
+	buf = binary.BigEndian.AppendUint16(buf, 0)
+	buf = binary.BigEndian.AppendUint16(buf, optionFlags)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(numGlyphs))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(indexFormat))
+	streams := [][]byte{nContours, nPoints, flags, glyphs, composites, bboxes, instructions}
+	for _, stream := range streams {
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(stream)))
+	}
+	for _, stream := range streams {
+		buf = append(buf, stream...)
+	}
+	if hasOverlap {
+		buf = append(buf, overlapBitmap...)
+	}
+	return buf, nil
+}
+
+// reconstructGlyf rebuilds the glyf and loca tables from a transformed WOFF2
+// glyf table. It also returns the loca format and each glyph's xMin, which
+// the hmtx transform needs.
+func reconstructGlyf(data []byte) (glyf, loca []byte, indexFormat uint16, xMins []int16, err error) {
+	if len(data) < woff2GlyfHeaderSize {
+		return nil, nil, 0, nil, errors.New("truncated woff2 glyf header")
+	}
+	optionFlags := binary.BigEndian.Uint16(data[2:])
+	numGlyphs := int(binary.BigEndian.Uint16(data[4:]))
+	indexFormat = binary.BigEndian.Uint16(data[6:])
+	streams := make([][]byte, 7)
+	pos := woff2GlyfHeaderSize
+	for i := range streams {
+		size := int(binary.BigEndian.Uint32(data[8+4*i:]))
+		if size < 0 || size > len(data)-pos {
+			return nil, nil, 0, nil, errors.New("truncated woff2 glyf stream")
+		}
+		streams[i] = data[pos : pos+size]
+		pos += size
+	}
+	nContours := &woff2Stream{data: streams[0]}
+	nPoints := &woff2Stream{data: streams[1]}
+	flags := &woff2Stream{data: streams[2]}
+	glyphs := &woff2Stream{data: streams[3]}
+	composites := &woff2Stream{data: streams[4]}
+	bboxes := &woff2Stream{data: streams[5]}
+	instructions := &woff2Stream{data: streams[6]}
+	bboxBitmap, err := bboxes.bytes(4 * ((numGlyphs + 31) / 32))
+	if err != nil {
+		return nil, nil, 0, nil, err
+	}
+	var overlapBitmap []byte
+	if optionFlags&1 != 0 {
+		if pos+(numGlyphs+7)/8 > len(data) {
+			return nil, nil, 0, nil, errors.New("truncated woff2 overlap bitmap")
+		}
+		overlapBitmap = data[pos : pos+(numGlyphs+7)/8]
+	}
+
+	offsets := make([]uint32, 0, numGlyphs+1)
+	xMins = make([]int16, numGlyphs)
+	for gid := 0; gid < numGlyphs; gid++ {
+		offsets = append(offsets, uint32(len(glyf)))
+		n, err := nContours.uint16()
+		if err != nil {
+			return nil, nil, 0, nil, err
+		}
+		numberOfContours := int16(n)
+		hasBBox := bboxBitmap[gid>>3]&(0x80>>(gid&7)) != 0
+		g := Glyph{NumberOfContours: numberOfContours}
+		if hasBBox {
+			for _, v := range []*int16{&g.XMin, &g.YMin, &g.XMax, &g.YMax} {
+				u, err := bboxes.uint16()
+				if err != nil {
+					return nil, nil, 0, nil, err
+				}
+				*v = int16(u)
+			}
+		}
+
+		switch {
+		case numberOfContours == 0:
+			if hasBBox {
+				return nil, nil, 0, nil, errors.New("woff2 empty glyph with a bounding box")
+			}
+		case numberOfContours < 0:
+			if !hasBBox {
+				return nil, nil, 0, nil, errors.New("woff2 composite glyph without a bounding box")
+			}
+			start := composites.pos
+			more := true
+			haveInstructions := false
+			for more {
+				flags, err := composites.uint16()
+				if err != nil {
+					return nil, nil, 0, nil, err
+				}
+				size := 4
+				if flags&glyfArg1And2AreWords != 0 {
+					size = 6
+				}
+				switch {
+				case flags&glyfWeHaveAScale != 0:
+					size += 2
+				case flags&glyfWeHaveAnXAndYScale != 0:
+					size += 4
+				case flags&glyfWeHaveATwoByTwo != 0:
+					size += 8
+				}
+				if _, err := composites.bytes(size); err != nil {
+					return nil, nil, 0, nil, err
+				}
+				more = flags&glyfMoreComponents != 0
+				haveInstructions = haveInstructions || flags&glyfWeHaveInstructions != 0
+			}
+			glyf = g.appendHeader(glyf)
+			glyf = append(glyf, composites.data[start:composites.pos]...)
+			if haveInstructions {
+				n, err := glyphs.read255UInt16()
+				if err != nil {
+					return nil, nil, 0, nil, err
+				}
+				code, err := instructions.bytes(int(n))
+				if err != nil {
+					return nil, nil, 0, nil, err
+				}
+				glyf = binary.BigEndian.AppendUint16(glyf, n)
+				glyf = append(glyf, code...)
+			}
+		default:
+			g.EndPtsOfContours = make([]uint16, numberOfContours)
+			total := 0
+			for i := range g.EndPtsOfContours {
+				n, err := nPoints.read255UInt16()
+				if err != nil {
+					return nil, nil, 0, nil, err
+				}
+				total += int(n)
+				if total > 0xFFFF+1 {
+					return nil, nil, 0, nil, errors.New("too many points in woff2 glyph")
+				}
+				g.EndPtsOfContours[i] = uint16(total - 1)
+			}
+			pointFlags, err := flags.bytes(total)
+			if err != nil {
+				return nil, nil, 0, nil, err
+			}
+			g.Points = make([]GlyphPoint, total)
+			var x, y int
+			for i, flag := range pointFlags {
+				dx, dy, err := glyphs.readTriplet(flag)
+				if err != nil {
+					return nil, nil, 0, nil, err
+				}
+				x, y = x+dx, y+dy
+				g.Points[i] = GlyphPoint{X: int16(x), Y: int16(y), OnCurve: flag&0x80 == 0}
+			}
+			n, err := glyphs.read255UInt16()
+			if err != nil {
+				return nil, nil, 0, nil, err
+			}
+			if g.Instructions, err = instructions.bytes(int(n)); err != nil {
+				return nil, nil, 0, nil, err
+			}
+			if overlapBitmap != nil && overlapBitmap[gid>>3]&(0x80>>(gid&7)) != 0 && total > 0 {
+				g.Flags = []uint8{glyfOverlapSimple}
+			}
+			if !hasBBox {
+				g.XMin, g.YMin, g.XMax, g.YMax = pointBounds(g.Points)
+			}
+			glyf = g.appendTo(glyf)
+		}
+		xMins[gid] = g.XMin
+		// keep the glyph addressable by short loca offsets
+		if len(glyf)%2 != 0 {
+			glyf = append(glyf, 0)
+		}
+	}
+	offsets = append(offsets, uint32(len(glyf)))
+	if indexFormat == 0 && len(glyf) > 2*0xFFFF {
+		return nil, nil, 0, nil, errors.New("woff2 glyf table too large for short loca offsets")
+	}
+	return glyf, LocaTable{Offsets: offsets}.encode(int16(indexFormat)), indexFormat, xMins, nil
+}
+
+// reconstructHmtx rebuilds an hmtx table stored with the WOFF2 hmtx
+// transform, taking omitted left side bearings from the glyph xMins.
+func reconstructHmtx(data, hhea []byte, xMins []int16) ([]byte, error) {
+	if len(hhea) < 36 || len(data) < 1 {
+		return nil, errors.New("invalid woff2 hmtx transform")
+	}
+	numGlyphs := len(xMins)
+	numberOfHMetrics := int(binary.BigEndian.Uint16(hhea[34:]))
+	if numberOfHMetrics < 1 || numberOfHMetrics > numGlyphs {
+		return nil, errors.New("invalid hhea numberOfHMetrics")
+	}
+	flags := data[0]
+	s := &woff2Stream{data: data, pos: 1}
+	advances := make([]uint16, numberOfHMetrics)
+	for i := range advances {
+		v, err := s.uint16()
+		if err != nil {
+			return nil, err
+		}
+		advances[i] = v
+	}
+	lsbs := make([]int16, numGlyphs)
+	for i := range lsbs {
+		proportional := i < numberOfHMetrics
+		if (proportional && flags&1 != 0) || (!proportional && flags&2 != 0) {
+			lsbs[i] = xMins[i]
+			continue
+		}
+		v, err := s.uint16()
+		if err != nil {
+			return nil, err
+		}
+		lsbs[i] = int16(v)
+	}
+	buf := make([]byte, 0, 4*numberOfHMetrics+2*(numGlyphs-numberOfHMetrics))
+	for i := range lsbs {
+		if i < numberOfHMetrics {
+			buf = binary.BigEndian.AppendUint16(buf, advances[i])
+		}
+		buf = binary.BigEndian.AppendUint16(buf, uint16(lsbs[i]))
+	}
+	return buf, nil
+}
+
+// pointBounds returns the bounding box of points, all zero if empty.
+func pointBounds(points []GlyphPoint) (xMin, yMin, xMax, yMax int16) {
+	if len(points) == 0 {
+		return 0, 0, 0, 0
+	}
+	xMin, yMin, xMax, yMax = points[0].X, points[0].Y, points[0].X, points[0].Y
+	for _, p := range points[1:] {
+		xMin, yMin = min(xMin, p.X), min(yMin, p.Y)
+		xMax, yMax = max(xMax, p.X), max(yMax, p.Y)
+	}
+	return xMin, yMin, xMax, yMax
+}
+
+// woff2Stream reads consecutive values from one of the WOFF2 glyf streams.
+type woff2Stream struct {
+	data []byte
+	pos  int
+}
+
+var errWOFF2Stream = errors.New("truncated woff2 glyf stream")
+
+func (s *woff2Stream) bytes(n int) ([]byte, error) {
+	if n < 0 || n > len(s.data)-s.pos {
+		return nil, errWOFF2Stream
+	}
+	b := s.data[s.pos : s.pos+n]
+	s.pos += n
+	return b, nil
+}
+
+func (s *woff2Stream) uint16() (uint16, error) {
+	b, err := s.bytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b), nil
+}
+
+// read255UInt16 reads a 255UInt16 variable-length value.
+func (s *woff2Stream) read255UInt16() (uint16, error) {
+	b, err := s.bytes(1)
+	if err != nil {
+		return 0, err
+	}
+	switch b[0] {
+	case 253:
+		return s.uint16()
+	case 254, 255:
+		next, err := s.bytes(1)
+		if err != nil {
+			return 0, err
+		}
+		if b[0] == 255 {
+			return uint16(next[0]) + 253, nil
+		}
+		return uint16(next[0]) + 506, nil
+	}
+	return uint16(b[0]), nil
+}
+
+// readTriplet decodes the coordinate deltas of one point whose triplet
+// flag is flag.
+func (s *woff2Stream) readTriplet(flag uint8) (dx, dy int, err error) {
+	flag &= 0x7F
+	withSign := func(flag uint8, v int) int {
+		if flag&1 != 0 {
+			return v
+		}
+		return -v
+	}
+	var size int
+	switch {
+	case flag < 84:
+		size = 1
+	case flag < 120:
+		size = 2
+	case flag < 124:
+		size = 3
+	default:
+		size = 4
+	}
+	b, err := s.bytes(size)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch {
+	case flag < 10:
+		dy = withSign(flag, int(flag&14)<<7+int(b[0]))
+	case flag < 20:
+		dx = withSign(flag, int((flag-10)&14)<<7+int(b[0]))
+	case flag < 84:
+		b0 := int(flag - 20)
+		dx = withSign(flag, 1+(b0&0x30)+int(b[0]>>4))
+		dy = withSign(flag>>1, 1+(b0&0x0C)<<2+int(b[0]&0x0F))
+	case flag < 120:
+		b0 := int(flag - 84)
+		dx = withSign(flag, 1+(b0/12)<<8+int(b[0]))
+		dy = withSign(flag>>1, 1+((b0%12)>>2)<<8+int(b[1]))
+	case flag < 124:
+		dx = withSign(flag, int(b[0])<<4+int(b[1]>>4))
+		dy = withSign(flag>>1, int(b[1]&0x0F)<<8+int(b[2]))
+	default:
+		dx = withSign(flag, int(b[0])<<8+int(b[1]))
+		dy = withSign(flag>>1, int(b[2])<<8+int(b[3]))
+	}
+	return dx, dy, nil
+}
+
+// appendTriplet encodes the coordinate deltas of one point, returning the
+// triplet flag and buf with the coordinate bytes appended.
+func appendTriplet(buf []byte, onCurve bool, dx, dy int) (uint8, []byte) {
+	absX, absY := dx, dy
+	if absX < 0 {
+		absX = -absX
+	}
+	if absY < 0 {
+		absY = -absY
+	}
+	var flag uint8
+	if !onCurve {
+		flag = 0x80
+	}
+	xSign, ySign := uint8(1), uint8(1)
+	if dx < 0 {
+		xSign = 0
+	}
+	if dy < 0 {
+		ySign = 0
+	}
+	xySigns := xSign + 2*ySign
+	switch {
+	case dx == 0 && absY < 1280:
+		flag += uint8((absY&0xF00)>>7) + ySign
+		buf = append(buf, uint8(absY))
+	case dy == 0 && absX < 1280:
+		flag += 10 + uint8((absX&0xF00)>>7) + xSign
+		buf = append(buf, uint8(absX))
+	case absX < 65 && absY < 65:
+		flag += 20 + uint8((absX-1)&0x30) + uint8(((absY-1)&0x30)>>2) + xySigns
+		buf = append(buf, uint8((absX-1)&0xF)<<4|uint8((absY-1)&0xF))
+	case absX < 769 && absY < 769:
+		flag += 84 + 12*uint8(((absX-1)&0x300)>>8) + uint8(((absY-1)&0x300)>>6) + xySigns
+		buf = append(buf, uint8(absX-1), uint8(absY-1))
+	case absX < 4096 && absY < 4096:
+		flag += 120 + xySigns
+		buf = append(buf, uint8(absX>>4), uint8(absX&0xF)<<4|uint8(absY>>8), uint8(absY))
+	default:
+		flag += 124 + xySigns
+		buf = append(buf, uint8(absX>>8), uint8(absX), uint8(absY>>8), uint8(absY))
+	}
+	return flag, buf
+}
+
+// append255UInt16 appends v as a 255UInt16 variable-length value.
+func append255UInt16(buf []byte, v uint16) []byte {
+	switch {
+	case v < 253:
+		return append(buf, uint8(v))
+	case v < 506:
+		return append(buf, 255, uint8(v-253))
+	case v < 762:
+		return append(buf, 254, uint8(v-506))
+	}
+	return binary.BigEndian.AppendUint16(append(buf, 253), v)
+}
+
+// readUIntBase128 reads a UIntBase128 value at data[pos:] and returns it
+// with the position of the following byte.
+func readUIntBase128(data []byte, pos int) (uint32, int, error) {
+	var v uint32
+	for i := 0; i < 5; i++ {
+		if pos >= len(data) {
+			return 0, pos, errors.New("truncated woff2 UIntBase128")
+		}
+		b := data[pos]
+		pos++
+		// no leading zeros, no overflow
+		if (i == 0 && b == 0x80) || v&0xFE000000 != 0 {
+			return 0, pos, errors.New("invalid woff2 UIntBase128")
+		}
+		v = v<<7 | uint32(b&0x7F)
+		if b&0x80 == 0 {
+			return v, pos, nil
+		}
+	}
+	return 0, pos, errors.New("invalid woff2 UIntBase128")
+}
+
+// appendUIntBase128 appends v as a UIntBase128 value.
+func appendUIntBase128(buf []byte, v uint32) []byte {
+	n := 1
+	for x := v >> 7; x != 0; x >>= 7 {
+		n++
+	}
+	for i := n - 1; i >= 0; i-- {
+		b := uint8(v>>(7*uint(i))) & 0x7F
+		if i > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+	}
+	return buf
+}
@@ -0,0 +1,129 @@
+package fontcompress_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+func glyfTable(t *testing.T, ttf *font_compress.TTF) font_compress.GlyfTable {
+	t.Helper()
+	glyf, err := ttf.Glyf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return glyf
+}
+
+func TestWOFF2RoundTrip(t *testing.T) {
+	font := fixtureFont()
+	woff2, err := font_compress.EncodeWOFF2(font)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(woff2, []byte("wOF2\x00\x01\x00\x00")) || len(woff2)%4 != 0 {
+		t.Fatalf("unexpected woff2 header % x", woff2[:8])
+	}
+
+	want, err := font_compress.NewTTF(writeFont(t, font))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := font_compress.NewTTF(writeFont(t, woff2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ScalerType != want.ScalerType || len(got.Tables) != len(want.Tables) {
+		t.Fatalf("decoded %d tables with scaler type %#x, want %d and %#x", len(got.Tables), got.ScalerType, len(want.Tables), want.ScalerType)
+	}
+	wantGlyphs, gotGlyphs := glyfTable(t, want).Glyphs, glyfTable(t, got).Glyphs
+	for gid := range wantGlyphs {
+		w, g := wantGlyphs[gid], gotGlyphs[gid]
+		if !reflect.DeepEqual(g.Points, w.Points) || !reflect.DeepEqual(g.Components, w.Components) ||
+			g.XMin != w.XMin || g.YMin != w.YMin || g.XMax != w.XMax || g.YMax != w.YMax {
+			t.Errorf("glyph %d = %+v, want %+v", gid, g, w)
+		}
+	}
+
+	// the decoded font encodes again
+	var buf bytes.Buffer
+	if _, err := got.WriteWOFF2(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := font_compress.NewTTF(writeFont(t, buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWOFF2Corrupt(t *testing.T) {
+	woff2, err := font_compress.EncodeWOFF2(fixtureFont())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{10, 48, 60, len(woff2) - 8} {
+		if _, err := font_compress.NewTTF(writeFont(t, woff2[:n])); err == nil {
+			t.Errorf("truncated to %d bytes: no error", n)
+		}
+	}
+	// totalSfntSize is checked before the tables are decompressed
+	sfntSize := binary.BigEndian.Uint32(woff2[16:])
+	for _, size := range []uint32{sfntSize - 4, 30<<20 + 1} {
+		if _, err := font_compress.ParseTTF(patchUint32(woff2, 16, size)); err == nil {
+			t.Errorf("totalSfntSize %d instead of %d: no error", size, sfntSize)
+		}
+	}
+}
+
+func TestWOFF2CompositeInstructions(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		component    int // announcing the instructions
+		instructions []uint8
+	}{
+		{"last component, no instructions", 1, nil},
+		{"first component", 0, []uint8{0xB0, 0x01}},
+		{"first component, no instructions", 0, nil},
+	} {
+		glyph := encodeFixtureGlyph(fixtureGlyphs[4])
+		flags := 10 + 8*tt.component
+		binary.BigEndian.PutUint16(glyph[flags:], binary.BigEndian.Uint16(glyph[flags:])|0x0100) // WE_HAVE_INSTRUCTIONS
+		glyph = append(appendInt16(glyph, int16(len(tt.instructions))), tt.instructions...)
+
+		woff2, err := font_compress.EncodeWOFF2(assembleFont(font_compress.TTF_MAGIC, fixtureTablesWithGlyph(4, glyph)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ttf, err := font_compress.ParseTTF(woff2)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		g := glyfTable(t, ttf).Glyphs[4]
+		if len(g.Components) != 2 || string(g.Instructions) != string(tt.instructions) {
+			t.Errorf("%s: glyph 4 = %+v, want 2 components and instructions %x", tt.name, g, tt.instructions)
+		}
+	}
+}
+
+func TestWOFF2ZeroContours(t *testing.T) {
+	// C is a header without contours
+	tables := fixtureTablesWithGlyph(5, appendInt16(nil, 0, 0, 0, 0, 0, 0))
+	woff2, err := font_compress.EncodeWOFF2(assembleFont(font_compress.TTF_MAGIC, tables))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttf, err := font_compress.ParseTTF(woff2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	glyphs := glyfTable(t, ttf).Glyphs
+	if g := glyphs[5]; g.NumberOfContours != 0 || len(g.Points) != 0 {
+		t.Errorf("glyph 5 = %+v, want an empty glyph", g)
+	}
+	if g := glyphs[6]; len(g.Points) != len(fixtureGlyphs[6].points) {
+		t.Errorf("glyph 6 = %+v, want %d points", g, len(fixtureGlyphs[6].points))
+	}
+}
@@ -0,0 +1,81 @@
+package fontcompress_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+func TestWOFFRoundTrip(t *testing.T) {
+	font := fixtureFont()
+	woff, err := font_compress.EncodeWOFF(font)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(woff, []byte("wOFF\x00\x01\x00\x00")) || int(binary.BigEndian.Uint32(woff[8:])) != len(woff) {
+		t.Fatalf("unexpected woff header % x", woff[:12])
+	}
+	numTables := int(binary.BigEndian.Uint16(woff[12:]))
+	compressed := 0
+	for i := 0; i < numTables; i++ {
+		entry := woff[44+20*i:]
+		tag := string(entry[:4])
+		compLength, origLength := binary.BigEndian.Uint32(entry[8:]), binary.BigEndian.Uint32(entry[12:])
+		if compLength > origLength {
+			t.Errorf("table %s: compLength %d > origLength %d", tag, compLength, origLength)
+		}
+		if compLength < origLength {
+			compressed++
+		}
+		if int(origLength) != len(fontTable(font, tag)) {
+			t.Errorf("table %s: origLength %d, want %d", tag, origLength, len(fontTable(font, tag)))
+		}
+	}
+	if compressed == 0 {
+		t.Error("no table was compressed")
+	}
+
+	want, err := font_compress.NewTTF(writeFont(t, font))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := font_compress.NewTTF(writeFont(t, woff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(glyfTable(t, got), glyfTable(t, want)) {
+		t.Error("glyf table changed after a woff round trip")
+	}
+
+	var buf bytes.Buffer
+	if _, err := got.WriteWOFF(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := font_compress.NewTTF(writeFont(t, buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWOFFSfntSize(t *testing.T) {
+	woff, err := font_compress.EncodeWOFF(fixtureFont())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfntSize := binary.BigEndian.Uint32(woff[16:])
+	for _, tt := range []struct {
+		name string
+		woff []byte
+	}{
+		{"totalSfntSize too small", patchUint32(woff, 16, sfntSize-4)},
+		{"totalSfntSize over the limit", patchUint32(woff, 16, 30<<20+1)},
+		// a few compressed bytes claiming a huge table
+		{"origLength over totalSfntSize", patchUint32(woff, 44+12, 0x7FFFFFFF)},
+	} {
+		if _, err := font_compress.ParseTTF(tt.woff); err == nil {
+			t.Errorf("%s: no error", tt.name)
+		}
+	}
+}
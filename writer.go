@@ -0,0 +1,445 @@
+package fontcompress
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// tableEncoder is implemented by decoded tables that can be serialized on
+// their own. Tables whose layout depends on other tables, such as loca and
+// glyf, are encoded by (*TTF).encodeTables.
+type tableEncoder interface {
+	encode() ([]byte, error)
+}
+
+// WriteTo serializes the font to w. It implements io.WriterTo.
+func (ttf *TTF) WriteTo(w io.Writer) (int64, error) {
+	buf, err := ttf.Bytes()
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// Bytes serializes the font. Table data keeps the order it was read in, so a
+// font that was not changed is written as it was read, up to padding. The
+// offset table, the table directory entries in ttf.Tables, including Data,
+// and head.CheckSumAdjustment are updated to describe the returned data; it
+// must not be modified.
+func (ttf *TTF) Bytes() ([]byte, error) {
+	tables, err := ttf.encodeTables()
+	if err != nil {
+		return nil, err
+	}
+	buf := buildSFNT(ttf.ScalerType, tables, ttf.dataOrder())
+
+	ttf.NumTables = binary.BigEndian.Uint16(buf[4:])
+	ttf.SearchRange = binary.BigEndian.Uint16(buf[6:])
+	ttf.EntrySelector = binary.BigEndian.Uint16(buf[8:])
+	ttf.RangeShift = binary.BigEndian.Uint16(buf[10:])
+	directory := make(map[uint32]TTFTableInfo, ttf.NumTables)
+	for i := 0; i < int(ttf.NumTables); i++ {
+		ti := readTableInfo(buf, i)
+		directory[ti.Tag] = ti
+	}
+	for i, table := range ttf.Tables {
+		ti := directory[table.Tag]
+		ti.Data = buf[ti.Offset : ti.Offset+ti.Length]
+		ti.Table = table.Table
+		if head, ok := ti.Table.(HeadTable); ok {
+			head.CheckSumAdjustment = binary.BigEndian.Uint32(buf[ti.Offset+8:])
+			ti.Table = head
+		}
+		ttf.Tables[i] = ti
+	}
+	ttf.buf, ttf.offset = buf, 0
+	return buf, nil
+}
+
+// dataOrder returns the tags of the tables in the order of their data in
+// the font they were read from.
+func (ttf *TTF) dataOrder() []string {
+	tables := append([]TTFTableInfo(nil), ttf.Tables...)
+	sort.SliceStable(tables, func(i, j int) bool { return tables[i].Offset < tables[j].Offset })
+	order := make([]string, len(tables))
+	for i, table := range tables {
+		order[i] = PrintTagName(table.Tag)
+	}
+	return order
+}
+
+// asRead returns the tables of ttf as they were read, without their decoded
+// values, to tell which ones were changed.
+func (ttf *TTF) asRead() *TTF {
+	original := &TTF{ScalerType: ttf.ScalerType, Tables: make([]TTFTableInfo, len(ttf.Tables))}
+	for i, table := range ttf.Tables {
+		table.Table = nil
+		original.Tables[i] = table
+	}
+	return original
+}
+
+// changed reports whether the decoded value of table differs from the
+// decoding of the same table in ttf, as returned by asRead.
+func (ttf *TTF) changed(table TTFTableInfo) bool {
+	if table.Table == nil {
+		return false
+	}
+	decoded, err := ttf.Table(PrintTagName(table.Tag))
+	return err != nil || !reflect.DeepEqual(decoded, table.Table)
+}
+
+// encodeTables serializes every table, keyed by tag. Tables that were never
+// decoded, or that still equal the decoding of their Data, are copied from
+// Data. A changed glyf table is re-encoded first so that loca and
+// head.IndexToLocFormat match it; hhea.numberOfHMetrics and
+// vhea.numOfLongVerMetrics likewise follow changed hmtx and vmtx tables.
+func (ttf *TTF) encodeTables() (map[string][]byte, error) {
+	tables := make(map[string][]byte, len(ttf.Tables))
+	head, err := ttf.Head()
+	if err != nil {
+		return nil, err
+	}
+	original := ttf.asRead()
+	changes := make(map[uint32]bool)
+	changed := func(table TTFTableInfo) bool {
+		if c, ok := changes[table.Tag]; ok {
+			return c
+		}
+		changes[table.Tag] = original.changed(table)
+		return changes[table.Tag]
+	}
+
+	// hhea.numberOfHMetrics follows a changed hmtx table
+	if ti := ttf.tableInfo(tagHmtx); ti != nil {
+		if hmtx, ok := ti.Table.(HmtxTable); ok && changed(*ti) {
+			hhea, err := ttf.Hhea()
+			if err != nil {
+				return nil, err
+			}
+			hhea.NumberOfHMetrics = uint16(len(hmtx.HMetrics))
+			ttf.tableInfo(tagHhea).Table = hhea
+		}
+	}
+	if ti := ttf.tableInfo(tagVmtx); ti != nil {
+		if vmtx, ok := ti.Table.(VmtxTable); ok && changed(*ti) {
+			vhea, err := ttf.Vhea()
+			if err != nil {
+				return nil, err
+			}
+			vhea.NumOfLongVerMetrics = uint16(len(vmtx.VMetrics))
+			ttf.tableInfo(tagVhea).Table = vhea
+		}
+	}
+
+	var loca *LocaTable
+	for _, table := range ttf.Tables {
+		if glyf, ok := table.Table.(GlyfTable); ok && changed(table) {
+			data, offsets := glyf.encode()
+			tables["glyf"] = data
+			loca = &LocaTable{Offsets: offsets}
+			head.IndexToLocFormat = loca.format()
+		}
+	}
+
+	for i, table := range ttf.Tables {
+		tag := PrintTagName(table.Tag)
+		switch {
+		case Tag(table.Tag) == tagHead:
+			// encoded last
+			continue
+		case Tag(table.Tag) == tagGlyf && loca != nil:
+			// encoded above
+			continue
+		case Tag(table.Tag) == tagLoca && loca != nil:
+			// follows the re-encoded glyf table
+			tables[tag] = loca.encode(head.IndexToLocFormat)
+			ttf.Tables[i].Table = *loca
+			continue
+		case !changed(table):
+			if table.Data == nil {
+				return nil, errors.New("table " + tag + " has no data")
+			}
+			tables[tag] = table.Data
+			continue
+		}
+		switch t := table.Table.(type) {
+		case LocaTable:
+			tables[tag] = t.encode(head.IndexToLocFormat)
+		case tableEncoder:
+			data, err := t.encode()
+			if err != nil {
+				return nil, err
+			}
+			tables[tag] = data
+		default:
+			return nil, errors.New("table " + tag + " cannot be serialized")
+		}
+	}
+
+	for i, table := range ttf.Tables {
+		if Tag(table.Tag) == tagHead {
+			ttf.Tables[i].Table, table.Table = head, head
+			if !changed(table) {
+				tables["head"] = table.Data
+				continue
+			}
+			data, err := head.encode()
+			if err != nil {
+				return nil, err
+			}
+			tables["head"] = data
+		}
+	}
+	return tables, nil
+}
+
+// encode serializes the head table with a zero checkSumAdjustment.
+func (head HeadTable) encode() ([]byte, error) {
+	buf := make([]byte, 0, 54)
+	buf = binary.BigEndian.AppendUint32(buf, head.Version)
+	buf = binary.BigEndian.AppendUint32(buf, head.FontRevision)
+	buf = binary.BigEndian.AppendUint32(buf, 0)
+	buf = binary.BigEndian.AppendUint32(buf, head.MagicNumber)
+	buf = binary.BigEndian.AppendUint16(buf, head.Flags)
+	buf = binary.BigEndian.AppendUint16(buf, head.UnitPerEm)
+	buf = binary.BigEndian.AppendUint64(buf, head.Created)
+	buf = binary.BigEndian.AppendUint64(buf, head.Modified)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(head.XMin))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(head.YMin))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(head.XMax))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(head.YMax))
+	buf = binary.BigEndian.AppendUint16(buf, head.MacStyle)
+	buf = binary.BigEndian.AppendUint16(buf, head.LowestRecPPEM)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(head.FontDirectionHint))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(head.IndexToLocFormat))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(head.GlyphDataFormat))
+	return buf, nil
+}
+
+// encode serializes the cmap table. Encoding records that share identical
+// subtable data also share its offset.
+func (cmap CmapTable) encode() ([]byte, error) {
+	buf := binary.BigEndian.AppendUint16(nil, cmap.Version)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(cmap.EncodingSubtables)))
+	subtables := make([]byte, 0)
+	offsets := make(map[string]uint32)
+	base := uint32(4 + 8*len(cmap.EncodingSubtables))
+	for i := range cmap.EncodingSubtables {
+		sub := cmap.EncodingSubtables[i]
+		data, err := sub.encode()
+		if err != nil {
+			return nil, err
+		}
+		offset, ok := offsets[string(data)]
+		if !ok {
+			offset = base + uint32(len(subtables))
+			offsets[string(data)] = offset
+			subtables = append(subtables, data...)
+		}
+		buf = binary.BigEndian.AppendUint16(buf, sub.PlatformID)
+		buf = binary.BigEndian.AppendUint16(buf, sub.EncodingID)
+		buf = binary.BigEndian.AppendUint32(buf, offset)
+	}
+	return append(buf, subtables...), nil
+}
+
+// encode serializes one cmap subtable. Formats 4, 6, 8, 10, 12 and 13 are
+// rebuilt from their decoded fields; formats 0 and 2 are written from
+// GlyphIndexArray, which holds everything after the subtable header.
+func (sub CmapSubTable) encode() ([]byte, error) {
+	var body []byte
+	switch sub.Format {
+	case 0, 2:
+		body = sub.GlyphIndexArray
+	case 4:
+		segCountX2 := 2 * len(sub.EndCode)
+		if len(sub.StartCode) != len(sub.EndCode) || len(sub.IdDelta) != len(sub.EndCode) || len(sub.IdRangeOffset) != len(sub.EndCode) {
+			return nil, errors.New("cmap format 4 subtable has segment arrays of different lengths")
+		}
+		// the glyphIdArray is found in GlyphIndexArray through SegCountX2
+		if int(sub.SegCountX2) != segCountX2 {
+			return nil, fmt.Errorf("cmap format 4 subtable has %d segments but a segCountX2 of %d", len(sub.EndCode), sub.SegCountX2)
+		}
+		searchRange, entrySelector := 2, 0
+		for 2*searchRange <= segCountX2 {
+			searchRange *= 2
+			entrySelector++
+		}
+		body = binary.BigEndian.AppendUint16(body, uint16(segCountX2))
+		body = binary.BigEndian.AppendUint16(body, uint16(searchRange))
+		body = binary.BigEndian.AppendUint16(body, uint16(entrySelector))
+		body = binary.BigEndian.AppendUint16(body, uint16(segCountX2-searchRange))
+		for _, v := range sub.EndCode {
+			body = binary.BigEndian.AppendUint16(body, v)
+		}
+		body = binary.BigEndian.AppendUint16(body, sub.ReservedPad)
+		for _, list := range [][]uint16{sub.StartCode, sub.IdDelta, sub.IdRangeOffset} {
+			for _, v := range list {
+				body = binary.BigEndian.AppendUint16(body, v)
+			}
+		}
+		// glyphIdArray follows the segment arrays as they were read
+		if arrays := 10 + 4*segCountX2; len(sub.GlyphIndexArray) > arrays {
+			body = append(body, sub.GlyphIndexArray[arrays:]...)
+		}
+	case 6:
+		body = binary.BigEndian.AppendUint16(body, sub.FirstCode)
+		body = binary.BigEndian.AppendUint16(body, sub.EntryCount)
+		if len(sub.GlyphIndexArray) > 4 {
+			body = append(body, sub.GlyphIndexArray[4:]...)
+		}
+	case 8:
+		if len(sub.Is32) != 8192 {
+			return nil, errors.New("cmap format 8 subtable needs an 8192 byte is32 array")
+		}
+		body = append(body, sub.Is32...)
+		body = appendCmapGroups(body, sub.Groups)
+	case 10:
+		body = binary.BigEndian.AppendUint32(body, sub.StartCharCode)
+		body = binary.BigEndian.AppendUint32(body, uint32(len(sub.GlyphIndexArray16)))
+		for _, gid := range sub.GlyphIndexArray16 {
+			body = binary.BigEndian.AppendUint16(body, gid)
+		}
+	case 12, 13:
+		body = appendCmapGroups(body, sub.Groups)
+	case 14:
+		return sub.encodeVariations(), nil
+	default:
+		return nil, fmt.Errorf("cmap subtable format %d cannot be serialized", sub.Format)
+	}
+	switch sub.Format {
+	case 8, 10, 12, 13:
+		buf := binary.BigEndian.AppendUint16(nil, sub.Format)
+		buf = binary.BigEndian.AppendUint16(buf, 0)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(12+len(body)))
+		buf = binary.BigEndian.AppendUint32(buf, sub.Language)
+		return append(buf, body...), nil
+	}
+	if 6+len(body) > 0xFFFF {
+		return nil, errors.New("cmap subtable is too large")
+	}
+	buf := binary.BigEndian.AppendUint16(nil, sub.Format)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(6+len(body)))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(sub.Language))
+	return append(buf, body...), nil
+}
+
+// encodeVariations serializes a format 14 subtable. Each UVS table follows
+// the selector records in record order; empty ones get a zero offset.
+func (sub CmapSubTable) encodeVariations() []byte {
+	appendUint24 := func(b []byte, v uint32) []byte { return append(b, byte(v>>16), byte(v>>8), byte(v)) }
+	records := make([]byte, 0, 11*len(sub.VarSelectors))
+	var tables []byte
+	base := 10 + 11*len(sub.VarSelectors)
+	for _, selector := range sub.VarSelectors {
+		records = appendUint24(records, selector.VarSelector)
+		if len(selector.DefaultUVS) == 0 {
+			records = binary.BigEndian.AppendUint32(records, 0)
+		} else {
+			records = binary.BigEndian.AppendUint32(records, uint32(base+len(tables)))
+			tables = binary.BigEndian.AppendUint32(tables, uint32(len(selector.DefaultUVS)))
+			for _, rng := range selector.DefaultUVS {
+				tables = append(appendUint24(tables, rng.StartUnicodeValue), rng.AdditionalCount)
+			}
+		}
+		if len(selector.NonDefaultUVS) == 0 {
+			records = binary.BigEndian.AppendUint32(records, 0)
+		} else {
+			records = binary.BigEndian.AppendUint32(records, uint32(base+len(tables)))
+			tables = binary.BigEndian.AppendUint32(tables, uint32(len(selector.NonDefaultUVS)))
+			for _, mapping := range selector.NonDefaultUVS {
+				tables = binary.BigEndian.AppendUint16(appendUint24(tables, mapping.UnicodeValue), mapping.GlyphID)
+			}
+		}
+	}
+	buf := binary.BigEndian.AppendUint16(nil, 14)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(base+len(tables)))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(sub.VarSelectors)))
+	buf = append(buf, records...)
+	return append(buf, tables...)
+}
+
+// appendCmapGroups appends the group count and the map groups of a format
+// 8, 12 or 13 subtable.
+func appendCmapGroups(buf []byte, groups []CmapSubTableFormatMixGroup) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(groups)))
+	for _, group := range groups {
+		buf = binary.BigEndian.AppendUint32(buf, group.StartCharCode)
+		buf = binary.BigEndian.AppendUint32(buf, group.EndCharCode)
+		buf = binary.BigEndian.AppendUint32(buf, group.StartGlyphCode)
+	}
+	return buf
+}
+
+// tableChecksum sums data as big-endian uint32 values, zero padded.
+func tableChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+// buildSFNT lays out tables behind an offset table and table directory,
+// computing table checksums and the head checkSumAdjustment. The directory
+// is sorted by tag; table data follows order, then the tags missing from
+// order in tag order.
+func buildSFNT(scalerType uint32, tables map[string][]byte, order []string) []byte {
+	tags := make([]string, 0, len(tables))
+	size := 12 + 16*len(tables)
+	for tag, data := range tables {
+		tags = append(tags, tag)
+		size += (len(data) + 3) &^ 3
+	}
+	sort.Strings(tags)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= len(tags) {
+		entrySelector++
+	}
+	searchRange := 16 << entrySelector
+
+	out := make([]byte, 12+16*len(tags), size)
+	binary.BigEndian.PutUint32(out, scalerType)
+	binary.BigEndian.PutUint16(out[4:], uint16(len(tags)))
+	binary.BigEndian.PutUint16(out[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(out[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(out[10:], uint16(16*len(tags)-searchRange))
+	records := make(map[string][]byte, len(tags))
+	for i, tag := range tags {
+		records[tag] = out[12+16*i : 12+16*i+16]
+	}
+	headOffset := -1
+	for _, tag := range append(order, tags...) {
+		rec, ok := records[tag]
+		if !ok {
+			// not a table, or laid out already
+			continue
+		}
+		delete(records, tag)
+		data := tables[tag]
+		if tag == "head" {
+			headOffset = len(out)
+		}
+		copy(rec, tag)
+		binary.BigEndian.PutUint32(rec[8:], uint32(len(out)))
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(data)))
+		out = append(out, data...)
+		if tag == "head" && len(data) >= 12 {
+			binary.BigEndian.PutUint32(out[headOffset+8:], 0)
+		}
+		binary.BigEndian.PutUint32(rec[4:], tableChecksum(out[len(out)-len(data):]))
+		out = append(out, make([]byte, (4-len(data)%4)%4)...)
+	}
+	if headOffset >= 0 && len(tables["head"]) >= 12 {
+		binary.BigEndian.PutUint32(out[headOffset+8:], 0xB1B0AFBA-tableChecksum(out))
+	}
+	return out
+}
@@ -0,0 +1,167 @@
+package fontcompress_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	font_compress "github.com/RustynailPlease/fontcompress"
+)
+
+func TestWriteTo(t *testing.T) {
+	ttf, err := font_compress.NewTTF(writeFont(t, fixtureFont()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	n, err := ttf.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.Bytes()
+	if n != int64(len(out)) {
+		t.Errorf("WriteTo returned %d, wrote %d bytes", n, len(out))
+	}
+	if ttf.NumTables != 8 || ttf.SearchRange != 128 || ttf.EntrySelector != 3 || ttf.RangeShift != 0 {
+		t.Errorf("offset table = %d %d %d %d, want 8 128 3 0", ttf.NumTables, ttf.SearchRange, ttf.EntrySelector, ttf.RangeShift)
+	}
+
+	if len(out)%4 != 0 {
+		t.Errorf("font length %d is not a multiple of 4", len(out))
+	}
+	var sum uint32
+	for i := 0; i+4 <= len(out); i += 4 {
+		sum += binary.BigEndian.Uint32(out[i:])
+	}
+	if sum != 0xB1B0AFBA {
+		t.Errorf("font checksum = %#x, want 0xb1b0afba", sum)
+	}
+	for _, table := range ttf.Tables {
+		if table.Offset%4 != 0 {
+			t.Errorf("table %s is not 4-byte aligned", font_compress.PrintTagName(table.Tag))
+		}
+		data := out[table.Offset : table.Offset+table.Length]
+		var sum uint32
+		for i := 0; i < len(data); i += 4 {
+			var word [4]byte
+			copy(word[:], data[i:])
+			sum += binary.BigEndian.Uint32(word[:])
+		}
+		switch table := table.Table.(type) {
+		case font_compress.HeadTable:
+			sum -= table.CheckSumAdjustment
+			if binary.BigEndian.Uint32(data[8:]) != table.CheckSumAdjustment {
+				t.Errorf("head.CheckSumAdjustment = %#x, written %#x", table.CheckSumAdjustment, binary.BigEndian.Uint32(data[8:]))
+			}
+		}
+		if sum != table.CheckSum {
+			t.Errorf("table %s checksum = %#x, want %#x", font_compress.PrintTagName(table.Tag), table.CheckSum, sum)
+		}
+	}
+
+	reread, err := font_compress.NewTTF(writeFont(t, out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reread.Tables) != len(ttf.Tables) {
+		t.Fatalf("re-read %d tables, want %d", len(reread.Tables), len(ttf.Tables))
+	}
+	for _, table := range ttf.Tables {
+		switch want := table.Table.(type) {
+		case font_compress.GlyfTable:
+			for gid, g := range glyfTable(t, reread).Glyphs {
+				w := want.Glyphs[gid]
+				if g.XMin != w.XMin || g.YMax != w.YMax || len(g.Points) != len(w.Points) || len(g.Components) != len(w.Components) {
+					t.Errorf("glyph %d = %+v, want %+v", gid, g, w)
+					continue
+				}
+				for j := range g.Points {
+					if g.Points[j] != w.Points[j] {
+						t.Errorf("glyph %d point %d = %v, want %v", gid, j, g.Points[j], w.Points[j])
+					}
+				}
+			}
+		case font_compress.CmapTable:
+			got, wantSub := cmapTable(t, reread).EncodingSubtables[0], want.EncodingSubtables[0]
+			if !equalUint16s(got.EndCode, wantSub.EndCode) || !equalUint16s(got.StartCode, wantSub.StartCode) || !equalUint16s(got.IdDelta, wantSub.IdDelta) {
+				t.Errorf("cmap subtable = %+v, want %+v", got, wantSub)
+			}
+		case font_compress.HeadTable:
+			if head, err := reread.Head(); err != nil || head != want {
+				t.Errorf("head = %+v, want %+v (%v)", head, want, err)
+			}
+		}
+	}
+}
+
+func equalUint16s(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRoundTrip(t *testing.T) {
+	tables := fixtureTables()
+	tables["DSIG"] = []byte{0, 0, 0, 1, 0, 0, 0, 0}
+	tables["kern"] = []byte{0, 0, 0, 0, 0x2A} // padded when written
+	order := []string{"head", "hhea", "maxp", "hmtx", "cmap", "loca", "glyf", "post", "kern", "DSIG"}
+	want, err := readFont(t, assembleFontInOrder(font_compress.TTF_MAGIC, tables, order)).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// table data keeps its order and bytes, but for head.checkSumAdjustment
+	ttf := readFont(t, want)
+	for i, tag := range order {
+		if i > 0 && tableOffset(want, tag) < tableOffset(want, order[i-1]) {
+			t.Errorf("table %s is written before %s", tag, order[i-1])
+		}
+		data := fontTable(want, tag)
+		if tag == "head" {
+			data = patchUint32(data, 8, binary.BigEndian.Uint32(tables["head"][8:]))
+		}
+		if !bytes.Equal(data, tables[tag]) {
+			t.Errorf("table %s = %x, want %x", tag, data, tables[tag])
+		}
+	}
+
+	// unchanged fonts are written as they were read, decoded or not
+	if got, err := ttf.Bytes(); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Bytes of an unchanged font differs from its data (%v)", err)
+	}
+	for _, table := range ttf.Tables {
+		if _, err := ttf.Table(font_compress.PrintTagName(table.Tag)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := ttf.Bytes(); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("Bytes of a decoded, unchanged font differs from its data (%v)", err)
+	}
+
+	// changed tables are encoded, the others still copied
+	glyf, err := ttf.Glyf()
+	if err != nil {
+		t.Fatal(err)
+	}
+	glyf.Glyphs[1].XMin--
+	got, err := ttf.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(got, want) {
+		t.Error("Bytes of a changed font is unchanged")
+	}
+	for _, tag := range []string{"kern", "DSIG", "hmtx", "cmap"} {
+		if !bytes.Equal(fontTable(got, tag), fontTable(want, tag)) {
+			t.Errorf("unchanged table %s was rewritten", tag)
+		}
+	}
+	if xMin := glyfTable(t, readFont(t, got)).Glyphs[1].XMin; xMin != glyf.Glyphs[1].XMin {
+		t.Errorf("glyph 1 XMin = %d, want %d", xMin, glyf.Glyphs[1].XMin)
+	}
+}